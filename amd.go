@@ -0,0 +1,309 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+type AMDStatus string
+
+const (
+	AMDHuman   AMDStatus = "HUMAN"
+	AMDMachine AMDStatus = "MACHINE"
+	AMDNotSure AMDStatus = "NOTSURE"
+
+	// Reasons of AMD decision
+	AMDReasonInitialSilence = "INITIALSILENCE"
+	AMDReasonLongGreeting   = "LONGGREETING"
+	AMDReasonMaxWords       = "MAXWORDS"
+	AMDReasonBeep           = "BEEP"
+	AMDReasonHuman          = "HUMAN"
+	AMDReasonTooLong        = "TOOLONG"
+)
+
+var (
+	// AMDBeepMinDuration is minimum duration of stable tone to be detected as beep
+	AMDBeepMinDuration = 120 * time.Millisecond
+
+	amdInitialNoiseFloor = -55.0
+)
+
+// AMDOptions are thresholds of answering machine detection. Zero values are defaults
+type AMDOptions struct {
+	// InitialSilence is max silence before greeting. Default 2500ms
+	InitialSilence time.Duration
+	// Greeting is max length of human greeting. Default 1500ms
+	Greeting time.Duration
+	// AfterGreetingSilence is silence after greeting that means human waits for answer. Default 800ms
+	AfterGreetingSilence time.Duration
+	// TotalAnalysisTime bounds analysis. Default 5000ms
+	TotalAnalysisTime time.Duration
+	// MinWordLength is min voice duration to count word. Default 100ms
+	MinWordLength time.Duration
+	// BetweenWordsSilence is min silence that separates words. Default 50ms
+	BetweenWordsSilence time.Duration
+	// MaxWords is number of words in greeting after which it is machine. Default 3
+	MaxWords int
+
+	// WaitForBeep continues analysis after MACHINE until beep is detected or BeepTimeout passes.
+	// Message can be left after AMD returns
+	WaitForBeep bool
+	// BeepTimeout is max waiting for beep. Default 10s
+	BeepTimeout time.Duration
+}
+
+func (o *AMDOptions) defaults() {
+	if o.InitialSilence == 0 {
+		o.InitialSilence = 2500 * time.Millisecond
+	}
+	if o.Greeting == 0 {
+		o.Greeting = 1500 * time.Millisecond
+	}
+	if o.AfterGreetingSilence == 0 {
+		o.AfterGreetingSilence = 800 * time.Millisecond
+	}
+	if o.TotalAnalysisTime == 0 {
+		o.TotalAnalysisTime = 5000 * time.Millisecond
+	}
+	if o.MinWordLength == 0 {
+		o.MinWordLength = 100 * time.Millisecond
+	}
+	if o.BetweenWordsSilence == 0 {
+		o.BetweenWordsSilence = 50 * time.Millisecond
+	}
+	if o.MaxWords == 0 {
+		o.MaxWords = 3
+	}
+	if o.BeepTimeout == 0 {
+		o.BeepTimeout = 10 * time.Second
+	}
+}
+
+// AMDResult is result of answering machine detection
+type AMDResult struct {
+	Status AMDStatus
+	// Reason is one of AMDReason constants
+	Reason string
+	// Beep is true if beep was detected
+	Beep bool
+	// Words counted in greeting
+	Words int
+	// Duration of analyzed audio
+	Duration time.Duration
+}
+
+// AMD runs answering machine detection on initial audio after call is answered.
+// It reads audio until decision is made, so no other audio reading should be running.
+// It returns at latest after TotalAnalysisTime, or if WaitForBeep, additional BeepTimeout.
+//
+// Experimental
+func (d *DialogClientSession) AMD(pctx context.Context, opts AMDOptions) (AMDResult, error) {
+	opts.defaults()
+	maxDur := opts.TotalAnalysisTime
+	if opts.WaitForBeep {
+		maxDur += opts.BeepTimeout
+	}
+
+	var res AMDResult
+	err := d.readAudioBounded(pctx, maxDur, func(reader io.Reader, codec media.Codec) (err error) {
+		res, err = amdRun(reader, codec, opts)
+		return err
+	})
+	return res, err
+}
+
+// amdRun decodes audio and analyzes until decision. Reading timeout or EOF is NOTSURE
+func amdRun(reader io.Reader, codec media.Codec, opts AMDOptions) (AMDResult, error) {
+	a := amdAnalyzer{}
+	a.init(opts, int(codec.SampleRate))
+	done, err := readPCMFrames(reader, codec, a.process)
+	if err != nil {
+		return a.result, err
+	}
+	if !done {
+		return a.timeout(), nil
+	}
+	return a.result, nil
+}
+
+// amdAnalyzer decides on speech and silence timing of greeting
+type amdAnalyzer struct {
+	opts       AMDOptions
+	sampleRate int
+	vad        audio.VAD
+	beep       amdBeepDetector
+
+	silenceDur    time.Duration
+	voiceDur      time.Duration
+	consecutive   time.Duration
+	inGreeting    bool
+	inSilence     bool
+	decided       bool
+	decidedAt     time.Duration
+	result        AMDResult
+	initialSilent bool
+}
+
+func (a *amdAnalyzer) init(opts AMDOptions, sampleRate int) {
+	opts.defaults()
+	a.opts = opts
+	a.sampleRate = sampleRate
+	// Greeting can start immediately so noise floor can not be taken from first frame
+	a.vad = audio.VAD{SampleRate: sampleRate, InitialNoiseFloor: amdInitialNoiseFloor}
+	a.vad.Init()
+	a.beep = amdBeepDetector{sampleRate: sampleRate}
+	a.inSilence = true
+	a.initialSilent = true
+}
+
+// process analyzes single frame and returns true when analysis is done
+func (a *amdAnalyzer) process(lpcm []byte) bool {
+	dur := time.Duration(len(lpcm)/2) * time.Second / time.Duration(a.sampleRate)
+	a.result.Duration += dur
+
+	if a.beep.process(lpcm, dur) {
+		a.result.Status = AMDMachine
+		a.result.Reason = AMDReasonBeep
+		a.result.Beep = true
+		return true
+	}
+
+	if a.decided {
+		// Waiting for beep
+		return a.result.Duration-a.decidedAt >= a.opts.BeepTimeout
+	}
+
+	f := a.vad.Process(lpcm)
+	if !f.Speech {
+		a.silenceDur += dur
+		a.consecutive = 0
+		if a.silenceDur >= a.opts.BetweenWordsSilence {
+			a.inSilence = true
+		}
+
+		if a.initialSilent && a.silenceDur >= a.opts.InitialSilence {
+			return a.decide(AMDMachine, AMDReasonInitialSilence)
+		}
+		if !a.initialSilent && a.silenceDur >= a.opts.AfterGreetingSilence {
+			return a.decide(AMDHuman, AMDReasonHuman)
+		}
+	} else {
+		a.consecutive += dur
+		a.voiceDur += dur
+		a.silenceDur = 0
+
+		if a.consecutive >= a.opts.MinWordLength && a.inSilence {
+			a.result.Words++
+			a.inSilence = false
+			a.initialSilent = false
+		}
+		if a.result.Words >= a.opts.MaxWords {
+			return a.decide(AMDMachine, AMDReasonMaxWords)
+		}
+		if a.inGreeting && a.voiceDur >= a.opts.Greeting {
+			return a.decide(AMDMachine, AMDReasonLongGreeting)
+		}
+		if !a.inGreeting && a.voiceDur >= a.opts.MinWordLength {
+			a.inGreeting = true
+		}
+	}
+
+	if a.result.Duration >= a.opts.TotalAnalysisTime {
+		return a.decide(AMDNotSure, AMDReasonTooLong)
+	}
+	return false
+}
+
+func (a *amdAnalyzer) decide(status AMDStatus, reason string) bool {
+	a.result.Status = status
+	a.result.Reason = reason
+	if status == AMDMachine && a.opts.WaitForBeep {
+		a.decided = true
+		a.decidedAt = a.result.Duration
+		return false
+	}
+	return true
+}
+
+// timeout returns result when audio stopped before decision
+func (a *amdAnalyzer) timeout() AMDResult {
+	if a.decided {
+		return a.result
+	}
+	res := a.result
+	res.Status = AMDNotSure
+	res.Reason = AMDReasonTooLong
+	return res
+}
+
+// amdBeepDetector detects stable pure tone between 400Hz and 2500Hz.
+// Frequency is estimated from zero crossings and tone is confirmed with autocorrelation on its period
+type amdBeepDetector struct {
+	sampleRate int
+	lastFreq   float64
+	toneDur    time.Duration
+	samples    []float64
+}
+
+func (b *amdBeepDetector) process(lpcm []byte, dur time.Duration) bool {
+	freq, ok := b.tone(lpcm)
+	if !ok || math.Abs(freq-b.lastFreq) > b.lastFreq*0.1 {
+		b.toneDur = 0
+	}
+	b.lastFreq = freq
+	if !ok {
+		return false
+	}
+	b.toneDur += dur
+	return b.toneDur >= AMDBeepMinDuration
+}
+
+func (b *amdBeepDetector) tone(lpcm []byte) (float64, bool) {
+	n := len(lpcm) / 2
+	if n < 40 {
+		return 0, false
+	}
+	if cap(b.samples) < n {
+		b.samples = make([]float64, n)
+	}
+	samples := b.samples[:n]
+	energy := 0.0
+	crossings := 0
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(lpcm[i*2:])))
+		energy += samples[i] * samples[i]
+		if i > 0 && (samples[i] >= 0) != (samples[i-1] >= 0) {
+			crossings++
+		}
+	}
+	// Ignore quiet frames below -40dBov
+	if math.Sqrt(energy/float64(n)) < math.MaxInt16/100 {
+		return 0, false
+	}
+
+	freq := float64(crossings) / float64(n) * float64(b.sampleRate) / 2
+	if freq < 400 || freq > 2500 {
+		return 0, false
+	}
+
+	period := int(math.Round(float64(b.sampleRate) / freq))
+	corr, e1, e2 := 0.0, 0.0, 0.0
+	for i := period; i < n; i++ {
+		corr += samples[i] * samples[i-period]
+		e1 += samples[i] * samples[i]
+		e2 += samples[i-period] * samples[i-period]
+	}
+	if corr/math.Sqrt(e1*e2) < 0.9 {
+		return 0, false
+	}
+	return freq, true
+}
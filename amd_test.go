@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+// testAMDAudio builds 8kHz PCM from parts. Positive freq is tone and zero is quiet noise
+func testAMDAudio(parts ...any) []byte {
+	var lpcm []byte
+	offset := 0
+	for i := 0; i < len(parts); i += 2 {
+		freq := parts[i].(float64)
+		n := int(parts[i+1].(time.Duration).Seconds() * 8000)
+		for j := 0; j < n; j++ {
+			s := int16(rand.Intn(61) - 30)
+			if freq > 0 {
+				s = int16(8000 * math.Sin(2*math.Pi*freq*float64(offset+j)/8000))
+			}
+			lpcm = binary.LittleEndian.AppendUint16(lpcm, uint16(s))
+		}
+		offset += n
+	}
+	return lpcm
+}
+
+func testAMDAnalyze(opts AMDOptions, lpcm []byte) AMDResult {
+	a := amdAnalyzer{}
+	a.init(opts, 8000)
+	for i := 0; i+320 <= len(lpcm); i += 320 {
+		if a.process(lpcm[i : i+320]) {
+			return a.result
+		}
+	}
+	return a.timeout()
+}
+
+func TestAMDAnalyzer(t *testing.T) {
+	const voice, silence = 200.0, 0.0
+	ms := time.Millisecond
+
+	t.Run("Human", func(t *testing.T) {
+		res := testAMDAnalyze(AMDOptions{}, testAMDAudio(silence, 300*ms, voice, 500*ms, silence, 2000*ms))
+		assert.Equal(t, AMDHuman, res.Status)
+		assert.Equal(t, AMDReasonHuman, res.Reason)
+		assert.Equal(t, 1, res.Words)
+		assert.Equal(t, 1600*ms, res.Duration)
+	})
+
+	t.Run("LongGreeting", func(t *testing.T) {
+		res := testAMDAnalyze(AMDOptions{}, testAMDAudio(voice, 3000*ms))
+		assert.Equal(t, AMDMachine, res.Status)
+		assert.Equal(t, AMDReasonLongGreeting, res.Reason)
+	})
+
+	t.Run("MaxWords", func(t *testing.T) {
+		res := testAMDAnalyze(AMDOptions{}, testAMDAudio(
+			voice, 300*ms, silence, 200*ms, voice, 300*ms, silence, 200*ms, voice, 300*ms, silence, 2000*ms,
+		))
+		assert.Equal(t, AMDMachine, res.Status)
+		assert.Equal(t, AMDReasonMaxWords, res.Reason)
+		assert.Equal(t, 3, res.Words)
+	})
+
+	t.Run("InitialSilence", func(t *testing.T) {
+		res := testAMDAnalyze(AMDOptions{}, testAMDAudio(silence, 3000*ms))
+		assert.Equal(t, AMDMachine, res.Status)
+		assert.Equal(t, AMDReasonInitialSilence, res.Reason)
+		assert.Equal(t, 2500*ms, res.Duration)
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		res := testAMDAnalyze(AMDOptions{TotalAnalysisTime: time.Second}, testAMDAudio(silence, 2000*ms))
+		assert.Equal(t, AMDNotSure, res.Status)
+		assert.Equal(t, AMDReasonTooLong, res.Reason)
+		assert.Equal(t, time.Second, res.Duration)
+	})
+
+	t.Run("WaitForBeep", func(t *testing.T) {
+		lpcm := testAMDAudio(voice, 2000*ms, silence, 500*ms, 1000.0, 300*ms, silence, 1000*ms)
+		res := testAMDAnalyze(AMDOptions{WaitForBeep: true}, lpcm)
+		assert.Equal(t, AMDMachine, res.Status)
+		assert.Equal(t, AMDReasonBeep, res.Reason)
+		assert.True(t, res.Beep)
+		assert.Less(t, res.Duration, 2700*ms)
+
+		// Without beep machine is returned after timeout
+		lpcm = testAMDAudio(voice, 2000*ms, silence, 2000*ms)
+		res = testAMDAnalyze(AMDOptions{WaitForBeep: true, BeepTimeout: time.Second}, lpcm)
+		assert.Equal(t, AMDMachine, res.Status)
+		assert.Equal(t, AMDReasonLongGreeting, res.Reason)
+		assert.False(t, res.Beep)
+		assert.Equal(t, 2500*ms, res.Duration)
+	})
+}
+
+func TestAMDRun(t *testing.T) {
+	lpcm := testAMDAudio(200.0, 500*time.Millisecond, 0.0, 1000*time.Millisecond)
+	encoded := make([]byte, len(lpcm)/2)
+	n, err := audio.EncodeAlawTo(encoded, lpcm)
+	require.NoError(t, err)
+
+	res, err := amdRun(&packetReader{data: encoded[:n], frameSize: 160}, media.CodecAudioAlaw, AMDOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, AMDHuman, res.Status)
+
+	// Audio ends before decision
+	res, err = amdRun(&packetReader{data: encoded[:1600], frameSize: 160}, media.CodecAudioAlaw, AMDOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, AMDNotSure, res.Status)
+}
+
+func TestAMDNoMedia(t *testing.T) {
+	d := &DialogClientSession{}
+	_, err := d.AMD(context.Background(), AMDOptions{})
+	require.ErrorIs(t, err, errNoRTPSession)
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	AuEncodingULaw  = 1
+	AuEncodingPCM8  = 2
+	AuEncodingPCM16 = 3
+	AuEncodingALaw  = 27
+)
+
+// AuReader reads Sun/NeXT .au headers and data
+type AuReader struct {
+	Encoding    uint32
+	SampleRate  uint32
+	NumChannels uint32
+	// DataSize is -1 when unknown
+	DataSize int
+
+	r        io.Reader
+	dataLeft int64
+}
+
+func NewAuReader(r io.Reader) *AuReader {
+	return &AuReader{r: r}
+}
+
+// ReadHeaders reads header and annotation until data
+func (r *AuReader) ReadHeaders() error {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		return err
+	}
+	if string(hdr[0:4]) != ".snd" {
+		return fmt.Errorf("not an au file")
+	}
+
+	be := binary.BigEndian
+	offset := be.Uint32(hdr[4:])
+	size := be.Uint32(hdr[8:])
+	r.Encoding = be.Uint32(hdr[12:])
+	r.SampleRate = be.Uint32(hdr[16:])
+	r.NumChannels = be.Uint32(hdr[20:])
+
+	if offset < 24 {
+		return fmt.Errorf("au data offset=%d too small", offset)
+	}
+	if _, err := io.CopyN(io.Discard, r.r, int64(offset-24)); err != nil {
+		return err
+	}
+
+	r.DataSize = int(size)
+	r.dataLeft = int64(size)
+	if size == 0xFFFFFFFF {
+		r.DataSize = -1
+		r.dataLeft = -1
+	}
+	return nil
+}
+
+// Read returns audio data underneath. Use PCMReader to read data as 16 bit PCM
+func (r *AuReader) Read(buf []byte) (int, error) {
+	switch {
+	case r.dataLeft == 0:
+		return 0, io.EOF
+	case r.dataLeft > 0 && int64(len(buf)) > r.dataLeft:
+		buf = buf[:r.dataLeft]
+	}
+
+	n, err := r.r.Read(buf)
+	if r.dataLeft > 0 {
+		r.dataLeft -= int64(n)
+	}
+	return n, err
+}
+
+// AudioFormat returns encoding as wav format and bitdepth
+func (r *AuReader) AudioFormat() (format uint16, bitsPerSample int, err error) {
+	switch r.Encoding {
+	case AuEncodingULaw:
+		return WavAudioFormatULaw, 8, nil
+	case AuEncodingALaw:
+		return WavAudioFormatALaw, 8, nil
+	case AuEncodingPCM8:
+		return WavAudioFormatPCM, 8, nil
+	case AuEncodingPCM16:
+		return WavAudioFormatPCM, 16, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported au encoding=%d", r.Encoding)
+}
+
+// PCMReader returns reader of data converted to 16 bit little endian PCM. Headers must be read before
+func (r *AuReader) PCMReader() (io.Reader, error) {
+	switch r.Encoding {
+	case AuEncodingPCM8:
+		// AU linear PCM is signed and big endian
+		return &decodeReader{Source: r, DecodeTo: decodePCM8SignedTo}, nil
+	case AuEncodingPCM16:
+		return &decodeReader{Source: r, Swap16: true}, nil
+	}
+	format, bits, err := r.AudioFormat()
+	if err != nil {
+		return nil, err
+	}
+	return NewPCM16Reader(format, bits, r)
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+
+	"github.com/vertan/diago/media"
+)
+
+// ComfortNoise generates comfort noise from RFC 3389 parameters as 16 bit mono PCM.
+// White noise is generated at received level and shaped with reflection coefficients if present
+type ComfortNoise struct {
+	// rms is target noise level
+	rms float64
+	// gain normalizes excitation so that filter output keeps level
+	gain  float64
+	k     []float64
+	state []float64
+	rand  *rand.Rand
+}
+
+func NewComfortNoise() *ComfortNoise {
+	c := &ComfortNoise{}
+	c.Init()
+	return c
+}
+
+func (c *ComfortNoise) Init() {
+	c.rand = rand.New(rand.NewSource(rand.Int63()))
+	c.Update(media.CNPayload{Level: 127})
+}
+
+// Update sets noise parameters from received comfort noise
+func (c *ComfortNoise) Update(cn media.CNPayload) {
+	c.rms = math.MaxInt16 * math.Pow(10, -float64(cn.Level&0x7F)/20)
+
+	c.k = c.k[:0]
+	c.gain = 1
+	for _, q := range cn.Coefficients {
+		// Quantized linearly with 127 as zero
+		k := (float64(q) - 127) / 128
+		c.k = append(c.k, k)
+		c.gain *= 1 - k*k
+	}
+	c.gain = math.Sqrt(c.gain)
+	if len(c.state) != len(c.k)+1 {
+		c.state = make([]float64, len(c.k)+1)
+	}
+}
+
+// GenerateTo fills whole lpcm with noise
+func (c *ComfortNoise) GenerateTo(lpcm []byte) (int, error) {
+	// Uniform noise has rms 1/sqrt(3)
+	amp := math.Sqrt(3) * c.rms * c.gain
+	n := len(lpcm) / 2
+	for i := 0; i < n; i++ {
+		f := (c.rand.Float64()*2 - 1) * amp
+		// All pole lattice filter
+		for j := len(c.k) - 1; j >= 0; j-- {
+			f -= c.k[j] * c.state[j]
+			c.state[j+1] = c.state[j] + c.k[j]*f
+		}
+		c.state[0] = f
+		binary.LittleEndian.PutUint16(lpcm[i*2:], uint16(clampInt16(f)))
+	}
+	return n * 2, nil
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media"
+	"github.com/zaf/g711"
+)
+
+func TestComfortNoiseLevel(t *testing.T) {
+	noise := NewComfortNoise()
+	for _, cn := range []media.CNPayload{
+		{Level: 40},
+		{Level: 40, Coefficients: []uint8{200, 60, 150}},
+	} {
+		noise.Update(cn)
+		lpcm := make([]byte, 8000*2)
+		n, err := noise.GenerateTo(lpcm)
+		require.NoError(t, err)
+		require.Equal(t, len(lpcm), n)
+
+		rms := math.Sqrt(testPCM16Energy(lpcm))
+		dbov := -20 * math.Log10(rms/math.MaxInt16)
+		assert.InDelta(t, 40, dbov, 2, "coefficients %v", cn.Coefficients)
+	}
+
+	noise.Update(media.CNPayload{Level: 127})
+	lpcm := make([]byte, 320)
+	noise.GenerateTo(lpcm)
+	assert.Less(t, testPCM16Energy(lpcm), 1.0)
+}
+
+// fakeCNReader returns single packet per read. Packets with delay are returned after waiting
+type fakeCNReader struct {
+	packets [][]byte
+	cn      []bool
+	delay   map[int]time.Duration
+	read    int
+	lastCN  bool
+}
+
+func (r *fakeCNReader) Read(b []byte) (int, error) {
+	if r.read == len(r.packets) {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay[r.read])
+	n := copy(b, r.packets[r.read])
+	r.lastCN = r.cn[r.read]
+	r.read++
+	return n, nil
+}
+
+func (r *fakeCNReader) ReadCN() (media.CNPayload, bool) {
+	return media.CNPayload{Level: 30}, r.lastCN
+}
+
+func TestPCMDecoderReadComfortNoise(t *testing.T) {
+	speech := g711.EncodeUlaw(testPCM16Tone(300, 0, 160))
+	// CN packet is single byte and it is replaced with full frame of noise
+	source := &fakeCNReader{
+		packets: [][]byte{speech, {30}, speech},
+		cn:      []bool{false, true, false},
+	}
+	decoder, err := NewPCMDecoderReader(FORMAT_TYPE_ULAW, source)
+	require.NoError(t, err)
+
+	frames := [][]byte{}
+	for range 3 {
+		lpcm := make([]byte, 320)
+		n, err := decoder.Read(lpcm)
+		require.NoError(t, err)
+		frames = append(frames, lpcm[:n])
+	}
+
+	require.Len(t, frames[1], 320)
+	assert.Greater(t, testPCM16Energy(frames[1]), 0.0)
+	assert.Equal(t, frames[0], frames[2])
+
+	_, err = decoder.Read(make([]byte, 320))
+	require.ErrorIs(t, err, io.EOF)
+
+	t.Run("Gap", func(t *testing.T) {
+		// Voice is resumed 200ms after CN and noise fills gap in frames of 20ms
+		source := &fakeCNReader{
+			packets: [][]byte{speech, {30}, speech},
+			cn:      []bool{false, true, false},
+			delay:   map[int]time.Duration{2: 200 * time.Millisecond},
+		}
+		decoder, err := NewPCMDecoderReader(FORMAT_TYPE_ULAW, source)
+		require.NoError(t, err)
+
+		total := 0
+		for {
+			n, err := decoder.Read(make([]byte, 320))
+			if err != nil {
+				require.ErrorIs(t, err, io.EOF)
+				break
+			}
+			assert.Equal(t, 320, n)
+			total += n
+		}
+		frames := total / 320
+		// voice + 200ms of noise + voice
+		assert.GreaterOrEqual(t, frames, 1+8+1)
+		assert.LessOrEqual(t, frames, 1+11+1)
+	})
+
+	t.Run("NoReadAhead", func(t *testing.T) {
+		// After voice resumes Source is not read before next Read, so other reader can continue
+		source := &fakeCNReader{
+			packets: [][]byte{{30}, speech, speech},
+			cn:      []bool{true, false, false},
+			delay:   map[int]time.Duration{1: 30 * time.Millisecond},
+		}
+		decoder, err := NewPCMDecoderReader(FORMAT_TYPE_ULAW, source)
+		require.NoError(t, err)
+
+		lpcm := make([]byte, 320)
+		for {
+			_, err := decoder.Read(lpcm)
+			require.NoError(t, err)
+			if bytes.Equal(lpcm, frames[0]) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, 2, source.read)
+		require.NoError(t, decoder.Close())
+		assert.Equal(t, 2, source.read)
+	})
+}
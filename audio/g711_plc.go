@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Constants are from ITU-T G.711 Appendix I. All are in 8kHz samples
+const (
+	plcPitchMin     = 40  // 200 Hz
+	plcPitchMax     = 120 // 66 Hz
+	plcPitchDiff    = plcPitchMax - plcPitchMin
+	plcOverlapMax   = plcPitchMax >> 2
+	plcHistoryLen   = plcPitchMax*3 + plcOverlapMax
+	plcNDec         = 2 // decimation in coarse pitch search
+	plcCorrLen      = 160
+	plcCorrBufLen   = plcCorrLen + plcPitchMax
+	plcCorrMinPower = 250.0
+	// plcEOverlapIncr is added to overlap of first good frame for each erased frame
+	plcEOverlapIncr = 32
+	// plcFrameSize is 10ms erasure unit. Attenuation and max concealed length are based on it
+	plcFrameSize = 80
+	plcAttenFac  = 0.2
+	plcAttenIncr = plcAttenFac / plcFrameSize
+	// plcMaxErased is number of erased 10ms frames after which output is muted
+	plcMaxErased = 6
+)
+
+// G711PLC is packet loss concealment for G.711 based on ITU-T G.711 Appendix I.
+// It keeps history of decoded audio and on loss repeats last pitch periods.
+// Synthesized audio is attenuated 20% per 10ms after first 10ms and muted after 60ms.
+// First good frame after loss is overlapped with synthesized audio to avoid clicks.
+//
+// It works with 8kHz mono 16 bit PCM
+type G711PLC struct {
+	// FrameSamples is number of samples concealed per ConcealTo
+	FrameSamples int
+
+	history  [plcHistoryLen]int16
+	pitchbuf [plcHistoryLen]float64
+	lastq    [plcOverlapMax]float64
+
+	erasecnt int
+	pitch    int
+	poverlap int
+	poffset  int
+	// pitch buffer is from pitchbufstart until end of pitchbuf
+	pitchblen int
+
+	samples []int16
+}
+
+func NewG711PLC(frameSamples int) *G711PLC {
+	p := &G711PLC{}
+	p.Init(frameSamples)
+	return p
+}
+
+func (p *G711PLC) Init(frameSamples int) {
+	p.FrameSamples = frameSamples
+	p.erasecnt = 0
+	p.history = [plcHistoryLen]int16{}
+}
+
+// AddHistory must be called for every decoded good frame. If it follows loss, start of lpcm is
+// overlapped with synthesized audio, so lpcm can be modified.
+func (p *G711PLC) AddHistory(lpcm []byte) {
+	samples := p.toSamples(lpcm)
+	if p.erasecnt > 0 {
+		olen := min(p.poverlap+(p.erasecnt-1)*plcEOverlapIncr, plcFrameSize, len(samples))
+		var overlap [plcFrameSize]int16
+		p.getfespeech(overlap[:olen])
+		p.overlapAddAtEnd(samples[:olen], overlap[:olen])
+		p.erasecnt = 0
+
+		for i, s := range samples[:olen] {
+			binary.LittleEndian.PutUint16(lpcm[i*2:], uint16(s))
+		}
+	}
+	p.saveSpeech(samples)
+}
+
+// ConcealTo writes FrameSamples of synthesized audio to lpcm. Next payload is not used.
+// Signature matches PCMDecoder.ConcealTo
+func (p *G711PLC) ConcealTo(lpcm []byte, next []byte) (int, error) {
+	size := p.FrameSamples * 2
+	if len(lpcm) < size {
+		return 0, fmt.Errorf("plc: %w", io.ErrShortBuffer)
+	}
+
+	var out [plcFrameSize]int16
+	for off := 0; off < size; off += plcFrameSize * 2 {
+		n := min(plcFrameSize, (size-off)/2)
+		p.conceal(out[:n])
+		for i, s := range out[:n] {
+			binary.LittleEndian.PutUint16(lpcm[off+i*2:], uint16(s))
+		}
+	}
+	return size, nil
+}
+
+// conceal synthesizes single erased 10ms frame
+func (p *G711PLC) conceal(out []int16) {
+	switch {
+	case p.erasecnt == 0:
+		// Start of loss. Build pitch buffer from history
+		for i, s := range p.history {
+			p.pitchbuf[i] = float64(s)
+		}
+		p.pitch = p.findPitch()
+		p.poverlap = p.pitch >> 2
+
+		end := plcHistoryLen
+		copy(p.lastq[:p.poverlap], p.pitchbuf[end-p.poverlap:])
+		p.poffset = 0
+		p.pitchblen = p.pitch
+		start := end - p.pitchblen
+		// Smooth transition from end of history to repeated period
+		p.overlapAdd(p.lastq[:p.poverlap], p.pitchbuf[start-p.poverlap:start], p.pitchbuf[end-p.poverlap:end])
+		for i := end - p.poverlap; i < end; i++ {
+			p.history[i] = clampInt16(p.pitchbuf[i])
+		}
+		p.getfespeech(out)
+
+	case p.erasecnt == 1 || p.erasecnt == 2:
+		// Use more pitch periods from history to avoid robotic sound
+		var tmp [plcOverlapMax]int16
+		saveoffset := p.poffset
+		p.getfespeech(tmp[:p.poverlap])
+
+		p.poffset = saveoffset
+		for p.poffset > p.pitch {
+			p.poffset -= p.pitch
+		}
+		p.pitchblen += p.pitch
+		end := plcHistoryLen
+		start := end - p.pitchblen
+		p.overlapAdd(p.lastq[:p.poverlap], p.pitchbuf[start-p.poverlap:start], p.pitchbuf[end-p.poverlap:end])
+
+		p.getfespeech(out)
+		n := min(p.poverlap, len(out))
+		var l, r, o [plcOverlapMax]float64
+		for i := 0; i < n; i++ {
+			l[i], r[i] = float64(tmp[i]), float64(out[i])
+		}
+		p.overlapAdd(l[:n], r[:n], o[:n])
+		for i := 0; i < n; i++ {
+			out[i] = clampInt16(o[i])
+		}
+		p.scaleSpeech(out)
+
+	case p.erasecnt >= plcMaxErased:
+		clear(out)
+
+	default:
+		p.getfespeech(out)
+		p.scaleSpeech(out)
+	}
+	p.erasecnt++
+	p.saveSpeech(out)
+}
+
+// getfespeech reads synthesized audio from pitch buffer
+func (p *G711PLC) getfespeech(out []int16) {
+	start := plcHistoryLen - p.pitchblen
+	for len(out) > 0 {
+		cnt := min(p.pitchblen-p.poffset, len(out))
+		for i := 0; i < cnt; i++ {
+			out[i] = clampInt16(p.pitchbuf[start+p.poffset+i])
+		}
+		p.poffset += cnt
+		if p.poffset == p.pitchblen {
+			p.poffset = 0
+		}
+		out = out[cnt:]
+	}
+}
+
+// scaleSpeech attenuates erased frame
+func (p *G711PLC) scaleSpeech(out []int16) {
+	g := 1 - float64(p.erasecnt-1)*plcAttenFac
+	for i := range out {
+		out[i] = clampInt16(float64(out[i]) * max(g, 0))
+		g -= plcAttenIncr
+	}
+}
+
+func (p *G711PLC) saveSpeech(samples []int16) {
+	if len(samples) >= plcHistoryLen {
+		copy(p.history[:], samples[len(samples)-plcHistoryLen:])
+		return
+	}
+	copy(p.history[:], p.history[len(samples):])
+	copy(p.history[plcHistoryLen-len(samples):], samples)
+}
+
+// overlapAdd crossfades from l to r into o
+func (p *G711PLC) overlapAdd(l []float64, r []float64, o []float64) {
+	incr := 1 / float64(len(l))
+	lw, rw := 1-incr, incr
+	for i := range l {
+		o[i] = lw*l[i] + rw*r[i]
+		lw -= incr
+		rw += incr
+	}
+}
+
+// overlapAddAtEnd crossfades synthesized audio f to good frame s. Synthesized is attenuated as last erased frame
+func (p *G711PLC) overlapAddAtEnd(s []int16, f []int16) {
+	gain := max(1-float64(p.erasecnt-1)*plcAttenFac, 0)
+	incr := 1 / float64(len(s))
+	lw, rw := (1-incr)*gain, incr
+	gainIncr := gain * incr
+	for i := range s {
+		s[i] = clampInt16(lw*float64(f[i]) + rw*float64(s[i]))
+		lw -= gainIncr
+		rw += incr
+	}
+}
+
+// findPitch estimates pitch period of end of pitch buffer with normalized cross correlation.
+// Coarse search is done on decimated signal and refined around best match
+func (p *G711PLC) findPitch() int {
+	end := plcHistoryLen
+	l := p.pitchbuf[end-plcCorrLen : end]
+	r := p.pitchbuf[end-plcCorrBufLen:]
+
+	corrAt := func(off int, step int) (corr float64, energy float64) {
+		for i := 0; i < plcCorrLen; i += step {
+			corr += r[off+i] * l[i]
+			energy += r[off+i] * r[off+i]
+		}
+		return corr, energy
+	}
+	normalize := func(corr float64, energy float64) float64 {
+		return corr / math.Sqrt(max(energy, plcCorrMinPower))
+	}
+
+	bestmatch := 0
+	bestcorr := math.Inf(-1)
+	for j := 0; j <= plcPitchDiff; j += plcNDec {
+		if c := normalize(corrAt(j, plcNDec)); c >= bestcorr {
+			bestcorr, bestmatch = c, j
+		}
+	}
+
+	from := max(bestmatch-(plcNDec-1), 0)
+	to := min(bestmatch+(plcNDec-1), plcPitchDiff)
+	bestcorr = math.Inf(-1)
+	for j := from; j <= to; j++ {
+		if c := normalize(corrAt(j, 1)); c >= bestcorr {
+			bestcorr, bestmatch = c, j
+		}
+	}
+	return plcPitchMax - bestmatch
+}
+
+func (p *G711PLC) toSamples(lpcm []byte) []int16 {
+	n := len(lpcm) / 2
+	if cap(p.samples) < n {
+		p.samples = make([]int16, n)
+	}
+	samples := p.samples[:n]
+	samplesByteToInt16(lpcm[:n*2], samples)
+	return samples
+}
+
+func clampInt16(v float64) int16 {
+	return int16(max(math.MinInt16, min(math.MaxInt16, math.Round(v))))
+}
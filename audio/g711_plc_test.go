@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media"
+	"github.com/zaf/g711"
+)
+
+// testPCM16Tone generates samples of tone at 8kHz starting at sample offset
+func testPCM16Tone(freq float64, offset int, n int) []byte {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(10000 * math.Sin(2*math.Pi*freq*float64(offset+i)/8000))
+	}
+	return testPCM16Samples(samples...)
+}
+
+func testPCM16Energy(lpcm []byte) float64 {
+	sum := 0.0
+	for i := 0; i+1 < len(lpcm); i += 2 {
+		v := float64(int16(binary.LittleEndian.Uint16(lpcm[i:])))
+		sum += v * v
+	}
+	return sum / float64(len(lpcm)/2)
+}
+
+func TestG711PLCConceal(t *testing.T) {
+	plc := NewG711PLC(160)
+	for i := 0; i < 5; i++ {
+		plc.AddHistory(testPCM16Tone(200, i*160, 160))
+	}
+
+	out := make([]byte, 320)
+	n, err := plc.ConcealTo(out, nil)
+	require.NoError(t, err)
+	require.Equal(t, 320, n)
+
+	// 200Hz has period of 40 samples
+	assert.Equal(t, 0, plc.pitch%40)
+
+	// First 10ms continue tone without attenuation
+	expected := testPCM16Tone(200, 5*160, 80)
+	for i := 0; i < 160; i += 2 {
+		diff := int16(binary.LittleEndian.Uint16(out[i:])) - int16(binary.LittleEndian.Uint16(expected[i:]))
+		assert.Less(t, math.Abs(float64(diff)), 500.0, "sample %d", i/2)
+	}
+
+	_, err = plc.ConcealTo(make([]byte, 100), nil)
+	require.Error(t, err)
+}
+
+func TestG711PLCAttenuation(t *testing.T) {
+	plc := NewG711PLC(80)
+	for i := 0; i < 5; i++ {
+		plc.AddHistory(testPCM16Tone(250, i*80, 80))
+	}
+	tone := testPCM16Energy(testPCM16Tone(250, 0, 80))
+
+	var energies []float64
+	out := make([]byte, 160)
+	for i := 0; i < 8; i++ {
+		_, err := plc.ConcealTo(out, nil)
+		require.NoError(t, err)
+		energies = append(energies, testPCM16Energy(out))
+	}
+
+	assert.InDelta(t, tone, energies[0], tone*0.1)
+	for i := 1; i < 6; i++ {
+		assert.Less(t, energies[i], energies[i-1], "frame %d", i)
+	}
+	// Muted after 60ms
+	assert.Zero(t, energies[6])
+	assert.Zero(t, energies[7])
+}
+
+func TestG711PLCOverlapAfterLoss(t *testing.T) {
+	plc := NewG711PLC(160)
+	for i := 0; i < 5; i++ {
+		plc.AddHistory(testPCM16Tone(200, i*160, 160))
+	}
+	concealed := make([]byte, 320)
+	_, err := plc.ConcealTo(concealed, nil)
+	require.NoError(t, err)
+
+	good := testPCM16Tone(200, 6*160, 160)
+	original := bytes.Clone(good)
+	// Overlap grows with each erased 10ms
+	olen := plc.poverlap + plcEOverlapIncr
+	plc.AddHistory(good)
+
+	// Start is crossfaded and rest is untouched
+	assert.NotEqual(t, original[:20], good[:20])
+	assert.Equal(t, original[2*olen:], good[2*olen:])
+
+	// No click on boundary
+	last := int16(binary.LittleEndian.Uint16(concealed[318:]))
+	first := int16(binary.LittleEndian.Uint16(good[0:]))
+	assert.Less(t, math.Abs(float64(first)-float64(last)), 2000.0)
+}
+
+func TestPCMDecoderReadG711PLC(t *testing.T) {
+	pcm := make([]byte, 0, 8*320)
+	for i := 0; i < 8; i++ {
+		pcm = append(pcm, testPCM16Tone(200, i*160, 160)...)
+	}
+	encoded := g711.EncodeAlaw(pcm)
+
+	// Frames 5 and 6 are lost
+	received := append(bytes.Clone(encoded[:5*160]), encoded[7*160:]...)
+	source := &fakeLossReader{Reader: bytes.NewReader(received), lost: []int{0, 0, 0, 0, 0, 2}}
+	decoder, err := NewPCMDecoderReader(FORMAT_TYPE_ALAW, source)
+	require.NoError(t, err)
+	decoder.BufSize = 160
+
+	decodedPCM, err := media.ReadAll(decoder, 320)
+	require.NoError(t, err)
+	// Timeline stays continuous
+	require.Len(t, decodedPCM, 8*320)
+
+	concealed := decodedPCM[5*320 : 7*320]
+	assert.Greater(t, testPCM16Energy(concealed[:160]), testPCM16Energy(pcm[:320])/2)
+}
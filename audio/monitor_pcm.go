@@ -3,33 +3,53 @@ package audio
 import (
 	"bufio"
 	"bytes"
-	"errors"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 	"os"
-	"path"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/vertan/diago/media"
 )
 
 var (
 	RecordingFlushSize = 4096
+	// RecordingMaxLag is how long stereo recording waits for channel without audio before filling it with silence.
+	// It also bounds how much audio is buffered in memory
+	RecordingMaxLag = 200 * time.Millisecond
 )
 
 type MonitorPCMReader struct {
+	// SampleRate and NumChannels of monitored PCM. By default they are same as codec,
+	// otherwise decoded audio is resampled. They must be set before Init
+	SampleRate  int
+	NumChannels int
+
 	audioReader io.Reader
 	writer      *bufio.Writer // Lets use Buffered flushing
+	pcmWriter   io.Writer
 
 	codec    media.Codec
 	decoder  PCMDecoderBuffer
 	silence  []byte
 	lastTime time.Time
+	// timeline is set by stereo recording, which does buffering and silence insertion
+	timeline bool
 }
 
 func (m *MonitorPCMReader) Init(w io.Writer, codec media.Codec, audioReader io.Reader) error {
-	bw := bufio.NewWriterSize(w, RecordingFlushSize)
-	m.writer = bw
+	if !m.timeline {
+		bw := bufio.NewWriterSize(w, RecordingFlushSize)
+		m.writer = bw
+		w = bw
+	}
+	pcmWriter, err := monitorPCMWriter(w, codec, m.SampleRate, m.NumChannels)
+	if err != nil {
+		return err
+	}
+	m.pcmWriter = pcmWriter
 	m.codec = codec
 	m.audioReader = audioReader
 
@@ -46,6 +66,9 @@ func (m *MonitorPCMReader) Init(w io.Writer, codec media.Codec, audioReader io.R
 }
 
 func (m *MonitorPCMReader) Flush() error {
+	if m.writer == nil {
+		return nil
+	}
 	return m.writer.Flush()
 }
 
@@ -61,11 +84,11 @@ func (m *MonitorPCMReader) Read(b []byte) (int, error) {
 	}
 	// Check do we need to inject silence
 	now := time.Now()
-	if !m.lastTime.IsZero() {
+	if !m.lastTime.IsZero() && !m.timeline {
 		diff := uint32(now.Sub(m.lastTime).Seconds() * float64(m.codec.SampleRate))
 		srt := m.codec.SampleTimestamp()
 		for i := 2 * srt; i < diff; i += srt {
-			if _, err := m.writer.Write(m.silence); err != nil {
+			if _, err := m.pcmWriter.Write(m.silence); err != nil {
 				return n, err
 			}
 		}
@@ -79,23 +102,39 @@ func (m *MonitorPCMReader) Read(b []byte) (int, error) {
 	lpcm := m.decoder.ReadFull()
 
 	// Write to outer stream. Expecting some buffer with flushing will happen
-	_, err = m.writer.Write(lpcm)
+	_, err = m.pcmWriter.Write(lpcm)
 	return n, err
 }
 
 type MonitorPCMWriter struct {
+	// SampleRate and NumChannels of monitored PCM. By default they are same as codec,
+	// otherwise decoded audio is resampled. They must be set before Init
+	SampleRate  int
+	NumChannels int
+
 	audioWriter io.Writer
 	writer      *bufio.Writer // Lets use Buffered flushing
+	pcmWriter   io.Writer
 
 	codec    media.Codec
 	decoder  PCMDecoderBuffer
 	silence  []byte
 	lastTime time.Time
+	// timeline is set by stereo recording, which does buffering and silence insertion
+	timeline bool
 }
 
 func (m *MonitorPCMWriter) Init(w io.Writer, codec media.Codec, audioWriter io.Writer) error {
-	bw := bufio.NewWriterSize(w, RecordingFlushSize)
-	m.writer = bw
+	if !m.timeline {
+		bw := bufio.NewWriterSize(w, RecordingFlushSize)
+		m.writer = bw
+		w = bw
+	}
+	pcmWriter, err := monitorPCMWriter(w, codec, m.SampleRate, m.NumChannels)
+	if err != nil {
+		return err
+	}
+	m.pcmWriter = pcmWriter
 	m.codec = codec
 	m.audioWriter = audioWriter
 
@@ -112,17 +151,20 @@ func (m *MonitorPCMWriter) Init(w io.Writer, codec media.Codec, audioWriter io.W
 }
 
 func (m *MonitorPCMWriter) Flush() error {
+	if m.writer == nil {
+		return nil
+	}
 	return m.writer.Flush()
 }
 
 func (m *MonitorPCMWriter) Write(b []byte) (int, error) {
 	// Check do we need to inject silence
 	now := time.Now()
-	if !m.lastTime.IsZero() {
+	if !m.lastTime.IsZero() && !m.timeline {
 		diff := uint32(now.Sub(m.lastTime).Seconds() * float64(m.codec.SampleRate))
 		srt := m.codec.SampleTimestamp()
 		for i := 2 * srt; i < diff; i += srt {
-			if _, err := m.writer.Write(m.silence); err != nil {
+			if _, err := m.pcmWriter.Write(m.silence); err != nil {
 				return 0, err
 			}
 		}
@@ -141,141 +183,289 @@ func (m *MonitorPCMWriter) Write(b []byte) (int, error) {
 	lpcm := m.decoder.ReadFull()
 
 	// Write to outer stream. Expecting some buffer with flushing will happen
-	_, err = m.writer.Write(lpcm)
+	_, err = m.pcmWriter.Write(lpcm)
 	return n, err
 }
 
+// monitorPCMWriter returns writer converting decoded codec PCM to sampleRate and numChannels if they differ
+func monitorPCMWriter(w io.Writer, codec media.Codec, sampleRate int, numChannels int) (io.Writer, error) {
+	if sampleRate == 0 {
+		sampleRate = int(codec.SampleRate)
+	}
+	if numChannels == 0 {
+		numChannels = codec.NumChannels
+	}
+	if sampleRate == int(codec.SampleRate) && numChannels == codec.NumChannels {
+		return w, nil
+	}
+
+	resampler := &PCMResamplerWriter{}
+	if err := resampler.Init(w, int(codec.SampleRate), codec.NumChannels, sampleRate, numChannels); err != nil {
+		return nil, err
+	}
+	return resampler, nil
+}
+
+// MonitorPCMStereo records reader as left and writer as right channel of 16 bit PCM.
+// Channels are interleaved in memory as audio arrives and aligned on wall clock,
+// so that channel without audio is filled with silence. Nothing is stored outside of record writer.
 type MonitorPCMStereo struct {
 	MonitorPCMReader
 	MonitorPCMWriter
 
-	PCMFileRead  *os.File
+	// Deprecated: Channels are no longer buffered in files. It is not used
+	PCMFileRead *os.File
+	// Deprecated: Channels are no longer buffered in files. It is not used
 	PCMFileWrite *os.File
 
-	recording io.Writer
+	timeline *pcmStereoTimeline
 }
 
-// It supports only single codec, which must be same for reader and writer
+// It supports only single codec, which must be same for reader and writer.
+// Each side is recorded as mono channel at codec sample rate, unless changed on MonitorPCMReader and MonitorPCMWriter
 func (m *MonitorPCMStereo) Init(record io.Writer, codec media.Codec, audioReader io.Reader, audioWriter io.Writer) error {
-	m.recording = record
-
-	uuid := uuid.New().String()
-	var err error
-	err = func() error {
-		if m.PCMFileRead == nil {
-			filepath := path.Join(os.TempDir(), uuid+"_monitor_reader.raw")
-			m.PCMFileRead, err = os.OpenFile(filepath, os.O_CREATE|os.O_RDWR, 0755)
-			if err != nil {
-				return err
-			}
-		}
+	sampleRate := m.MonitorPCMReader.SampleRate
+	if sampleRate == 0 {
+		sampleRate = int(codec.SampleRate)
+	}
+	if rate := m.MonitorPCMWriter.SampleRate; rate != 0 && rate != sampleRate {
+		return fmt.Errorf("sample rate of reader and writer need to match for stereo")
+	}
+	m.MonitorPCMReader.SampleRate = sampleRate
+	m.MonitorPCMWriter.SampleRate = sampleRate
 
-		if m.PCMFileWrite == nil {
-			filepath := path.Join(os.TempDir(), uuid+"_monitor_writer.raw")
-			m.PCMFileWrite, err = os.OpenFile(filepath, os.O_CREATE|os.O_RDWR, 0755)
-			if err != nil {
-				return err
-			}
-		}
+	m.timeline = newPCMStereoTimeline(record, sampleRate, 2*codec.SampleDur, RecordingMaxLag)
 
-		if err := m.MonitorPCMReader.Init(m.PCMFileRead, codec, audioReader); err != nil {
-			return err
-		}
+	// Each side is single channel in stereo
+	m.MonitorPCMReader.NumChannels = 1
+	m.MonitorPCMWriter.NumChannels = 1
+	m.MonitorPCMReader.timeline = true
+	m.MonitorPCMWriter.timeline = true
+	if err := m.MonitorPCMReader.Init(&pcmStereoChannel{m.timeline, 0}, codec, audioReader); err != nil {
+		return err
+	}
+	return m.MonitorPCMWriter.Init(&pcmStereoChannel{m.timeline, 1}, codec, audioWriter)
+}
 
-		if err := m.MonitorPCMWriter.Init(m.PCMFileWrite, codec, audioWriter); err != nil {
-			return err
-		}
+// Close writes remaining audio. Shorter channel is filled with silence.
+// Record writer is not closed
+func (m *MonitorPCMStereo) Close() error {
+	if m.timeline == nil {
 		return nil
-	}()
-	if err != nil {
-		return errors.Join(err, m.removeTmpFiles())
 	}
+	return m.timeline.close()
+}
 
+// Flush does nothing as audio is written as soon as both channels have it
+func (m *MonitorPCMStereo) Flush() error {
 	return nil
 }
 
-func (m *MonitorPCMStereo) removeTmpFiles() (err error) {
-	if m.PCMFileRead != nil {
-		e1 := m.PCMFileRead.Close()
-		e2 := os.Remove(m.PCMFileRead.Name())
-		err = errors.Join(err, e1, e2)
-	}
+// Pause records silence until Resume. With remove paused section is left out of recording
+func (m *MonitorPCMStereo) Pause(remove bool) {
+	m.timeline.pause(remove)
+}
 
-	if m.PCMFileWrite != nil {
-		e1 := m.PCMFileWrite.Close()
-		e2 := os.Remove(m.PCMFileWrite.Name())
-		err = errors.Join(err, e1, e2)
-	}
-	return err
+func (m *MonitorPCMStereo) Resume() {
+	m.timeline.resume()
 }
 
-func (m *MonitorPCMStereo) Close() error {
-	if err := m.Flush(); err != nil {
-		return err
+// PCMStereoRecorder records two encoded audio streams as left and right channel of 16 bit PCM.
+// Each channel can have different codec, which is decoded and resampled to recording sample rate.
+// Channels are aligned on wall clock same as in MonitorPCMStereo
+//
+// Experimental
+type PCMStereoRecorder struct {
+	// Mono mixes both channels into single channel. Must be set before Init
+	Mono bool
+
+	sampleRate int
+	timeline   *pcmStereoTimeline
+}
+
+// Init creates recorder writing 16 bit PCM with sampleRate to record
+func (r *PCMStereoRecorder) Init(record io.Writer, sampleRate int) {
+	r.sampleRate = sampleRate
+	r.timeline = newPCMStereoTimeline(record, sampleRate, 2*20*time.Millisecond, RecordingMaxLag)
+	r.timeline.mono = r.Mono
+}
+
+// ChannelWriter returns writer of encoded audio for channel 0 (left) or 1 (right)
+func (r *PCMStereoRecorder) ChannelWriter(ch int, codec media.Codec) (io.Writer, error) {
+	if ch != 0 && ch != 1 {
+		return nil, fmt.Errorf("invalid channel %d", ch)
 	}
-	if err := m.interleave(); err != nil {
-		return err
+	mon := &MonitorPCMWriter{
+		SampleRate:  r.sampleRate,
+		NumChannels: 1,
+		timeline:    true,
 	}
+	if err := mon.Init(&pcmStereoChannel{r.timeline, ch}, codec, io.Discard); err != nil {
+		return nil, err
+	}
+	return mon, nil
+}
 
-	return m.removeTmpFiles()
+// Pause records silence until Resume. With remove paused section is left out of recording
+func (r *PCMStereoRecorder) Pause(remove bool) {
+	r.timeline.pause(remove)
 }
 
-func (m *MonitorPCMStereo) Flush() error {
-	if err := m.MonitorPCMReader.Flush(); err != nil {
-		return err
-	}
-	if err := m.MonitorPCMWriter.Flush(); err != nil {
-		return err
+func (r *PCMStereoRecorder) Resume() {
+	r.timeline.resume()
+}
+
+// Close writes remaining audio. Record writer is not closed
+func (r *PCMStereoRecorder) Close() error {
+	return r.timeline.close()
+}
+
+// pcmStereoTimeline interleaves two mono 16 bit PCM channels.
+// Position of each channel is kept in samples from first written audio
+type pcmStereoTimeline struct {
+	mu         sync.Mutex
+	w          io.Writer
+	now        func() time.Time
+	sampleRate int
+	// tolerance is how much channel can be behind wall clock before silence is inserted
+	tolerance int64
+	maxLag    int64
+	// mono mixes channels instead of interleaving
+	mono bool
+
+	start time.Time
+	bufs  [2][]byte
+	pos   [2]int64
+	out   []byte
+
+	paused       bool
+	removePaused bool
+	pausedAt     time.Time
+}
+
+func newPCMStereoTimeline(w io.Writer, sampleRate int, tolerance time.Duration, maxLag time.Duration) *pcmStereoTimeline {
+	return &pcmStereoTimeline{
+		w:          w,
+		now:        time.Now,
+		sampleRate: sampleRate,
+		tolerance:  durationSamples(tolerance, sampleRate),
+		maxLag:     durationSamples(maxLag, sampleRate),
 	}
-	return nil
 }
 
-func (m *MonitorPCMStereo) interleave() error {
-	fr := m.PCMFileRead
-	fw := m.PCMFileWrite
-	recording := m.recording
-	if _, err := fr.Seek(0, 0); err != nil {
-		return err
+func durationSamples(d time.Duration, sampleRate int) int64 {
+	return int64(d.Seconds() * float64(sampleRate))
+}
+
+func (t *pcmStereoTimeline) write(ch int, pcm []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.paused && t.removePaused {
+		return len(pcm), nil
 	}
-	if _, err := fw.Seek(0, 0); err != nil {
-		return err
+
+	now := t.now()
+	if t.start.IsZero() {
+		t.start = now
+	}
+	if t.paused {
+		// Audio is replaced with silence
+		pcm = make([]byte, len(pcm))
 	}
+	elapsed := durationSamples(now.Sub(t.start), t.sampleRate)
 
-	// Read frames from both files and interleave
-	readBuf1 := make([]byte, RecordingFlushSize/2)
-	readBuf2 := make([]byte, RecordingFlushSize/2)
-	stereoBuf := make([]byte, (RecordingFlushSize/2)*2)
-	size := 2 // 16 bit
-	for {
-		n1, err1 := io.ReadFull(fr, readBuf1)
-		n2, err2 := io.ReadFull(fw, readBuf2)
+	// Audio is arriving after it is produced, so it started before now.
+	// Gap between channel position and audio start is filled with silence
+	samples := int64(len(pcm) / 2)
+	if gap := elapsed - samples - t.pos[ch]; gap > t.tolerance {
+		t.pad(ch, gap)
+	}
+	t.bufs[ch] = append(t.bufs[ch], pcm...)
+	t.pos[ch] += samples
 
-		n := max(n1, n2)
+	// Other channel is not receiving audio. Fill it so that audio is not held
+	other := 1 - ch
+	if lag := elapsed - t.maxLag - t.pos[other]; lag > 0 {
+		t.pad(other, lag)
+	}
 
-		if (err1 != nil || err2 != nil) && n == 0 {
-			if !errors.Is(err1, io.EOF) {
-				return err1
-			}
+	if err := t.interleave(); err != nil {
+		return 0, err
+	}
+	return len(pcm), nil
+}
 
-			if !errors.Is(err2, io.EOF) {
-				return err2
-			}
-			break
-		}
+func (t *pcmStereoTimeline) pad(ch int, samples int64) {
+	t.bufs[ch] = append(t.bufs[ch], make([]byte, samples*2)...)
+	t.pos[ch] += samples
+}
 
-		// interleave
-		copyN := 0
-		for i, j := 0, 0; i < n; i += size {
-			copyN += copy(stereoBuf[j:j+size], readBuf1[i:i+size])
-			copyN += copy(stereoBuf[j+size:j+2*size], readBuf2[i:i+size])
-			j += 2 * size // 2 channels * size
-		}
+// interleave writes samples present in both channels. Must be called under lock
+func (t *pcmStereoTimeline) interleave() error {
+	n := min(len(t.bufs[0]), len(t.bufs[1])) &^ 1
+	if n == 0 {
+		return nil
+	}
 
-		if _, err := recording.Write(stereoBuf[:copyN]); err != nil {
-			return err
+	t.out = t.out[:0]
+	for i := 0; i < n; i += 2 {
+		if t.mono {
+			l := int32(int16(binary.LittleEndian.Uint16(t.bufs[0][i:])))
+			r := int32(int16(binary.LittleEndian.Uint16(t.bufs[1][i:])))
+			t.out = binary.LittleEndian.AppendUint16(t.out, uint16(int16(min(max(l+r, math.MinInt16), math.MaxInt16))))
+			continue
 		}
+		t.out = append(t.out, t.bufs[0][i:i+2]...)
+		t.out = append(t.out, t.bufs[1][i:i+2]...)
+	}
+	for ch := range t.bufs {
+		t.bufs[ch] = t.bufs[ch][:copy(t.bufs[ch], t.bufs[ch][n:])]
+	}
+	_, err := t.w.Write(t.out)
+	return err
+}
 
+func (t *pcmStereoTimeline) pause(remove bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paused {
+		return
 	}
+	t.paused = true
+	t.removePaused = remove
+	t.pausedAt = t.now()
+}
 
-	return nil
+func (t *pcmStereoTimeline) resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.paused {
+		return
+	}
+	t.paused = false
+	if t.removePaused && !t.start.IsZero() {
+		// Removed section is not part of timeline
+		t.start = t.start.Add(t.now().Sub(t.pausedAt))
+	}
+}
+
+func (t *pcmStereoTimeline) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if diff := t.pos[0] - t.pos[1]; diff > 0 {
+		t.pad(1, diff)
+	} else if diff < 0 {
+		t.pad(0, -diff)
+	}
+	return t.interleave()
+}
+
+type pcmStereoChannel struct {
+	timeline *pcmStereoTimeline
+	ch       int
+}
+
+func (c *pcmStereoChannel) Write(b []byte) (int, error) {
+	return c.timeline.write(c.ch, b)
 }
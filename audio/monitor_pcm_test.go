@@ -2,7 +2,6 @@ package audio
 
 import (
 	"bytes"
-	"os"
 	"testing"
 	"time"
 
@@ -67,6 +66,18 @@ func TestMonitorPCMReaderWriter(t *testing.T) {
 		assert.Equal(t, 2*frameSize+2*frameSize+2*frameSize, recording.Len())
 	})
 
+	t.Run("Resample", func(t *testing.T) {
+		recording := bytes.NewBuffer([]byte{})
+		mon := &MonitorPCMWriter{SampleRate: 16000, NumChannels: 2}
+		require.NoError(t, mon.Init(recording, codecR, bytes.NewBuffer([]byte{})))
+
+		_, err = media.WriteAll(mon, audioAlawBuf, 160)
+		require.NoError(t, err)
+		mon.Flush()
+
+		// 4 frames with double rate and 2 channels
+		assert.Equal(t, 4*4*codecR.Samples16(), recording.Len())
+	})
 }
 
 func TestMonitorPCMStereo(t *testing.T) {
@@ -97,12 +108,6 @@ func TestMonitorPCMStereo(t *testing.T) {
 		err = mon.Close()
 		require.NoError(t, err)
 
-		// Do files get removed
-		_, err = os.Stat(mon.PCMFileRead.Name())
-		assert.True(t, os.IsNotExist(err))
-		_, err = os.Stat(mon.PCMFileWrite.Name())
-		assert.True(t, os.IsNotExist(err))
-
 		frameSize := media.CodecAudioAlaw.Samples16()
 		assert.Equal(t, 8*frameSize, recording.Len())
 		// Check does data alternate
@@ -139,4 +144,61 @@ func TestMonitorPCMStereo(t *testing.T) {
 		assert.Equal(t, 80*2*frameSize, recording.Len())
 	})
 
+	t.Run("TimeAligned", func(t *testing.T) {
+		recording := bytes.NewBuffer([]byte{})
+		// 1 sample per ms
+		tl := newPCMStereoTimeline(recording, 1000, 2*time.Millisecond, 50*time.Millisecond)
+		now := time.Now()
+		tl.now = func() time.Time { return now }
+
+		left := bytes.Repeat([]byte{1, 0}, 20)
+		right := bytes.Repeat([]byte{2, 0}, 20)
+		sample := func(i int) (int16, int16) {
+			stereo := recording.Bytes()
+			return int16(stereo[4*i]), int16(stereo[4*i+2])
+		}
+
+		// Both channels start together
+		_, err := tl.write(0, left)
+		require.NoError(t, err)
+		_, err = tl.write(1, right)
+		require.NoError(t, err)
+		assert.Equal(t, 20*4, recording.Len())
+
+		// Right channel stops sending. Left is held until max lag is reached
+		now = now.Add(40 * time.Millisecond)
+		_, err = tl.write(0, left)
+		require.NoError(t, err)
+		assert.Equal(t, 20*4, recording.Len())
+
+		// Left audio arrives after gap, which is filled with silence
+		now = now.Add(80 * time.Millisecond)
+		_, err = tl.write(0, left)
+		require.NoError(t, err)
+		// Right is filled with silence up to 120-50 ms
+		assert.Equal(t, 70*4, recording.Len())
+		l, r := sample(25)
+		assert.EqualValues(t, 1, l)
+		assert.EqualValues(t, 0, r)
+
+		// Right continues after long gap. Both channels get silence before audio
+		now = now.Add(100 * time.Millisecond)
+		_, err = tl.write(1, right)
+		require.NoError(t, err)
+		_, err = tl.write(0, left)
+		require.NoError(t, err)
+		require.NoError(t, tl.close())
+
+		// Left: 40 audio, 60 silence, 20 audio, 80 silence, 20 audio. Right: 20 audio, 180 silence, 20 audio
+		assert.Equal(t, 220*4, recording.Len())
+		l, r = sample(110)
+		assert.EqualValues(t, 1, l)
+		assert.EqualValues(t, 0, r)
+		l, r = sample(150)
+		assert.EqualValues(t, 0, l)
+		assert.EqualValues(t, 0, r)
+		l, r = sample(210)
+		assert.EqualValues(t, 1, l)
+		assert.EqualValues(t, 2, r)
+	})
 }
@@ -0,0 +1,303 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Ogg page header types
+const (
+	OggHeaderContinued = 0x01
+	OggHeaderBOS       = 0x02
+	OggHeaderEOS       = 0x04
+)
+
+var (
+	// OggPageMaxData is data size after which writer starts new page
+	OggPageMaxData = 4096
+
+	ErrOggCRC = errors.New("ogg page checksum mismatch")
+
+	oggCRCTable = func() (t [256]uint32) {
+		for i := range t {
+			r := uint32(i) << 24
+			for j := 0; j < 8; j++ {
+				if r&0x80000000 != 0 {
+					r = r<<1 ^ 0x04c11db7
+				} else {
+					r <<= 1
+				}
+			}
+			t[i] = r
+		}
+		return t
+	}()
+)
+
+// OggGranuleNone is granule position of page where no packet ends
+const OggGranuleNone = ^uint64(0)
+
+func oggCRC(crc uint32, b []byte) uint32 {
+	for _, v := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^v]
+	}
+	return crc
+}
+
+// OggPage is single page of Ogg bitstream (RFC 3533)
+type OggPage struct {
+	HeaderType byte
+	Granule    uint64
+	Serial     uint32
+	Sequence   uint32
+	// Segments is lacing table of data
+	Segments []byte
+	Data     []byte
+}
+
+// OggWriter muxes packets of single logical bitstream into Ogg pages.
+// Packets are buffered into page until OggPageMaxData is reached or Flush is called
+type OggWriter struct {
+	W      io.Writer
+	Serial uint32
+
+	seq         uint32
+	continued   bool
+	granule     uint64
+	lastGranule uint64
+	segments    []byte
+	data        []byte
+	header      [27]byte
+}
+
+func NewOggWriter(w io.Writer, serial uint32) *OggWriter {
+	return &OggWriter{W: w, Serial: serial, granule: OggGranuleNone}
+}
+
+// WritePacket adds packet to page. Granule is position after this packet
+func (w *OggWriter) WritePacket(packet []byte, granule uint64) error {
+	segs := len(packet)/255 + 1
+	if len(w.segments) > 0 && (len(w.segments)+segs > 255 || len(w.data)+len(packet) > OggPageMaxData) {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	// Packet larger than page continues on next pages
+	for len(packet) >= 255*(255-len(w.segments)) {
+		n := 255 * (255 - len(w.segments))
+		for i := 0; i < n/255; i++ {
+			w.segments = append(w.segments, 255)
+		}
+		w.data = append(w.data, packet[:n]...)
+		packet = packet[n:]
+		if err := w.flush(0); err != nil {
+			return err
+		}
+		w.continued = true
+	}
+
+	for len(packet) >= 255 {
+		w.segments = append(w.segments, 255)
+		w.data = append(w.data, packet[:255]...)
+		packet = packet[255:]
+	}
+	w.segments = append(w.segments, byte(len(packet)))
+	w.data = append(w.data, packet...)
+	w.granule = granule
+	w.lastGranule = granule
+	return nil
+}
+
+// Flush writes buffered packets as page
+func (w *OggWriter) Flush() error {
+	if len(w.segments) == 0 {
+		return nil
+	}
+	return w.flush(0)
+}
+
+// Close writes buffered packets as last page with end of stream flag
+func (w *OggWriter) Close() error {
+	if len(w.segments) == 0 {
+		// Empty page is allowed for marking end of stream
+		w.granule = w.lastGranule
+	}
+	return w.flush(OggHeaderEOS)
+}
+
+func (w *OggWriter) flush(headerType byte) error {
+	if w.seq == 0 {
+		headerType |= OggHeaderBOS
+	}
+	if w.continued {
+		headerType |= OggHeaderContinued
+	}
+
+	h := w.header[:]
+	copy(h, "OggS")
+	h[4] = 0
+	h[5] = headerType
+	binary.LittleEndian.PutUint64(h[6:], w.granule)
+	binary.LittleEndian.PutUint32(h[14:], w.Serial)
+	binary.LittleEndian.PutUint32(h[18:], w.seq)
+	binary.LittleEndian.PutUint32(h[22:], 0)
+	h[26] = byte(len(w.segments))
+
+	crc := oggCRC(0, h)
+	crc = oggCRC(crc, w.segments)
+	crc = oggCRC(crc, w.data)
+	binary.LittleEndian.PutUint32(h[22:], crc)
+
+	page := make([]byte, 0, len(h)+len(w.segments)+len(w.data))
+	page = append(page, h...)
+	page = append(page, w.segments...)
+	page = append(page, w.data...)
+	if _, err := w.W.Write(page); err != nil {
+		return err
+	}
+
+	w.seq++
+	w.continued = false
+	w.granule = OggGranuleNone
+	w.segments = w.segments[:0]
+	w.data = w.data[:0]
+	return nil
+}
+
+// OggReader demuxes packets of first logical bitstream. Pages of other streams are skipped
+type OggReader struct {
+	R io.Reader
+
+	serial    uint32
+	started   bool
+	page      OggPage
+	segIndex  int
+	dataIndex int
+	packet    []byte
+	eos       bool
+}
+
+func NewOggReader(r io.Reader) *OggReader {
+	return &OggReader{R: r}
+}
+
+// ReadPage reads next page of any stream and checks its CRC
+func (r *OggReader) ReadPage() (OggPage, error) {
+	var h [27]byte
+	if _, err := io.ReadFull(r.R, h[:]); err != nil {
+		return OggPage{}, err
+	}
+	if string(h[0:4]) != "OggS" {
+		return OggPage{}, fmt.Errorf("ogg page capture pattern not found")
+	}
+	if h[4] != 0 {
+		return OggPage{}, fmt.Errorf("unsupported ogg version %d", h[4])
+	}
+
+	page := OggPage{
+		HeaderType: h[5],
+		Granule:    binary.LittleEndian.Uint64(h[6:]),
+		Serial:     binary.LittleEndian.Uint32(h[14:]),
+		Sequence:   binary.LittleEndian.Uint32(h[18:]),
+		Segments:   make([]byte, h[26]),
+	}
+	crc := binary.LittleEndian.Uint32(h[22:])
+
+	if _, err := io.ReadFull(r.R, page.Segments); err != nil {
+		return OggPage{}, unexpectedEOF(err)
+	}
+	size := 0
+	for _, s := range page.Segments {
+		size += int(s)
+	}
+	page.Data = make([]byte, size)
+	if _, err := io.ReadFull(r.R, page.Data); err != nil {
+		return OggPage{}, unexpectedEOF(err)
+	}
+
+	binary.LittleEndian.PutUint32(h[22:], 0)
+	check := oggCRC(0, h[:])
+	check = oggCRC(check, page.Segments)
+	check = oggCRC(check, page.Data)
+	if check != crc {
+		return OggPage{}, ErrOggCRC
+	}
+	return page, nil
+}
+
+// ReadPacket returns next packet and granule of page where it ends.
+// Granule is OggGranuleNone if other packets end on same page after it.
+// Packet is valid until next read
+func (r *OggReader) ReadPacket() ([]byte, uint64, error) {
+	r.packet = r.packet[:0]
+	for {
+		for r.segIndex < len(r.page.Segments) {
+			s := int(r.page.Segments[r.segIndex])
+			r.packet = append(r.packet, r.page.Data[r.dataIndex:r.dataIndex+s]...)
+			r.segIndex++
+			r.dataIndex += s
+			if s < 255 {
+				granule := OggGranuleNone
+				if r.lastPacketInPage() {
+					granule = r.page.Granule
+				}
+				return r.packet, granule, nil
+			}
+		}
+
+		if r.eos {
+			return nil, 0, io.EOF
+		}
+		if err := r.nextPage(); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+func (r *OggReader) lastPacketInPage() bool {
+	for _, s := range r.page.Segments[r.segIndex:] {
+		if s < 255 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *OggReader) nextPage() error {
+	for {
+		page, err := r.ReadPage()
+		if err != nil {
+			return err
+		}
+		if !r.started {
+			r.started = true
+			r.serial = page.Serial
+		}
+		if page.Serial != r.serial {
+			continue
+		}
+
+		r.page = page
+		r.segIndex = 0
+		r.dataIndex = 0
+		r.eos = page.HeaderType&OggHeaderEOS != 0
+		if page.HeaderType&OggHeaderContinued == 0 && len(r.packet) > 0 {
+			// Continued packet is lost
+			r.packet = r.packet[:0]
+		}
+		return nil
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,394 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+)
+
+const (
+	// OggOpusSampleRate is rate of Ogg Opus granule positions and pre-skip
+	OggOpusSampleRate = 48000
+)
+
+var (
+	// OggOpusVendor is vendor string written in OpusTags
+	OggOpusVendor = "diago"
+	// OggOpusEncoderPreSkip is pre-skip of encoded audio. It matches libopus encoder lookahead
+	OggOpusEncoderPreSkip = 312
+)
+
+// OpusHead is identification header of Ogg Opus stream (RFC 7845)
+type OpusHead struct {
+	Version         uint8
+	Channels        uint8
+	PreSkip         uint16
+	InputSampleRate uint32
+	OutputGain      int16
+	// MappingFamily 0 is only supported for reading, which is mono or stereo.
+	// Other families are written with channel mapping table
+	MappingFamily uint8
+	// StreamCount, CoupledCount and ChannelMapping are channel mapping table of families other than 0
+	StreamCount    uint8
+	CoupledCount   uint8
+	ChannelMapping []byte
+}
+
+func (h *OpusHead) Marshal() []byte {
+	b := []byte("OpusHead")
+	b = append(b, h.Version, h.Channels)
+	b = binary.LittleEndian.AppendUint16(b, h.PreSkip)
+	b = binary.LittleEndian.AppendUint32(b, h.InputSampleRate)
+	b = binary.LittleEndian.AppendUint16(b, uint16(h.OutputGain))
+	b = append(b, h.MappingFamily)
+	if h.MappingFamily != 0 {
+		b = append(b, h.StreamCount, h.CoupledCount)
+		b = append(b, h.ChannelMapping...)
+	}
+	return b
+}
+
+func (h *OpusHead) Unmarshal(b []byte) error {
+	if len(b) < 19 || string(b[:8]) != "OpusHead" {
+		return fmt.Errorf("not an OpusHead packet")
+	}
+	h.Version = b[8]
+	if h.Version>>4 != 0 {
+		return fmt.Errorf("unsupported OpusHead version %d", h.Version)
+	}
+	h.Channels = b[9]
+	h.PreSkip = binary.LittleEndian.Uint16(b[10:])
+	h.InputSampleRate = binary.LittleEndian.Uint32(b[12:])
+	h.OutputGain = int16(binary.LittleEndian.Uint16(b[16:]))
+	h.MappingFamily = b[18]
+	if h.MappingFamily != 0 || h.Channels == 0 || h.Channels > 2 {
+		return fmt.Errorf("unsupported opus channel mapping family=%d channels=%d", h.MappingFamily, h.Channels)
+	}
+	return nil
+}
+
+// OpusTags is comment header of Ogg Opus stream
+type OpusTags struct {
+	Vendor string
+	// Comments are in form NAME=value
+	Comments []string
+}
+
+func (t *OpusTags) Marshal() []byte {
+	b := []byte("OpusTags")
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(t.Vendor)))
+	b = append(b, t.Vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(t.Comments)))
+	for _, c := range t.Comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c)))
+		b = append(b, c...)
+	}
+	return b
+}
+
+func (t *OpusTags) Unmarshal(b []byte) error {
+	if len(b) < 8 || string(b[:8]) != "OpusTags" {
+		return fmt.Errorf("not an OpusTags packet")
+	}
+	r := bytes.NewReader(b[8:])
+	readString := func() (string, error) {
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return "", err
+		}
+		if int64(size) > int64(r.Len()) {
+			return "", io.ErrUnexpectedEOF
+		}
+		s := make([]byte, size)
+		_, err := io.ReadFull(r, s)
+		return string(s), err
+	}
+
+	var err error
+	if t.Vendor, err = readString(); err != nil {
+		return fmt.Errorf("invalid OpusTags vendor: %w", err)
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return fmt.Errorf("invalid OpusTags: %w", err)
+	}
+	t.Comments = t.Comments[:0]
+	for i := uint32(0); i < count; i++ {
+		c, err := readString()
+		if err != nil {
+			return fmt.Errorf("invalid OpusTags comment: %w", err)
+		}
+		t.Comments = append(t.Comments, c)
+	}
+	return nil
+}
+
+// OpusPacketSamples returns number of samples in opus packet at 48000 sample rate (RFC 6716 3.1)
+func OpusPacketSamples(packet []byte) (int, error) {
+	if len(packet) == 0 {
+		return 0, fmt.Errorf("empty opus packet")
+	}
+	toc := packet[0]
+	config := toc >> 3
+
+	var frameSamples int
+	switch {
+	case config < 12:
+		// SILK 10, 20, 40, 60 ms
+		frameSamples = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16:
+		// Hybrid 10, 20 ms
+		frameSamples = []int{480, 960}[config%2]
+	default:
+		// CELT 2.5, 5, 10, 20 ms
+		frameSamples = []int{120, 240, 480, 960}[config%4]
+	}
+
+	frames := 1
+	switch toc & 0x3 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, fmt.Errorf("invalid opus packet with frame count missing")
+		}
+		frames = int(packet[1] & 0x3F)
+	}
+	return frames * frameSamples, nil
+}
+
+// OggOpusWriter writes opus packets to Ogg Opus stream.
+// Headers are written on first packet or Close
+type OggOpusWriter struct {
+	Head OpusHead
+	Tags OpusTags
+
+	ogg            *OggWriter
+	granule        uint64
+	headersWritten bool
+}
+
+// NewOggOpusWriter creates writer for opus packets of channels and original input sample rate
+func NewOggOpusWriter(w io.Writer, channels int, inputSampleRate int) *OggOpusWriter {
+	return &OggOpusWriter{
+		Head: OpusHead{
+			Version:         1,
+			Channels:        uint8(channels),
+			InputSampleRate: uint32(inputSampleRate),
+		},
+		Tags: OpusTags{Vendor: OggOpusVendor},
+		ogg:  NewOggWriter(w, rand.Uint32()),
+	}
+}
+
+// Write writes single opus packet
+func (w *OggOpusWriter) Write(packet []byte) (int, error) {
+	samples, err := OpusPacketSamples(packet)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.writeHeaders(); err != nil {
+		return 0, err
+	}
+
+	w.granule += uint64(samples)
+	if err := w.ogg.WritePacket(packet, w.granule); err != nil {
+		return 0, err
+	}
+	return len(packet), nil
+}
+
+func (w *OggOpusWriter) writeHeaders() error {
+	if w.headersWritten {
+		return nil
+	}
+	w.headersWritten = true
+	w.granule = uint64(w.Head.PreSkip)
+
+	// Each header must be on own page
+	if err := w.ogg.WritePacket(w.Head.Marshal(), 0); err != nil {
+		return err
+	}
+	if err := w.ogg.Flush(); err != nil {
+		return err
+	}
+	if err := w.ogg.WritePacket(w.Tags.Marshal(), 0); err != nil {
+		return err
+	}
+	return w.ogg.Flush()
+}
+
+// Flush writes buffered packets
+func (w *OggOpusWriter) Flush() error {
+	return w.ogg.Flush()
+}
+
+// Close writes last page. Underlying writer is not closed
+func (w *OggOpusWriter) Close() error {
+	if err := w.writeHeaders(); err != nil {
+		return err
+	}
+	return w.ogg.Close()
+}
+
+// OggOpusReader reads opus packets from Ogg Opus stream
+type OggOpusReader struct {
+	Head OpusHead
+	Tags OpusTags
+
+	ogg *OggReader
+}
+
+func NewOggOpusReader(r io.Reader) *OggOpusReader {
+	return &OggOpusReader{ogg: NewOggReader(r)}
+}
+
+// ReadHeaders reads OpusHead and OpusTags
+func (r *OggOpusReader) ReadHeaders() error {
+	packet, _, err := r.ogg.ReadPacket()
+	if err != nil {
+		return err
+	}
+	if err := r.Head.Unmarshal(packet); err != nil {
+		return err
+	}
+
+	packet, _, err = r.ogg.ReadPacket()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	return r.Tags.Unmarshal(packet)
+}
+
+// Read reads single opus packet. Buffer must be large enough for packet
+func (r *OggOpusReader) Read(b []byte) (int, error) {
+	packet, _, err := r.ogg.ReadPacket()
+	if err != nil {
+		return 0, err
+	}
+	if len(packet) > len(b) {
+		return 0, io.ErrShortBuffer
+	}
+	return copy(b, packet), nil
+}
+
+// PCMReader returns reader decoding packets to 16 bit PCM at 48000 sample rate with Head channels.
+// Pre-skip samples are dropped. Headers must be read before
+func (r *OggOpusReader) PCMReader() (io.Reader, error) {
+	channels := int(r.Head.Channels)
+	// Maximum opus packet is 120 ms
+	samplesSize := OggOpusSampleRate * 120 / 1000 * channels * 2
+	dec := OpusDecoder{}
+	if err := dec.Init(OggOpusSampleRate, channels, samplesSize); err != nil {
+		return nil, err
+	}
+	return &oggOpusPCMReader{
+		packets: r,
+		dec:     &dec,
+		skip:    int(r.Head.PreSkip) * channels * 2,
+		buf:     make([]byte, samplesSize),
+		pcm:     make([]byte, samplesSize),
+	}, nil
+}
+
+type oggOpusPCMReader struct {
+	packets io.Reader
+	dec     *OpusDecoder
+	skip    int
+	buf     []byte
+	pcm     []byte
+	unread  []byte
+}
+
+func (r *oggOpusPCMReader) Read(b []byte) (int, error) {
+	for len(r.unread) == 0 {
+		n, err := r.packets.Read(r.buf)
+		if err != nil {
+			return 0, err
+		}
+		n, err = r.dec.DecodeTo(r.pcm, r.buf[:n])
+		if err != nil {
+			return 0, err
+		}
+		r.unread = r.pcm[:n]
+
+		skip := min(r.skip, len(r.unread))
+		r.unread = r.unread[skip:]
+		r.skip -= skip
+	}
+
+	n := copy(b, r.unread)
+	r.unread = r.unread[n:]
+	return n, nil
+}
+
+// OggOpusPCMWriter encodes 16 bit PCM in 20 ms frames and writes Ogg Opus stream.
+// Opus encoder requires building with with_opus_c tag
+type OggOpusPCMWriter struct {
+	// Options of opus encoder applied on Init
+	Options OpusEncoderOptions
+
+	ogg   *OggOpusWriter
+	enc   OpusEncoder
+	frame []byte
+	n     int
+	data  []byte
+}
+
+// Init creates encoder for PCM with sample rate 8000, 12000, 16000, 24000 or 48000 and mono or stereo channels
+func (w *OggOpusPCMWriter) Init(ogg io.Writer, sampleRate int, numChannels int) error {
+	frameSize := sampleRate / 50 * numChannels * 2
+	w.enc.Options = w.Options
+	if err := w.enc.Init(sampleRate, numChannels, frameSize); err != nil {
+		return err
+	}
+
+	w.ogg = NewOggOpusWriter(ogg, numChannels, sampleRate)
+	w.ogg.Head.PreSkip = uint16(OggOpusEncoderPreSkip)
+	w.frame = make([]byte, frameSize)
+	w.data = make([]byte, 4000)
+	return nil
+}
+
+func (w *OggOpusPCMWriter) Write(lpcm []byte) (int, error) {
+	written := 0
+	for len(lpcm) > 0 {
+		n := copy(w.frame[w.n:], lpcm)
+		w.n += n
+		lpcm = lpcm[n:]
+		written += n
+		if w.n < len(w.frame) {
+			break
+		}
+		if err := w.encodeFrame(); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (w *OggOpusPCMWriter) encodeFrame() error {
+	w.n = 0
+	n, err := w.enc.EncodeTo(w.data, w.frame)
+	if err != nil {
+		return err
+	}
+	_, err = w.ogg.Write(w.data[:n])
+	return err
+}
+
+// Close encodes remaining PCM padded with silence and writes last page
+func (w *OggOpusPCMWriter) Close() error {
+	if w.n > 0 {
+		clear(w.frame[w.n:])
+		if err := w.encodeFrame(); err != nil {
+			return err
+		}
+	}
+	return w.ogg.Close()
+}
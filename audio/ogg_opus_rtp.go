@@ -0,0 +1,334 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+const (
+	// oggOpusRTPMaxGap is biggest timestamp jump treated as gap in stream. Bigger is new stream
+	oggOpusRTPMaxGap = 60 * OggOpusSampleRate
+	// oggOpusRTPFrame is duration of lost frames written for gap in both channels
+	oggOpusRTPFrame = OggOpusSampleRate / 50
+)
+
+// OggOpusRTPWriter writes opus RTP payloads of two channels to Ogg Opus stream without decoding.
+// Each channel is mono opus stream of multistream packet (channel mapping family 1).
+// Payloads are aligned by RTP timestamps. Channel without payload and gaps in timestamps are written as lost frames,
+// so that granule position follows RTP time and decoder conceals or plays silence.
+// Channel without audio is waited up to RecordingMaxLag
+//
+// Experimental
+type OggOpusRTPWriter struct {
+	mu       sync.Mutex
+	ogg      *OggOpusWriter
+	channels [2]oggOpusRTPChannel
+	// pos is written samples
+	pos    uint64
+	maxLag uint64
+	paused bool
+	buf    []byte
+}
+
+type oggOpusRTPChannel struct {
+	queue   []oggOpusRTPPacket
+	started bool
+	lastTs  uint32
+	lastPos uint64
+	lastEnd uint64
+}
+
+type oggOpusRTPPacket struct {
+	payload []byte
+	pos     uint64
+	samples uint64
+}
+
+func NewOggOpusRTPWriter(w io.Writer) *OggOpusRTPWriter {
+	ogg := NewOggOpusWriter(w, 2, OggOpusSampleRate)
+	ogg.Head.MappingFamily = 1
+	ogg.Head.StreamCount = 2
+	ogg.Head.ChannelMapping = []byte{0, 1}
+	return &OggOpusRTPWriter{
+		ogg:    ogg,
+		maxLag: uint64(RecordingMaxLag.Seconds() * OggOpusSampleRate),
+	}
+}
+
+// WriteRTP writes opus payload of channel 0 or 1 with RTP timestamp. Opus RTP clock rate is always 48000
+func (w *OggOpusRTPWriter) WriteRTP(ch int, payload []byte, timestamp uint32) error {
+	samples, err := OpusPacketSamples(payload)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	c, other := &w.channels[ch], &w.channels[1-ch]
+	diff := int64(int32(timestamp - c.lastTs))
+	if c.started && diff <= 0 {
+		// Duplicate or reordered after newer is buffered
+		return nil
+	}
+
+	pos := c.lastPos + uint64(diff)
+	if !c.started || diff > oggOpusRTPMaxGap {
+		// New stream starts now, which is end of other channel if it is ahead
+		pos = max(w.pos, c.lastEnd)
+		if other.started && other.lastEnd > pos+uint64(samples) {
+			pos = other.lastEnd - uint64(samples)
+		}
+	}
+	c.started = true
+	c.lastTs = timestamp
+	c.lastPos = pos
+	c.lastEnd = pos + uint64(samples)
+
+	if c.lastEnd <= w.pos {
+		// Late, as other channel is already written
+		return nil
+	}
+	c.queue = append(c.queue, oggOpusRTPPacket{payload: slices.Clone(payload), pos: pos, samples: uint64(samples)})
+	return w.flush(false)
+}
+
+// Pause writes lost frames instead of payloads until Resume
+func (w *OggOpusRTPWriter) Pause() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused = true
+}
+
+func (w *OggOpusRTPWriter) Resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused = false
+}
+
+// Close writes buffered payloads and last page. Underlying writer is not closed
+func (w *OggOpusRTPWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	return w.ogg.Close()
+}
+
+// flush writes packets while both channels are known or other channel lags too much
+func (w *OggOpusRTPWriter) flush(final bool) error {
+	for {
+		h0, h1 := w.head(0), w.head(1)
+		if h0 == nil && h1 == nil {
+			return nil
+		}
+		// Payload starting in next frame is aligned to current position
+		r0 := h0 != nil && h0.pos < w.pos+oggOpusRTPFrame
+		r1 := h1 != nil && h1.pos < w.pos+oggOpusRTPFrame
+		waiting := !final && (h0 == nil || h1 == nil) && max(w.channels[0].lastEnd, w.channels[1].lastEnd) < w.pos+w.maxLag
+
+		switch {
+		case r0 && r1 && h0.samples == h1.samples:
+			w.pop(0)
+			w.pop(1)
+			if err := w.write(h0.payload, h1.payload, h0.samples); err != nil {
+				return err
+			}
+		case r0 && r1:
+			// Streams must have same duration. Payload of other channel is lost
+			w.pop(0)
+			if err := w.write(h0.payload, opusLostPacket(h0.payload), h0.samples); err != nil {
+				return err
+			}
+			if h1.pos+h1.samples <= w.pos {
+				w.pop(1)
+			}
+		case r0 || r1:
+			if waiting {
+				return nil
+			}
+			if r0 {
+				w.pop(0)
+				if err := w.write(h0.payload, opusLostPacket(h0.payload), h0.samples); err != nil {
+					return err
+				}
+				continue
+			}
+			w.pop(1)
+			if err := w.write(opusLostPacket(h1.payload), h1.payload, h1.samples); err != nil {
+				return err
+			}
+		default:
+			if waiting {
+				return nil
+			}
+			// Gap in both channels
+			lost := opusLostPacket([]byte{0xF8})
+			if err := w.write(lost, lost, oggOpusRTPFrame); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *OggOpusRTPWriter) head(ch int) *oggOpusRTPPacket {
+	if q := w.channels[ch].queue; len(q) > 0 {
+		return &q[0]
+	}
+	return nil
+}
+
+func (w *OggOpusRTPWriter) pop(ch int) {
+	c := &w.channels[ch]
+	c.queue = c.queue[1:]
+	if len(c.queue) == 0 {
+		c.queue = nil
+	}
+}
+
+// write writes multistream packet where first stream uses self delimiting framing (RFC 6716 Appendix B)
+func (w *OggOpusRTPWriter) write(p0 []byte, p1 []byte, samples uint64) error {
+	if w.paused {
+		p0, p1 = opusLostPacket(p0), opusLostPacket(p1)
+	}
+
+	buf, err := opusSelfDelimitedAppend(w.buf[:0], p0)
+	if err != nil {
+		return err
+	}
+	w.buf = append(buf, p1...)
+	if _, err := w.ogg.Write(w.buf); err != nil {
+		return err
+	}
+	w.pos += samples
+	return nil
+}
+
+// opusLostPacket returns packet with zero length frames of same duration as packet.
+// Decoder handles them as lost frames (RFC 6716 3.2.1)
+func opusLostPacket(packet []byte) []byte {
+	frames := 1
+	switch packet[0] & 0x3 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		frames = int(packet[1] & 0x3F)
+	}
+	// Code 3 CBR packet with frame count and no data
+	return []byte{packet[0] | 0x3, byte(frames)}
+}
+
+// opusSelfDelimitedAppend appends packet in self delimiting framing, which adds size of last frame
+func opusSelfDelimitedAppend(dst []byte, packet []byte) ([]byte, error) {
+	if len(packet) == 0 {
+		return nil, fmt.Errorf("empty opus packet")
+	}
+	toc, data := packet[0], packet[1:]
+	errInvalid := fmt.Errorf("invalid opus packet")
+
+	switch toc & 0x3 {
+	case 0:
+		dst = append(dst, toc)
+		dst = appendOpusFrameLen(dst, len(data))
+		return append(dst, data...), nil
+	case 1:
+		if len(data)%2 != 0 {
+			return nil, errInvalid
+		}
+		dst = append(dst, toc)
+		dst = appendOpusFrameLen(dst, len(data)/2)
+		return append(dst, data...), nil
+	case 2:
+		n1, size, ok := readOpusFrameLen(data)
+		if !ok || size+n1 > len(data) {
+			return nil, errInvalid
+		}
+		dst = append(dst, toc)
+		dst = append(dst, data[:size]...)
+		dst = appendOpusFrameLen(dst, len(data)-size-n1)
+		return append(dst, data[size:]...), nil
+	}
+
+	// Code 3 has frame count byte, optional padding and frame lengths if VBR
+	if len(data) < 1 {
+		return nil, errInvalid
+	}
+	count := data[0]
+	frames := int(count & 0x3F)
+	if frames == 0 {
+		return nil, errInvalid
+	}
+	off := 1
+	padding := 0
+	if count&0x40 > 0 {
+		for {
+			if off >= len(data) {
+				return nil, errInvalid
+			}
+			p := int(data[off])
+			off++
+			if p < 255 {
+				padding += p
+				break
+			}
+			padding += 254
+		}
+	}
+
+	lengths := 0
+	if count&0x80 > 0 {
+		// VBR has lengths of all frames except last
+		for i := 0; i < frames-1; i++ {
+			n, size, ok := readOpusFrameLen(data[off:])
+			if !ok {
+				return nil, errInvalid
+			}
+			off += size
+			lengths += n
+		}
+	}
+
+	framesData := len(data) - off - padding
+	if framesData < lengths {
+		return nil, errInvalid
+	}
+
+	dst = append(dst, toc)
+	dst = append(dst, data[:off]...)
+	if count&0x80 > 0 {
+		dst = appendOpusFrameLen(dst, framesData-lengths)
+	} else {
+		if framesData%frames != 0 {
+			return nil, errInvalid
+		}
+		dst = appendOpusFrameLen(dst, framesData/frames)
+	}
+	return append(dst, data[off:]...), nil
+}
+
+func appendOpusFrameLen(dst []byte, n int) []byte {
+	if n < 252 {
+		return append(dst, byte(n))
+	}
+	first := 252 + n&0x3
+	return append(dst, byte(first), byte((n-first)>>2))
+}
+
+func readOpusFrameLen(data []byte) (n int, size int, ok bool) {
+	if len(data) < 1 {
+		return 0, 0, false
+	}
+	if data[0] < 252 {
+		return int(data[0]), 1, true
+	}
+	if len(data) < 2 {
+		return 0, 0, false
+	}
+	return int(data[1])*4 + int(data[0]), 2, true
+}
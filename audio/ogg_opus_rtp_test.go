@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpusSelfDelimited(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		packet   []byte
+		expected []byte
+	}{
+		{"Code0", []byte{0xf8, 1, 2, 3}, []byte{0xf8, 3, 1, 2, 3}},
+		{"Code1", []byte{0xf9, 1, 2, 3, 4}, []byte{0xf9, 2, 1, 2, 3, 4}},
+		{"Code2", []byte{0xfa, 1, 9, 1, 2}, []byte{0xfa, 1, 2, 9, 1, 2}},
+		{"Code3CBR", []byte{0xfb, 0x02, 1, 2, 3, 4}, []byte{0xfb, 0x02, 2, 1, 2, 3, 4}},
+		{"Code3VBRPadding", []byte{0xfb, 0xc2, 1, 1, 9, 1, 2, 0}, []byte{0xfb, 0xc2, 1, 1, 2, 9, 1, 2, 0}},
+		{"Lost", opusLostPacket([]byte{0xf8}), []byte{0xfb, 1, 0}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := opusSelfDelimitedAppend(nil, tc.packet)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, b)
+		})
+	}
+
+	// Lengths above 251 are two bytes
+	n, size, ok := readOpusFrameLen(appendOpusFrameLen(nil, 300))
+	require.True(t, ok)
+	assert.Equal(t, 300, n)
+	assert.Equal(t, 2, size)
+
+	_, err := opusSelfDelimitedAppend(nil, []byte{0xfa, 10, 1})
+	require.Error(t, err)
+}
+
+func TestOggOpusRTPWriter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewOggOpusRTPWriter(buf)
+
+	// Channel 0 misses 2 packets and channel 1 has other timestamp base
+	p0, p1 := []byte{0xf8, 1, 2, 3}, []byte{0xf8, 4, 5}
+	for _, ts := range []uint32{1000, 1960, 2920} {
+		require.NoError(t, w.WriteRTP(0, p0, ts))
+		require.NoError(t, w.WriteRTP(1, p1, ts+4000))
+	}
+	require.NoError(t, w.WriteRTP(1, p1, 7880))
+	require.NoError(t, w.WriteRTP(1, p1, 8840))
+	require.NoError(t, w.WriteRTP(0, p0, 5800))
+	require.NoError(t, w.WriteRTP(1, p1, 9800))
+	// Channel without other is written on close
+	require.NoError(t, w.WriteRTP(0, p0, 6760))
+	require.NoError(t, w.Close())
+
+	r := NewOggReader(bytes.NewReader(buf.Bytes()))
+	headPacket, _, err := r.ReadPacket()
+	require.NoError(t, err)
+	require.Len(t, headPacket, 23)
+	assert.Equal(t, "OpusHead", string(headPacket[:8]))
+	// Channels, mapping family 1 with 2 uncoupled streams
+	assert.Equal(t, byte(2), headPacket[9])
+	assert.Equal(t, []byte{1, 2, 0, 0, 1}, headPacket[18:])
+	_, _, err = r.ReadPacket()
+	require.NoError(t, err)
+
+	both := []byte{0xf8, 3, 1, 2, 3, 0xf8, 4, 5}
+	lost0 := []byte{0xfb, 1, 0, 0xf8, 4, 5}
+	lost1 := []byte{0xf8, 3, 1, 2, 3, 0xfb, 1}
+	expected := [][]byte{both, both, both, lost0, lost0, both, lost1}
+
+	packets := [][]byte{}
+	var granule uint64
+	for {
+		p, g, err := r.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		packets = append(packets, bytes.Clone(p))
+		if g != OggGranuleNone {
+			granule = g
+		}
+	}
+	assert.Equal(t, expected, packets)
+	assert.Equal(t, uint64(7*960), granule)
+
+	t.Run("Gap", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		w := NewOggOpusRTPWriter(buf)
+		require.NoError(t, w.WriteRTP(0, p0, 0))
+		require.NoError(t, w.WriteRTP(1, p1, 0))
+		// Both channels are silent for 60ms
+		require.NoError(t, w.WriteRTP(0, p0, 4*960))
+		require.NoError(t, w.WriteRTP(1, p1, 4*960))
+		require.NoError(t, w.Close())
+
+		r := NewOggReader(bytes.NewReader(buf.Bytes()))
+		var granule uint64
+		packets := 0
+		for {
+			_, g, err := r.ReadPacket()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			packets++
+			if g != OggGranuleNone {
+				granule = g
+			}
+		}
+		// Headers and 5 audio packets
+		assert.Equal(t, 2+5, packets)
+		assert.Equal(t, uint64(5*960), granule)
+	})
+}
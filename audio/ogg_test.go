@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOggWriterReader(t *testing.T) {
+	packets := [][]byte{
+		bytes.Repeat([]byte{1}, 10),
+		bytes.Repeat([]byte{2}, 255),
+		{},
+		bytes.Repeat([]byte{3}, 70000), // spans pages
+		bytes.Repeat([]byte{4}, 510),
+	}
+	for i := 0; i < 100; i++ {
+		packets = append(packets, bytes.Repeat([]byte{byte(i)}, 100))
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w := NewOggWriter(buf, 1234)
+	for i, p := range packets {
+		require.NoError(t, w.WritePacket(p, uint64(i+1)))
+	}
+	require.NoError(t, w.Close())
+
+	t.Run("Pages", func(t *testing.T) {
+		r := NewOggReader(bytes.NewReader(buf.Bytes()))
+		var pages []OggPage
+		for {
+			page, err := r.ReadPage()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			pages = append(pages, page)
+		}
+		require.Greater(t, len(pages), 3)
+
+		for i, page := range pages {
+			assert.Equal(t, uint32(1234), page.Serial)
+			assert.Equal(t, uint32(i), page.Sequence)
+			assert.LessOrEqual(t, len(page.Segments), 255)
+		}
+		assert.Equal(t, byte(OggHeaderBOS), pages[0].HeaderType)
+		assert.Equal(t, uint64(3), pages[0].Granule)
+		// Large packet is on new page and continues on next page
+		assert.Equal(t, OggGranuleNone, pages[1].Granule, "no packet ends on page")
+		assert.Equal(t, byte(OggHeaderContinued), pages[2].HeaderType&OggHeaderContinued)
+		assert.Equal(t, byte(OggHeaderEOS), pages[len(pages)-1].HeaderType&OggHeaderEOS)
+		assert.Equal(t, uint64(len(packets)), pages[len(pages)-1].Granule)
+	})
+
+	t.Run("Packets", func(t *testing.T) {
+		r := NewOggReader(bytes.NewReader(buf.Bytes()))
+		for i, p := range packets {
+			packet, _, err := r.ReadPacket()
+			require.NoError(t, err, i)
+			require.Equal(t, p, packet, i)
+		}
+		_, _, err := r.ReadPacket()
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("CRC", func(t *testing.T) {
+		data := bytes.Clone(buf.Bytes())
+		data[40] ^= 0xff
+		r := NewOggReader(bytes.NewReader(data))
+		_, err := r.ReadPage()
+		require.ErrorIs(t, err, ErrOggCRC)
+	})
+}
+
+func TestOpusPacketSamples(t *testing.T) {
+	for _, tc := range []struct {
+		packet  []byte
+		samples int
+	}{
+		{[]byte{0x08}, 960},        // SILK NB 20 ms
+		{[]byte{0x18}, 2880},       // SILK NB 60 ms
+		{[]byte{0x78}, 960},        // Hybrid FB 20 ms
+		{[]byte{0xf8}, 960},        // CELT FB 20 ms
+		{[]byte{0x80}, 120},        // CELT NB 2.5 ms
+		{[]byte{0xf9}, 1920},       // 2 frames
+		{[]byte{0xfb, 0x03}, 2880}, // code 3 with 3 frames
+	} {
+		samples, err := OpusPacketSamples(tc.packet)
+		require.NoError(t, err)
+		assert.Equal(t, tc.samples, samples, "toc=%x", tc.packet[0])
+	}
+
+	_, err := OpusPacketSamples(nil)
+	require.Error(t, err)
+}
+
+func TestOggOpusWriterReader(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewOggOpusWriter(buf, 2, 8000)
+	w.Head.PreSkip = 312
+	w.Tags.Comments = []string{"TITLE=test"}
+
+	packets := [][]byte{{0xf8, 1, 2, 3}, {0xf8, 4, 5}, {0xf9, 6}}
+	for _, p := range packets {
+		n, err := w.Write(p)
+		require.NoError(t, err)
+		require.Equal(t, len(p), n)
+	}
+	require.NoError(t, w.Close())
+
+	// Headers are on own pages
+	ogg := NewOggReader(bytes.NewReader(buf.Bytes()))
+	head, err := ogg.ReadPage()
+	require.NoError(t, err)
+	require.Len(t, head.Segments, 1)
+	tags, err := ogg.ReadPage()
+	require.NoError(t, err)
+	require.Len(t, tags.Segments, 1)
+	audioPage, err := ogg.ReadPage()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(312+960+960+1920), audioPage.Granule)
+
+	r := NewOggOpusReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, r.ReadHeaders())
+	assert.Equal(t, w.Head, r.Head)
+	assert.Equal(t, OggOpusVendor, r.Tags.Vendor)
+	assert.Equal(t, []string{"TITLE=test"}, r.Tags.Comments)
+
+	packet := make([]byte, 100)
+	for _, p := range packets {
+		n, err := r.Read(packet)
+		require.NoError(t, err)
+		assert.Equal(t, p, packet[:n])
+	}
+	_, err = r.Read(packet)
+	require.ErrorIs(t, err, io.EOF)
+}
@@ -12,6 +12,8 @@ import (
 // This is placeholder for opus encoder. Opus is used as C binding.
 
 type OpusEncoder struct {
+	// Options are applied on Init
+	Options OpusEncoderOptions
 }
 
 func (enc *OpusEncoder) Init(sampleRate int, numChannels int, samplesSize int) error {
@@ -32,3 +34,7 @@ func (enc *OpusDecoder) Init(sampleRate int, numChannels int, samplesSize int) e
 func (dec *OpusDecoder) DecodeTo(lpcm []byte, data []byte) (int, error) {
 	return 0, fmt.Errorf("not supported")
 }
+
+func (dec *OpusDecoder) ConcealTo(lpcm []byte, next []byte) (int, error) {
+	return 0, fmt.Errorf("not supported")
+}
@@ -13,6 +13,8 @@ import (
 
 type OpusEncoder struct {
 	opus.Encoder
+	// Options are applied on Init
+	Options     OpusEncoderOptions
 	pcmInt16    []int16
 	numChannels int
 }
@@ -26,9 +28,58 @@ func (enc *OpusEncoder) Init(sampleRate int, numChannels int, samplesSize int) e
 		return fmt.Errorf("failed to create opus decoder: %w", err)
 	}
 
+	if err := enc.applyOptions(enc.Options); err != nil {
+		return fmt.Errorf("failed to configure opus encoder: %w", err)
+	}
+	return nil
+}
+
+func (enc *OpusEncoder) applyOptions(opts OpusEncoderOptions) error {
+	if opts.Bitrate > 0 {
+		if err := enc.SetBitrate(opts.Bitrate); err != nil {
+			return err
+		}
+	}
+
+	if opts.FEC {
+		if err := enc.SetInBandFEC(true); err != nil {
+			return err
+		}
+		if err := enc.SetPacketLossPerc(opts.PacketLossPerc); err != nil {
+			return err
+		}
+	}
+
+	if opts.DTX {
+		if err := enc.SetDTX(true); err != nil {
+			return err
+		}
+	}
+
+	if opts.MaxPlaybackRate > 0 {
+		if err := enc.SetMaxBandwidth(opusBandwidth(opts.MaxPlaybackRate)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// opusBandwidth maps maxplaybackrate to audio bandwidth
+// https://datatracker.ietf.org/doc/html/rfc7587#section-3.1.1
+func opusBandwidth(playbackRate int) opus.Bandwidth {
+	switch {
+	case playbackRate <= 8000:
+		return opus.Narrowband
+	case playbackRate <= 12000:
+		return opus.Mediumband
+	case playbackRate <= 16000:
+		return opus.Wideband
+	case playbackRate <= 24000:
+		return opus.SuperWideband
+	}
+	return opus.Fullband
+}
+
 func (enc *OpusEncoder) EncodeTo(data []byte, lpcm []byte) (int, error) {
 	n, err := samplesByteToInt16(lpcm, enc.pcmInt16)
 	if err != nil {
@@ -47,11 +98,14 @@ type OpusDecoder struct {
 	opus.Decoder
 	pcmInt16    []int16
 	numChannels int
+	frameSize   int
 }
 
 func (enc *OpusDecoder) Init(sampleRate int, numChannels int, samplesSize int) error {
 	enc.numChannels = numChannels
 	enc.pcmInt16 = make([]int16, samplesSize)
+	// samplesSize is 16 bit PCM size in bytes
+	enc.frameSize = samplesSize / 2
 	if err := enc.Decoder.Init(sampleRate, numChannels); err != nil {
 		return fmt.Errorf("failed to create opus decoder: %w", err)
 	}
@@ -75,3 +129,21 @@ func (dec *OpusDecoder) DecodeTo(lpcm []byte, data []byte) (int, error) {
 	n, err := samplesInt16ToBytes(pcm, lpcm)
 	return n, err
 }
+
+// ConcealTo generates single lost frame. If next packet is passed, inband FEC is used
+// which falls back to PLC in case next packet has no FEC data.
+func (dec *OpusDecoder) ConcealTo(lpcm []byte, next []byte) (int, error) {
+	// Opus calculates frame size from capacity, so it must be exact
+	pcm := dec.pcmInt16[:dec.frameSize:dec.frameSize]
+
+	var err error
+	if len(next) > 0 {
+		err = dec.Decoder.DecodeFEC(next, pcm)
+	} else {
+		err = dec.Decoder.DecodePLC(pcm)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return samplesInt16ToBytes(pcm, lpcm)
+}
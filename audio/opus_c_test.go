@@ -152,3 +152,30 @@ func TestOpusDecodingDifferentBandwith(t *testing.T) {
 		runDecodeTest(t, 16000)
 	})
 }
+
+func TestOggOpusPCMWriter(t *testing.T) {
+	pcm := testGeneratePCM16(48000)
+	buf := bytes.NewBuffer(nil)
+
+	w := OggOpusPCMWriter{}
+	require.NoError(t, w.Init(buf, 48000, 1))
+	for i := 0; i < 10; i++ {
+		_, err := w.Write(pcm)
+		require.NoError(t, err)
+	}
+	// Partial frame is padded on close
+	_, err := w.Write(pcm[:100])
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r := NewOggOpusReader(buf)
+	require.NoError(t, r.ReadHeaders())
+	assert.Equal(t, uint8(1), r.Head.Channels)
+	assert.Equal(t, uint16(OggOpusEncoderPreSkip), r.Head.PreSkip)
+
+	dec, err := r.PCMReader()
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(dec)
+	require.NoError(t, err)
+	assert.Equal(t, 11*len(pcm)-OggOpusEncoderPreSkip*2, len(decoded))
+}
@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"github.com/vertan/diago/media/sdp"
+)
+
+var (
+	// OpusFECPacketLossPerc is expected packet loss percentage passed to encoder when FEC is negotiated.
+	// Encoder does not produce FEC data if this is 0
+	OpusFECPacketLossPerc = 10
+)
+
+// OpusEncoderOptions are applied on opus encoder Init.
+// Zero values leave encoder defaults
+type OpusEncoderOptions struct {
+	// Bitrate in bits per second
+	Bitrate int
+	// FEC enables inband forward error correction
+	FEC bool
+	// PacketLossPerc is expected packet loss. Needed for FEC
+	PacketLossPerc int
+	// DTX enables discontinuous transmission
+	DTX bool
+	// MaxPlaybackRate limits encoded audio bandwidth
+	MaxPlaybackRate int
+}
+
+// OpusEncoderOptionsFromFmtp builds encoder options from remote (negotiated) fmtp parameters.
+// Remote fmtp are receiver preferences, so our encoder should follow them
+// https://datatracker.ietf.org/doc/html/rfc7587#section-6.1
+func OpusEncoderOptionsFromFmtp(f sdp.OpusFmtp) OpusEncoderOptions {
+	opts := OpusEncoderOptions{
+		Bitrate:         f.MaxAverageBitrate,
+		FEC:             f.UseInbandFEC,
+		DTX:             f.UseDTX,
+		MaxPlaybackRate: f.MaxPlaybackRate,
+	}
+	if opts.FEC {
+		opts.PacketLossPerc = OpusFECPacketLossPerc
+	}
+	return opts
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/vertan/diago/media"
 )
@@ -31,6 +32,10 @@ const (
 )
 
 var (
+	// PCMConcealMaxFrames is maximum number of lost frames that decoder reader conceals.
+	// Bigger gaps are not worth recovering
+	PCMConcealMaxFrames = 5
+
 	decoderBufPool = sync.Pool{
 		New: func() any {
 			return make([]byte, 160)
@@ -44,6 +49,11 @@ type PCMDecoder struct {
 
 	// DecoderTo Must know size in advance!
 	DecoderTo func(lpcm []byte, encoded []byte) (int, error)
+
+	// ConcealTo generates single lost frame. It is nil if codec does not support concealment.
+	// G.711 uses G711PLC and opus uses decoder PLC/FEC.
+	// next is payload received after loss and can be used for FEC. Nil means PLC only
+	ConcealTo func(lpcm []byte, next []byte) (int, error)
 }
 
 // PCM decoder is streamer implementing io.Reader. It reads from underhood reader and returns decoded codec data
@@ -64,26 +74,61 @@ func (dec *PCMDecoder) Init(codec media.Codec) error {
 
 	switch codec.PayloadType {
 	case FORMAT_TYPE_ULAW:
-		dec.DecoderTo = DecodeUlawTo
+		dec.initG711(DecodeUlawTo)
 	case FORMAT_TYPE_ALAW:
-		dec.DecoderTo = DecodeAlawTo
+		dec.initG711(DecodeAlawTo)
 	case FORMAT_TYPE_OPUS:
 		opusDec := OpusDecoder{}
 		if err := opusDec.Init(int(codec.SampleRate), codec.NumChannels, codec.Samples16()); err != nil {
 			return fmt.Errorf("failed to create opus decoder: %w", err)
 		}
 		dec.DecoderTo = opusDec.DecodeTo
+		dec.ConcealTo = opusDec.ConcealTo
 	default:
 		return fmt.Errorf("not supported codec %d", codec.PayloadType)
 	}
 	return nil
 }
 
+// initG711 sets decoder with packet loss concealment. Decoded audio is kept as history for concealment
+func (dec *PCMDecoder) initG711(decodeTo func(lpcm []byte, encoded []byte) (int, error)) {
+	plc := NewG711PLC(dec.samplesSize / 2)
+	dec.DecoderTo = func(lpcm []byte, encoded []byte) (int, error) {
+		n, err := decodeTo(lpcm, encoded)
+		if err != nil {
+			return n, err
+		}
+		plc.AddHistory(lpcm[:n])
+		return n, nil
+	}
+	dec.ConcealTo = plc.ConcealTo
+}
+
 type PCMDecoderReader struct {
 	PCMDecoder
 	Source  io.Reader
 	BufSize int
-	buf     []byte
+	// LossReader reports lost packets before last read payload.
+	// If codec supports concealment, lost frames are generated before decoded payload.
+	// By default it is set if Source implements it
+	LossReader media.RTPLossReader
+	// CNReader reports comfort noise received instead of audio. Noise frame is generated for it.
+	// By default it is set if Source implements it
+	CNReader media.RTPCNReader
+
+	noise     *ComfortNoise
+	buf       []byte
+	concealed []byte
+	unread    []byte
+
+	frameDur    time.Duration
+	noiseActive bool
+	noiseNext   time.Time
+	// Source is read in background only while comfort noise is generated
+	sourceRead  chan pcmSourceRead
+	sourceNext  chan struct{}
+	sourceStop  chan struct{}
+	sourceAsked bool
 }
 
 func NewPCMDecoderReader(codec uint8, reader io.Reader) (*PCMDecoderReader, error) {
@@ -100,23 +145,89 @@ func (d *PCMDecoderReader) Init(codec media.Codec, reader io.Reader) error {
 	if d.BufSize == 0 {
 		d.BufSize = media.RTPBufSize
 	}
+	if lr, ok := reader.(media.RTPLossReader); ok && d.LossReader == nil {
+		d.LossReader = lr
+	}
+	if cr, ok := reader.(media.RTPCNReader); ok && d.CNReader == nil {
+		d.CNReader = cr
+	}
+	d.frameDur = codec.SampleDur
+	if d.frameDur == 0 {
+		d.frameDur = 20 * time.Millisecond
+	}
 	return d.PCMDecoder.Init(codec)
 }
 
 // Read decodes and return PCM
 // NOTE: It is expected that buffer matches codec samples size.
+// In case of loss concealed frames are returned first and decoded payload is returned on next reads.
+// After comfort noise is received, Source is read in background and noise frames are returned
+// every codec frame duration until next payload arrives. Call Close when reading is done
 func (d *PCMDecoderReader) Read(b []byte) (n int, err error) {
+	if len(d.unread) > 0 {
+		n = copy(b, d.unread)
+		d.unread = d.unread[n:]
+		return n, nil
+	}
+
+	if d.sourceRead != nil {
+		return d.readPaced(b)
+	}
+
 	if d.buf == nil {
 		d.buf = make([]byte, d.BufSize)
 	}
+	return d.decode(b, d.readSource(d.buf))
+}
+
+type pcmSourceRead struct {
+	data []byte
+	err  error
+	lost int
+	cn   media.CNPayload
+	isCN bool
+}
 
-	n, err = d.Source.Read(d.buf)
+func (d *PCMDecoderReader) readSource(buf []byte) pcmSourceRead {
+	n, err := d.Source.Read(buf)
+	r := pcmSourceRead{data: buf[:n], err: err}
 	if err != nil {
+		return r
+	}
+	if d.CNReader != nil {
+		r.cn, r.isCN = d.CNReader.ReadCN()
+	}
+	if d.LossReader != nil {
+		r.lost = d.LossReader.ReadLost()
+	}
+	return r
+}
+
+func (d *PCMDecoderReader) decode(b []byte, r pcmSourceRead) (int, error) {
+	if r.err != nil {
+		return len(r.data), r.err
+	}
+
+	if r.isCN {
+		n, err := d.readComfortNoise(b, r.cn)
+		d.noiseNext = time.Now().Add(d.frameDur)
+		d.noiseActive = true
+		if d.sourceRead == nil {
+			// Reading continues in background so that noise can be generated while waiting
+			d.sourceRead = make(chan pcmSourceRead)
+			d.sourceNext = make(chan struct{})
+			d.sourceStop = make(chan struct{})
+			go d.sourceLoop(make([]byte, d.BufSize), d.sourceRead, d.sourceNext, d.sourceStop)
+		}
 		return n, err
 	}
+	d.noiseActive = false
 
-	encoded := d.buf[:n]
-	n, err = d.DecoderTo(b, encoded)
+	if r.lost > 0 && d.ConcealTo != nil {
+		return d.readConcealed(b, r.data, r.lost)
+	}
+
+	n, err := d.DecoderTo(b, r.data)
 	if err != nil {
 		return 0, err
 	}
@@ -124,6 +235,127 @@ func (d *PCMDecoderReader) Read(b []byte) (n int, err error) {
 	return n, nil
 }
 
+// sourceLoop reads Source only when asked, so no packet is read ahead of Read
+func (d *PCMDecoderReader) sourceLoop(buf []byte, read chan<- pcmSourceRead, next <-chan struct{}, stop <-chan struct{}) {
+	for {
+		select {
+		case <-next:
+		case <-stop:
+			return
+		}
+
+		r := d.readSource(buf)
+		select {
+		case read <- r:
+		case <-stop:
+			return
+		}
+		if r.err != nil {
+			return
+		}
+	}
+}
+
+// readPaced returns next payload from background reading or noise frame if payload is not received in frame duration
+func (d *PCMDecoderReader) readPaced(b []byte) (int, error) {
+	if !d.sourceAsked {
+		d.sourceNext <- struct{}{}
+		d.sourceAsked = true
+	}
+
+	timer := time.NewTimer(time.Until(d.noiseNext))
+	defer timer.Stop()
+
+	select {
+	case r := <-d.sourceRead:
+		d.sourceAsked = false
+		n, err := d.decode(b, r)
+		if r.err != nil || !r.isCN {
+			// Noise is stopped. Reading continues directly
+			d.stopSourceLoop()
+		}
+		return n, err
+	case <-timer.C:
+		d.noiseNext = d.noiseNext.Add(d.frameDur)
+		return d.readNoise(b)
+	}
+}
+
+func (d *PCMDecoderReader) stopSourceLoop() {
+	if d.sourceStop != nil {
+		close(d.sourceStop)
+	}
+	d.sourceRead, d.sourceNext, d.sourceStop = nil, nil, nil
+	d.sourceAsked = false
+	d.noiseActive = false
+}
+
+// Close stops background reading of Source started by comfort noise. Source is not closed.
+// If reading is closed while waiting next payload after comfort noise, that payload is dropped.
+// It must not be called concurrently with Read
+func (d *PCMDecoderReader) Close() error {
+	d.stopSourceLoop()
+	return nil
+}
+
+func (d *PCMDecoderReader) readConcealed(b []byte, encoded []byte, lost int) (int, error) {
+	lost = min(lost, PCMConcealMaxFrames)
+	size := (lost + 1) * d.samplesSize
+	if cap(d.concealed) < size {
+		d.concealed = make([]byte, size)
+	}
+	buf := d.concealed[:size]
+
+	off := 0
+	for i := 0; i < lost; i++ {
+		// Only last lost frame can be recovered from next payload
+		var next []byte
+		if i == lost-1 {
+			next = encoded
+		}
+		n, err := d.ConcealTo(buf[off:], next)
+		if err != nil {
+			return 0, fmt.Errorf("failed to conceal lost frame: %w", err)
+		}
+		off += n
+	}
+
+	n, err := d.DecoderTo(buf[off:], encoded)
+	if err != nil {
+		return 0, err
+	}
+	off += n
+
+	n = copy(b, buf[:off])
+	d.unread = buf[n:off]
+	return n, nil
+}
+
+// readComfortNoise generates single frame of noise from comfort noise parameters
+func (d *PCMDecoderReader) readComfortNoise(b []byte, cn media.CNPayload) (int, error) {
+	if d.noise == nil {
+		d.noise = NewComfortNoise()
+	}
+	d.noise.Update(cn)
+	return d.readNoise(b)
+}
+
+// readNoise generates single frame of noise with last comfort noise parameters
+func (d *PCMDecoderReader) readNoise(b []byte) (int, error) {
+	if len(b) >= d.samplesSize {
+		return d.noise.GenerateTo(b[:d.samplesSize])
+	}
+
+	if cap(d.concealed) < d.samplesSize {
+		d.concealed = make([]byte, d.samplesSize)
+	}
+	buf := d.concealed[:d.samplesSize]
+	d.noise.GenerateTo(buf)
+	n := copy(b, buf)
+	d.unread = buf[n:]
+	return n, nil
+}
+
 type PCMDecoderWriter struct {
 	PCMDecoder
 	Writer io.Writer
@@ -222,8 +454,7 @@ func (enc *PCMEncoder) Init(codec media.Codec) error {
 		enc.EncoderTo = EncodeAlawTo
 
 	case FORMAT_TYPE_OPUS:
-		// TODO handle mono
-		opusEnc := OpusEncoder{}
+		opusEnc := OpusEncoder{Options: OpusEncoderOptionsFromFmtp(codec.Opus)}
 		if err := opusEnc.Init(int(codec.SampleRate), codec.NumChannels, codec.Samples16()); err != nil {
 			return fmt.Errorf("failed to create opus decoder: %w", err)
 		}
@@ -6,6 +6,7 @@ package audio
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 	"io/ioutil"
 	"math"
 	"testing"
@@ -132,6 +133,51 @@ func TestPCMDecoderRead(t *testing.T) {
 	}
 }
 
+type fakeLossReader struct {
+	io.Reader
+	lost []int
+}
+
+func (r *fakeLossReader) ReadLost() int {
+	lost := r.lost[0]
+	r.lost = r.lost[1:]
+	return lost
+}
+
+func TestPCMDecoderReadConceal(t *testing.T) {
+	pcm := testGeneratePCM16(8000)
+	encoded := g711.EncodeUlaw(pcm[:3*320])
+
+	source := &fakeLossReader{Reader: bytes.NewReader(encoded), lost: []int{0, 2, 0}}
+	decoder, err := NewPCMDecoderReader(FORMAT_TYPE_ULAW, source)
+	require.NoError(t, err)
+	decoder.BufSize = 160
+	require.Equal(t, source, decoder.LossReader)
+
+	var nexts [][]byte
+	decoder.ConcealTo = func(lpcm, next []byte) (int, error) {
+		nexts = append(nexts, bytes.Clone(next))
+		for i := range lpcm[:320] {
+			lpcm[i] = 0xFF
+		}
+		return 320, nil
+	}
+
+	decodedPCM, err := media.ReadAll(decoder, 320)
+	require.NoError(t, err)
+	require.Len(t, decodedPCM, 5*320)
+
+	expected := g711.DecodeUlaw(encoded)
+	assert.Equal(t, expected[:320], decodedPCM[:320])
+	assert.Equal(t, bytes.Repeat([]byte{0xFF}, 2*320), decodedPCM[320:3*320])
+	assert.Equal(t, expected[320:], decodedPCM[3*320:])
+
+	// Only last concealed frame gets next payload for FEC
+	require.Len(t, nexts, 2)
+	assert.Nil(t, nexts[0])
+	assert.Equal(t, encoded[160:320], nexts[1])
+}
+
 // Extract raw pcm data from .wav file
 func extractWavPcm(t *testing.T, fname string) []int16 {
 	bytes, err := ioutil.ReadFile(fname)
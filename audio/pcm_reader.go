@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NewPCM16Reader returns reader converting audio data of wav format to 16 bit little endian PCM.
+// Supported are 8 and 16 bit PCM, G.711 μ-law and A-law
+func NewPCM16Reader(format uint16, bitsPerSample int, r io.Reader) (io.Reader, error) {
+	switch {
+	case format == WavAudioFormatPCM && bitsPerSample == 16:
+		return r, nil
+	case format == WavAudioFormatPCM && bitsPerSample == 8:
+		return &decodeReader{Source: r, DecodeTo: decodePCM8UnsignedTo}, nil
+	case format == WavAudioFormatULaw && bitsPerSample == 8:
+		return &decodeReader{Source: r, DecodeTo: DecodeUlawTo}, nil
+	case format == WavAudioFormatALaw && bitsPerSample == 8:
+		return &decodeReader{Source: r, DecodeTo: DecodeAlawTo}, nil
+	}
+	return nil, fmt.Errorf("unsupported audio format=%d bitdepth=%d", format, bitsPerSample)
+}
+
+// NewL16Reader returns reader converting big endian 16 bit PCM, like audio/L16 (RFC 3551), to little endian
+func NewL16Reader(r io.Reader) io.Reader {
+	return &decodeReader{Source: r, Swap16: true}
+}
+
+// decodeReader decodes 8 bit samples to 16 bit PCM.
+// With Swap16 it converts 16 bit big endian samples instead
+type decodeReader struct {
+	Source   io.Reader
+	DecodeTo func(lpcm []byte, encoded []byte) (int, error)
+	Swap16   bool
+
+	buf []byte
+}
+
+func (r *decodeReader) Read(b []byte) (int, error) {
+	size := len(b) / 2
+	if r.Swap16 {
+		size = len(b) / 2 * 2
+	}
+	if size == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	if cap(r.buf) < size {
+		r.buf = make([]byte, size)
+	}
+
+	n, err := io.ReadFull(r.Source, r.buf[:size])
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	if r.Swap16 {
+		n = n / 2 * 2
+	}
+	if n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+
+	if r.Swap16 {
+		for i := 0; i < n; i += 2 {
+			b[i], b[i+1] = r.buf[i+1], r.buf[i]
+		}
+		return n, err
+	}
+
+	n, derr := r.DecodeTo(b, r.buf[:n])
+	if derr != nil {
+		return n, derr
+	}
+	return n, err
+}
+
+// decodePCM8UnsignedTo converts wav 8 bit unsigned PCM
+func decodePCM8UnsignedTo(lpcm []byte, pcm8 []byte) (int, error) {
+	if len(lpcm) < 2*len(pcm8) {
+		return 0, io.ErrShortBuffer
+	}
+	for i, s := range pcm8 {
+		v := (int16(s) - 128) << 8
+		lpcm[2*i] = byte(v)
+		lpcm[2*i+1] = byte(v >> 8)
+	}
+	return 2 * len(pcm8), nil
+}
+
+// decodePCM8SignedTo converts signed 8 bit PCM, like in AU files
+func decodePCM8SignedTo(lpcm []byte, pcm8 []byte) (int, error) {
+	if len(lpcm) < 2*len(pcm8) {
+		return 0, io.ErrShortBuffer
+	}
+	for i, s := range pcm8 {
+		v := int16(int8(s)) << 8
+		lpcm[2*i] = byte(v)
+		lpcm[2*i+1] = byte(v >> 8)
+	}
+	return 2 * len(pcm8), nil
+}
@@ -0,0 +1,318 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+type ResampleQuality int
+
+const (
+	// ResampleQualityMedium uses linear interpolation. It is default
+	ResampleQualityMedium ResampleQuality = iota
+	// ResampleQualityLow picks nearest sample. It is cheapest but with most artifacts
+	ResampleQualityLow
+	// ResampleQualityHigh is linear interpolation with low pass filter, which removes aliasing
+	ResampleQualityHigh
+)
+
+var (
+	// ResampleFilterTaps is size of low pass filter used with ResampleQualityHigh
+	ResampleFilterTaps = 32
+)
+
+// PCMResampler converts 16 bit PCM between sample rates and channels (mono/stereo).
+// By default it uses linear interpolation, see Quality for other options.
+// It keeps state between calls, so it must be used for single stream.
+//
+// Output is delayed for one sample in order to interpolate between chunks.
+// Number of output samples per chunk is constant as long as chunk samples are multiple of rate ratio,
+// which is the case for 20ms frames on 8000, 16000 and 48000 rates
+type PCMResampler struct {
+	FromRate     int
+	FromChannels int
+	ToRate       int
+	ToChannels   int
+	// Quality should be set before Init
+	Quality ResampleQuality
+
+	// t is position of next output sample in 1/ToRate input sample units.
+	// Negative means it is between last sample of previous chunk and first of current
+	t    int
+	prev []int16
+
+	filter   *resampleFilter
+	filtered []byte
+}
+
+func NewPCMResampler(fromRate int, fromChannels int, toRate int, toChannels int) (*PCMResampler, error) {
+	r := &PCMResampler{}
+	return r, r.Init(fromRate, fromChannels, toRate, toChannels)
+}
+
+func (r *PCMResampler) Init(fromRate int, fromChannels int, toRate int, toChannels int) error {
+	if fromRate <= 0 || toRate <= 0 {
+		return fmt.Errorf("resampler: bad sample rate from=%d to=%d", fromRate, toRate)
+	}
+	if fromChannels < 1 || fromChannels > 2 || toChannels < 1 || toChannels > 2 {
+		return fmt.Errorf("resampler: only mono or stereo supported from=%d to=%d", fromChannels, toChannels)
+	}
+
+	r.FromRate = fromRate
+	r.FromChannels = fromChannels
+	r.ToRate = toRate
+	r.ToChannels = toChannels
+	r.t = -toRate
+	r.prev = make([]int16, toChannels)
+
+	r.filter = nil
+	if r.Quality == ResampleQualityHigh && fromRate != toRate {
+		// Filter is applied on higher rate side with cutoff at lower rate nyquist
+		rate, channels := toRate, toChannels
+		if fromRate > toRate {
+			rate, channels = fromRate, fromChannels
+		}
+		cutoff := float64(min(fromRate, toRate)) / 2 / float64(rate)
+		r.filter = newResampleFilter(cutoff, ResampleFilterTaps, channels)
+	}
+	return nil
+}
+
+// OutputSize returns maximum output size in bytes for input lpcm size in bytes
+func (r *PCMResampler) OutputSize(inSize int) int {
+	samples := inSize / (2 * r.FromChannels)
+	return (samples*r.ToRate/r.FromRate + 2) * r.ToChannels * 2
+}
+
+// ResampleTo resamples lpcm into out and returns number of bytes written to out.
+// Out should be at least OutputSize(len(lpcm))
+func (r *PCMResampler) ResampleTo(out []byte, lpcm []byte) (int, error) {
+	samples := len(lpcm) / (2 * r.FromChannels)
+	if samples == 0 {
+		return 0, nil
+	}
+
+	downsampling := r.filter != nil && r.FromRate > r.ToRate
+	if downsampling {
+		// Filter input before decimation. Input must not be modified
+		if cap(r.filtered) < len(lpcm) {
+			r.filtered = make([]byte, len(lpcm))
+		}
+		r.filtered = r.filtered[:len(lpcm)]
+		copy(r.filtered, lpcm)
+		r.filter.apply(r.filtered)
+		lpcm = r.filtered
+	}
+
+	n := 0
+	last := (samples - 1) * r.ToRate
+	for ; r.t < last; r.t += r.FromRate {
+		i, frac := -1, r.t+r.ToRate
+		if r.t >= 0 {
+			i, frac = r.t/r.ToRate, r.t%r.ToRate
+		}
+
+		if n+2*r.ToChannels > len(out) {
+			return n, fmt.Errorf("resampler: output buffer too small: %w", io.ErrShortBuffer)
+		}
+
+		for c := 0; c < r.ToChannels; c++ {
+			a := int(r.sample(lpcm, i, c))
+			b := int(r.sample(lpcm, i+1, c))
+
+			var v int
+			if r.Quality == ResampleQualityLow {
+				v = a
+				if 2*frac >= r.ToRate {
+					v = b
+				}
+			} else {
+				v = a + (b-a)*frac/r.ToRate
+			}
+			binary.LittleEndian.PutUint16(out[n:], uint16(int16(v)))
+			n += 2
+		}
+	}
+
+	r.t -= samples * r.ToRate
+	for c := range r.prev {
+		r.prev[c] = r.sample(lpcm, samples-1, c)
+	}
+
+	if r.filter != nil && !downsampling {
+		// Remove images created by upsampling
+		r.filter.apply(out[:n])
+	}
+	return n, nil
+}
+
+// sample returns sample i already converted to output channel c
+func (r *PCMResampler) sample(lpcm []byte, i int, c int) int16 {
+	if i < 0 {
+		return r.prev[c]
+	}
+
+	switch {
+	case r.FromChannels == r.ToChannels:
+		off := (i*r.FromChannels + c) * 2
+		return int16(binary.LittleEndian.Uint16(lpcm[off:]))
+	case r.FromChannels == 1:
+		// mono to stereo
+		return int16(binary.LittleEndian.Uint16(lpcm[i*2:]))
+	}
+
+	// stereo to mono
+	left := int(int16(binary.LittleEndian.Uint16(lpcm[i*4:])))
+	right := int(int16(binary.LittleEndian.Uint16(lpcm[i*4+2:])))
+	return int16((left + right) / 2)
+}
+
+// PCMResamplerWriter resamples written PCM and passes to Writer
+type PCMResamplerWriter struct {
+	PCMResampler
+	Writer io.Writer
+	buf    []byte
+}
+
+func NewPCMResamplerWriter(w io.Writer, fromRate int, fromChannels int, toRate int, toChannels int) (*PCMResamplerWriter, error) {
+	r := &PCMResamplerWriter{}
+	return r, r.Init(w, fromRate, fromChannels, toRate, toChannels)
+}
+
+func (r *PCMResamplerWriter) Init(w io.Writer, fromRate int, fromChannels int, toRate int, toChannels int) error {
+	r.Writer = w
+	return r.PCMResampler.Init(fromRate, fromChannels, toRate, toChannels)
+}
+
+func (r *PCMResamplerWriter) Write(lpcm []byte) (int, error) {
+	if size := r.OutputSize(len(lpcm)); cap(r.buf) < size {
+		r.buf = make([]byte, size)
+	}
+
+	n, err := r.ResampleTo(r.buf[:cap(r.buf)], lpcm)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := r.Writer.Write(r.buf[:n]); err != nil {
+		return 0, err
+	}
+	return len(lpcm), nil
+}
+
+// PCMResamplerReader resamples PCM read from Source
+type PCMResamplerReader struct {
+	PCMResampler
+	Source io.Reader
+
+	buf    []byte
+	out    []byte
+	unread []byte
+}
+
+func NewPCMResamplerReader(r io.Reader, fromRate int, fromChannels int, toRate int, toChannels int) (*PCMResamplerReader, error) {
+	rr := &PCMResamplerReader{}
+	return rr, rr.Init(r, fromRate, fromChannels, toRate, toChannels)
+}
+
+func (r *PCMResamplerReader) Init(source io.Reader, fromRate int, fromChannels int, toRate int, toChannels int) error {
+	r.Source = source
+	return r.PCMResampler.Init(fromRate, fromChannels, toRate, toChannels)
+}
+
+// Read reads resampled PCM. Source is read in size matching buffer,
+// so reading with fixed buffer size gives fixed frames
+func (r *PCMResamplerReader) Read(b []byte) (int, error) {
+	if len(r.unread) > 0 {
+		n := copy(b, r.unread)
+		r.unread = r.unread[n:]
+		return n, nil
+	}
+
+	frameSize := 2 * r.FromChannels
+	outSamples := len(b) / (2 * r.ToChannels)
+	inSize := max(outSamples*r.FromRate/r.ToRate, 1) * frameSize
+	if cap(r.buf) < inSize {
+		r.buf = make([]byte, inSize)
+	}
+
+	// Reading full keeps frames aligned. Partial read can only happen at the end of stream
+	n, err := io.ReadFull(r.Source, r.buf[:inSize])
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, err
+	}
+
+	if size := r.OutputSize(n); cap(r.out) < size {
+		r.out = make([]byte, size)
+	}
+	nn, err := r.ResampleTo(r.out[:cap(r.out)], r.buf[:n-n%frameSize])
+	if err != nil {
+		return 0, err
+	}
+
+	copied := copy(b, r.out[:nn])
+	r.unread = r.out[copied:nn]
+	return copied, nil
+}
+
+// resampleFilter is windowed sinc low pass FIR filter for interleaved 16 bit PCM
+type resampleFilter struct {
+	taps     []float64
+	channels int
+	// history holds last samples per channel in ring buffer
+	history [][]float64
+	pos     int
+}
+
+// newResampleFilter creates filter with cutoff as fraction of sample rate (0-0.5)
+func newResampleFilter(cutoff float64, numTaps int, channels int) *resampleFilter {
+	taps := make([]float64, numTaps)
+	m := float64(numTaps - 1)
+	sum := 0.0
+	for i := range taps {
+		x := float64(i) - m/2
+		sinc := 2 * cutoff
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		// Blackman window
+		w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/m) + 0.08*math.Cos(4*math.Pi*float64(i)/m)
+		taps[i] = sinc * w
+		sum += taps[i]
+	}
+	for i := range taps {
+		taps[i] /= sum
+	}
+
+	history := make([][]float64, channels)
+	for c := range history {
+		history[c] = make([]float64, numTaps)
+	}
+	return &resampleFilter{taps: taps, channels: channels, history: history}
+}
+
+// apply filters lpcm in place
+func (f *resampleFilter) apply(lpcm []byte) {
+	numTaps := len(f.taps)
+	for i := 0; i+2*f.channels <= len(lpcm); i += 2 * f.channels {
+		for c := 0; c < f.channels; c++ {
+			off := i + 2*c
+			hist := f.history[c]
+			hist[f.pos] = float64(int16(binary.LittleEndian.Uint16(lpcm[off:])))
+
+			acc := 0.0
+			for k, tap := range f.taps {
+				acc += tap * hist[(f.pos-k+numTaps)%numTaps]
+			}
+			v := int16(max(math.MinInt16, min(math.MaxInt16, math.Round(acc))))
+			binary.LittleEndian.PutUint16(lpcm[off:], uint16(v))
+		}
+		f.pos = (f.pos + 1) % numTaps
+	}
+}
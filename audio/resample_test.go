@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPCM16Samples(samples ...int16) []byte {
+	buf := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+	return buf
+}
+
+func testPCM16Ramp(n int, step int16) []byte {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(i) * step
+	}
+	return testPCM16Samples(samples...)
+}
+
+func TestPCMResamplerFrameSizes(t *testing.T) {
+	tests := []struct {
+		from, to     int
+		fromCh, toCh int
+	}{
+		{8000, 48000, 1, 1},
+		{48000, 8000, 1, 1},
+		{8000, 16000, 1, 1},
+		{16000, 8000, 1, 1},
+		{48000, 16000, 2, 2},
+		{8000, 48000, 1, 2},
+		{48000, 8000, 2, 1},
+		{8000, 8000, 1, 2},
+	}
+
+	for _, tt := range tests {
+		r, err := NewPCMResampler(tt.from, tt.fromCh, tt.to, tt.toCh)
+		require.NoError(t, err)
+
+		// 20ms frames
+		in := make([]byte, tt.from/50*2*tt.fromCh)
+		out := make([]byte, r.OutputSize(len(in)))
+		for i := 0; i < 5; i++ {
+			n, err := r.ResampleTo(out, in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.to/50*2*tt.toCh, n, "from=%d to=%d", tt.from, tt.to)
+		}
+	}
+}
+
+func TestPCMResamplerInterpolation(t *testing.T) {
+	r, err := NewPCMResampler(8000, 1, 16000, 1)
+	require.NoError(t, err)
+
+	out := make([]byte, 64)
+	n, err := r.ResampleTo(out, testPCM16Ramp(4, 100))
+	require.NoError(t, err)
+	// Delayed for one sample, first is interpolated with zero
+	assert.Equal(t, testPCM16Samples(0, 0, 0, 50, 100, 150, 200, 250), out[:n])
+
+	// Stream continues without discontinuity
+	n, err = r.ResampleTo(out, testPCM16Samples(400))
+	require.NoError(t, err)
+	assert.Equal(t, testPCM16Samples(300, 350), out[:n])
+}
+
+func TestPCMResamplerChannels(t *testing.T) {
+	t.Run("MonoToStereo", func(t *testing.T) {
+		r, err := NewPCMResampler(8000, 1, 8000, 2)
+		require.NoError(t, err)
+
+		out := make([]byte, 64)
+		n, err := r.ResampleTo(out, testPCM16Samples(10, 20, 30))
+		require.NoError(t, err)
+		assert.Equal(t, testPCM16Samples(0, 0, 10, 10, 20, 20), out[:n])
+	})
+
+	t.Run("StereoToMono", func(t *testing.T) {
+		r, err := NewPCMResampler(8000, 2, 8000, 1)
+		require.NoError(t, err)
+
+		out := make([]byte, 64)
+		n, err := r.ResampleTo(out, testPCM16Samples(10, 30, 20, 40, -100, 100))
+		require.NoError(t, err)
+		assert.Equal(t, testPCM16Samples(0, 20, 30), out[:n])
+	})
+
+	_, err := NewPCMResampler(8000, 3, 8000, 1)
+	require.Error(t, err)
+}
+
+func TestPCMResamplerWriter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w, err := NewPCMResamplerWriter(buf, 48000, 2, 8000, 1)
+	require.NoError(t, err)
+
+	frame := make([]byte, 960*2*2)
+	for i := 0; i < 3; i++ {
+		n, err := w.Write(frame)
+		require.NoError(t, err)
+		require.Equal(t, len(frame), n)
+	}
+	assert.Equal(t, 3*160*2, buf.Len())
+}
+
+func TestPCMResamplerReader(t *testing.T) {
+	// 3 frames of 48000 stereo
+	source := bytes.NewReader(make([]byte, 3*960*2*2))
+	r, err := NewPCMResamplerReader(source, 48000, 2, 8000, 1)
+	require.NoError(t, err)
+
+	buf := make([]byte, 320)
+	for i := 0; i < 3; i++ {
+		n, err := r.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, 320, n)
+	}
+	_, err = r.Read(buf)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestPCMResamplerQuality(t *testing.T) {
+	t.Run("Low", func(t *testing.T) {
+		r := &PCMResampler{Quality: ResampleQualityLow}
+		require.NoError(t, r.Init(8000, 1, 32000, 1))
+
+		out := make([]byte, 64)
+		n, err := r.ResampleTo(out, testPCM16Samples(100, 200, 300))
+		require.NoError(t, err)
+		assert.Equal(t, testPCM16Samples(0, 0, 100, 100, 100, 100, 200, 200, 200, 200, 300, 300), out[:n])
+	})
+
+	t.Run("High", func(t *testing.T) {
+		// Tone above 4kHz must be removed when downsampling to 8kHz
+		tone := make([]int16, 960*5)
+		for i := range tone {
+			tone[i] = int16(10000 * math.Sin(2*math.Pi*6000*float64(i)/48000))
+		}
+		in := testPCM16Samples(tone...)
+
+		energy := func(quality ResampleQuality) float64 {
+			r := &PCMResampler{Quality: quality}
+			require.NoError(t, r.Init(48000, 1, 8000, 1))
+			out := make([]byte, r.OutputSize(len(in)))
+			n, err := r.ResampleTo(out, in)
+			require.NoError(t, err)
+
+			sum := 0.0
+			// Skip filter warmup
+			for i := 320; i < n; i += 2 {
+				v := float64(int16(binary.LittleEndian.Uint16(out[i:])))
+				sum += v * v
+			}
+			return sum
+		}
+
+		assert.Less(t, energy(ResampleQualityHigh), energy(ResampleQualityMedium)/100)
+	})
+}
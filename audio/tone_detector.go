@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// ToneDetector measures presence of frequencies in 16 bit mono PCM frame with Goertzel algorithm
+type ToneDetector struct {
+	SampleRate  int
+	Frequencies []float64
+
+	coeffs  []float64
+	samples []float64
+}
+
+func NewToneDetector(sampleRate int, freqs ...float64) *ToneDetector {
+	d := &ToneDetector{SampleRate: sampleRate, Frequencies: freqs}
+	d.Init()
+	return d
+}
+
+func (d *ToneDetector) Init() {
+	d.coeffs = make([]float64, len(d.Frequencies))
+	for i, f := range d.Frequencies {
+		d.coeffs[i] = 2 * math.Cos(2*math.Pi*f/float64(d.SampleRate))
+	}
+}
+
+// Detect writes power ratio of each frequency to powers and returns frame level in dBov.
+// Ratio is part of frame energy at frequency. Pure tone has ratio close to 1 and
+// two tones with same level have 0.5 each. Frame should be at least 10ms
+func (d *ToneDetector) Detect(lpcm []byte, powers []float64) float64 {
+	n := len(lpcm) / 2
+	if cap(d.samples) < n {
+		d.samples = make([]float64, n)
+	}
+	samples := d.samples[:n]
+	energy := 0.0
+	for i := range samples {
+		s := float64(int16(binary.LittleEndian.Uint16(lpcm[i*2:])))
+		samples[i] = s
+		energy += s * s
+	}
+
+	if energy == 0 {
+		clear(powers)
+		return math.Inf(-1)
+	}
+
+	for i, coeff := range d.coeffs {
+		var s1, s2 float64
+		for _, x := range samples {
+			s0 := x + coeff*s1 - s2
+			s2, s1 = s1, s0
+		}
+		power := s1*s1 + s2*s2 - coeff*s1*s2
+		powers[i] = 2 * power / (float64(n) * energy)
+	}
+	return 20 * math.Log10(math.Sqrt(energy/float64(n))/math.MaxInt16)
+}
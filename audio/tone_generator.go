@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"slices"
+)
+
+var (
+	// ToneLevel is default level of each tone frequency in dBm0
+	ToneLevel = -13.0
+)
+
+// ToneGenerator is reader of 16 bit mono PCM for tone.
+// Segments are played in order and then tone cadence is repeated.
+// Reader returns io.EOF when tone has no repeated segments and all are played
+type ToneGenerator struct {
+	SampleRate int
+	Tone       Tone
+	// Level of each frequency in dBm0. Zero is ToneLevel
+	Level float64
+
+	amplitude float64
+	// sample is position in stream and segSample in current segment
+	sample    int
+	segSample int
+	seg       int
+	repeating bool
+}
+
+func NewToneGenerator(sampleRate int, tone Tone, level float64) *ToneGenerator {
+	g := &ToneGenerator{SampleRate: sampleRate, Tone: tone, Level: level}
+	g.Init()
+	return g
+}
+
+// Init resets generator to start of tone
+func (g *ToneGenerator) Init() {
+	level := g.Level
+	if level == 0 {
+		level = ToneLevel
+	}
+	// Full scale G.711 sine is +3.14 dBm0
+	g.amplitude = math.MaxInt16 * math.Pow(10, (level-3.14)/20)
+	g.sample = 0
+	g.segSample = 0
+	g.seg = 0
+	g.repeating = false
+}
+
+func (g *ToneGenerator) Read(b []byte) (int, error) {
+	n := 0
+	for ; n+2 <= len(b); n += 2 {
+		if !g.nextSegment() {
+			break
+		}
+
+		seg := g.Tone[g.seg]
+		s := 0.0
+		for _, f := range seg.Frequencies {
+			s += g.amplitude * math.Sin(2*math.Pi*f*float64(g.sample)/float64(g.SampleRate))
+		}
+		s = max(min(s, math.MaxInt16), math.MinInt16)
+		binary.LittleEndian.PutUint16(b[n:], uint16(int16(s)))
+		g.sample++
+		g.segSample++
+	}
+
+	if n == 0 && len(b) >= 2 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// nextSegment moves to segment of next sample and returns false when tone is done
+func (g *ToneGenerator) nextSegment() bool {
+	for g.seg < len(g.Tone) {
+		seg := g.Tone[g.seg]
+		if !(g.repeating && seg.Once) {
+			if seg.Duration == 0 || g.segSample < int(seg.Duration.Seconds()*float64(g.SampleRate)) {
+				return true
+			}
+		}
+		g.segSample = 0
+		g.seg++
+		if g.seg == len(g.Tone) && slices.ContainsFunc(g.Tone, func(s ToneSegment) bool { return !s.Once }) {
+			g.seg = 0
+			g.repeating = true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToneGenerator(t *testing.T) {
+	gen := NewToneGenerator(8000, MustParseTone("!350+440/100,425/200,0/300"), 0)
+	detector := NewToneDetector(8000, 350, 440, 425)
+	powers := make([]float64, 3)
+
+	// 100ms once, then 200ms tone and 300ms silence repeated
+	frame := make([]byte, 320)
+	var detected []string
+	for i := 0; i < 35; i++ {
+		n, err := gen.Read(frame)
+		require.NoError(t, err)
+		require.Equal(t, 320, n)
+
+		level := detector.Detect(frame, powers)
+		switch {
+		case powers[0] > 0.4 && powers[1] > 0.4:
+			assert.InDelta(t, -16.1, level, 1, "two frequencies are summed")
+			detected = append(detected, "D")
+		case powers[2] > 0.9:
+			// -13 dBm0 sine has rms level -19.1 dBov
+			assert.InDelta(t, -19.1, level, 0.5)
+			detected = append(detected, "T")
+		case level < -90:
+			detected = append(detected, "-")
+		default:
+			detected = append(detected, "?")
+		}
+	}
+	assert.Equal(t, "DDDDDTTTTTTTTTT---------------TTTTT", strings.Join(detected, ""))
+
+	// Tone without cadence ends
+	gen = NewToneGenerator(8000, MustParseTone("!1000/100"), -20)
+	data, err := io.ReadAll(gen)
+	require.NoError(t, err)
+	assert.Len(t, data, 1600)
+
+	n, err := gen.Read(frame)
+	assert.Equal(t, 0, n)
+	assert.ErrorIs(t, err, io.EOF)
+
+	gen.Init()
+	n, err = gen.Read(frame)
+	require.NoError(t, err)
+	assert.Equal(t, 320, n)
+}
+
+func TestTonePlans(t *testing.T) {
+	for country, plan := range TonePlans {
+		assert.Equal(t, country, plan.Country)
+		for _, name := range []ToneName{ToneDial, ToneRingback, ToneBusy, ToneCongestion, ToneCallWaiting} {
+			tone, ok := plan.Tone(name)
+			assert.True(t, ok, "%s %s", country, name)
+			assert.Equal(t, tone.String(), MustParseTone(tone.String()).String())
+		}
+	}
+
+	plan, ok := TonePlanCountry("DE")
+	require.True(t, ok)
+	tone, ok := plan.Tone(ToneRingback)
+	require.True(t, ok)
+	assert.Equal(t, "425/1000,0/4000", tone.String())
+
+	_, ok = plan.Tone("unknown")
+	assert.False(t, ok)
+
+	// ISO code and common alias
+	for _, country := range []string{"GB", "uk"} {
+		plan, ok := TonePlanCountry(country)
+		require.True(t, ok, country)
+		assert.Equal(t, "gb", plan.Country)
+	}
+}
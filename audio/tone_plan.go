@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ToneSegment is single part of tone. No frequencies is silence
+type ToneSegment struct {
+	Frequencies []float64
+	// Duration of segment. Zero means until tone is stopped
+	Duration time.Duration
+	// Once segments are not repeated with rest of tone. Marked with ! in tone string
+	Once bool
+}
+
+// Tone is call progress tone as sequence of segments. Segments that are not Once are repeated.
+// It is written as ITU style string like "425/1000,0/4000" or "!350+440/100,350+440"
+type Tone []ToneSegment
+
+// ParseTone parses tone string. Each comma separated segment is [!]freq[+freq...][/duration ms]
+func ParseTone(s string) (Tone, error) {
+	var t Tone
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		seg := ToneSegment{}
+		if strings.HasPrefix(part, "!") {
+			seg.Once = true
+			part = part[1:]
+		}
+
+		freqs, dur, hasDur := strings.Cut(part, "/")
+		if hasDur {
+			ms, err := strconv.Atoi(dur)
+			if err != nil || ms < 0 {
+				return nil, fmt.Errorf("bad tone duration %q", part)
+			}
+			seg.Duration = time.Duration(ms) * time.Millisecond
+		}
+
+		for _, f := range strings.Split(freqs, "+") {
+			freq, err := strconv.ParseFloat(f, 64)
+			if err != nil || freq < 0 {
+				return nil, fmt.Errorf("bad tone frequency %q", part)
+			}
+			if freq > 0 {
+				seg.Frequencies = append(seg.Frequencies, freq)
+			}
+		}
+		t = append(t, seg)
+	}
+	return t, nil
+}
+
+func MustParseTone(s string) Tone {
+	t, err := ParseTone(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (t Tone) String() string {
+	parts := make([]string, len(t))
+	for i, seg := range t {
+		var sb strings.Builder
+		if seg.Once {
+			sb.WriteString("!")
+		}
+		if len(seg.Frequencies) == 0 {
+			sb.WriteString("0")
+		}
+		for j, f := range seg.Frequencies {
+			if j > 0 {
+				sb.WriteString("+")
+			}
+			sb.WriteString(strconv.FormatFloat(f, 'f', -1, 64))
+		}
+		if seg.Duration > 0 {
+			sb.WriteString("/" + strconv.FormatInt(seg.Duration.Milliseconds(), 10))
+		}
+		parts[i] = sb.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Cadence returns repeated segments of tone
+func (t Tone) Cadence() Tone {
+	var c Tone
+	for _, seg := range t {
+		if !seg.Once {
+			c = append(c, seg)
+		}
+	}
+	return c
+}
+
+// ToneName is name of tone in tone plan
+type ToneName string
+
+const (
+	ToneDial        ToneName = "dial"
+	ToneRingback    ToneName = "ringback"
+	ToneBusy        ToneName = "busy"
+	ToneCongestion  ToneName = "congestion"
+	ToneCallWaiting ToneName = "callwaiting"
+)
+
+// TonePlan are call progress tones of country
+type TonePlan struct {
+	Country     string
+	Dial        Tone
+	Ringback    Tone
+	Busy        Tone
+	Congestion  Tone
+	CallWaiting Tone
+	// Level of each tone frequency in dBm0. Zero is ToneLevel
+	Level float64
+}
+
+// Tone returns tone by name. False if plan does not have it
+func (p TonePlan) Tone(name ToneName) (Tone, bool) {
+	var t Tone
+	switch name {
+	case ToneDial:
+		t = p.Dial
+	case ToneRingback:
+		t = p.Ringback
+	case ToneBusy:
+		t = p.Busy
+	case ToneCongestion:
+		t = p.Congestion
+	case ToneCallWaiting:
+		t = p.CallWaiting
+	}
+	return t, len(t) > 0
+}
+
+var (
+	// TonePlans are presets by lower case ISO country code
+	TonePlans = map[string]TonePlan{
+		"us": {
+			Country:     "us",
+			Dial:        MustParseTone("350+440"),
+			Ringback:    MustParseTone("440+480/2000,0/4000"),
+			Busy:        MustParseTone("480+620/500,0/500"),
+			Congestion:  MustParseTone("480+620/250,0/250"),
+			CallWaiting: MustParseTone("440/300,0/10000"),
+		},
+		"ca": {
+			Country:     "ca",
+			Dial:        MustParseTone("350+440"),
+			Ringback:    MustParseTone("440+480/2000,0/4000"),
+			Busy:        MustParseTone("480+620/500,0/500"),
+			Congestion:  MustParseTone("480+620/250,0/250"),
+			CallWaiting: MustParseTone("440/300,0/10000"),
+		},
+		"gb": {
+			Country:     "gb",
+			Dial:        MustParseTone("350+440"),
+			Ringback:    MustParseTone("400+450/400,0/200,400+450/400,0/2000"),
+			Busy:        MustParseTone("400/375,0/375"),
+			Congestion:  MustParseTone("400/400,0/350,400/225,0/525"),
+			CallWaiting: MustParseTone("400/100,0/4000"),
+		},
+		"au": {
+			Country:     "au",
+			Dial:        MustParseTone("413+438"),
+			Ringback:    MustParseTone("400+450/400,0/200,400+450/400,0/2000"),
+			Busy:        MustParseTone("425/375,0/375"),
+			Congestion:  MustParseTone("425/375,0/375,420/375,0/375"),
+			CallWaiting: MustParseTone("425/200,0/200,425/200,0/4400"),
+		},
+		"de": {
+			Country:     "de",
+			Dial:        MustParseTone("425"),
+			Ringback:    MustParseTone("425/1000,0/4000"),
+			Busy:        MustParseTone("425/480,0/480"),
+			Congestion:  MustParseTone("425/240,0/240"),
+			CallWaiting: MustParseTone("425/200,0/200,425/200,0/5000"),
+		},
+		"at": {
+			Country:     "at",
+			Dial:        MustParseTone("420"),
+			Ringback:    MustParseTone("420/1000,0/5000"),
+			Busy:        MustParseTone("420/400,0/400"),
+			Congestion:  MustParseTone("420/200,0/200"),
+			CallWaiting: MustParseTone("420/40,0/1960"),
+		},
+		"ch": {
+			Country:     "ch",
+			Dial:        MustParseTone("425"),
+			Ringback:    MustParseTone("425/1000,0/4000"),
+			Busy:        MustParseTone("425/500,0/500"),
+			Congestion:  MustParseTone("425/200,0/200"),
+			CallWaiting: MustParseTone("425/200,0/200,425/200,0/4000"),
+		},
+		"nl": {
+			Country:     "nl",
+			Dial:        MustParseTone("425"),
+			Ringback:    MustParseTone("425/1000,0/4000"),
+			Busy:        MustParseTone("425/500,0/500"),
+			Congestion:  MustParseTone("425/250,0/250"),
+			CallWaiting: MustParseTone("425/500,0/9500"),
+		},
+		"fr": {
+			Country:     "fr",
+			Dial:        MustParseTone("440"),
+			Ringback:    MustParseTone("440/1500,0/3500"),
+			Busy:        MustParseTone("440/500,0/500"),
+			Congestion:  MustParseTone("440/250,0/250"),
+			CallWaiting: MustParseTone("440/300,0/10000"),
+		},
+		"it": {
+			Country:     "it",
+			Dial:        MustParseTone("425/200,0/200,425/600,0/1000"),
+			Ringback:    MustParseTone("425/1000,0/4000"),
+			Busy:        MustParseTone("425/500,0/500"),
+			Congestion:  MustParseTone("425/200,0/200"),
+			CallWaiting: MustParseTone("425/400,0/100,425/250,0/100,425/150,0/14000"),
+		},
+		"es": {
+			Country:     "es",
+			Dial:        MustParseTone("425"),
+			Ringback:    MustParseTone("425/1500,0/3000"),
+			Busy:        MustParseTone("425/200,0/200"),
+			Congestion:  MustParseTone("425/200,0/200,425/200,0/200,425/200,0/600"),
+			CallWaiting: MustParseTone("425/175,0/175,425/175,0/3500"),
+		},
+	}
+
+	// TonePlanDefault is used when no plan is set
+	TonePlanDefault = "us"
+
+	// tonePlanAliases are commonly used codes, which are not ISO
+	tonePlanAliases = map[string]string{
+		"uk": "gb",
+	}
+)
+
+// TonePlanCountry returns preset tone plan for country code
+func TonePlanCountry(country string) (TonePlan, bool) {
+	country = strings.ToLower(country)
+	if alias, ok := tonePlanAliases[country]; ok {
+		country = alias
+	}
+	p, ok := TonePlans[country]
+	return p, ok
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTone(t *testing.T) {
+	tone, err := ParseTone("!350+440/100,425/1000,0/4000")
+	require.NoError(t, err)
+	require.Len(t, tone, 3)
+	assert.Equal(t, ToneSegment{Frequencies: []float64{350, 440}, Duration: 100 * time.Millisecond, Once: true}, tone[0])
+	assert.Equal(t, ToneSegment{Frequencies: []float64{425}, Duration: time.Second}, tone[1])
+	assert.Equal(t, ToneSegment{Duration: 4 * time.Second}, tone[2])
+	assert.Equal(t, "!350+440/100,425/1000,0/4000", tone.String())
+	assert.Len(t, tone.Cadence(), 2)
+
+	tone, err = ParseTone("350+440")
+	require.NoError(t, err)
+	assert.Equal(t, Tone{{Frequencies: []float64{350, 440}}}, tone)
+
+	_, err = ParseTone("425/abc")
+	assert.Error(t, err)
+	_, err = ParseTone("x/100")
+	assert.Error(t, err)
+}
+
+func TestToneDetector(t *testing.T) {
+	d := NewToneDetector(8000, 440, 480, 620)
+	lpcm := make([]byte, 320)
+	for i := 0; i < 160; i++ {
+		s := 4000*math.Sin(2*math.Pi*480*float64(i)/8000) + 4000*math.Sin(2*math.Pi*620*float64(i)/8000)
+		binary.LittleEndian.PutUint16(lpcm[i*2:], uint16(int16(s)))
+	}
+
+	powers := make([]float64, 3)
+	level := d.Detect(lpcm, powers)
+	assert.InDelta(t, -18.3, level, 0.5)
+	assert.Less(t, powers[0], 0.1)
+	assert.InDelta(t, 0.5, powers[1], 0.1)
+	assert.InDelta(t, 0.5, powers[2], 0.1)
+
+	level = d.Detect(make([]byte, 320), powers)
+	assert.True(t, math.IsInf(level, -1))
+	assert.Equal(t, []float64{0, 0, 0}, powers)
+}
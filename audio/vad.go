@@ -0,0 +1,284 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/vertan/diago/media"
+)
+
+var (
+	// VADThreshold is how many dB frame must be above noise floor to be speech
+	VADThreshold = 9.0
+	// VADMinLevel is minimum level in dBov for speech
+	VADMinLevel = -55.0
+	// VADMaxZeroCrossingRate is max rate of sign changes per sample for speech close to noise floor.
+	// Noise like signals have high rate
+	VADMaxZeroCrossingRate = 0.4
+	// VADMinSpeech is duration of speech frames needed before speech start is signaled
+	VADMinSpeech = 40 * time.Millisecond
+	// VADHangover is how long speech lasts after last speech frame
+	VADHangover = 300 * time.Millisecond
+
+	// vadMinNoiseFloor is lowest noise floor in dBov
+	vadMinNoiseFloor = -70.0
+)
+
+// VADFrame are features and decision of single processed frame
+type VADFrame struct {
+	// Level is frame level in dBov
+	Level float64
+	// NoiseFloor is current noise floor estimate in dBov
+	NoiseFloor float64
+	// ZeroCrossingRate is number of sign changes per sample
+	ZeroCrossingRate float64
+	// Speech is true if frame is detected as speech
+	Speech bool
+	// Speaking is current state with hangover applied
+	Speaking bool
+}
+
+// VAD is voice activity detection on 16 bit mono PCM frames.
+// Frame is speech when its energy is enough above adaptive noise floor. Frames close to noise floor
+// are also checked with zero crossing rate to ignore noise.
+// Speech starts after MinSpeech of speech frames and ends after Hangover without them.
+//
+// Experimental
+type VAD struct {
+	// SampleRate of PCM. Default is 8000
+	SampleRate int
+	// Threshold in dB above noise floor. Default VADThreshold
+	Threshold float64
+	// MinSpeech and Hangover. Default VADMinSpeech and VADHangover
+	MinSpeech time.Duration
+	Hangover  time.Duration
+	// InitialNoiseFloor in dBov is used until noise floor adapts. Zero means level of first frame,
+	// which is not good if audio starts with speech
+	InitialNoiseFloor float64
+
+	// OnSpeechStart is called when speech starts
+	OnSpeechStart func()
+	// OnSpeechEnd is called when speech ends with duration of speech including hangover
+	OnSpeechEnd func(dur time.Duration)
+	// OnFrame is called for every processed frame
+	OnFrame func(f VADFrame)
+
+	noiseFloor  float64
+	initialized bool
+	speaking    bool
+	speechDur   time.Duration
+	silenceDur  time.Duration
+	speakingDur time.Duration
+}
+
+func NewVAD(sampleRate int) *VAD {
+	v := &VAD{SampleRate: sampleRate}
+	v.Init()
+	return v
+}
+
+// Init sets defaults. Callbacks and settings are kept
+func (v *VAD) Init() {
+	if v.SampleRate == 0 {
+		v.SampleRate = 8000
+	}
+	if v.Threshold == 0 {
+		v.Threshold = VADThreshold
+	}
+	if v.MinSpeech == 0 {
+		v.MinSpeech = VADMinSpeech
+	}
+	if v.Hangover == 0 {
+		v.Hangover = VADHangover
+	}
+	v.initialized = false
+	v.speaking = false
+	v.speechDur, v.silenceDur, v.speakingDur = 0, 0, 0
+}
+
+// Speaking returns current speech state
+func (v *VAD) Speaking() bool {
+	return v.speaking
+}
+
+// Process runs detection on single frame
+func (v *VAD) Process(lpcm []byte) VADFrame {
+	n := len(lpcm) / 2
+	if n == 0 {
+		return VADFrame{Level: math.Inf(-1), NoiseFloor: v.noiseFloor, Speaking: v.speaking}
+	}
+
+	sum := 0.0
+	crossings := 0
+	var prev int16
+	for i := 0; i < n; i++ {
+		s := int16(binary.LittleEndian.Uint16(lpcm[i*2:]))
+		sum += float64(s) * float64(s)
+		if i > 0 && (s >= 0) != (prev >= 0) {
+			crossings++
+		}
+		prev = s
+	}
+	rms := math.Sqrt(sum / float64(n))
+	level := 20 * math.Log10(max(rms, 1)/math.MaxInt16)
+	zcr := float64(crossings) / float64(n)
+
+	if !v.initialized {
+		v.noiseFloor = max(level, vadMinNoiseFloor)
+		if v.InitialNoiseFloor != 0 {
+			v.noiseFloor = v.InitialNoiseFloor
+		}
+		v.initialized = true
+	}
+
+	above := level - v.noiseFloor
+	speech := level >= VADMinLevel && (above >= 2*v.Threshold || (above >= v.Threshold && zcr <= VADMaxZeroCrossingRate))
+	v.updateNoiseFloor(level, speech)
+
+	dur := time.Duration(n) * time.Second / time.Duration(v.SampleRate)
+	v.updateState(speech, dur)
+
+	f := VADFrame{
+		Level:            level,
+		NoiseFloor:       v.noiseFloor,
+		ZeroCrossingRate: zcr,
+		Speech:           speech,
+		Speaking:         v.speaking,
+	}
+	if v.OnFrame != nil {
+		v.OnFrame(f)
+	}
+	return f
+}
+
+// updateNoiseFloor follows drops fast and rises slowly. During speech it rises very slowly
+// so that constant loud noise is eventually not speech
+func (v *VAD) updateNoiseFloor(level float64, speech bool) {
+	switch {
+	case level < v.noiseFloor:
+		v.noiseFloor += (level - v.noiseFloor) * 0.3
+	case speech:
+		v.noiseFloor += (level - v.noiseFloor) * 0.002
+	default:
+		v.noiseFloor += (level - v.noiseFloor) * 0.05
+	}
+	v.noiseFloor = max(v.noiseFloor, vadMinNoiseFloor)
+}
+
+func (v *VAD) updateState(speech bool, dur time.Duration) {
+	if v.speaking {
+		v.speakingDur += dur
+	}
+
+	if speech {
+		v.silenceDur = 0
+		v.speechDur += dur
+		if !v.speaking && v.speechDur >= v.MinSpeech {
+			v.speaking = true
+			v.speakingDur = v.speechDur
+			if v.OnSpeechStart != nil {
+				v.OnSpeechStart()
+			}
+		}
+		return
+	}
+
+	v.speechDur = 0
+	if !v.speaking {
+		return
+	}
+	v.silenceDur += dur
+	if v.silenceDur >= v.Hangover {
+		v.speaking = false
+		if v.OnSpeechEnd != nil {
+			v.OnSpeechEnd(v.speakingDur)
+		}
+	}
+}
+
+// VADReader runs VAD on encoded audio passing through it. Audio is returned unchanged.
+// Any codec supported by PCMDecoder can be used
+//
+// Experimental
+type VADReader struct {
+	VAD
+	Reader io.Reader
+	// PacketReader is optional. If set, only payloads with codec payload type are processed
+	// and comfort noise is processed as silence
+	PacketReader *media.RTPPacketReader
+
+	codec   media.Codec
+	decoder PCMDecoder
+	lpcm    []byte
+}
+
+func NewVADReader(codec media.Codec, reader io.Reader) (*VADReader, error) {
+	r := &VADReader{}
+	return r, r.Init(codec, reader)
+}
+
+func (r *VADReader) Init(codec media.Codec, reader io.Reader) error {
+	r.Reader = reader
+	r.codec = codec
+	r.VAD.SampleRate = int(codec.SampleRate)
+	r.VAD.Init()
+	if err := r.decoder.Init(codec); err != nil {
+		return fmt.Errorf("vad: %w", err)
+	}
+	// Opus packets can have up to 120ms
+	r.lpcm = make([]byte, codec.Samples16()*6)
+	return nil
+}
+
+func (r *VADReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if err != nil {
+		return n, err
+	}
+
+	if r.PacketReader != nil {
+		if cn, ok := r.PacketReader.ReadCN(); ok {
+			r.processComfortNoise(cn)
+			return n, nil
+		}
+		if r.PacketReader.PacketHeader.PayloadType != r.codec.PayloadType {
+			return n, nil
+		}
+	}
+	if n == 0 {
+		return n, nil
+	}
+
+	nn, err := r.decoder.DecoderTo(r.lpcm, b[:n])
+	if err != nil {
+		return n, fmt.Errorf("vad: %w", err)
+	}
+	r.Process(r.mono(r.lpcm[:nn]))
+	return n, nil
+}
+
+// processComfortNoise handles comfort noise as non speech frame. Noise floor is not changed
+func (r *VADReader) processComfortNoise(cn media.CNPayload) {
+	r.updateState(false, r.codec.SampleDur)
+	if r.OnFrame != nil {
+		r.OnFrame(VADFrame{Level: -float64(cn.Level), NoiseFloor: r.noiseFloor, Speaking: r.speaking})
+	}
+}
+
+// mono keeps first channel of stereo PCM in place
+func (r *VADReader) mono(lpcm []byte) []byte {
+	if r.codec.NumChannels < 2 {
+		return lpcm
+	}
+	n := len(lpcm) / 4
+	for i := 0; i < n; i++ {
+		copy(lpcm[i*2:i*2+2], lpcm[i*4:i*4+2])
+	}
+	return lpcm[:n*2]
+}
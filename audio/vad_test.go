@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media"
+	"github.com/zaf/g711"
+)
+
+// testPCM16Noise generates white noise with peak amplitude
+func testPCM16Noise(amp int, n int) []byte {
+	lpcm := make([]byte, n*2)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint16(lpcm[i*2:], uint16(int16(rand.Intn(2*amp+1)-amp)))
+	}
+	return lpcm
+}
+
+// testVADSignal is noise with tone in the middle. Tone is 300ms at 20ms frames
+func testVADSignal() []byte {
+	var lpcm []byte
+	for i := 0; i < 50; i++ {
+		frame := testPCM16Noise(200, 160)
+		if i >= 20 && i < 35 {
+			tone := testPCM16Tone(300, i*160, 160)
+			for j := 0; j < len(frame); j += 2 {
+				s := int16(binary.LittleEndian.Uint16(frame[j:])) + int16(binary.LittleEndian.Uint16(tone[j:]))
+				binary.LittleEndian.PutUint16(frame[j:], uint16(s))
+			}
+		}
+		lpcm = append(lpcm, frame...)
+	}
+	return lpcm
+}
+
+func TestVAD(t *testing.T) {
+	var events []string
+	var speechDur time.Duration
+	frames := 0
+	v := NewVAD(8000)
+	v.OnSpeechStart = func() { events = append(events, "start") }
+	v.OnSpeechEnd = func(dur time.Duration) {
+		events = append(events, "end")
+		speechDur = dur
+	}
+	v.OnFrame = func(f VADFrame) { frames++ }
+
+	lpcm := testVADSignal()
+	var speaking []bool
+	var last VADFrame
+	for i := 0; i < len(lpcm); i += 320 {
+		last = v.Process(lpcm[i : i+320])
+		speaking = append(speaking, last.Speaking)
+	}
+
+	assert.Equal(t, []string{"start", "end"}, events)
+	assert.Equal(t, 50, frames)
+	// Start is delayed by min speech and end by hangover
+	assert.False(t, speaking[20])
+	assert.True(t, speaking[21])
+	assert.True(t, speaking[48])
+	assert.False(t, speaking[49])
+	assert.Equal(t, 300*time.Millisecond+VADHangover, speechDur)
+
+	// Noise floor follows noise level
+	assert.InDelta(t, -47, last.NoiseFloor, 3)
+	assert.Greater(t, last.ZeroCrossingRate, VADMaxZeroCrossingRate)
+}
+
+func TestVADNoiseFloorAdapts(t *testing.T) {
+	v := NewVAD(8000)
+	started := 0
+	v.OnSpeechStart = func() { started++ }
+
+	// Quiet start and constant louder noise afterwards
+	for i := 0; i < 10; i++ {
+		v.Process(make([]byte, 320))
+	}
+	for i := 0; i < 50*20; i++ {
+		v.Process(testPCM16Noise(3000, 160))
+	}
+	assert.LessOrEqual(t, started, 1)
+	assert.False(t, v.Speaking())
+}
+
+func TestVADReader(t *testing.T) {
+	lpcm := testVADSignal()
+	encoded := g711.EncodeUlaw(lpcm)
+
+	starts := 0
+	r := &VADReader{}
+	r.OnSpeechStart = func() { starts++ }
+	require.NoError(t, r.Init(media.CodecAudioUlaw, bytes.NewReader(encoded)))
+
+	var out []byte
+	buf := make([]byte, 160)
+	for {
+		n, err := r.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		out = append(out, buf[:n]...)
+	}
+	// Audio is passed unchanged
+	assert.Equal(t, encoded, out)
+	assert.Equal(t, 1, starts)
+	assert.False(t, r.Speaking())
+}
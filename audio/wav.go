@@ -9,7 +9,10 @@ import (
 )
 
 const (
-	WavAudioFormatPCM = 1
+	WavAudioFormatPCM        = 1
+	WavAudioFormatALaw       = 6
+	WavAudioFormatULaw       = 7
+	WavAudioFormatExtensible = 0xFFFE
 )
 
 // WavWriteVoipPCM is normally 16 bit mono 8000 PCM
@@ -4,79 +4,141 @@
 package audio
 
 import (
+	"encoding/binary"
+	"fmt"
 	"io"
 
 	"github.com/go-audio/riff"
 )
 
+// WavReader reads wav headers and data. Chunks other than fmt and data, like LIST or fact, are skipped.
+// Supported are PCM, G.711 μ-law and A-law formats, also as WAVE_FORMAT_EXTENSIBLE
 type WavReader struct {
 	riff.Parser
-	chunkData *riff.Chunk
-	DataSize  int
+	// AudioFormat is format of data. For WAVE_FORMAT_EXTENSIBLE it is sub format,
+	// while Parser WavAudioFormat holds format tag as in file
+	AudioFormat uint16
+	// DataSize is -1 when unknown
+	DataSize int
+
+	r         io.Reader
+	fmtFound  bool
+	dataFound bool
+	dataLeft  int64
 }
 
 func NewWavReader(r io.Reader) *WavReader {
 	parser := riff.New(r)
-	reader := WavReader{Parser: *parser}
+	reader := WavReader{Parser: *parser, r: r}
 	return &reader
 }
 
 // ReadHeaders reads until data chunk
 func (r *WavReader) ReadHeaders() error {
-	if err := r.readHeaders(); err != nil {
-		return err
-	}
-
-	return r.readDataChunk()
-}
-
-func (r *WavReader) readHeaders() error {
 	if err := r.Parser.ParseHeaders(); err != nil {
 		return err
 	}
+	if r.Format != riff.WavFormatID {
+		return fmt.Errorf("riff format %q is not WAVE", r.Format[:])
+	}
+
 	for {
-		chunk, err := r.NextChunk()
-		if err != nil {
+		var id [4]byte
+		var size uint32
+		if err := binary.Read(r.r, binary.BigEndian, &id); err != nil {
+			return err
+		}
+		if err := binary.Read(r.r, binary.LittleEndian, &size); err != nil {
 			return err
 		}
 
-		if chunk.ID != riff.FmtID {
-			chunk.Drain()
-			continue
+		switch id {
+		case riff.FmtID:
+			if err := r.readFmt(size); err != nil {
+				return err
+			}
+			r.fmtFound = true
+		case riff.DataFormatID:
+			if !r.fmtFound {
+				return fmt.Errorf("wav data chunk before fmt chunk")
+			}
+			r.dataFound = true
+			r.DataSize = int(size)
+			r.dataLeft = int64(size)
+			if size == 0xFFFFFFFF {
+				// Unknown size of streamed wav. Read until EOF
+				r.DataSize = -1
+				r.dataLeft = -1
+			}
+			return nil
+		default:
+			if err := r.skip(int64(size) + int64(size%2)); err != nil {
+				return err
+			}
 		}
-		return chunk.DecodeWavHeader(&r.Parser)
 	}
 }
 
-func (r *WavReader) readDataChunk() error {
-	// if r.Size == 0 {
-	// 	r.Parser.ParseHeaders()
-	// }
+func (r *WavReader) readFmt(size uint32) error {
+	if size < 16 {
+		return fmt.Errorf("wav fmt chunk too small size=%d", size)
+	}
+	buf := make([]byte, size+size%2)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return err
+	}
 
-	for {
-		chunk, err := r.NextChunk()
-		if err != nil {
-			return err
-		}
+	le := binary.LittleEndian
+	r.WavAudioFormat = le.Uint16(buf[0:])
+	r.NumChannels = le.Uint16(buf[2:])
+	r.SampleRate = le.Uint32(buf[4:])
+	r.AvgBytesPerSec = le.Uint32(buf[8:])
+	r.BlockAlign = le.Uint16(buf[12:])
+	r.BitsPerSample = le.Uint16(buf[14:])
 
-		if chunk.ID != riff.DataFormatID {
-			chunk.Drain()
-			continue
+	r.AudioFormat = r.WavAudioFormat
+	if r.WavAudioFormat == WavAudioFormatExtensible {
+		// cbSize(2) validBits(2) channelMask(4) subFormat GUID(16) starting with format tag
+		if size < 40 {
+			return fmt.Errorf("wav extensible fmt chunk too small size=%d", size)
 		}
-		r.chunkData = chunk
-		r.DataSize = chunk.Size
-		return nil
+		r.AudioFormat = le.Uint16(buf[24:])
+	}
+	return nil
+}
+
+func (r *WavReader) skip(n int64) error {
+	if s, ok := r.r.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekCurrent)
+		return err
 	}
+	_, err := io.CopyN(io.Discard, r.r, n)
+	return err
 }
 
-// Read returns PCM underneath
+// Read returns audio data underneath. Use PCMReader to read data as 16 bit PCM
 func (r *WavReader) Read(buf []byte) (n int, err error) {
-	if r.chunkData != nil {
-		return r.chunkData.Read(buf)
+	if !r.dataFound {
+		if err := r.ReadHeaders(); err != nil {
+			return 0, err
+		}
+	}
+
+	switch {
+	case r.dataLeft == 0:
+		return 0, io.EOF
+	case r.dataLeft > 0 && int64(len(buf)) > r.dataLeft:
+		buf = buf[:r.dataLeft]
 	}
 
-	if err := r.readDataChunk(); err != nil {
-		return 0, err
+	n, err = r.r.Read(buf)
+	if r.dataLeft > 0 {
+		r.dataLeft -= int64(n)
 	}
-	return r.chunkData.Read(buf)
+	return n, err
+}
+
+// PCMReader returns reader of data converted to 16 bit PCM. Headers must be read before
+func (r *WavReader) PCMReader() (io.Reader, error) {
+	return NewPCM16Reader(r.AudioFormat, int(r.BitsPerSample), r)
 }
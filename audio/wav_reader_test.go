@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWavChunks builds wav from chunks. Odd sized chunks are padded
+func testWavChunks(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, ch := range chunks {
+		body = append(body, ch...)
+		if len(ch)%2 == 1 {
+			body = append(body, 0)
+		}
+	}
+	data := []byte("RIFF")
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(body)))
+	return append(data, body...)
+}
+
+func testChunk(id string, payload []byte) []byte {
+	ch := []byte(id)
+	ch = binary.LittleEndian.AppendUint32(ch, uint32(len(payload)))
+	return append(ch, payload...)
+}
+
+func testFmt(format uint16, channels uint16, rate uint32, bits uint16, extensible bool) []byte {
+	le := binary.LittleEndian
+	align := channels * bits / 8
+	fmtTag := format
+	if extensible {
+		fmtTag = WavAudioFormatExtensible
+	}
+	b := le.AppendUint16(nil, fmtTag)
+	b = le.AppendUint16(b, channels)
+	b = le.AppendUint32(b, rate)
+	b = le.AppendUint32(b, rate*uint32(align))
+	b = le.AppendUint16(b, align)
+	b = le.AppendUint16(b, bits)
+	if extensible {
+		b = le.AppendUint16(b, 22)
+		b = le.AppendUint16(b, bits)
+		b = le.AppendUint32(b, 0x4)
+		guid := le.AppendUint16(nil, format)
+		guid = append(guid, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71)
+		b = append(b, guid...)
+	}
+	return testChunk("fmt ", b)
+}
+
+func TestWavReader(t *testing.T) {
+	t.Run("ExtensibleULaw", func(t *testing.T) {
+		ulaw := []byte{0xff, 0x7f, 0x00, 0x80, 0xff}
+		data := testWavChunks(
+			testChunk("JUNK", []byte{1, 2, 3}),
+			testFmt(WavAudioFormatULaw, 1, 8000, 8, true),
+			testChunk("fact", []byte{5, 0, 0, 0}),
+			testChunk("LIST", []byte("INFOISFT\x05\x00\x00\x00test\x00")),
+			testChunk("data", ulaw),
+			testChunk("LIST", []byte("trailing")),
+		)
+
+		r := NewWavReader(bytes.NewReader(data))
+		require.NoError(t, r.ReadHeaders())
+		assert.Equal(t, uint16(WavAudioFormatExtensible), r.WavAudioFormat)
+		assert.Equal(t, uint16(WavAudioFormatULaw), r.AudioFormat)
+		assert.Equal(t, uint32(8000), r.SampleRate)
+		assert.Equal(t, 5, r.DataSize)
+
+		// Trailing chunks are not part of data
+		read, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, ulaw, read)
+	})
+
+	t.Run("ALawPCM", func(t *testing.T) {
+		alaw := []byte{0xd5, 0x55, 0x2a, 0xaa}
+		data := testWavChunks(testFmt(WavAudioFormatALaw, 1, 8000, 8, false), testChunk("data", alaw))
+
+		r := NewWavReader(bytes.NewReader(data))
+		require.NoError(t, r.ReadHeaders())
+		pcm, err := r.PCMReader()
+		require.NoError(t, err)
+		lpcm, err := io.ReadAll(pcm)
+		require.NoError(t, err)
+
+		expected := make([]byte, 2*len(alaw))
+		DecodeAlawTo(expected, alaw)
+		assert.Equal(t, expected, lpcm)
+	})
+
+	t.Run("PCM8", func(t *testing.T) {
+		data := testWavChunks(testFmt(WavAudioFormatPCM, 1, 8000, 8, false), testChunk("data", []byte{0, 128, 255}))
+
+		r := NewWavReader(bytes.NewReader(data))
+		require.NoError(t, r.ReadHeaders())
+		pcm, err := r.PCMReader()
+		require.NoError(t, err)
+		lpcm, err := io.ReadAll(pcm)
+		require.NoError(t, err)
+
+		samples := make([]int16, 3)
+		require.NoError(t, binary.Read(bytes.NewReader(lpcm), binary.LittleEndian, samples))
+		assert.Equal(t, []int16{-32768, 0, 32512}, samples)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		data := testWavChunks(testFmt(3, 1, 8000, 32, false), testChunk("data", make([]byte, 8)))
+		r := NewWavReader(bytes.NewReader(data))
+		require.NoError(t, r.ReadHeaders())
+		_, err := r.PCMReader()
+		require.Error(t, err)
+	})
+
+	t.Run("UnknownSize", func(t *testing.T) {
+		data := testWavChunks(testFmt(WavAudioFormatPCM, 1, 8000, 16, false), testChunk("data", []byte{1, 2, 3, 4}))
+		binary.LittleEndian.PutUint32(data[len(data)-8:], 0xFFFFFFFF)
+
+		r := NewWavReader(bytes.NewReader(data))
+		require.NoError(t, r.ReadHeaders())
+		assert.Equal(t, -1, r.DataSize)
+		read, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1, 2, 3, 4}, read)
+	})
+
+	t.Run("NoFmt", func(t *testing.T) {
+		data := testWavChunks(testChunk("data", make([]byte, 8)))
+		r := NewWavReader(bytes.NewReader(data))
+		require.Error(t, r.ReadHeaders())
+	})
+}
+
+func TestAuReader(t *testing.T) {
+	be := binary.BigEndian
+	testAu := func(encoding uint32, annotation []byte, data []byte) []byte {
+		b := []byte(".snd")
+		b = be.AppendUint32(b, uint32(24+len(annotation)))
+		b = be.AppendUint32(b, uint32(len(data)))
+		b = be.AppendUint32(b, encoding)
+		b = be.AppendUint32(b, 8000)
+		b = be.AppendUint32(b, 1)
+		b = append(b, annotation...)
+		return append(b, data...)
+	}
+
+	t.Run("ULaw", func(t *testing.T) {
+		ulaw := []byte{0xff, 0x7f, 0x00, 0x80}
+		r := NewAuReader(bytes.NewReader(testAu(AuEncodingULaw, []byte("note\x00\x00\x00\x00"), ulaw)))
+		require.NoError(t, r.ReadHeaders())
+		format, bits, err := r.AudioFormat()
+		require.NoError(t, err)
+		assert.Equal(t, uint16(WavAudioFormatULaw), format)
+		assert.Equal(t, 8, bits)
+
+		read, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, ulaw, read)
+	})
+
+	t.Run("PCM16", func(t *testing.T) {
+		r := NewAuReader(bytes.NewReader(testAu(AuEncodingPCM16, nil, []byte{0x12, 0x34, 0xff, 0xfe})))
+		require.NoError(t, r.ReadHeaders())
+		pcm, err := r.PCMReader()
+		require.NoError(t, err)
+		lpcm, err := io.ReadAll(pcm)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x34, 0x12, 0xfe, 0xff}, lpcm)
+	})
+
+	t.Run("NotAu", func(t *testing.T) {
+		r := NewAuReader(bytes.NewReader(make([]byte, 32)))
+		require.Error(t, r.ReadHeaders())
+	})
+}
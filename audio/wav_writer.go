@@ -6,6 +6,12 @@ package audio
 import (
 	"encoding/binary"
 	"io"
+	"time"
+)
+
+var (
+	// WavHeaderUpdateInterval is default interval of updating sizes in wav header while writing
+	WavHeaderUpdateInterval = time.Second
 )
 
 type WavWriter struct {
@@ -13,10 +19,14 @@ type WavWriter struct {
 	BitDepth    int
 	NumChans    int
 	AudioFormat int
+	// HeaderUpdateInterval is how often header is updated with current data size,
+	// so that partially written file is playable. Zero updates header only on Close
+	HeaderUpdateInterval time.Duration
 
 	W              io.WriteSeeker
 	headersWritten bool
 	dataSize       int64
+	headerUpdated  time.Time
 }
 
 func NewWavWriter(w io.WriteSeeker) *WavWriter {
@@ -27,13 +37,24 @@ func NewWavWriter(w io.WriteSeeker) *WavWriter {
 		AudioFormat: 1, // 1 PCM
 		dataSize:    0,
 		W:           w,
+
+		HeaderUpdateInterval: WavHeaderUpdateInterval,
 	}
 }
 
 func (ww *WavWriter) Write(audio []byte) (int, error) {
 	n, err := ww.writeData(audio)
 	ww.dataSize += int64(n)
-	return n, err
+	if err != nil {
+		return n, err
+	}
+
+	if ww.HeaderUpdateInterval > 0 && time.Since(ww.headerUpdated) >= ww.HeaderUpdateInterval {
+		if err := ww.updateHeader(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
 }
 
 func (ww *WavWriter) writeData(audio []byte) (int, error) {
@@ -47,6 +68,7 @@ func (ww *WavWriter) writeData(audio []byte) (int, error) {
 		return 0, err
 	}
 	ww.headersWritten = true
+	ww.headerUpdated = time.Now()
 
 	n, err := w.Write(audio)
 	return n, err
@@ -91,16 +113,24 @@ func (ww *WavWriter) writeHeader() (int, error) {
 	return w.Write(header)
 }
 
-func (ww *WavWriter) Close() error {
-	// It is needed to finalize and update wav
-	_, err := ww.W.Seek(0, 0)
+// updateHeader rewrites header with current data size and continues writing at end
+func (ww *WavWriter) updateHeader() error {
+	pos, err := ww.W.Seek(0, io.SeekCurrent)
 	if err != nil {
 		return err
 	}
-	// Update header.
-	_, err = ww.writeHeader()
-	if err != nil {
+	if _, err := ww.W.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ww.writeHeader(); err != nil {
 		return err
 	}
+	ww.headerUpdated = time.Now()
+	_, err = ww.W.Seek(pos, io.SeekStart)
 	return err
 }
+
+func (ww *WavWriter) Close() error {
+	// It is needed to finalize and update wav
+	return ww.updateHeader()
+}
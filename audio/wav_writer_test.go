@@ -5,8 +5,10 @@ package audio
 
 import (
 	"bytes"
+	"encoding/binary"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/go-audio/riff"
 	"github.com/stretchr/testify/assert"
@@ -45,3 +47,36 @@ func TestWavWriter(t *testing.T) {
 	assert.EqualValues(t, 8000, p.SampleRate)
 	assert.EqualValues(t, 100, w.dataSize)
 }
+
+func TestWavWriterHeaderUpdate(t *testing.T) {
+	f, err := os.OpenFile("/tmp/test-waw-writer-update.wav", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0755)
+	require.NoError(t, err)
+	defer f.Close()
+
+	dataSize := func() uint32 {
+		header := make([]byte, 44)
+		_, err := f.ReadAt(header, 0)
+		require.NoError(t, err)
+		return binary.LittleEndian.Uint32(header[40:])
+	}
+
+	w := NewWavWriter(f)
+	w.HeaderUpdateInterval = time.Millisecond
+	_, err = w.Write(bytes.Repeat([]byte{1}, 100))
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, dataSize())
+
+	time.Sleep(2 * time.Millisecond)
+	_, err = w.Write(bytes.Repeat([]byte{1}, 100))
+	require.NoError(t, err)
+	// Header is updated without closing and writing continues at end
+	assert.EqualValues(t, 200, dataSize())
+	_, err = w.Write(bytes.Repeat([]byte{1}, 100))
+	require.NoError(t, err)
+
+	require.NoError(t, w.Close())
+	assert.EqualValues(t, 300, dataSize())
+	stat, err := f.Stat()
+	require.NoError(t, err)
+	assert.EqualValues(t, 344, stat.Size())
+}
@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/vertan/diago/media"
+)
+
+// audioTap copies audio to attached writers. Writers can be attached and detached while audio flows
+type audioTap struct {
+	mu      sync.Mutex
+	targets []*audioTapTarget
+}
+
+type audioTapTarget struct {
+	w io.Writer
+}
+
+// attach adds writer and returns func to detach it
+func (t *audioTap) attach(w io.Writer) (detach func()) {
+	target := &audioTapTarget{w: w}
+	t.mu.Lock()
+	t.targets = append(t.targets, target)
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.targets = slices.DeleteFunc(t.targets, func(x *audioTapTarget) bool { return x == target })
+	}
+}
+
+// write passes audio to attached writers. Failed writer is detached, so that audio flow is not affected
+func (t *audioTap) write(b []byte, log *slog.Logger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := 0; i < len(t.targets); {
+		if _, err := t.targets[i].w.Write(b); err != nil {
+			log.Error("Audio tap write failed. Writer is detached", "error", err)
+			t.targets = slices.Delete(t.targets, i, i+1)
+			continue
+		}
+		i++
+	}
+}
+
+// audioTapReader passes read audio to tap
+type audioTapReader struct {
+	r   io.Reader
+	tap *audioTap
+	log *slog.Logger
+}
+
+func (r *audioTapReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n > 0 {
+		r.tap.write(b[:n], r.log)
+	}
+	return n, err
+}
+
+// audioTapWriter passes written audio to tap
+type audioTapWriter struct {
+	w   io.Writer
+	tap *audioTap
+	log *slog.Logger
+}
+
+func (w *audioTapWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	if n > 0 {
+		w.tap.write(b[:n], w.log)
+	}
+	return n, err
+}
+
+// dialogAudioTaps are installed once on dialog audio reader and writer. Forks like media stream and SIPREC
+// attach and detach on them, so dialog readers and writers are not changed when fork stops
+type dialogAudioTaps struct {
+	read  audioTap
+	write audioTap
+	dtmf  dtmfTap
+}
+
+// dtmfTap passes received DTMF digits to attached funcs
+type dtmfTap struct {
+	mu      sync.Mutex
+	targets []*dtmfTapTarget
+}
+
+type dtmfTapTarget struct {
+	f func(digit rune)
+}
+
+// attach adds func and returns func to detach it
+func (t *dtmfTap) attach(f func(digit rune)) (detach func()) {
+	target := &dtmfTapTarget{f: f}
+	t.mu.Lock()
+	t.targets = append(t.targets, target)
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.targets = slices.DeleteFunc(t.targets, func(x *dtmfTapTarget) bool { return x == target })
+	}
+}
+
+func (t *dtmfTap) write(digit rune) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, target := range t.targets {
+		target.f(digit)
+	}
+}
+
+// dialogTapReader passes read audio to taps. Only payloads of audio codec are passed as audio,
+// and telephone events are passed as digits
+type dialogTapReader struct {
+	r            io.Reader
+	taps         *dialogAudioTaps
+	log          *slog.Logger
+	packetReader *media.RTPPacketReader
+	codec        media.Codec
+	dtmfCodec    media.Codec
+
+	dtmfTimestamp uint32
+	dtmfSent      bool
+}
+
+func (r *dialogTapReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n <= 0 {
+		return n, err
+	}
+
+	hdr := r.packetReader.PacketHeader
+	switch hdr.PayloadType {
+	case r.codec.PayloadType:
+		r.taps.read.write(b[:n], r.log)
+	case r.dtmfCodec.PayloadType:
+		ev := media.DTMFEvent{}
+		if derr := media.DTMFDecode(b[:n], &ev); derr != nil {
+			return n, err
+		}
+		// Event packets share timestamp and end packet is repeated
+		if hdr.Timestamp != r.dtmfTimestamp {
+			r.dtmfTimestamp = hdr.Timestamp
+			r.dtmfSent = false
+		}
+		if ev.EndOfEvent && !r.dtmfSent {
+			r.dtmfSent = true
+			r.taps.dtmf.write(media.DTMFToRune(ev.Event))
+		}
+	}
+	return n, err
+}
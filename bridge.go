@@ -9,8 +9,10 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"slices"
 	"time"
 
+	"github.com/vertan/diago/audio"
 	"github.com/vertan/diago/media"
 )
 
@@ -23,13 +25,30 @@ type Bridge struct {
 	Originator DialogSession
 	// DTMFpass is also dtmf pipeline and proxy. By default only audio media is proxied
 	DTMFpass bool
+	// Transcode allows bridging dialogs with different codecs. Audio is decoded, resampled if needed
+	// and encoded to other codec, which is more CPU expensive than proxy.
+	// By default dialogs must have same codec
+	//
+	// Experimental
+	Transcode bool
+
+	// RTPpass relays RTP packets between dialogs without decoding, see media.RTPRelay.
+	// This gives high performance but you can not attach any pipeline in media processing.
+	// Codecs must match, and telephone-event is passed as is with payload type remapped
+	//
+	// Experimental
+	RTPpass bool
 
 	log *slog.Logger
-	// TODO: RTPpass. RTP pass means that RTP will be proxied.
-	// This gives high performance but you can not attach any pipeline in media processing
-	// RTPpass bool
 
-	dialogs []DialogSession
+	dialogs   []DialogSession
+	recording *BridgeRecording
+	// taps receive audio read from each leg, see SIPRECInviteBridge
+	taps [2]*audioTap
+	// supervision mixes supervisor audio into legs, see Supervise
+	supervision *bridgeSupervision
+	// proxyDone is closed when proxy started with AddDialogSession is finished
+	proxyDone chan struct{}
 
 	// minDialogs is just helper flag when to start proxy
 	WaitDialogsNum int
@@ -43,6 +62,8 @@ func NewBridge() Bridge {
 
 func (b *Bridge) Init(log *slog.Logger) {
 	b.log = log
+	b.taps = [2]*audioTap{{}, {}}
+	b.supervision = &bridgeSupervision{injects: [2]*bridgeInject{newBridgeInject(), newBridgeInject()}}
 	if b.WaitDialogsNum == 0 {
 		b.WaitDialogsNum = 2
 	}
@@ -53,8 +74,8 @@ func (b *Bridge) GetDialogs() []DialogSession {
 }
 
 func (b *Bridge) AddDialogSession(d DialogSession) error {
-	// Check can this dialog be added to bridge. NO TRANSCODING
-	if b.Originator != nil {
+	// Check can this dialog be added to bridge. NO TRANSCODING unless enabled
+	if b.Originator != nil && !b.Transcode {
 		// This may look ugly but it is safe way of reading
 		origM := b.Originator.Media()
 		origProps := MediaProps{}
@@ -65,7 +86,7 @@ func (b *Bridge) AddDialogSession(d DialogSession) error {
 		_ = m.audioWriterProps(&mprops)
 
 		err := func() error {
-			if origProps.Codec != mprops.Codec {
+			if !origProps.Codec.Equal(mprops.Codec) {
 				return fmt.Errorf("no transcoding supported in bridge codec1=%+v codec2=%+v", origProps.Codec, mprops.Codec)
 			}
 			return nil
@@ -75,17 +96,19 @@ func (b *Bridge) AddDialogSession(d DialogSession) error {
 		}
 	}
 
+	unlock := b.lockDialogs()
 	b.dialogs = append(b.dialogs, d)
 	if len(b.dialogs) == 1 {
 		b.Originator = d
 	}
+	unlock()
 
 	if len(b.dialogs) < b.WaitDialogsNum {
 		return nil
 	}
 
 	if len(b.dialogs) > 2 {
-		return fmt.Errorf("currently bridge only support 2 party")
+		return fmt.Errorf("currently bridge only support 2 party. Use Conference for more")
 	}
 	// Check are both answered
 	for _, d := range b.dialogs {
@@ -95,7 +118,10 @@ func (b *Bridge) AddDialogSession(d DialogSession) error {
 		}
 	}
 
+	done := make(chan struct{})
+	b.proxyDone = done
 	go func() {
+		defer close(done)
 		defer func(start time.Time) {
 			b.log.Info("Proxy media setup", "dur", time.Since(start).String())
 		}(time.Now())
@@ -110,6 +136,108 @@ func (b *Bridge) AddDialogSession(d DialogSession) error {
 	return nil
 }
 
+// removeDialogSession removes dialog from bridge. Proxy is stopped as it can not continue without dialog
+func (b *Bridge) removeDialogSession(d DialogSession) {
+	i := slices.Index(b.dialogs, d)
+	if i < 0 {
+		return
+	}
+
+	if b.proxyDone != nil {
+		for _, d := range b.dialogs {
+			if sess := d.Media().mediaSession; sess != nil {
+				sess.StopRTP(1, 0)
+			}
+		}
+		<-b.proxyDone
+		b.proxyDone = nil
+
+		for _, dd := range b.dialogs {
+			if sess := dd.Media().mediaSession; dd != d && sess != nil {
+				sess.StartRTP(1)
+			}
+		}
+	}
+
+	unlock := b.lockDialogs()
+	defer unlock()
+	b.dialogs = slices.Delete(b.dialogs, i, i+1)
+	if b.Originator == d {
+		b.Originator = nil
+		if len(b.dialogs) > 0 {
+			b.Originator = b.dialogs[0]
+		}
+	}
+}
+
+// lockDialogs locks dialogs against concurrent reading with dialogsCopy
+func (b *Bridge) lockDialogs() (unlock func()) {
+	if b.supervision == nil {
+		return func() {}
+	}
+	b.supervision.dialogsMu.Lock()
+	return b.supervision.dialogsMu.Unlock
+}
+
+// dialogsCopy returns copy of dialogs which is safe to use while dialogs change
+func (b *Bridge) dialogsCopy() []DialogSession {
+	unlock := b.lockDialogs()
+	defer unlock()
+	return slices.Clone(b.dialogs)
+}
+
+// RecordingCreate records incoming audio of both legs as wav. Each leg is decoded with own codec,
+// so legs with different codecs are recorded. Recording must be created after originator is added
+// and before proxy media starts, and it is not possible with RTPpass.
+// Recording must be closed after bridge is finished
+//
+// Experimental
+func (b *Bridge) RecordingCreate(wavFile io.WriteSeeker, opts BridgeRecordingOptions) (*BridgeRecording, error) {
+	if b.RTPpass {
+		return nil, fmt.Errorf("recording is not possible with RTPpass")
+	}
+	if b.Originator == nil {
+		return nil, fmt.Errorf("bridge has no originator dialog")
+	}
+	if b.recording != nil {
+		return nil, fmt.Errorf("bridge is already recorded")
+	}
+
+	if opts.SampleRate == 0 {
+		props := MediaProps{}
+		if r := b.Originator.Media().audioReaderProps(&props); r == nil {
+			return nil, fmt.Errorf("no media setup")
+		}
+		opts.SampleRate = int(props.Codec.SampleRate)
+	}
+	b.recording = newBridgeRecording(wavFile, opts)
+	return b.recording, nil
+}
+
+// legReader returns reader passing audio of dialog media to leg tap and recording, if bridge is recorded
+func (b *Bridge) legReader(m *DialogMedia, codec media.Codec, r io.Reader) (io.Reader, error) {
+	ch := 1
+	if b.dialogs[0].Media() == m {
+		ch = 0
+	}
+	if tap := b.taps[ch]; tap != nil {
+		r = &audioTapReader{r: r, tap: tap, log: b.log}
+	}
+	if b.recording == nil {
+		return r, nil
+	}
+	return b.recording.tapReader(ch, codec, r, b.log)
+}
+
+func dialogCallID(d DialogSession) string {
+	if req := d.DialogSIP().InviteRequest; req != nil {
+		if h := req.CallID(); h != nil {
+			return h.Value()
+		}
+	}
+	return d.Id()
+}
+
 // ProxyMedia is explicit starting proxy media.
 // In some cases you want to control and be signaled when bridge terminates
 //
@@ -164,19 +292,57 @@ func (b *Bridge) proxyMedia() error {
 	var err error
 	log := b.log
 
+	// Stops supervisor audio pacing of leg writers
+	done := make(chan struct{})
+	defer close(done)
+
 	m1 := b.dialogs[0].Media()
 	m2 := b.dialogs[1].Media()
+	if b.recording != nil {
+		b.recording.setCallIDs([]string{dialogCallID(b.dialogs[0]), dialogCallID(b.dialogs[1])})
+	}
 
 	// Lets for now simplify proxy and later optimize
+	if b.Transcode && b.needsTranscoding(m1, m2) {
+		errCh := make(chan error, 2)
+		go func() {
+			errCh <- b.proxyMediaTranscode(m1, m2, done)
+		}()
+
+		go func() {
+			errCh <- b.proxyMediaTranscode(m2, m1, done)
+		}()
+
+		for i := 0; i < 2; i++ {
+			err = errors.Join(err, <-errCh)
+		}
+		return err
+	}
+
+	if b.RTPpass {
+		errCh := make(chan error, 2)
+		go func() {
+			errCh <- b.proxyMediaRTP(m1, m2)
+		}()
+
+		go func() {
+			errCh <- b.proxyMediaRTP(m2, m1)
+		}()
+
+		for i := 0; i < 2; i++ {
+			err = errors.Join(err, <-errCh)
+		}
+		return err
+	}
 
 	if b.DTMFpass {
 		errCh := make(chan error, 4)
 		go func() {
-			errCh <- b.proxyMediaWithDTMF(m1, m2)
+			errCh <- b.proxyMediaWithDTMF(m1, m2, done)
 		}()
 
 		go func() {
-			errCh <- b.proxyMediaWithDTMF(m2, m1)
+			errCh <- b.proxyMediaWithDTMF(m2, m1, done)
 		}()
 
 		// Wait for all to finish
@@ -189,7 +355,13 @@ func (b *Bridge) proxyMedia() error {
 	func() {
 		p1, p2 := MediaProps{}, MediaProps{}
 		r := m1.audioReaderProps(&p1)
+		r, err := b.legReader(m1, p1.Codec, r)
+		if err != nil {
+			errCh <- err
+			return
+		}
 		w := m2.audioWriterProps(&p2)
+		w = b.legWriter(m2, p2.Codec, w, done)
 
 		log := log.With("from", p1.Raddr+" > "+p1.Laddr, "to", p2.Laddr+" > "+p2.Raddr)
 		log.Debug("Starting proxy media routine")
@@ -200,7 +372,13 @@ func (b *Bridge) proxyMedia() error {
 	func() {
 		p1, p2 := MediaProps{}, MediaProps{}
 		r := m2.audioReaderProps(&p1)
+		r, err := b.legReader(m2, p1.Codec, r)
+		if err != nil {
+			errCh <- err
+			return
+		}
 		w := m1.audioWriterProps(&p2)
+		w = b.legWriter(m1, p2.Codec, w, done)
 		log := log.With("from", p1.Raddr+" > "+p1.Laddr, "to", p2.Laddr+" > "+p2.Raddr)
 		log.Debug("Starting proxy media routine")
 		go proxyMediaBackground(log, r, w, errCh)
@@ -226,18 +404,23 @@ func proxyMediaBackground(log *slog.Logger, reader io.Reader, writer io.Writer,
 	ch <- err
 }
 
-func (b *Bridge) proxyMediaWithDTMF(m1 *DialogMedia, m2 *DialogMedia) error {
+func (b *Bridge) proxyMediaWithDTMF(m1 *DialogMedia, m2 *DialogMedia, done <-chan struct{}) error {
 	dtmfReader := DTMFReader{}
 	p1, p2 := MediaProps{}, MediaProps{}
 	r, err := m1.AudioReader(WithAudioReaderDTMF(&dtmfReader), WithAudioReaderMediaProps(&p1))
 	if err != nil {
 		return err
 	}
+	r, err = b.legReader(m1, p1.Codec, r)
+	if err != nil {
+		return err
+	}
 	dtmfWriter := DTMFWriter{}
 	w, err := m2.AudioWriter(WithAudioWriterDTMF(&dtmfWriter), WithAudioWriterMediaProps(&p2))
 	if err != nil {
 		return err
 	}
+	w = b.legWriter(m2, p2.Codec, w, done)
 	dtmfReader.OnDTMF(func(dtmf rune) error {
 		return dtmfWriter.WriteDTMF(dtmf)
 	})
@@ -252,6 +435,184 @@ func (b *Bridge) proxyMediaWithDTMF(m1 *DialogMedia, m2 *DialogMedia) error {
 	return err
 }
 
+func (b *Bridge) needsTranscoding(m1 *DialogMedia, m2 *DialogMedia) bool {
+	p1, p2 := MediaProps{}, MediaProps{}
+	_ = m1.audioWriterProps(&p1)
+	_ = m2.audioWriterProps(&p2)
+	return !p1.Codec.Equal(p2.Codec)
+}
+
+// proxyMediaTranscode decodes audio from m1, resamples if needed and encodes to m2 codec.
+// DTMF is passed as events, so telephone-event payload types can differ
+func (b *Bridge) proxyMediaTranscode(m1 *DialogMedia, m2 *DialogMedia, done <-chan struct{}) error {
+	p1, p2 := MediaProps{}, MediaProps{}
+	readerOpts := []AudioReaderOption{WithAudioReaderMediaProps(&p1)}
+	writerOpts := []AudioWriterOption{WithAudioWriterMediaProps(&p2)}
+
+	dtmfReader, dtmfWriter := DTMFReader{}, DTMFWriter{}
+	if b.DTMFpass {
+		readerOpts = append(readerOpts, WithAudioReaderDTMF(&dtmfReader))
+		writerOpts = append(writerOpts, WithAudioWriterDTMF(&dtmfWriter))
+	}
+
+	r, err := m1.AudioReader(readerOpts...)
+	if err != nil {
+		return err
+	}
+	r, err = b.legReader(m1, p1.Codec, r)
+	if err != nil {
+		return err
+	}
+	w, err := m2.AudioWriter(writerOpts...)
+	if err != nil {
+		return err
+	}
+	w = b.legWriter(m2, p2.Codec, w, done)
+
+	if b.DTMFpass {
+		dtmfReader.OnDTMF(func(dtmf rune) error {
+			return dtmfWriter.WriteDTMF(dtmf)
+		})
+	}
+
+	decoder := audio.PCMDecoderReader{}
+	if err := decoder.Init(p1.Codec, r); err != nil {
+		return fmt.Errorf("failed to create decoder: %w", err)
+	}
+	defer decoder.Close()
+
+	encoder := audio.PCMEncoderWriter{}
+	if err := encoder.Init(p2.Codec, w); err != nil {
+		return fmt.Errorf("failed to create encoder: %w", err)
+	}
+
+	var pcmWriter io.Writer = &encoder
+	c1, c2 := p1.Codec, p2.Codec
+	if c1.SampleRate != c2.SampleRate || c1.NumChannels != c2.NumChannels {
+		resampler := audio.PCMResamplerWriter{}
+		if err := resampler.Init(&encoder, int(c1.SampleRate), c1.NumChannels, int(c2.SampleRate), c2.NumChannels); err != nil {
+			return err
+		}
+		pcmWriter = &resampler
+	}
+
+	log := b.log.With("from", p1.Raddr+" > "+p1.Laddr, "to", p2.Laddr+" > "+p2.Raddr)
+	log.Debug("Starting transcode media routine", "codec1", c1.Name, "codec2", c2.Name)
+
+	// Decoder expects buffer to fit decoded frame
+	buf := make([]byte, c1.Samples16())
+	written, err := copyWithBuf(&decoder, pcmWriter, buf)
+	log.Debug("Transcode media routine finished", "bytes", written)
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		log.Debug("Transcode media stopped with timeout. RTP Deadline", "error", err)
+		return nil
+	}
+	return err
+}
+
+// proxyMediaRTP relays RTP packets from m1 to m2. Outgoing stream continues stream
+// of m2 RTPPacketWriter, so playback before and after bridge keeps same SSRC
+func (b *Bridge) proxyMediaRTP(m1 *DialogMedia, m2 *DialogMedia) error {
+	p1, p2 := MediaProps{}, MediaProps{}
+	_ = m1.audioReaderProps(&p1)
+	_ = m2.audioWriterProps(&p2)
+
+	m1.mu.Lock()
+	reader := m1.rtpSession
+	m1.mu.Unlock()
+
+	m2.mu.Lock()
+	writer := m2.rtpSession
+	packetWriter := m2.RTPPacketWriter
+	m2.mu.Unlock()
+
+	if reader == nil || writer == nil {
+		return fmt.Errorf("rtp session not established")
+	}
+
+	relay := media.RTPRelay{}
+	relay.Init(reader, writer)
+	relay.SSRC = packetWriter.SSRC
+	if h := packetWriter.PacketHeader; h.SSRC != 0 {
+		relay.ContinueStream(h)
+	}
+
+	ev1 := media.CodecTelephoneEventFromSession(reader.Sess)
+	ev2 := media.CodecTelephoneEventFromSession(writer.Sess)
+	if ev1.PayloadType != ev2.PayloadType {
+		relay.PayloadTypes = map[uint8]uint8{ev1.PayloadType: ev2.PayloadType}
+	}
+
+	// Relay follows media updates of both dialogs
+	m1.addRTPRelay(&relay, reader)
+	defer m1.removeRTPRelay(&relay)
+	m2.addRTPRelay(&relay, writer)
+	defer m2.removeRTPRelay(&relay)
+
+	log := b.log.With("from", p1.Raddr+" > "+p1.Laddr, "to", p2.Laddr+" > "+p2.Raddr)
+	log.Debug("Starting RTP relay routine")
+	written, err := relay.Relay()
+	log.Debug("RTP relay routine finished", "bytes", written)
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		log.Debug("RTP relay stopped with timeout. RTP Deadline", "error", err)
+		return nil
+	}
+	return err
+}
+
+// addRTPRelay makes relay follow rtp session changes. Session is one relay was created with
+func (d *DialogMedia) addRTPRelay(relay *media.RTPRelay, sess *media.RTPSession) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rtpRelays = append(d.rtpRelays, relay)
+	if d.rtpSession != sess {
+		// Media was updated meanwhile
+		relay.UpdateRTPSession(sess, d.rtpSession)
+	}
+}
+
+func (d *DialogMedia) removeRTPRelay(relay *media.RTPRelay) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rtpRelays = slices.DeleteFunc(d.rtpRelays, func(r *media.RTPRelay) bool { return r == relay })
+}
+
+// BridgeStats are stats of media going from one dialog to other
+type BridgeStats struct {
+	From string
+	To   string
+	// Read are stats of RTP read from From dialog
+	Read media.RTPReadStats
+	// Write are stats of RTP written to To dialog
+	Write media.RTPWriteStats
+}
+
+// Stats returns per direction media stats read from dialogs RTP sessions.
+// Should be called after proxy media is started
+//
+// Experimental
+func (b *Bridge) Stats() []BridgeStats {
+	if len(b.dialogs) < 2 {
+		return nil
+	}
+
+	stats := make([]BridgeStats, 0, 2)
+	for i, j := range []int{1, 0} {
+		from, to := b.dialogs[i], b.dialogs[j]
+		r, w := from.Media().RTPSession(), to.Media().RTPSession()
+		if r == nil || w == nil {
+			continue
+		}
+		stats = append(stats, BridgeStats{
+			From:  from.Id(),
+			To:    to.Id(),
+			Read:  r.ReadStats(),
+			Write: w.WriteStats(),
+		})
+	}
+	return stats
+}
+
 func (b *Bridge) proxyMediaRTPRaw(m1 media.RTPReaderRaw, m2 media.RTPWriterRaw) (written int64, e error) {
 	buf := make([]byte, 1500) // MTU
 
@@ -0,0 +1,530 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+const (
+	// BridgeSupervisorListen supervisor hears both legs and nobody hears supervisor
+	BridgeSupervisorListen = "listen"
+	// BridgeSupervisorWhisper supervisor hears both legs and only chosen leg hears supervisor
+	BridgeSupervisorWhisper = "whisper"
+	// BridgeSupervisorBarge supervisor joins call as third party
+	BridgeSupervisorBarge = "barge"
+)
+
+var (
+	// BridgeSupervisorQueue is number of 20ms frames buffered between supervisor and legs.
+	// Older audio is dropped to keep delay low
+	BridgeSupervisorQueue = 5
+)
+
+// bridgeSupervision is state shared with bridge proxy routines
+type bridgeSupervision struct {
+	mu         sync.Mutex
+	supervisor *BridgeSupervisor
+	// injects are supervisor audio mixed into audio written to each leg
+	injects [2]*bridgeInject
+
+	// dialogsMu protects bridge dialogs read by supervisor. Bridge is passed by value, so it is kept here
+	dialogsMu sync.Mutex
+}
+
+// BridgeSupervisor is dialog session attached to bridge as supervisor. Use Bridge Supervise
+//
+// Experimental
+type BridgeSupervisor struct {
+	Dialog DialogSession
+
+	b    *Bridge
+	log  *slog.Logger
+	mu   sync.Mutex
+	mode string
+	// whisperTo is index of leg in bridge dialogs
+	whisperTo int
+	stopped   bool
+
+	// legs are audio of bridge legs at supervisor sample rate
+	legs   [2]*pcmQueue
+	detach [2]func()
+	// outs convert supervisor audio to leg format
+	outs [2]io.Writer
+
+	done      chan struct{}
+	stopOnce  sync.Once
+	readDone  chan struct{}
+	writeDone chan struct{}
+}
+
+// Supervise attaches dialog session to bridge as supervisor in BridgeSupervisorListen mode.
+// Mode can be changed at any time. Legs audio is only decoded and mixed while supervisor talks to them,
+// otherwise original call is proxied as is.
+// Bridge must have both legs and it is not possible with RTPpass.
+//
+// Experimental
+func (b *Bridge) Supervise(d DialogSession) (*BridgeSupervisor, error) {
+	if b.RTPpass {
+		return nil, fmt.Errorf("supervising is not possible with RTPpass")
+	}
+	if b.supervision == nil {
+		return nil, fmt.Errorf("bridge is not initialized")
+	}
+	dialogs := b.dialogsCopy()
+	if len(dialogs) != 2 {
+		return nil, fmt.Errorf("bridge must have 2 dialogs")
+	}
+
+	m := d.Media()
+	pr, pw := MediaProps{}, MediaProps{}
+	r := m.audioReaderProps(&pr)
+	if r == nil {
+		return nil, fmt.Errorf("no media setup")
+	}
+	w := m.audioWriterProps(&pw)
+
+	s := &BridgeSupervisor{
+		Dialog:    d,
+		b:         b,
+		log:       b.log.With("supervisor", d.Id()),
+		mode:      BridgeSupervisorListen,
+		done:      make(chan struct{}),
+		readDone:  make(chan struct{}),
+		writeDone: make(chan struct{}),
+	}
+
+	// Supervisor hears legs mixed in mono at own codec rate
+	rate := int(pw.Codec.SampleRate)
+	frameSize := rate / 50 * 2
+
+	legWriters := [2]io.Writer{}
+	for i, leg := range dialogs {
+		lr, lw := MediaProps{}, MediaProps{}
+		_ = leg.Media().audioReaderProps(&lr)
+		_ = leg.Media().audioWriterProps(&lw)
+
+		s.legs[i] = &pcmQueue{limit: BridgeSupervisorQueue * frameSize}
+		var pcmWriter io.Writer = s.legs[i]
+		if int(lr.Codec.SampleRate) != rate || lr.Codec.NumChannels > 1 {
+			resampler, err := audio.NewPCMResamplerWriter(pcmWriter, int(lr.Codec.SampleRate), max(lr.Codec.NumChannels, 1), rate, 1)
+			if err != nil {
+				return nil, err
+			}
+			pcmWriter = resampler
+		}
+		dec := &audio.PCMDecoderWriter{}
+		if err := dec.Init(lr.Codec, pcmWriter); err != nil {
+			return nil, fmt.Errorf("failed to create leg decoder: %w", err)
+		}
+		legWriters[i] = dec
+
+		// Leg hears supervisor in own codec format
+		inject := b.supervision.injects[i]
+		inject.queue.setLimit(BridgeSupervisorQueue * lw.Codec.Samples16())
+		var out io.Writer = inject.queue
+		if pr.Codec.SampleRate != lw.Codec.SampleRate || pr.Codec.NumChannels != lw.Codec.NumChannels {
+			resampler, err := audio.NewPCMResamplerWriter(out, int(pr.Codec.SampleRate), max(pr.Codec.NumChannels, 1), int(lw.Codec.SampleRate), max(lw.Codec.NumChannels, 1))
+			if err != nil {
+				return nil, err
+			}
+			out = resampler
+		}
+		s.outs[i] = out
+	}
+
+	decoder := &audio.PCMDecoderReader{}
+	if err := decoder.Init(pr.Codec, r); err != nil {
+		return nil, fmt.Errorf("failed to create decoder: %w", err)
+	}
+	encoder := &audio.PCMEncoderWriter{}
+	if err := encoder.Init(pw.Codec, w); err != nil {
+		return nil, fmt.Errorf("failed to create encoder: %w", err)
+	}
+	var mixWriter io.Writer = encoder
+	if pw.Codec.NumChannels > 1 {
+		resampler, err := audio.NewPCMResamplerWriter(encoder, rate, 1, rate, pw.Codec.NumChannels)
+		if err != nil {
+			return nil, err
+		}
+		mixWriter = resampler
+	}
+
+	sup := b.supervision
+	sup.mu.Lock()
+	if sup.supervisor != nil {
+		sup.mu.Unlock()
+		return nil, fmt.Errorf("bridge is already supervised")
+	}
+	sup.supervisor = s
+	sup.mu.Unlock()
+
+	for i := range s.legs {
+		s.detach[i] = b.taps[i].attach(legWriters[i])
+	}
+
+	s.log.Debug("Supervisor attached to bridge", "codec1", pr.Codec.Name, "codec2", pw.Codec.Name)
+	go s.readLoop(decoder, pr.Codec.Samples16())
+	go s.writeLoop(mixWriter, frameSize)
+	return s, nil
+}
+
+// Mode returns current supervisor mode
+func (s *BridgeSupervisor) Mode() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mode
+}
+
+// Listen switches supervisor to BridgeSupervisorListen mode
+func (s *BridgeSupervisor) Listen() {
+	s.setMode(BridgeSupervisorListen, 0)
+}
+
+// Whisper switches supervisor to BridgeSupervisorWhisper mode. Only dialog session to hears supervisor
+func (s *BridgeSupervisor) Whisper(to DialogSession) error {
+	ind := slices.IndexFunc(s.b.dialogsCopy(), func(d DialogSession) bool {
+		return d.Id() == to.Id()
+	})
+	if ind < 0 {
+		return fmt.Errorf("dialog session is not in bridge %q", to.Id())
+	}
+	s.setMode(BridgeSupervisorWhisper, ind)
+	return nil
+}
+
+// Barge switches supervisor to BridgeSupervisorBarge mode. Both legs hear supervisor
+func (s *BridgeSupervisor) Barge() {
+	s.setMode(BridgeSupervisorBarge, 0)
+}
+
+func (s *BridgeSupervisor) setMode(mode string, whisperTo int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mode = mode
+	s.whisperTo = whisperTo
+	if s.stopped {
+		return
+	}
+	for i, inject := range s.b.supervision.injects {
+		active := mode == BridgeSupervisorBarge || (mode == BridgeSupervisorWhisper && i == whisperTo)
+		inject.setActive(active)
+	}
+}
+
+// targets returns leg indexes hearing supervisor
+func (s *BridgeSupervisor) targets() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch s.mode {
+	case BridgeSupervisorWhisper:
+		return []int{s.whisperTo}
+	case BridgeSupervisorBarge:
+		return []int{0, 1}
+	}
+	return nil
+}
+
+// Close detaches supervisor from bridge. Bridge and supervisor dialog are left running
+func (s *BridgeSupervisor) Close() error {
+	s.stop()
+	<-s.writeDone
+
+	select {
+	case <-s.readDone:
+		return nil
+	default:
+	}
+
+	// Unblock reading
+	m := s.Dialog.Media()
+	if err := m.StopRTP(1, 0); err != nil {
+		return err
+	}
+	<-s.readDone
+	return m.StartRTP(1, 0)
+}
+
+func (s *BridgeSupervisor) stop() {
+	s.stopOnce.Do(func() {
+		for _, detach := range s.detach {
+			detach()
+		}
+
+		s.setMode(BridgeSupervisorListen, 0)
+		s.mu.Lock()
+		s.stopped = true
+		s.mu.Unlock()
+
+		sup := s.b.supervision
+		sup.mu.Lock()
+		sup.supervisor = nil
+		sup.mu.Unlock()
+		close(s.done)
+	})
+}
+
+// readLoop passes supervisor audio to legs depending on mode
+func (s *BridgeSupervisor) readLoop(decoder *audio.PCMDecoderReader, frameSize int) {
+	defer close(s.readDone)
+	defer decoder.Close()
+
+	buf := make([]byte, frameSize)
+	for {
+		n, err := decoder.Read(buf)
+		if err != nil {
+			if !media.ErrorIsTimeout(err) {
+				s.log.Debug("Supervisor reading stopped", "error", err)
+				// Media is gone, so supervisor is leaving
+				s.stop()
+			}
+			return
+		}
+
+		for _, i := range s.targets() {
+			if _, err := s.outs[i].Write(buf[:n]); err != nil {
+				s.log.Error("Supervisor failed to write leg audio", "error", err)
+			}
+		}
+	}
+}
+
+// writeLoop sends mix of legs to supervisor every 20ms
+func (s *BridgeSupervisor) writeLoop(w io.Writer, frameSize int) {
+	defer close(s.writeDone)
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	frame := make([]byte, frameSize)
+	legFrame := make([]byte, frameSize)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		clear(frame)
+		for _, leg := range s.legs {
+			n := leg.take(legFrame)
+			mixPCM(frame, legFrame[:n])
+		}
+		if _, err := w.Write(frame); err != nil {
+			s.log.Debug("Supervisor writing stopped", "error", err)
+			return
+		}
+	}
+}
+
+// bridgeInject is supervisor audio for single leg
+type bridgeInject struct {
+	queue  *pcmQueue
+	active atomic.Bool
+	// activated wakes leg writer pacing
+	activated chan struct{}
+}
+
+func newBridgeInject() *bridgeInject {
+	return &bridgeInject{queue: &pcmQueue{}, activated: make(chan struct{}, 1)}
+}
+
+func (i *bridgeInject) setActive(active bool) {
+	i.active.Store(active)
+	if !active {
+		i.queue.reset()
+		return
+	}
+	select {
+	case i.activated <- struct{}{}:
+	default:
+	}
+}
+
+// bridgeLegIdleFrames is number of frames without audio from other leg after which supervisor audio is paced alone.
+// It tolerates jitter of other leg
+const bridgeLegIdleFrames = 3
+
+// bridgeLegWriter mixes supervisor audio into audio written to leg while inject is active.
+// When other leg sends no audio, like on silence suppression, supervisor audio is written in paced frames
+type bridgeLegWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	inject    *bridgeInject
+	dec       audio.PCMDecoder
+	enc       audio.PCMEncoder
+	pcm       []byte
+	mix       []byte
+	buf       []byte
+	frameDur  time.Duration
+	frameSize int
+	lastWrite time.Time
+}
+
+func (w *bridgeLegWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastWrite = time.Now()
+	if !w.inject.active.Load() {
+		return w.w.Write(b)
+	}
+
+	n, err := w.dec.DecoderTo(w.pcm, b)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.writeMixed(w.pcm[:n]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeMixed mixes supervisor audio to pcm and writes it encoded. It must be called under lock
+func (w *bridgeLegWriter) writeMixed(pcm []byte) error {
+	mix := w.mix[:min(len(pcm), len(w.mix))]
+	mixPCM(pcm, mix[:w.inject.queue.take(mix)])
+
+	n, err := w.enc.EncoderTo(w.buf, pcm)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(w.buf[:n])
+	return err
+}
+
+// pace writes supervisor audio every frame while inject is active and other leg is idle, until done
+func (w *bridgeLegWriter) pace(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-w.inject.activated:
+		}
+
+		ticker := time.NewTicker(w.frameDur)
+		for w.inject.active.Load() {
+			select {
+			case <-done:
+				ticker.Stop()
+				return
+			case <-ticker.C:
+			}
+			if err := w.writeIdle(); err != nil {
+				// Leg media is gone
+				ticker.Stop()
+				return
+			}
+		}
+		ticker.Stop()
+	}
+}
+
+func (w *bridgeLegWriter) writeIdle() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.inject.active.Load() || time.Since(w.lastWrite) < bridgeLegIdleFrames*w.frameDur {
+		return nil
+	}
+	pcm := w.pcm[:w.frameSize]
+	clear(pcm)
+	return w.writeMixed(pcm)
+}
+
+// legWriter returns writer mixing supervisor audio to dialog media writer.
+// Supervisor audio is paced until done is closed. Writer is returned as is if codec can not be mixed
+func (b *Bridge) legWriter(m *DialogMedia, codec media.Codec, w io.Writer, done <-chan struct{}) io.Writer {
+	if b.supervision == nil {
+		return w
+	}
+	ch := 1
+	if b.dialogs[0].Media() == m {
+		ch = 0
+	}
+	frameSize := codec.Samples16()
+	frameDur := codec.SampleDur
+	if frameDur == 0 {
+		frameDur = 20 * time.Millisecond
+	}
+	lw := &bridgeLegWriter{
+		w:      w,
+		inject: b.supervision.injects[ch],
+		// Decoded packet can be larger than 20ms frame
+		pcm:       make([]byte, max(frameSize, 2*media.RTPBufSize)),
+		mix:       make([]byte, max(frameSize, 2*media.RTPBufSize)),
+		buf:       make([]byte, media.RTPBufSize),
+		frameDur:  frameDur,
+		frameSize: frameSize,
+		lastWrite: time.Now(),
+	}
+	if err := lw.dec.Init(codec); err != nil {
+		b.log.Debug("Leg can not be supervised", "error", err)
+		return w
+	}
+	if err := lw.enc.Init(codec); err != nil {
+		b.log.Debug("Leg can not be supervised", "error", err)
+		return w
+	}
+	go lw.pace(done)
+	return lw
+}
+
+// pcmQueue buffers PCM between routines. Oldest audio is dropped above limit to keep delay low
+type pcmQueue struct {
+	mu    sync.Mutex
+	buf   []byte
+	limit int
+}
+
+func (q *pcmQueue) Write(b []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.buf = append(q.buf, b...)
+	if q.limit > 0 && len(q.buf) > q.limit {
+		// Keep sample alignment
+		drop := (len(q.buf) - q.limit + 1) &^ 1
+		q.buf = q.buf[drop:]
+	}
+	return len(b), nil
+}
+
+// take copies queued audio to b and returns copied size
+func (q *pcmQueue) take(b []byte) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := copy(b, q.buf)
+	q.buf = q.buf[n:]
+	return n
+}
+
+func (q *pcmQueue) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.buf = nil
+}
+
+func (q *pcmQueue) setLimit(limit int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.limit = limit
+}
+
+// mixPCM adds 16 bit samples of src to dst with clipping
+func mixPCM(dst []byte, src []byte) {
+	for i := 0; i+1 < len(src) && i+1 < len(dst); i += 2 {
+		v := int32(int16(binary.LittleEndian.Uint16(dst[i:]))) + int32(int16(binary.LittleEndian.Uint16(src[i:])))
+		v = max(math.MinInt16, min(math.MaxInt16, v))
+		binary.LittleEndian.PutUint16(dst[i:], uint16(int16(v)))
+	}
+}
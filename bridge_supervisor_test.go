@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+func TestBridgeSupervisor(t *testing.T) {
+	alawFrames := func(sample byte, frames int) []byte {
+		pcm := bytes.Repeat([]byte{0, sample}, frames*160)
+		alaw := make([]byte, len(pcm)/2)
+		_, err := audio.EncodeAlawTo(alaw, pcm)
+		require.NoError(t, err)
+		return alaw
+	}
+	newDialog := func(id string, data []byte) *DialogServerSession {
+		return &DialogServerSession{
+			DialogServerSession: &sipgo.DialogServerSession{Dialog: sipgo.Dialog{ID: id}},
+			DialogMedia: DialogMedia{
+				mediaSession:    &media.MediaSession{Codecs: []media.Codec{media.CodecAudioAlaw}},
+				audioReader:     &packetReader{data: data, frameSize: 160, delay: 20 * time.Millisecond},
+				audioWriter:     &syncBuffer{},
+				RTPPacketReader: media.NewRTPPacketReader(nil, media.CodecAudioAlaw),
+				RTPPacketWriter: media.NewRTPPacketWriter(nil, media.CodecAudioAlaw),
+			},
+		}
+	}
+
+	b := NewBridge()
+	b.WaitDialogsNum = 99 // Do not start proxy
+
+	agentAudio, customerAudio := alawFrames(0x10, 10), alawFrames(0x08, 10)
+	agent, customer := newDialog("agent", agentAudio), newDialog("customer", customerAudio)
+	require.NoError(t, b.AddDialogSession(agent))
+	require.NoError(t, b.AddDialogSession(customer))
+
+	// Supervisor talks longer than call, so it stays attached during proxy
+	supervisor := newDialog("supervisor", alawFrames(0x20, 20))
+	sup, err := b.Supervise(supervisor)
+	require.NoError(t, err)
+	assert.Equal(t, BridgeSupervisorListen, sup.Mode())
+
+	_, err = b.Supervise(newDialog("other", nil))
+	require.Error(t, err)
+	require.Error(t, sup.Whisper(newDialog("unknown", nil)))
+
+	// Coach agent without customer hearing
+	require.NoError(t, sup.Whisper(agent))
+	assert.Equal(t, BridgeSupervisorWhisper, sup.Mode())
+
+	err = b.proxyMedia()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Customer hears agent as is
+	assert.Equal(t, agentAudio, customer.audioWriter.(*syncBuffer).Bytes())
+	// Agent hears customer with supervisor mixed
+	agentHeard := agent.audioWriter.(*syncBuffer).Bytes()
+	require.Len(t, agentHeard, len(customerAudio))
+	assert.NotEqual(t, customerAudio, agentHeard)
+
+	// Supervisor hears both legs mixed
+	<-sup.readDone
+	require.NoError(t, sup.Close())
+	supervisorHeard := supervisor.audioWriter.(*syncBuffer).Bytes()
+	require.NotEmpty(t, supervisorHeard)
+	pcm := make([]byte, len(supervisorHeard)*2)
+	_, err = audio.DecodeAlawTo(pcm, supervisorHeard)
+	require.NoError(t, err)
+	assert.NotEqual(t, make([]byte, len(pcm)), pcm)
+
+	// Bridge can be supervised again after close
+	sup, err = b.Supervise(newDialog("supervisor2", alawFrames(0x20, 5)))
+	require.NoError(t, err)
+	sup.Barge()
+	assert.Equal(t, BridgeSupervisorBarge, sup.Mode())
+	assert.True(t, b.supervision.injects[0].active.Load())
+	assert.True(t, b.supervision.injects[1].active.Load())
+	<-sup.readDone
+	require.NoError(t, sup.Close())
+	assert.False(t, b.supervision.injects[0].active.Load())
+
+	// Stopped supervisor does not affect legs
+	sup.Barge()
+	assert.False(t, b.supervision.injects[0].active.Load())
+
+	rtpPass := NewBridge()
+	rtpPass.RTPpass = true
+	_, err = rtpPass.Supervise(supervisor)
+	require.Error(t, err)
+}
+
+func TestBridgeLegWriterIdle(t *testing.T) {
+	b := NewBridge()
+	b.WaitDialogsNum = 99 // Do not start proxy
+	newDialog := func(id string) *DialogServerSession {
+		return &DialogServerSession{
+			DialogServerSession: &sipgo.DialogServerSession{Dialog: sipgo.Dialog{ID: id}},
+			DialogMedia: DialogMedia{
+				mediaSession:    &media.MediaSession{Codecs: []media.Codec{media.CodecAudioAlaw}},
+				RTPPacketReader: media.NewRTPPacketReader(nil, media.CodecAudioAlaw),
+				RTPPacketWriter: media.NewRTPPacketWriter(nil, media.CodecAudioAlaw),
+			},
+		}
+	}
+	agent := newDialog("agent")
+	require.NoError(t, b.AddDialogSession(agent))
+	require.NoError(t, b.AddDialogSession(newDialog("customer")))
+
+	done := make(chan struct{})
+	heard := &syncBuffer{}
+	w := b.legWriter(agent.Media(), media.CodecAudioAlaw, heard, done)
+	require.IsType(t, &bridgeLegWriter{}, w)
+
+	// Customer sends no audio, but agent hears whisper
+	inject := b.supervision.injects[0]
+	inject.queue.setLimit(100 * 320)
+	inject.queue.Write(bytes.Repeat([]byte{0, 0x20}, 100*160))
+	inject.setActive(true)
+	require.Eventually(t, func() bool {
+		return heard.Len() >= 5*160
+	}, 2*time.Second, 20*time.Millisecond)
+	// Audio is written in 20ms frames
+	assert.Zero(t, heard.Len()%160)
+	pcm := make([]byte, 2*160)
+	_, err := audio.DecodeAlawTo(pcm, heard.Bytes()[:160])
+	require.NoError(t, err)
+	assert.NotEqual(t, make([]byte, len(pcm)), pcm)
+
+	// Nothing is written when inject is not active
+	inject.setActive(false)
+	time.Sleep(40 * time.Millisecond)
+	n := heard.Len()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, n, heard.Len())
+	close(done)
+}
+
+func TestMixPCM(t *testing.T) {
+	dst := []byte{0x10, 0, 0xff, 0x7f, 0, 0x80}
+	mixPCM(dst, []byte{0x01, 0, 0x01, 0, 0xff, 0xff})
+	// Mixed samples are clipped
+	assert.Equal(t, []byte{0x11, 0, 0xff, 0x7f, 0, 0x80}, dst)
+}
@@ -6,11 +6,18 @@ package diago
 import (
 	"bytes"
 	"io"
+	"net"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/emiago/sipgo"
+	"github.com/pion/rtp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/audio"
 	"github.com/vertan/diago/media"
+	"github.com/vertan/diago/media/sdp"
 )
 
 func TestBridgeProxy(t *testing.T) {
@@ -81,3 +88,291 @@ func TestBridgeNoTranscodingAllowed(t *testing.T) {
 	err = b.AddDialogSession(outgoing)
 	require.Error(t, err)
 }
+
+// packetReader returns single frame per read like RTP reader
+type packetReader struct {
+	data      []byte
+	frameSize int
+	// delay paces reading like RTP
+	delay time.Duration
+}
+
+func (r *packetReader) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	n := copy(b, r.data[:min(r.frameSize, len(r.data))])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestBridgeTranscode(t *testing.T) {
+	b := NewBridge()
+	b.Transcode = true
+	b.WaitDialogsNum = 99 // Do not start proxy
+
+	pcm := make([]byte, 10*320)
+	for i := range pcm {
+		pcm[i] = byte(i)
+	}
+	alaw := make([]byte, len(pcm)/2)
+	_, err := audio.EncodeAlawTo(alaw, pcm)
+	require.NoError(t, err)
+	ulaw := make([]byte, len(pcm)/2)
+	_, err = audio.EncodeUlawTo(ulaw, pcm)
+	require.NoError(t, err)
+
+	incoming := &DialogServerSession{
+		DialogMedia: DialogMedia{
+			mediaSession: &media.MediaSession{
+				Codecs: []media.Codec{media.CodecAudioAlaw},
+			},
+			audioReader:     &packetReader{data: alaw, frameSize: 160},
+			audioWriter:     bytes.NewBuffer(make([]byte, 0)),
+			RTPPacketReader: media.NewRTPPacketReader(nil, media.CodecAudioAlaw),
+			RTPPacketWriter: media.NewRTPPacketWriter(nil, media.CodecAudioAlaw),
+		},
+	}
+	outgoing := &DialogClientSession{
+		DialogMedia: DialogMedia{
+			mediaSession: &media.MediaSession{
+				Codecs: []media.Codec{media.CodecAudioUlaw},
+			},
+			audioReader:     &packetReader{data: ulaw, frameSize: 160},
+			audioWriter:     bytes.NewBuffer(make([]byte, 0)),
+			RTPPacketReader: media.NewRTPPacketReader(nil, media.CodecAudioUlaw),
+			RTPPacketWriter: media.NewRTPPacketWriter(nil, media.CodecAudioUlaw),
+		},
+	}
+
+	require.NoError(t, b.AddDialogSession(incoming))
+	require.NoError(t, b.AddDialogSession(outgoing))
+
+	err = b.proxyMedia()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Each side receives other side audio in own codec
+	transcode := func(encoded []byte, decodeTo, encodeTo func([]byte, []byte) (int, error)) []byte {
+		lpcm := make([]byte, len(encoded)*2)
+		_, err := decodeTo(lpcm, encoded)
+		require.NoError(t, err)
+		out := make([]byte, len(encoded))
+		_, err = encodeTo(out, lpcm)
+		require.NoError(t, err)
+		return out
+	}
+	assert.Equal(t, transcode(ulaw, audio.DecodeUlawTo, audio.EncodeAlawTo), incoming.audioWriter.(*bytes.Buffer).Bytes())
+	assert.Equal(t, transcode(alaw, audio.DecodeAlawTo, audio.EncodeUlawTo), outgoing.audioWriter.(*bytes.Buffer).Bytes())
+}
+
+func TestBridgeRTPpass(t *testing.T) {
+	newSession := func() *media.MediaSession {
+		m := &media.MediaSession{
+			Laddr:  net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			Codecs: []media.Codec{media.CodecAudioAlaw, media.CodecTelephoneEvent8000},
+			Mode:   sdp.ModeSendrecv,
+		}
+		require.NoError(t, m.Init())
+		t.Cleanup(func() { m.Close() })
+		return m
+	}
+	newDialog := func(id string, phone *media.MediaSession) *DialogServerSession {
+		leg := newSession()
+		require.NoError(t, leg.RemoteSDP(phone.LocalSDP()))
+		require.NoError(t, phone.RemoteSDP(leg.LocalSDP()))
+
+		rtpSess := media.NewRTPSession(leg)
+		return &DialogServerSession{
+			DialogServerSession: &sipgo.DialogServerSession{Dialog: sipgo.Dialog{ID: id}},
+			DialogMedia: DialogMedia{
+				mediaSession:    leg,
+				rtpSession:      rtpSess,
+				RTPPacketReader: media.NewRTPPacketReaderSession(rtpSess),
+				RTPPacketWriter: media.NewRTPPacketWriterSession(rtpSess),
+			},
+		}
+	}
+	readPacket := func(phone *media.MediaSession) rtp.Packet {
+		pkt := rtp.Packet{}
+		phone.StopRTP(1, 2*time.Second)
+		_, err := phone.ReadRTP(make([]byte, media.RTPBufSize), &pkt)
+		require.NoError(t, err)
+		return pkt
+	}
+
+	phone1, phone2 := newSession(), newSession()
+	d1, d2 := newDialog("d1", phone1), newDialog("d2", phone2)
+
+	// Playback to second dialog before bridging
+	_, err := d2.RTPPacketWriter.Write(make([]byte, 160))
+	require.NoError(t, err)
+	before := readPacket(phone2)
+
+	b := NewBridge()
+	b.RTPpass = true
+	b.WaitDialogsNum = 99 // Do not start proxy
+	require.NoError(t, b.AddDialogSession(d1))
+	require.NoError(t, b.AddDialogSession(d2))
+	go b.proxyMedia()
+
+	for i := 0; i < 3; i++ {
+		pkt := rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 1234, SequenceNumber: uint16(5000 + i), Timestamp: uint32(160 * i)},
+			Payload: bytes.Repeat([]byte{byte(i)}, 160),
+		}
+		require.NoError(t, phone1.WriteRTP(&pkt))
+
+		relayed := readPacket(phone2)
+		assert.Equal(t, pkt.Payload, relayed.Payload)
+		// Stream continues playback stream
+		assert.Equal(t, before.SSRC, relayed.SSRC)
+		assert.Equal(t, before.SequenceNumber+uint16(i+1), relayed.SequenceNumber)
+		assert.Equal(t, i == 0, relayed.Marker)
+	}
+
+	stats := b.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "d1", stats[0].From)
+	assert.EqualValues(t, 3, stats[0].Read.PacketsCount)
+	assert.EqualValues(t, 4, stats[0].Write.PacketsCount)
+
+	// Re-INVITE moves second dialog media to other phone. Relay continues on new session
+	phone3 := newSession()
+	d2.mu.Lock()
+	require.NoError(t, d2.sdpUpdateUnsafe(phone3.LocalSDP()))
+	localSDP := d2.mediaSession.LocalSDP()
+	d2.mu.Unlock()
+	require.NoError(t, phone3.RemoteSDP(localSDP))
+
+	for i := 3; i < 5; i++ {
+		pkt := rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 1234, SequenceNumber: uint16(5000 + i), Timestamp: uint32(160 * i)},
+			Payload: bytes.Repeat([]byte{byte(i)}, 160),
+		}
+		require.NoError(t, phone1.WriteRTP(&pkt))
+		relayed := readPacket(phone3)
+		assert.Equal(t, pkt.Payload, relayed.Payload)
+		assert.Equal(t, before.SSRC, relayed.SSRC)
+	}
+
+	// Other direction reads from new session
+	for i := 0; i < 2; i++ {
+		pkt := rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 4321, SequenceNumber: uint16(100 + i), Timestamp: uint32(160 * i)},
+			Payload: bytes.Repeat([]byte{byte(10 + i)}, 160),
+		}
+		require.NoError(t, phone3.WriteRTP(&pkt))
+		relayed := readPacket(phone1)
+		assert.Equal(t, pkt.Payload, relayed.Payload)
+	}
+}
+
+func TestBridgeRecording(t *testing.T) {
+	pcm := make([]byte, 10*320)
+	for i := range pcm {
+		pcm[i] = byte(i)
+	}
+	alaw := make([]byte, len(pcm)/2)
+	_, err := audio.EncodeAlawTo(alaw, pcm)
+	require.NoError(t, err)
+	ulaw := make([]byte, len(pcm)/2)
+	_, err = audio.EncodeUlawTo(ulaw, pcm)
+	require.NoError(t, err)
+
+	newDialog := func(id string, codec media.Codec, data []byte) *DialogServerSession {
+		return &DialogServerSession{
+			DialogServerSession: &sipgo.DialogServerSession{Dialog: sipgo.Dialog{ID: id}},
+			DialogMedia: DialogMedia{
+				mediaSession:    &media.MediaSession{Codecs: []media.Codec{codec}},
+				audioReader:     &packetReader{data: data, frameSize: 160},
+				audioWriter:     bytes.NewBuffer(make([]byte, 0)),
+				RTPPacketReader: media.NewRTPPacketReader(nil, codec),
+				RTPPacketWriter: media.NewRTPPacketWriter(nil, codec),
+			},
+		}
+	}
+
+	record := func(t *testing.T, opts BridgeRecordingOptions, onRecording func(rec *BridgeRecording)) *audio.WavReader {
+		b := NewBridge()
+		b.Transcode = true
+		b.WaitDialogsNum = 99 // Do not start proxy
+		require.NoError(t, b.AddDialogSession(newDialog("in", media.CodecAudioAlaw, alaw)))
+
+		f, err := os.OpenFile("/tmp/diago_test_bridge_record.wav", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0755)
+		require.NoError(t, err)
+		t.Cleanup(func() { f.Close() })
+
+		rec, err := b.RecordingCreate(f, opts)
+		require.NoError(t, err)
+		require.NoError(t, b.AddDialogSession(newDialog("out", media.CodecAudioUlaw, ulaw)))
+		onRecording(rec)
+
+		err = b.proxyMedia()
+		require.ErrorIs(t, err, io.EOF)
+		require.NoError(t, rec.Close())
+
+		f.Seek(0, 0)
+		wav := audio.NewWavReader(f)
+		require.NoError(t, wav.ReadHeaders())
+		return wav
+	}
+
+	t.Run("Stereo", func(t *testing.T) {
+		events := []RecordingState{}
+		meta := bytes.NewBuffer(nil)
+		opts := BridgeRecordingOptions{
+			OnEvent:  func(ev RecordingEvent) { events = append(events, ev.State) },
+			Metadata: meta,
+		}
+		wav := record(t, opts, func(rec *BridgeRecording) {})
+
+		assert.EqualValues(t, 2, wav.NumChannels)
+		assert.EqualValues(t, 8000, wav.SampleRate)
+		require.Equal(t, 2*len(pcm), wav.DataSize)
+
+		// Left is originator decoded from alaw, right is other leg decoded from ulaw
+		stereo, err := io.ReadAll(wav)
+		require.NoError(t, err)
+		left, right := make([]byte, len(pcm)), make([]byte, len(pcm))
+		audio.DecodeAlawTo(left, alaw)
+		audio.DecodeUlawTo(right, ulaw)
+		assert.Equal(t, left[:2], stereo[:2])
+		assert.Equal(t, right[:2], stereo[2:4])
+		assert.Equal(t, left[len(left)-2:], stereo[len(stereo)-4:len(stereo)-2])
+		assert.Equal(t, right[len(right)-2:], stereo[len(stereo)-2:])
+
+		assert.Equal(t, []RecordingState{RecordingStarted, RecordingStopped}, events)
+		assert.Contains(t, meta.String(), `"call_ids":["in","out"]`)
+	})
+
+	t.Run("Mono", func(t *testing.T) {
+		wav := record(t, BridgeRecordingOptions{Mono: true}, func(rec *BridgeRecording) {})
+		assert.EqualValues(t, 1, wav.NumChannels)
+		assert.Equal(t, len(pcm), wav.DataSize)
+	})
+
+	t.Run("PauseRemoved", func(t *testing.T) {
+		var bridgeRec *BridgeRecording
+		wav := record(t, BridgeRecordingOptions{RemovePaused: true}, func(rec *BridgeRecording) {
+			bridgeRec = rec
+			rec.Pause()
+		})
+		assert.Equal(t, 0, wav.DataSize)
+
+		meta := bridgeRec.Metadata()
+		require.Len(t, meta.Pauses, 1)
+		assert.True(t, meta.Pauses[0].Removed)
+		assert.False(t, meta.Pauses[0].End.IsZero())
+	})
+
+	t.Run("PauseSilence", func(t *testing.T) {
+		wav := record(t, BridgeRecordingOptions{}, func(rec *BridgeRecording) {
+			rec.Pause()
+		})
+		require.Equal(t, 2*len(pcm), wav.DataSize)
+		stereo, err := io.ReadAll(wav)
+		require.NoError(t, err)
+		assert.Equal(t, make([]byte, len(stereo)), stereo)
+	})
+}
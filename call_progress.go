@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"context"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+type CallProgressStatus string
+
+const (
+	CallProgressUnknown    CallProgressStatus = "UNKNOWN"
+	CallProgressRingback   CallProgressStatus = "RINGBACK"
+	CallProgressBusy       CallProgressStatus = "BUSY"
+	CallProgressCongestion CallProgressStatus = "CONGESTION"
+	CallProgressSIT        CallProgressStatus = "SIT"
+)
+
+var (
+	// SIT tone frequencies. First and second segment have low and high variant
+	sitFreqs = []float64{913.8, 985.2, 1370.6, 1428.5, 1776.7}
+)
+
+const (
+	// cpaSilenceLevel is level in dBov below which frame is silence
+	cpaSilenceLevel = -45.0
+	// cpaMinSegment is shortest segment. Shorter are glitches on tone changes
+	cpaMinSegment = 40 * time.Millisecond
+	// sitLongSegment separates short 274ms and long 380ms SIT segments
+	sitLongSegment = 327 * time.Millisecond
+)
+
+// CallProgressResult is classified early media
+type CallProgressResult struct {
+	Status CallProgressStatus
+	// SIT is category of special information tone: IC intercept, VC vacant code, RO reorder,
+	// NC no circuit or IO ineffective other. Empty if not recognized
+	SIT string
+	// Duration of analyzed audio
+	Duration time.Duration
+}
+
+// Final is true for results after which call should be canceled
+func (r CallProgressResult) Final() bool {
+	return r.Status == CallProgressBusy || r.Status == CallProgressCongestion || r.Status == CallProgressSIT
+}
+
+type CallProgressOptions struct {
+	// TonePlan for ringback, busy and congestion cadences. Default is audio.TonePlanDefault preset
+	TonePlan audio.TonePlan
+	// Cycles is number of tone cadence cycles needed for detection. Default 1
+	Cycles int
+	// Timeout bounds analysis. Default 30s
+	Timeout time.Duration
+	// OnResult is called when status changes, like on ringback
+	OnResult func(res CallProgressResult)
+}
+
+// CallProgress analyzes early media and classifies ringback, busy, congestion and SIT tones.
+// It should be called after Invite with EarlyMediaDetect returned ErrClientEarlyMedia.
+// It returns on final result, after Timeout or when ctx is done. Last result is returned on timeout,
+// which is CallProgressUnknown if nothing was detected.
+// No other audio reading should be running.
+//
+// Experimental
+func (d *DialogClientSession) CallProgress(ctx context.Context, opts CallProgressOptions) (CallProgressResult, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+
+	var res CallProgressResult
+	err := d.readAudioBounded(ctx, opts.Timeout, func(reader io.Reader, codec media.Codec) (err error) {
+		res, err = callProgressRun(reader, codec, opts)
+		return err
+	})
+	return res, err
+}
+
+func callProgressRun(reader io.Reader, codec media.Codec, opts CallProgressOptions) (CallProgressResult, error) {
+	a := callProgressAnalyzer{}
+	a.init(opts, int(codec.SampleRate))
+	_, err := readPCMFrames(reader, codec, a.process)
+	return a.result, err
+}
+
+// cpaSegment is part of audio with same tone
+type cpaSegment struct {
+	// freqs is mask of detected candidate frequencies. Zero is silence or other
+	freqs   uint64
+	silence bool
+	dur     time.Duration
+}
+
+func (s cpaSegment) same(o cpaSegment) bool {
+	return s.freqs == o.freqs && s.silence == o.silence
+}
+
+type cpaTone struct {
+	status  CallProgressStatus
+	cadence []cpaSegment
+}
+
+// callProgressAnalyzer splits audio in segments of tones and silence and matches them to cadences
+type callProgressAnalyzer struct {
+	opts     CallProgressOptions
+	detector audio.ToneDetector
+	powers   []float64
+	tones    []cpaTone
+
+	cur     cpaSegment
+	history []cpaSegment
+	result  CallProgressResult
+}
+
+func (a *callProgressAnalyzer) init(opts CallProgressOptions, sampleRate int) {
+	if opts.TonePlan.Country == "" {
+		opts.TonePlan, _ = audio.TonePlanCountry(audio.TonePlanDefault)
+	}
+	if opts.Cycles == 0 {
+		opts.Cycles = 1
+	}
+	a.opts = opts
+	a.result.Status = CallProgressUnknown
+
+	freqs := slices.Clone(sitFreqs)
+	index := func(f float64) int {
+		i := slices.Index(freqs, f)
+		if i < 0 {
+			freqs = append(freqs, f)
+			i = len(freqs) - 1
+		}
+		return i
+	}
+	// Faster cadences are checked first
+	plan := opts.TonePlan
+	for _, t := range []struct {
+		status CallProgressStatus
+		tone   audio.Tone
+	}{
+		{CallProgressCongestion, plan.Congestion},
+		{CallProgressBusy, plan.Busy},
+		{CallProgressRingback, plan.Ringback},
+	} {
+		tone := cpaTone{status: t.status}
+		for _, seg := range t.tone.Cadence() {
+			s := cpaSegment{dur: seg.Duration, silence: len(seg.Frequencies) == 0}
+			for _, f := range seg.Frequencies {
+				s.freqs |= 1 << index(f)
+			}
+			tone.cadence = append(tone.cadence, s)
+		}
+		// Continuous tones can not be matched by cadence
+		if len(tone.cadence) > 1 && !slices.ContainsFunc(tone.cadence, func(s cpaSegment) bool { return s.dur == 0 }) {
+			a.tones = append(a.tones, tone)
+		}
+	}
+
+	a.detector = audio.ToneDetector{SampleRate: sampleRate, Frequencies: freqs[:min(len(freqs), 64)]}
+	a.detector.Init()
+	a.powers = make([]float64, len(a.detector.Frequencies))
+}
+
+// process analyzes frame and returns true on final result
+func (a *callProgressAnalyzer) process(lpcm []byte) bool {
+	dur := time.Duration(len(lpcm)/2) * time.Second / time.Duration(a.detector.SampleRate)
+	a.result.Duration += dur
+
+	frame := a.classify(lpcm)
+	frame.dur = dur
+	if a.cur.same(frame) {
+		a.cur.dur += dur
+		return false
+	}
+
+	prev := a.cur
+	a.cur = frame
+	if prev.dur < cpaMinSegment {
+		// Glitch is dropped and segment before it continues
+		if n := len(a.history); n > 0 && a.history[n-1].same(frame) {
+			a.cur = a.history[n-1]
+			a.cur.dur += dur
+			a.history = a.history[:n-1]
+		}
+		return false
+	}
+
+	a.history = append(a.history, prev)
+	if len(a.history) > 32 {
+		a.history = slices.Delete(a.history, 0, len(a.history)-32)
+	}
+	return a.match()
+}
+
+// classify returns frame as tone with detected frequencies, silence or other audio
+func (a *callProgressAnalyzer) classify(lpcm []byte) cpaSegment {
+	level := a.detector.Detect(lpcm, a.powers)
+	if level < cpaSilenceLevel {
+		return cpaSegment{silence: true}
+	}
+
+	pmax := slices.Max(a.powers)
+	var mask uint64
+	sum := 0.0
+	for i, p := range a.powers {
+		if p >= max(0.15, pmax*0.3) {
+			mask |= 1 << i
+			sum += p
+		}
+	}
+	if sum < 0.7 {
+		return cpaSegment{}
+	}
+	return cpaSegment{freqs: mask}
+}
+
+func (a *callProgressAnalyzer) match() bool {
+	if sit, ok := a.matchSIT(); ok {
+		a.setResult(CallProgressSIT, sit)
+		return true
+	}
+
+	for _, t := range a.tones {
+		if a.matchCadence(t.cadence) {
+			a.setResult(t.status, "")
+			return a.result.Final()
+		}
+	}
+	return false
+}
+
+func (a *callProgressAnalyzer) setResult(status CallProgressStatus, sit string) {
+	changed := a.result.Status != status
+	a.result.Status = status
+	a.result.SIT = sit
+	if changed && a.opts.OnResult != nil {
+		a.opts.OnResult(a.result)
+	}
+}
+
+// matchCadence checks are last segments cycles of cadence starting at any segment
+func (a *callProgressAnalyzer) matchCadence(cadence []cpaSegment) bool {
+	n := len(cadence) * a.opts.Cycles
+	if len(a.history) < n {
+		return false
+	}
+	last := a.history[len(a.history)-n:]
+	for r := range cadence {
+		matched := true
+		for i, seg := range last {
+			c := cadence[(r+i)%len(cadence)]
+			if !seg.same(c) || !cpaDurationMatch(seg.dur, c.dur) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func cpaDurationMatch(d time.Duration, expected time.Duration) bool {
+	tolerance := max(expected/4, 60*time.Millisecond)
+	return d >= expected-tolerance && d <= expected+tolerance
+}
+
+// matchSIT checks are last segments SIT triplet and returns its category
+func (a *callProgressAnalyzer) matchSIT() (string, bool) {
+	if len(a.history) < 3 {
+		return "", false
+	}
+	last := a.history[len(a.history)-3:]
+	// Index of sitFreqs allowed in each segment
+	allowed := [3][]int{{0, 1}, {2, 3}, {4}}
+	var high, long [3]bool
+	for i, seg := range last {
+		if seg.dur < 200*time.Millisecond || seg.dur > 450*time.Millisecond {
+			return "", false
+		}
+		found := false
+		for j, idx := range allowed[i] {
+			if seg.freqs == 1<<idx {
+				found = true
+				high[i] = j == 1
+			}
+		}
+		if !found {
+			return "", false
+		}
+		long[i] = seg.dur >= sitLongSegment
+	}
+
+	switch [4]bool{high[0], long[0], high[1], long[1]} {
+	case [4]bool{false, false, false, false}:
+		return "IC", true
+	case [4]bool{true, true, false, false}:
+		return "VC", true
+	case [4]bool{false, false, true, true}, [4]bool{true, false, false, true}:
+		return "RO", true
+	case [4]bool{true, true, true, true}, [4]bool{false, true, false, true}:
+		return "NC", true
+	case [4]bool{false, true, true, false}:
+		return "IO", true
+	}
+	return "", true
+}
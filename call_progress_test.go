@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+// testToneAudio builds 8kHz PCM of tone repeated for duration
+func testToneAudio(tone string, dur time.Duration) []byte {
+	lpcm := make([]byte, int(dur.Seconds()*8000)*2)
+	gen := audio.NewToneGenerator(8000, audio.MustParseTone(tone), 0)
+	if _, err := io.ReadFull(gen, lpcm); err != nil {
+		panic(err)
+	}
+	return lpcm
+}
+
+func testCallProgressAnalyze(opts CallProgressOptions, lpcm []byte) CallProgressResult {
+	a := callProgressAnalyzer{}
+	a.init(opts, 8000)
+	for i := 0; i+320 <= len(lpcm); i += 320 {
+		if a.process(lpcm[i : i+320]) {
+			break
+		}
+	}
+	return a.result
+}
+
+func TestCallProgressAnalyzer(t *testing.T) {
+	us, _ := audio.TonePlanCountry("us")
+	de, _ := audio.TonePlanCountry("de")
+
+	t.Run("Ringback", func(t *testing.T) {
+		var results []CallProgressResult
+		opts := CallProgressOptions{OnResult: func(res CallProgressResult) { results = append(results, res) }}
+		res := testCallProgressAnalyze(opts, testToneAudio("440+480/2000,0/4000", 13*time.Second))
+		assert.Equal(t, CallProgressRingback, res.Status)
+		assert.False(t, res.Final())
+		require.Len(t, results, 1)
+		assert.Equal(t, CallProgressRingback, results[0].Status)
+
+		res = testCallProgressAnalyze(CallProgressOptions{TonePlan: de}, testToneAudio("425/1000,0/4000", 6*time.Second))
+		assert.Equal(t, CallProgressRingback, res.Status)
+	})
+
+	t.Run("Busy", func(t *testing.T) {
+		res := testCallProgressAnalyze(CallProgressOptions{TonePlan: us}, testToneAudio("480+620/500,0/500", 5*time.Second))
+		assert.Equal(t, CallProgressBusy, res.Status)
+		assert.True(t, res.Final())
+		assert.Less(t, res.Duration, 2*time.Second)
+
+		res = testCallProgressAnalyze(CallProgressOptions{TonePlan: de, Cycles: 2}, testToneAudio("425/480,0/480", 5*time.Second))
+		assert.Equal(t, CallProgressBusy, res.Status)
+	})
+
+	t.Run("Congestion", func(t *testing.T) {
+		res := testCallProgressAnalyze(CallProgressOptions{}, testToneAudio("480+620/250,0/250", 5*time.Second))
+		assert.Equal(t, CallProgressCongestion, res.Status)
+	})
+
+	t.Run("SIT", func(t *testing.T) {
+		lpcm := testToneAudio("913.8/280,1370.6/280,1776.7/380,0/2000", 3*time.Second)
+		res := testCallProgressAnalyze(CallProgressOptions{}, lpcm)
+		assert.Equal(t, CallProgressSIT, res.Status)
+		assert.Equal(t, "IC", res.SIT)
+
+		lpcm = testToneAudio("985.2/380,1370.6/280,1776.7/380,0/2000", 3*time.Second)
+		res = testCallProgressAnalyze(CallProgressOptions{}, lpcm)
+		assert.Equal(t, "VC", res.SIT)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		// Other plan tones are not matched
+		res := testCallProgressAnalyze(CallProgressOptions{TonePlan: us}, testToneAudio("425/480,0/480", 5*time.Second))
+		assert.Equal(t, CallProgressUnknown, res.Status)
+
+		res = testCallProgressAnalyze(CallProgressOptions{}, testAMDAudio(200.0, 3*time.Second))
+		assert.Equal(t, CallProgressUnknown, res.Status)
+	})
+}
+
+func TestCallProgressRun(t *testing.T) {
+	lpcm := testToneAudio("480+620/500,0/500", 3*time.Second)
+	encoded := make([]byte, len(lpcm)/2)
+	n, err := audio.EncodeUlawTo(encoded, lpcm)
+	require.NoError(t, err)
+
+	res, err := callProgressRun(&packetReader{data: encoded[:n], frameSize: 160}, media.CodecAudioUlaw, CallProgressOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, CallProgressBusy, res.Status)
+}
@@ -0,0 +1,493 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+var (
+	// ConferenceFrameQueue is number of frames buffered per participant.
+	// Bigger queue handles more jitter but adds delay
+	ConferenceFrameQueue = 5
+
+	// ConferenceTalkerHangover is number of quiet frames before participant stops being talker
+	ConferenceTalkerHangover = 10
+)
+
+// Conference mixes audio of any number of dialog sessions.
+// Audio of each participant is decoded and every participant receives mix of all others (N-1 mixing).
+// Participants can have different codecs.
+//
+// Experimental
+type Conference struct {
+	// SampleRate is mixing sample rate. Participants audio is resampled to it. Default is 16000
+	SampleRate int
+	// TalkerLevel is RMS level of participant audio above which participant is talking. Default is 300
+	TalkerLevel int
+	// OnTalker is called when participant starts or stops talking.
+	// It is called from mixer routine and it must not block
+	OnTalker func(p *ConferenceParticipant, talking bool)
+
+	log          *slog.Logger
+	mu           sync.Mutex
+	participants []*ConferenceParticipant
+	mixing       bool
+	done         chan struct{}
+	closeOnce    sync.Once
+	frameSamples int
+}
+
+func NewConference() *Conference {
+	c := &Conference{}
+	c.Init(media.DefaultLogger())
+	return c
+}
+
+func (c *Conference) Init(log *slog.Logger) {
+	c.log = log
+	if c.SampleRate == 0 {
+		c.SampleRate = 16000
+	}
+	if c.TalkerLevel == 0 {
+		c.TalkerLevel = 300
+	}
+	// 20 ms frames
+	c.frameSamples = c.SampleRate / 50
+	c.done = make(chan struct{})
+}
+
+// Participants returns current participants
+func (c *Conference) Participants() []*ConferenceParticipant {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.participants)
+}
+
+// Join adds dialog session to conference. Dialog session must be answered.
+// Participant leaves conference when dialog media stops or by calling Leave
+func (c *Conference) Join(d DialogSession) (*ConferenceParticipant, error) {
+	m := d.Media()
+	if m.RTPPacketReader == nil || m.RTPPacketWriter == nil {
+		return nil, fmt.Errorf("dialog session not answered %q", d.Id())
+	}
+
+	p1, p2 := MediaProps{}, MediaProps{}
+	r := m.audioReaderProps(&p1)
+	w := m.audioWriterProps(&p2)
+
+	p := &ConferenceParticipant{
+		Dialog:    d,
+		conf:      c,
+		gain:      1,
+		in:        make(chan []int16, ConferenceFrameQueue),
+		out:       make(chan conferenceFrame, ConferenceFrameQueue),
+		done:      make(chan struct{}),
+		readDone:  make(chan struct{}),
+		writeDone: make(chan struct{}),
+	}
+
+	decoder := &audio.PCMDecoderReader{}
+	if err := decoder.Init(p1.Codec, r); err != nil {
+		return nil, fmt.Errorf("failed to create decoder: %w", err)
+	}
+	resamplerIn := &audio.PCMResampler{}
+	if err := resamplerIn.Init(int(p1.Codec.SampleRate), p1.Codec.NumChannels, c.SampleRate, 1); err != nil {
+		return nil, err
+	}
+
+	encoder := &audio.PCMEncoderWriter{}
+	if err := encoder.Init(p2.Codec, w); err != nil {
+		return nil, fmt.Errorf("failed to create encoder: %w", err)
+	}
+	resamplerOut := &audio.PCMResamplerWriter{}
+	if err := resamplerOut.Init(encoder, c.SampleRate, 1, int(p2.Codec.SampleRate), p2.Codec.NumChannels); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil, fmt.Errorf("conference closed")
+	default:
+	}
+	c.participants = append(c.participants, p)
+	startMixer := !c.mixing
+	c.mixing = true
+	c.mu.Unlock()
+
+	log := c.log.With("id", d.Id())
+	log.Debug("Participant joined conference", "codec1", p1.Codec.Name, "codec2", p2.Codec.Name)
+	go p.readLoop(log, decoder, p1.Codec.Samples16(), resamplerIn, m.RTPPacketReader)
+	go p.writeLoop(log, resamplerOut, m.RTPPacketWriter)
+
+	if startMixer {
+		go c.mixLoop()
+	}
+	return p, nil
+}
+
+// Leave removes dialog session from conference. Dialog session is not terminated
+func (c *Conference) Leave(d DialogSession) error {
+	c.mu.Lock()
+	ind := slices.IndexFunc(c.participants, func(p *ConferenceParticipant) bool {
+		return p.Dialog.Id() == d.Id()
+	})
+	if ind < 0 {
+		c.mu.Unlock()
+		return fmt.Errorf("dialog session is not in conference %q", d.Id())
+	}
+	p := c.participants[ind]
+	c.participants = slices.Delete(c.participants, ind, ind+1)
+	c.mu.Unlock()
+
+	return p.stop()
+}
+
+// Close stops mixing and removes all participants
+func (c *Conference) Close() error {
+	c.mu.Lock()
+	if c.done == nil {
+		// Not initialized
+		c.done = make(chan struct{})
+	}
+	c.closeOnce.Do(func() { close(c.done) })
+	participants := c.participants
+	c.participants = nil
+	c.mu.Unlock()
+
+	var err error
+	for _, p := range participants {
+		err = errors.Join(err, p.stop())
+	}
+	return err
+}
+
+func (c *Conference) remove(p *ConferenceParticipant) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.participants = slices.DeleteFunc(c.participants, func(cp *ConferenceParticipant) bool {
+		return cp == p
+	})
+}
+
+// mixLoop mixes until last participant leaves. Next Join starts it again
+func (c *Conference) mixLoop() {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			if len(c.participants) == 0 {
+				c.mixing = false
+				c.mu.Unlock()
+				return
+			}
+			c.mu.Unlock()
+			c.mix()
+		}
+	}
+}
+
+// mix takes single frame of each participant and sends N-1 mix to each participant
+func (c *Conference) mix() {
+	participants := c.Participants()
+	if len(participants) == 0 {
+		return
+	}
+
+	total := make([]int32, c.frameSamples)
+	contribs := make([][]int32, len(participants))
+	csrc := make([]uint32, 0, len(participants))
+	for i, p := range participants {
+		frame := p.nextFrame()
+		muted, _, gain := p.state()
+
+		talking := p.detectTalker(frameLevel(frame), c.TalkerLevel)
+		if talking != nil && c.OnTalker != nil {
+			c.OnTalker(p, *talking)
+		}
+
+		if frame == nil || muted {
+			continue
+		}
+
+		contrib := make([]int32, c.frameSamples)
+		for k := 0; k < len(contrib) && k < len(frame); k++ {
+			contrib[k] = int32(float64(frame[k]) * gain)
+			total[k] += contrib[k]
+		}
+		contribs[i] = contrib
+
+		if ssrc := p.ssrc.Load(); ssrc != 0 && p.Talking() {
+			csrc = append(csrc, ssrc)
+		}
+	}
+
+	for i, p := range participants {
+		_, deaf, _ := p.state()
+		if deaf {
+			continue
+		}
+
+		out := make([]int16, c.frameSamples)
+		own := contribs[i]
+		for k, v := range total {
+			if own != nil {
+				v -= own[k]
+			}
+			out[k] = int16(max(math.MinInt16, min(math.MaxInt16, v)))
+		}
+
+		// Participant own source is not contributing
+		ssrc := p.ssrc.Load()
+		pcsrc := slices.DeleteFunc(slices.Clone(csrc), func(s uint32) bool { return s == ssrc })
+		p.send(conferenceFrame{pcm: out, csrc: pcsrc})
+	}
+}
+
+type conferenceFrame struct {
+	pcm  []int16
+	csrc []uint32
+}
+
+// ConferenceParticipant is dialog session joined in conference
+type ConferenceParticipant struct {
+	Dialog DialogSession
+
+	conf *Conference
+	mu   sync.Mutex
+	// muted participant is not heard by others
+	muted bool
+	// deaf participant does not hear others
+	deaf bool
+	gain float64
+
+	talking     bool
+	quietFrames int
+	ssrc        atomic.Uint32
+
+	in        chan []int16
+	out       chan conferenceFrame
+	done      chan struct{}
+	stopOnce  sync.Once
+	readDone  chan struct{}
+	writeDone chan struct{}
+}
+
+// Mute stops participant audio being mixed to others
+func (p *ConferenceParticipant) Mute(mute bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.muted = mute
+}
+
+// Deaf stops participant receiving audio from others
+func (p *ConferenceParticipant) Deaf(deaf bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deaf = deaf
+}
+
+// SetGain changes volume of participant audio heard by others. Default is 1
+func (p *ConferenceParticipant) SetGain(gain float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gain = gain
+}
+
+func (p *ConferenceParticipant) Muted() bool {
+	muted, _, _ := p.state()
+	return muted
+}
+
+func (p *ConferenceParticipant) IsDeaf() bool {
+	_, deaf, _ := p.state()
+	return deaf
+}
+
+// Talking returns is participant currently detected as talker
+func (p *ConferenceParticipant) Talking() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.talking
+}
+
+// Leave removes participant from conference
+func (p *ConferenceParticipant) Leave() error {
+	return p.conf.Leave(p.Dialog)
+}
+
+func (p *ConferenceParticipant) state() (muted bool, deaf bool, gain float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.muted, p.deaf, p.gain
+}
+
+// detectTalker returns non nil value when talking state changed
+func (p *ConferenceParticipant) detectTalker(level int, talkerLevel int) *bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if level >= talkerLevel {
+		p.quietFrames = 0
+		if !p.talking {
+			p.talking = true
+			return &p.talking
+		}
+		return nil
+	}
+
+	if !p.talking {
+		return nil
+	}
+
+	p.quietFrames++
+	if p.quietFrames < ConferenceTalkerHangover {
+		return nil
+	}
+	p.talking = false
+	return &p.talking
+}
+
+func (p *ConferenceParticipant) nextFrame() []int16 {
+	select {
+	case frame := <-p.in:
+		return frame
+	default:
+		return nil
+	}
+}
+
+func (p *ConferenceParticipant) send(f conferenceFrame) {
+	select {
+	case p.out <- f:
+	default:
+		// Writing is slower than mixing. Drop frame
+	}
+}
+
+func (p *ConferenceParticipant) readLoop(log *slog.Logger, decoder *audio.PCMDecoderReader, frameSize int, resampler *audio.PCMResampler, rtpReader *media.RTPPacketReader) {
+	defer close(p.readDone)
+	defer decoder.Close()
+
+	buf := make([]byte, frameSize)
+	resampled := make([]byte, resampler.OutputSize(frameSize))
+	for {
+		n, err := decoder.Read(buf)
+		if err != nil {
+			if !media.ErrorIsTimeout(err) {
+				log.Debug("Conference participant reading stopped", "error", err)
+				// Media is gone, so participant is leaving
+				p.conf.remove(p)
+				p.closeDone()
+			}
+			return
+		}
+		p.ssrc.Store(rtpReader.PacketHeader.SSRC)
+
+		nn, err := resampler.ResampleTo(resampled, buf[:n])
+		if err != nil {
+			log.Error("Conference failed to resample", "error", err)
+			continue
+		}
+
+		frame := make([]int16, nn/2)
+		for i := range frame {
+			frame[i] = int16(binary.LittleEndian.Uint16(resampled[i*2:]))
+		}
+
+		select {
+		case p.in <- frame:
+		default:
+			// Mixer is slower. Drop oldest frame to keep delay low
+			select {
+			case <-p.in:
+			default:
+			}
+			select {
+			case p.in <- frame:
+			default:
+			}
+		}
+	}
+}
+
+func (p *ConferenceParticipant) writeLoop(log *slog.Logger, w *audio.PCMResamplerWriter, rtpWriter *media.RTPPacketWriter) {
+	defer close(p.writeDone)
+
+	var buf []byte
+	for {
+		select {
+		case <-p.done:
+			return
+		case f := <-p.out:
+			if cap(buf) < 2*len(f.pcm) {
+				buf = make([]byte, 2*len(f.pcm))
+			}
+			buf = buf[:2*len(f.pcm)]
+			for i, s := range f.pcm {
+				binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+			}
+
+			rtpWriter.SetCSRC(f.csrc)
+			if _, err := w.Write(buf); err != nil {
+				log.Debug("Conference participant writing stopped", "error", err)
+				return
+			}
+		}
+	}
+}
+
+func (p *ConferenceParticipant) closeDone() {
+	p.stopOnce.Do(func() { close(p.done) })
+}
+
+// stop stops reading and writing of participant. Dialog media is left running
+func (p *ConferenceParticipant) stop() error {
+	p.closeDone()
+	<-p.writeDone
+
+	select {
+	case <-p.readDone:
+		return nil
+	default:
+	}
+
+	// Unblock reading
+	m := p.Dialog.Media()
+	if err := m.StopRTP(1, 0); err != nil {
+		return err
+	}
+	<-p.readDone
+	return m.StartRTP(1, 0)
+}
+
+// frameLevel returns RMS level of frame
+func frameLevel(frame []int16) int {
+	if len(frame) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range frame {
+		sum += float64(s) * float64(s)
+	}
+	return int(math.Sqrt(sum / float64(len(frame))))
+}
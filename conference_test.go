@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+func testConferenceParticipant(c *Conference, ssrc uint32) *ConferenceParticipant {
+	p := &ConferenceParticipant{
+		conf: c,
+		gain: 1,
+		in:   make(chan []int16, ConferenceFrameQueue),
+		out:  make(chan conferenceFrame, ConferenceFrameQueue),
+	}
+	p.ssrc.Store(ssrc)
+	c.participants = append(c.participants, p)
+	return p
+}
+
+func testConferenceFrame(c *Conference, val int16) []int16 {
+	frame := make([]int16, c.frameSamples)
+	for i := range frame {
+		frame[i] = val
+	}
+	return frame
+}
+
+func TestConferenceMix(t *testing.T) {
+	c := NewConference()
+
+	var talkers []bool
+	c.OnTalker = func(p *ConferenceParticipant, talking bool) {
+		talkers = append(talkers, talking)
+	}
+
+	p1 := testConferenceParticipant(c, 1)
+	p2 := testConferenceParticipant(c, 2)
+	p3 := testConferenceParticipant(c, 3)
+
+	mix := func(v1, v2, v3 int16) {
+		p1.in <- testConferenceFrame(c, v1)
+		p2.in <- testConferenceFrame(c, v2)
+		p3.in <- testConferenceFrame(c, v3)
+		c.mix()
+	}
+
+	t.Run("N-1", func(t *testing.T) {
+		mix(1000, 2000, 4000)
+
+		f := <-p1.out
+		assert.Equal(t, testConferenceFrame(c, 6000), f.pcm)
+		assert.Equal(t, []uint32{2, 3}, f.csrc)
+		f = <-p2.out
+		assert.Equal(t, testConferenceFrame(c, 5000), f.pcm)
+		assert.Equal(t, []uint32{1, 3}, f.csrc)
+		f = <-p3.out
+		assert.Equal(t, testConferenceFrame(c, 3000), f.pcm)
+		assert.Equal(t, []uint32{1, 2}, f.csrc)
+		assert.Equal(t, []bool{true, true, true}, talkers)
+	})
+
+	t.Run("MuteDeafGain", func(t *testing.T) {
+		p1.Mute(true)
+		p2.Deaf(true)
+		p3.SetGain(0.5)
+		mix(1000, 2000, 4000)
+
+		f := <-p1.out
+		assert.Equal(t, testConferenceFrame(c, 4000), f.pcm)
+		assert.Empty(t, p2.out)
+		f = <-p3.out
+		assert.Equal(t, testConferenceFrame(c, 2000), f.pcm)
+
+		p1.Mute(false)
+		p2.Deaf(false)
+		p3.SetGain(1)
+	})
+
+	t.Run("Clipping", func(t *testing.T) {
+		mix(30000, 30000, 30000)
+		f := <-p1.out
+		assert.Equal(t, testConferenceFrame(c, 32767), f.pcm)
+		<-p2.out
+		<-p3.out
+	})
+
+	t.Run("TalkerStop", func(t *testing.T) {
+		talkers = nil
+		for i := 0; i < ConferenceTalkerHangover; i++ {
+			mix(0, 0, 4000)
+			<-p1.out
+			<-p2.out
+			<-p3.out
+		}
+		assert.Equal(t, []bool{false, false}, talkers)
+		assert.False(t, p1.Talking())
+		assert.True(t, p3.Talking())
+	})
+}
+
+func TestConferenceJoin(t *testing.T) {
+	c := NewConference()
+	defer c.Close()
+
+	pcm := bytes.Repeat([]byte{0, 10}, 160*10)
+	newDialog := func(codec media.Codec, id string) *DialogServerSession {
+		encoded := make([]byte, len(pcm)/2)
+		enc := audio.EncodeUlawTo
+		if codec == media.CodecAudioAlaw {
+			enc = audio.EncodeAlawTo
+		}
+		_, err := enc(encoded, pcm)
+		require.NoError(t, err)
+
+		d := &DialogServerSession{
+			DialogServerSession: &sipgo.DialogServerSession{Dialog: sipgo.Dialog{ID: id}},
+			DialogMedia: DialogMedia{
+				mediaSession: &media.MediaSession{
+					Codecs: []media.Codec{codec},
+				},
+				audioReader:     &packetReader{data: encoded, frameSize: 160, delay: 20 * time.Millisecond},
+				audioWriter:     &syncBuffer{},
+				RTPPacketReader: media.NewRTPPacketReader(nil, codec),
+				RTPPacketWriter: media.NewRTPPacketWriter(nil, codec),
+			},
+		}
+		return d
+	}
+
+	dialogs := []*DialogServerSession{
+		newDialog(media.CodecAudioAlaw, "d1"),
+		newDialog(media.CodecAudioUlaw, "d2"),
+		newDialog(media.CodecAudioAlaw, "d3"),
+	}
+	for _, d := range dialogs {
+		_, err := c.Join(d)
+		require.NoError(t, err)
+	}
+	require.Len(t, c.Participants(), 3)
+
+	// Participants leave when media stops
+	require.Eventually(t, func() bool {
+		return len(c.Participants()) == 0
+	}, 2*time.Second, 20*time.Millisecond)
+
+	for _, d := range dialogs {
+		assert.NotZero(t, d.audioWriter.(*syncBuffer).Len())
+	}
+
+	// Mixing stops without participants
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return !c.mixing
+	}, time.Second, 20*time.Millisecond)
+}
+
+func TestConferenceCloseNotInitialized(t *testing.T) {
+	c := &Conference{}
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/emiago/sipgo"
 	"github.com/emiago/sipgo/sip"
+	"github.com/vertan/diago/audio"
 	"github.com/vertan/diago/media"
 )
 
@@ -528,6 +529,16 @@ type InviteOptions struct {
 	Password string
 	// Custom headers to pass. DO NOT SET THIS to nil
 	Headers []sip.Header
+
+	// Ringback generates local ringback toward Originator while outgoing call rings without early media,
+	// like on 180 Ringing without SDP. Originator must have media setup, like with ProgressMedia or Answer.
+	// Ringback stops and early media is bridged if 183 with SDP arrives, and bridge continues on answer.
+	// Only used by InviteBridge
+	//
+	// Experimental
+	Ringback bool
+	// RingbackTonePlan is tone plan of Ringback. Default is audio.TonePlanDefault preset
+	RingbackTonePlan audio.TonePlan
 }
 
 // Invite makes outgoing call leg and waits for answer.
@@ -560,6 +571,7 @@ func (dg *Diago) Invite(ctx context.Context, recipient sip.Uri, opts InviteOptio
 // Outgoing session will be added into bridge on answer
 // If bridge has Originator (first participant) it will be used for creating outgoing call leg as in B2BUA
 // When bridge is provided then this call will be bridged with any participant already present in bridge
+// With Ringback option originator hears local ringback or early media until answer
 func (dg *Diago) InviteBridge(ctx context.Context, recipient sip.Uri, bridge *Bridge, opts InviteOptions) (d *DialogClientSession, err error) {
 	d, err = dg.NewDialog(recipient, NewDialogOptions{})
 	if err != nil {
@@ -571,13 +583,54 @@ func (dg *Diago) InviteBridge(ctx context.Context, recipient sip.Uri, bridge *Br
 		opts.Originator = bridge.Originator
 	}
 
-	if err := d.Invite(ctx, InviteClientOptions{
+	inviteOpts := InviteClientOptions{
 		Originator: opts.Originator,
 		OnResponse: opts.OnResponse,
 		Headers:    opts.Headers,
 		Username:   opts.Username,
 		Password:   opts.Password,
-	}); err != nil {
+	}
+
+	ringback := inviteRingback{}
+	if opts.Ringback {
+		if err := ringback.init(opts.Originator, opts.RingbackTonePlan); err != nil {
+			d.Close()
+			return nil, err
+		}
+		inviteOpts.OnResponse = ringback.onResponse(opts.OnResponse)
+		inviteOpts.EarlyMediaDetect = true
+	}
+
+	err = d.Invite(ctx, inviteOpts)
+	if rerr := ringback.stop(); rerr != nil {
+		dg.log.Error("Failed to stop ringback", "error", rerr)
+	}
+
+	if errors.Is(err, ErrClientEarlyMedia) {
+		// Early media is bridged. On answer media session is updated and bridge continues
+		if err := bridge.AddDialogSession(d); err != nil {
+			d.Close()
+			return nil, err
+		}
+
+		err = d.WaitAnswer(ctx, sipgo.AnswerOptions{
+			Username:   opts.Username,
+			Password:   opts.Password,
+			OnResponse: opts.OnResponse,
+		})
+		if err == nil {
+			err = d.Ack(ctx)
+		}
+		if err != nil {
+			// Call failed after early media. Originator is left in bridge without proxy
+			bridge.removeDialogSession(d)
+			d.Close()
+			return nil, err
+		}
+		return d, nil
+	}
+
+	if err != nil {
 		d.Close()
 		return nil, err
 	}
@@ -595,6 +648,67 @@ func (dg *Diago) InviteBridge(ctx context.Context, recipient sip.Uri, bridge *Br
 	return d, nil
 }
 
+// inviteRingback plays ringback to originator while outgoing call rings
+type inviteRingback struct {
+	tone     AudioTone
+	mu       sync.Mutex
+	stopFunc func() error
+}
+
+func (r *inviteRingback) init(originator DialogSession, plan audio.TonePlan) error {
+	if originator == nil {
+		return fmt.Errorf("ringback needs originator")
+	}
+	if plan.Country == "" {
+		plan, _ = audio.TonePlanCountry(audio.TonePlanDefault)
+	}
+
+	tone, err := originator.Media().PlaybackToneCreate(plan, audio.ToneRingback)
+	if err != nil {
+		return fmt.Errorf("ringback can not be created: %w", err)
+	}
+	r.tone = tone
+	return nil
+}
+
+// onResponse starts ringback on first provisional response without SDP
+func (r *inviteRingback) onResponse(onResponse func(res *sip.Response) error) func(res *sip.Response) error {
+	return func(res *sip.Response) error {
+		if onResponse != nil {
+			if err := onResponse(res); err != nil {
+				return err
+			}
+		}
+
+		if !res.IsProvisional() || res.StatusCode == sip.StatusTrying || len(res.Body()) > 0 {
+			return nil
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.stopFunc != nil {
+			return nil
+		}
+		stop, err := r.tone.PlayBackground()
+		if err != nil {
+			return err
+		}
+		r.stopFunc = stop
+		return nil
+	}
+}
+
+func (r *inviteRingback) stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopFunc == nil {
+		return nil
+	}
+	err := r.stopFunc()
+	r.stopFunc = nil
+	return err
+}
+
 type NewDialogOptions struct {
 	// Transport or protocol that should be used
 	Transport string
@@ -747,7 +861,8 @@ func (dg *Diago) Register(ctx context.Context, recipient sip.Uri, opts RegisterO
 
 	// Unregister
 	defer func() {
-		ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
 		err := t.Unregister(ctx)
 		if err != nil {
 			dg.log.Error("Failed to unregister", "error", err)
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"io"
 	"net"
-	"net/http"
 	"os"
 	"slices"
 	"sync"
@@ -23,17 +22,13 @@ import (
 
 var (
 	HTTPDebug = os.Getenv("HTTP_DEBUG") == "true"
-	// TODO remove client singleton
-	client = http.Client{
-		Timeout: 10 * time.Second,
-	}
 
 	errNoRTPSession = errors.New("no rtp session")
 )
 
 func init() {
 	if HTTPDebug {
-		client.Transport = &loggingTransport{}
+		PlaybackURLClient.Transport = &loggingTransport{}
 	}
 }
 
@@ -67,6 +62,13 @@ type DialogMedia struct {
 	// In case we are chaining audio readers
 	audioReader io.Reader
 	audioWriter io.Writer
+	// audioTaps fork audio for media stream and SIPREC. They are installed once on first fork
+	audioTaps *dialogAudioTaps
+
+	// rtpForks are moved to new rtp session on media changes
+	rtpForks []*media.RTPFork
+	// rtpRelays are updated with new rtp session on media changes, see Bridge RTPpass
+	rtpRelays []*media.RTPRelay
 
 	// lastInvite is actual last invite sent by remote REINVITE
 	// We do not use sipgo as this needs mutex but also keeping original invite
@@ -149,12 +151,21 @@ func (d *DialogMedia) initMediaSessionFromConf(conf MediaConfig) error {
 		return nil
 	}
 
+	sess, err := newMediaSessionFromConf(conf, sdp.ModeSendrecv)
+	if err != nil {
+		return err
+	}
+	d.mediaSession = sess
+	return nil
+}
+
+func newMediaSessionFromConf(conf MediaConfig, mode string) (*media.MediaSession, error) {
 	bindIP := conf.bindIP
 	if bindIP == nil {
 		var err error
 		bindIP, _, err = sip.ResolveInterfacesIP("ip4", nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -162,16 +173,15 @@ func (d *DialogMedia) initMediaSessionFromConf(conf MediaConfig) error {
 		Codecs:     slices.Clone(conf.Codecs),
 		Laddr:      net.UDPAddr{IP: bindIP, Port: 0},
 		ExternalIP: conf.externalIP,
-		Mode:       sdp.ModeSendrecv,
+		Mode:       mode,
 		SecureRTP:  conf.secureRTP,
 		SRTPAlg:    conf.SecureRTPAlg,
 	}
 
 	if err := sess.Init(); err != nil {
-		return err
+		return nil, err
 	}
-	d.mediaSession = sess
-	return nil
+	return sess, nil
 }
 
 // RTPSession returns underhood rtp session
@@ -249,6 +259,9 @@ func (d *DialogMedia) sdpUpdateUnsafe(sdp []byte) error {
 	d.onCloseUnsafe(func() error {
 		return rtpSess.Close()
 	})
+	for _, f := range d.rtpForks {
+		rtpSess.AddFork(f)
+	}
 
 	if err := rtpSess.MonitorBackground(); err != nil {
 		rtpSess.Close()
@@ -257,6 +270,9 @@ func (d *DialogMedia) sdpUpdateUnsafe(sdp []byte) error {
 
 	d.RTPPacketReader.UpdateRTPSession(rtpSess)
 	d.RTPPacketWriter.UpdateRTPSession(rtpSess)
+	for _, r := range d.rtpRelays {
+		r.UpdateRTPSession(d.rtpSession, rtpSess)
+	}
 
 	// update the reference
 	d.mediaSession = msess
@@ -297,7 +313,7 @@ func WithAudioReaderRTPStats(hook media.OnRTPReadStats) AudioReaderOption {
 // WithAudioReaderDTMF creates DTMF interceptor
 func WithAudioReaderDTMF(r *DTMFReader) AudioReaderOption {
 	return func(d *DialogMedia) error {
-		r.dtmfReader = media.NewRTPDTMFReader(media.CodecTelephoneEvent8000, d.RTPPacketReader, d.getAudioReader())
+		r.dtmfReader = media.NewRTPDTMFReader(media.CodecTelephoneEventFromSession(d.mediaSession), d.RTPPacketReader, d.getAudioReader())
 		r.mediaSession = d.mediaSession
 
 		d.audioReader = r
@@ -305,6 +321,40 @@ func WithAudioReaderDTMF(r *DTMFReader) AudioReaderOption {
 	}
 }
 
+// WithAudioReaderVAD creates voice activity detection interceptor. Audio is decoded with current codec
+// and VAD callbacks are called from reading goroutine.
+//
+// Experimental
+func WithAudioReaderVAD(r *audio.VADReader) AudioReaderOption {
+	return func(d *DialogMedia) error {
+		if err := r.Init(media.CodecAudioFromSession(d.mediaSession), d.getAudioReader()); err != nil {
+			return err
+		}
+		r.PacketReader = d.RTPPacketReader
+		d.audioReader = r
+		return nil
+	}
+}
+
+// WithAudioReaderJitterBuffer puts jitter buffer between RTP session and RTP packet reader.
+// Packets are reordered and losses are signaled to decoders. Buffer is initialized with current RTP session
+// and it stays on media session changes.
+//
+// Experimental
+func WithAudioReaderJitterBuffer(jb *media.RTPJitterBuffer) AudioReaderOption {
+	return func(d *DialogMedia) error {
+		if d.rtpSession == nil {
+			return errNoRTPSession
+		}
+		if _, ok := d.RTPPacketReader.Reader().(*media.RTPJitterBuffer); ok {
+			return fmt.Errorf("jitter buffer already exists")
+		}
+		jb.Init(d.rtpSession)
+		d.RTPPacketReader.UpdateReader(jb)
+		return nil
+	}
+}
+
 // AudioReader gets current audio reader. It MUST be called after Answer.
 // Use AuidioListen for optimized reading.
 // Reading buffer should be equal or bigger of media.RTPBufSize
@@ -329,6 +379,30 @@ func (d *DialogMedia) getAudioReader() io.Reader {
 	return d.RTPPacketReader
 }
 
+// audioTapsInstall installs audio taps on current audio reader and writer once and returns them.
+// Audio reader and writer wrapped later are still forked
+func (d *DialogMedia) audioTapsInstall() *dialogAudioTaps {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.audioTaps != nil {
+		return d.audioTaps
+	}
+
+	taps := &dialogAudioTaps{}
+	log := media.DefaultLogger()
+	d.audioReader = &dialogTapReader{
+		r:            d.getAudioReader(),
+		taps:         taps,
+		log:          log,
+		packetReader: d.RTPPacketReader,
+		codec:        media.CodecAudioFromSession(d.mediaSession),
+		dtmfCodec:    media.CodecTelephoneEventFromSession(d.mediaSession),
+	}
+	d.audioWriter = &audioTapWriter{w: d.getAudioWriter(), tap: &taps.write, log: log}
+	d.audioTaps = taps
+	return taps
+}
+
 // audioReaderProps
 func (d *DialogMedia) audioReaderProps(p *MediaProps) io.Reader {
 	d.mu.Lock()
@@ -373,7 +447,7 @@ func WithAudioWriterRTPStats(hook media.OnRTPWriteStats) AudioWriterOption {
 // WithAudioWriterDTMF creates DTMF interceptor
 func WithAudioWriterDTMF(r *DTMFWriter) AudioWriterOption {
 	return func(d *DialogMedia) error {
-		r.dtmfWriter = media.NewRTPDTMFWriter(media.CodecTelephoneEvent8000, d.RTPPacketWriter, d.getAudioWriter())
+		r.dtmfWriter = media.NewRTPDTMFWriter(media.CodecTelephoneEventFromSession(d.mediaSession), d.RTPPacketWriter, d.getAudioWriter())
 		r.mediaSession = d.mediaSession
 		d.audioWriter = r
 		return nil
@@ -448,7 +522,7 @@ func (d *DialogMedia) PlaybackCreate() (AudioPlayback, error) {
 	return p, nil
 }
 
-// PlaybackControlCreate creates playback for audio with controls like mute unmute
+// PlaybackControlCreate creates playback for audio with controls like mute unmute, pause resume, seek and playlist
 func (d *DialogMedia) PlaybackControlCreate() (AudioPlaybackControl, error) {
 	// NOTE we should avoid returning pointers for any IN dialplan to avoid heap
 	mprops := MediaProps{}
@@ -459,7 +533,10 @@ func (d *DialogMedia) PlaybackControlCreate() (AudioPlaybackControl, error) {
 	}
 	// Audio is controled via audio reader/writer
 	control := &audioControl{
-		Writer: w,
+		Writer:   w,
+		frameDur: mprops.Codec.SampleDur,
+		// After pause RTP timestamp must continue with gap and marker
+		onResume: d.RTPPacketWriter.ResetTimestamp,
 	}
 
 	p := AudioPlaybackControl{
@@ -469,33 +546,49 @@ func (d *DialogMedia) PlaybackControlCreate() (AudioPlaybackControl, error) {
 	return p, nil
 }
 
-// PlaybackRingtoneCreate is creating playback for ringtone
+// PlaybackRingtoneCreate is creating playback for ringtone.
+// Ringtone is 350+440Hz played 2s with 4s pause. Use PlaybackToneCreate for ringback of country
 //
 // Experimental
 func (d *DialogMedia) PlaybackRingtoneCreate() (AudioRingtone, error) {
+	return d.playbackToneCreate(ringtone, 0)
+}
+
+// PlaybackToneCreate is creating playback for tone of tone plan like
+//
+//	plan, _ := audio.TonePlanCountry("de")
+//	tone, err := d.PlaybackToneCreate(plan, audio.ToneBusy)
+//
+// Experimental
+func (d *DialogMedia) PlaybackToneCreate(plan audio.TonePlan, name audio.ToneName) (AudioTone, error) {
+	tone, ok := plan.Tone(name)
+	if !ok {
+		return AudioTone{}, fmt.Errorf("tone %q not defined in tone plan %q", name, plan.Country)
+	}
+	return d.playbackToneCreate(tone, plan.Level)
+}
+
+func (d *DialogMedia) playbackToneCreate(tone audio.Tone, level float64) (AudioTone, error) {
 	mprops := MediaProps{}
 	w := d.audioWriterProps(&mprops)
 	if w == nil {
-		return AudioRingtone{}, fmt.Errorf("no media setup")
-	}
-
-	ringtone, err := loadRingTonePCM(mprops.Codec)
-	if err != nil {
-		return AudioRingtone{}, err
+		return AudioTone{}, fmt.Errorf("no media setup")
 	}
 
 	encoder := audio.PCMEncoderWriter{}
 	if err := encoder.Init(mprops.Codec, w); err != nil {
-		return AudioRingtone{}, err
+		return AudioTone{}, err
 	}
 
-	ar := AudioRingtone{
+	at := AudioTone{
 		writer:       &encoder,
-		ringtone:     ringtone,
+		tone:         tone,
+		level:        level,
+		sampleRate:   int(mprops.Codec.SampleRate),
 		sampleSize:   mprops.Codec.Samples16(),
 		mediaSession: d.mediaSession,
 	}
-	return ar, nil
+	return at, nil
 }
 
 // AudioStereoRecordingCreate creates Stereo Recording audio Pipeline and stores as Wav file format
@@ -506,27 +599,17 @@ func (d *DialogMedia) PlaybackRingtoneCreate() (AudioRingtone, error) {
 //
 // NOTE: API WILL change
 func (d *DialogMedia) AudioStereoRecordingCreate(wawFile *os.File) (AudioStereoRecordingWav, error) {
-	mpropsW := MediaProps{}
-	aw := d.audioWriterProps(&mpropsW)
-	if aw == nil {
-		return AudioStereoRecordingWav{}, fmt.Errorf("no media setup")
-	}
-
-	mpropsR := MediaProps{}
-	ar := d.audioReaderProps(&mpropsR)
-	if ar == nil {
-		return AudioStereoRecordingWav{}, fmt.Errorf("no media setup")
-	}
-	codec := mpropsW.Codec
-	if mpropsR.Codec != mpropsW.Codec {
-		return AudioStereoRecordingWav{}, fmt.Errorf("codecs of reader and writer need to match for stereo")
+	codec, err := d.audioStereoRecordingCodec()
+	if err != nil {
+		return AudioStereoRecordingWav{}, err
 	}
 	// Create wav file to store recording
 	// Now create WavWriter to have Wav Container written
 	wavWriter := audio.NewWavWriter(wawFile)
+	wavWriter.SampleRate = int(codec.SampleRate)
 
 	mon := audio.MonitorPCMStereo{}
-	if err := mon.Init(wavWriter, codec, ar, aw); err != nil {
+	if err := d.audioStereoMonitorInit(&mon, wavWriter, codec); err != nil {
 		wavWriter.Close()
 		return AudioStereoRecordingWav{}, err
 	}
@@ -538,6 +621,87 @@ func (d *DialogMedia) AudioStereoRecordingCreate(wawFile *os.File) (AudioStereoR
 	return r, nil
 }
 
+// AudioStereoRecordingOggOpusCreate creates Stereo Recording audio Pipeline and stores as Ogg Opus,
+// which is much smaller than wav. Calls with opus codec are recorded as received and sent without re-encoding.
+// Other codecs are encoded with opus, which requires building with with_opus_c tag.
+// For audio to be recorded use AudioReader and AudioWriter from Recording
+//
+// Experimental
+func (d *DialogMedia) AudioStereoRecordingOggOpusCreate(w io.Writer) (AudioStereoRecordingOggOpus, error) {
+	codec, err := d.audioStereoRecordingCodec()
+	if err != nil {
+		return AudioStereoRecordingOggOpus{}, err
+	}
+
+	if codec.IsOpus() && d.RTPPacketReader != nil && d.RTPPacketWriter != nil {
+		rtpWriter := audio.NewOggOpusRTPWriter(w)
+		r := AudioStereoRecordingOggOpus{
+			rtpWriter: rtpWriter,
+			reader: &oggOpusRTPTapReader{
+				r:   d.audioReaderProps(&MediaProps{}),
+				pkt: d.RTPPacketReader,
+				rec: rtpWriter,
+				pt:  codec.PayloadType,
+			},
+			writer: &oggOpusRTPTapWriter{
+				w:   d.audioWriterProps(&MediaProps{}),
+				pkt: d.RTPPacketWriter,
+				rec: rtpWriter,
+				pt:  codec.PayloadType,
+			},
+		}
+		return r, nil
+	}
+
+	// Opus encodes only 8, 12, 16, 24 and 48 kHz
+	sampleRate := int(codec.SampleRate)
+	switch sampleRate {
+	case 8000, 12000, 16000, 24000, 48000:
+	default:
+		sampleRate = 48000
+	}
+
+	oggWriter := &audio.OggOpusPCMWriter{}
+	if err := oggWriter.Init(w, sampleRate, 2); err != nil {
+		return AudioStereoRecordingOggOpus{}, err
+	}
+
+	mon := audio.MonitorPCMStereo{}
+	mon.MonitorPCMReader.SampleRate = sampleRate
+	mon.MonitorPCMWriter.SampleRate = sampleRate
+	if err := d.audioStereoMonitorInit(&mon, oggWriter, codec); err != nil {
+		return AudioStereoRecordingOggOpus{}, err
+	}
+
+	r := AudioStereoRecordingOggOpus{
+		oggWriter: oggWriter,
+		mon:       mon,
+	}
+	return r, nil
+}
+
+func (d *DialogMedia) audioStereoRecordingCodec() (media.Codec, error) {
+	mpropsW := MediaProps{}
+	if aw := d.audioWriterProps(&mpropsW); aw == nil {
+		return media.Codec{}, fmt.Errorf("no media setup")
+	}
+
+	mpropsR := MediaProps{}
+	if ar := d.audioReaderProps(&mpropsR); ar == nil {
+		return media.Codec{}, fmt.Errorf("no media setup")
+	}
+	if !mpropsR.Codec.Equal(mpropsW.Codec) {
+		return media.Codec{}, fmt.Errorf("codecs of reader and writer need to match for stereo")
+	}
+	return mpropsW.Codec, nil
+}
+
+func (d *DialogMedia) audioStereoMonitorInit(mon *audio.MonitorPCMStereo, record io.Writer, codec media.Codec) error {
+	aw := d.audioWriterProps(&MediaProps{})
+	ar := d.audioReaderProps(&MediaProps{})
+	return mon.Init(record, codec, ar, aw)
+}
+
 // Listen keeps reading stream until it gets closed or deadlined
 // Use ListenBackground or ListenContext for better control
 func (d *DialogMedia) Listen() (err error) {
@@ -616,6 +780,46 @@ func (d *DialogMedia) ListenContext(pctx context.Context) error {
 	}
 }
 
+// readAudioBounded passes current audio reader to read. Reading is stopped after maxDur or when ctx is done.
+// It is used for audio analysis
+func (d *DialogMedia) readAudioBounded(pctx context.Context, maxDur time.Duration, read func(r io.Reader, codec media.Codec) error) error {
+	mediaSession := d.MediaSession()
+	if mediaSession == nil {
+		return errNoRTPSession
+	}
+	props := MediaProps{}
+	reader := d.audioReaderProps(&props)
+	if reader == nil {
+		return errNoRTPSession
+	}
+
+	if err := mediaSession.StopRTP(1, maxDur); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(pctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		if pctx.Err() != nil {
+			mediaSession.StopRTP(1, 0)
+		}
+	}()
+	defer func() {
+		// Reading must be started after goroutine is done, so that it does not stop reading again
+		cancel()
+		<-stopped
+		mediaSession.StartRTP(1)
+	}()
+
+	err := read(reader, props.Codec)
+	if pctx.Err() != nil {
+		return pctx.Err()
+	}
+	return err
+}
+
 func (d *DialogMedia) ListenUntil(dur time.Duration) error {
 	buf := make([]byte, media.RTPBufSize)
 
@@ -652,7 +856,7 @@ type DTMFReader struct {
 func (m *DialogMedia) AudioReaderDTMF(minDuration ...uint16) *DTMFReader {
 	ar, _ := m.AudioReader()
 	return &DTMFReader{
-		dtmfReader:   media.NewRTPDTMFReader(media.CodecTelephoneEvent8000, m.RTPPacketReader, ar, minDuration...),
+		dtmfReader:   media.NewRTPDTMFReader(media.CodecTelephoneEventFromSession(m.mediaSession), m.RTPPacketReader, ar, minDuration...),
 		mediaSession: m.mediaSession,
 	}
 }
@@ -707,7 +911,7 @@ type DTMFWriter struct {
 
 func (m *DialogMedia) AudioWriterDTMF() *DTMFWriter {
 	return &DTMFWriter{
-		dtmfWriter:   media.NewRTPDTMFWriter(media.CodecTelephoneEvent8000, m.RTPPacketWriter, m.getAudioWriter()),
+		dtmfWriter:   media.NewRTPDTMFWriter(media.CodecTelephoneEventFromSession(m.mediaSession), m.RTPPacketWriter, m.getAudioWriter()),
 		mediaSession: m.mediaSession,
 	}
 }
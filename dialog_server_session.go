@@ -22,6 +22,8 @@ type DialogServerSession struct {
 	DialogMedia
 
 	onReferDialog func(referDialog *DialogClientSession)
+	// siprec is set when dialog is answered as SRS
+	siprec *SIPRECRecording
 
 	mediaConf MediaConfig
 	closed    atomic.Uint32
@@ -338,6 +340,13 @@ func (d *DialogServerSession) handleReInvite(req *sip.Request, tx sip.ServerTran
 		return tx.Respond(sip.NewResponseFromRequest(req, sip.StatusBadRequest, err.Error(), nil))
 	}
 
+	d.mu.Lock()
+	siprec := d.siprec
+	d.mu.Unlock()
+	if siprec != nil {
+		return siprec.handleReInvite(req, tx, d.InviteResponse.Contact())
+	}
+
 	return d.handleMediaUpdate(req, tx, d.InviteResponse.Contact())
 }
 
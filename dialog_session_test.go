@@ -4,6 +4,7 @@
 package diago
 
 import (
+	"bytes"
 	"context"
 	"math/rand/v2"
 	"testing"
@@ -263,3 +264,233 @@ func TestIntegrationDialogCancel(t *testing.T) {
 	}
 
 }
+
+func TestIntegrationBridgingRingback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	earlyFrame := bytes.Repeat([]byte{0, 100}, 80)
+	{
+		// Callee rings without SDP, then sends early media and answers
+		ua, _ := sipgo.NewUA()
+		defer ua.Close()
+
+		dg := NewDiago(ua, WithTransport(
+			Transport{
+				Transport: "udp",
+				BindHost:  "127.0.0.201",
+				BindPort:  5091,
+			},
+		))
+		err := dg.ServeBackground(ctx, func(d *DialogServerSession) {
+			d.Trying()
+			d.Ringing()
+			time.Sleep(300 * time.Millisecond)
+
+			if err := d.ProgressMedia(); err != nil {
+				t.Log("Failed to progress media", err)
+				return
+			}
+			w, _ := d.AudioWriter()
+			for i := 0; i < 10; i++ {
+				w.Write(earlyFrame)
+			}
+
+			if err := d.Answer(); err != nil {
+				t.Log("Failed to answer", err)
+				return
+			}
+			<-d.Context().Done()
+		})
+		require.NoError(t, err)
+	}
+
+	b2buaDone := make(chan struct{})
+	{
+		// B2BUA
+		ua, _ := sipgo.NewUA()
+		defer ua.Close()
+
+		tu := NewDiago(ua, WithTransport(
+			Transport{
+				Transport: "udp",
+				BindHost:  "127.0.0.1",
+				BindPort:  5091,
+			},
+		))
+		err := tu.ServeBackground(ctx, func(in *DialogServerSession) {
+			defer close(b2buaDone)
+			in.Trying()
+			if err := in.Answer(); err != nil {
+				t.Log("Failed to answer", err)
+				return
+			}
+
+			bridge := NewBridge()
+			if err := bridge.AddDialogSession(in); err != nil {
+				t.Log("Adding dialog in bridge failed", err)
+				return
+			}
+
+			out, err := tu.InviteBridge(in.Context(), sip.Uri{User: "test", Host: "127.0.0.201", Port: 5091}, &bridge, InviteOptions{
+				Ringback: true,
+			})
+			if err != nil {
+				t.Log("Dialing failed", err)
+				return
+			}
+			defer out.Close()
+
+			select {
+			case <-in.Context().Done():
+			case <-out.Context().Done():
+			}
+			out.Hangup(context.Background())
+		})
+		require.NoError(t, err)
+	}
+
+	ua, _ := sipgo.NewUA()
+	defer ua.Close()
+
+	dg := newDialer(ua)
+	dialog, err := dg.Invite(ctx, sip.Uri{Host: "127.0.0.1", Port: 5091}, InviteOptions{})
+	require.NoError(t, err)
+	defer dialog.Close()
+
+	// Ringback is heard first and then early media of callee
+	r, _ := dialog.AudioReader()
+	ringback := 0
+	readDone := make(chan error)
+	go func() {
+		buf := make([]byte, media.RTPBufSize)
+		for {
+			n, err := r.Read(buf)
+			if err != nil {
+				readDone <- err
+				return
+			}
+			if bytes.Equal(buf[:n], earlyFrame) {
+				readDone <- nil
+				return
+			}
+			ringback++
+		}
+	}()
+
+	select {
+	case err := <-readDone:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("early media not received")
+	}
+	assert.Greater(t, ringback, 5)
+	dialog.Hangup(ctx)
+	<-b2buaDone
+}
+
+func TestIntegrationBridgingEarlyMediaFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	{
+		// Callee sends early media and then rejects call
+		ua, _ := sipgo.NewUA()
+		defer ua.Close()
+
+		dg := NewDiago(ua, WithTransport(
+			Transport{
+				Transport: "udp",
+				BindHost:  "127.0.0.202",
+				BindPort:  5092,
+			},
+		))
+		err := dg.ServeBackground(ctx, func(d *DialogServerSession) {
+			d.Trying()
+			if err := d.ProgressMedia(); err != nil {
+				t.Log("Failed to progress media", err)
+				return
+			}
+			w, _ := d.AudioWriter()
+			for i := 0; i < 10; i++ {
+				w.Write(make([]byte, 160))
+			}
+			d.Respond(sip.StatusBusyHere, "Busy Here", nil)
+		})
+		require.NoError(t, err)
+	}
+
+	type result struct {
+		err       error
+		dialogs   int
+		proxying  bool
+		originErr error
+	}
+	b2buaRes := make(chan result, 1)
+	{
+		// B2BUA
+		ua, _ := sipgo.NewUA()
+		defer ua.Close()
+
+		tu := NewDiago(ua, WithTransport(
+			Transport{
+				Transport: "udp",
+				BindHost:  "127.0.0.1",
+				BindPort:  5092,
+			},
+		))
+		err := tu.ServeBackground(ctx, func(in *DialogServerSession) {
+			in.Trying()
+			if err := in.Answer(); err != nil {
+				t.Log("Failed to answer", err)
+				return
+			}
+
+			bridge := NewBridge()
+			if err := bridge.AddDialogSession(in); err != nil {
+				t.Log("Adding dialog in bridge failed", err)
+				return
+			}
+
+			_, err := tu.InviteBridge(in.Context(), sip.Uri{User: "test", Host: "127.0.0.202", Port: 5092}, &bridge, InviteOptions{
+				Ringback: true,
+			})
+			res := result{err: err, dialogs: len(bridge.GetDialogs()), proxying: bridge.proxyDone != nil}
+
+			// Originator audio is no longer read by proxy
+			r, _ := in.AudioReader()
+			in.mediaSession.StopRTP(1, 2*time.Second)
+			_, res.originErr = r.Read(make([]byte, media.RTPBufSize))
+			b2buaRes <- res
+			in.Hangup(context.Background())
+		})
+		require.NoError(t, err)
+	}
+
+	ua, _ := sipgo.NewUA()
+	defer ua.Close()
+
+	dg := newDialer(ua)
+	dialog, err := dg.Invite(ctx, sip.Uri{Host: "127.0.0.1", Port: 5092}, InviteOptions{})
+	require.NoError(t, err)
+	defer dialog.Close()
+
+	w, _ := dialog.AudioWriter()
+	go func() {
+		for dialog.Context().Err() == nil {
+			if _, err := w.Write(make([]byte, 160)); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case res := <-b2buaRes:
+		require.Error(t, res.err)
+		assert.Equal(t, 1, res.dialogs)
+		assert.False(t, res.proxying)
+		require.NoError(t, res.originErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridging not finished")
+	}
+}
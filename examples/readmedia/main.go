@@ -62,6 +62,7 @@ func ReadMedia(inDialog *diago.DialogServerSession) error {
 	if err != nil {
 		return err
 	}
+	defer decoder.Close()
 	for {
 		_, err := decoder.Read(buf)
 		if err != nil {
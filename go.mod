@@ -7,6 +7,7 @@ toolchain go1.24.2
 require (
 	github.com/emiago/sipgo v0.33.0
 	github.com/go-audio/riff v1.0.0
+	github.com/gobwas/ws v1.4.0
 	github.com/google/uuid v1.6.0
 	github.com/icholy/digest v1.1.0
 	github.com/pion/rtcp v1.2.15
@@ -21,7 +22,6 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gobwas/httphead v0.1.0 // indirect
 	github.com/gobwas/pool v0.2.1 // indirect
-	github.com/gobwas/ws v1.4.0 // indirect
 	github.com/google/go-cmp v0.7.0 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/pion/logging v0.2.3 // indirect
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -18,8 +19,13 @@ var (
 	// Here are some codec constants that can be reused
 	CodecAudioUlaw          = Codec{PayloadType: 0, SampleRate: 8000, SampleDur: 20 * time.Millisecond, NumChannels: 1, Name: "PCMU"}
 	CodecAudioAlaw          = Codec{PayloadType: 8, SampleRate: 8000, SampleDur: 20 * time.Millisecond, NumChannels: 1, Name: "PCMA"}
-	CodecAudioOpus          = Codec{PayloadType: 96, SampleRate: 48000, SampleDur: 20 * time.Millisecond, NumChannels: 2, Name: "opus"}
+	CodecAudioOpus          = Codec{PayloadType: 96, SampleRate: 48000, SampleDur: 20 * time.Millisecond, NumChannels: 2, Name: "opus", Opus: sdp.OpusFmtp{Stereo: true, SpropStereo: true, UseInbandFEC: true}}
 	CodecTelephoneEvent8000 = Codec{PayloadType: 101, SampleRate: 8000, SampleDur: 20 * time.Millisecond, NumChannels: 1, Name: "telephone-event"}
+	// CodecComfortNoise8000 is RFC 3389 comfort noise. It is not offered by default
+	CodecComfortNoise8000 = Codec{PayloadType: 13, SampleRate: 8000, SampleDur: 20 * time.Millisecond, NumChannels: 1, Name: "CN"}
+
+	// CodecAudioOpusMono is opus with mono PCM. In SDP it is still presented as opus/48000/2 but with stereo=0
+	CodecAudioOpusMono = Codec{PayloadType: 96, SampleRate: 48000, SampleDur: 20 * time.Millisecond, NumChannels: 1, Name: "opus", Opus: sdp.OpusFmtp{UseInbandFEC: true}}
 )
 
 type Codec struct {
@@ -28,6 +34,10 @@ type Codec struct {
 	SampleRate  uint32
 	SampleDur   time.Duration
 	NumChannels int // 1 or 2
+
+	// Opus are fmtp parameters of opus codec. After negotiation they are holding remote preferences
+	// which are applied on our encoder
+	Opus sdp.OpusFmtp
 }
 
 func (c *Codec) String() string {
@@ -49,6 +59,50 @@ func (c *Codec) SamplesPCM(bitSize int) int {
 	return bitSize / 8 * int(float64(c.SampleRate)*c.SampleDur.Seconds()) * c.NumChannels
 }
 
+// Equal compares codecs ignoring format parameters
+func (c *Codec) Equal(other Codec) bool {
+	a := *c
+	a.Opus, other.Opus = sdp.OpusFmtp{}, sdp.OpusFmtp{}
+	return a == other
+}
+
+// IsOpus checks is codec opus by encoding name
+func (c *Codec) IsOpus() bool {
+	return strings.EqualFold(c.Name, "opus")
+}
+
+// IsTelephoneEvent checks is codec RFC 4733 telephone-event
+func (c *Codec) IsTelephoneEvent() bool {
+	return strings.EqualFold(c.Name, "telephone-event")
+}
+
+// IsComfortNoise checks is codec RFC 3389 comfort noise
+func (c *Codec) IsComfortNoise() bool {
+	return strings.EqualFold(c.Name, "CN")
+}
+
+// codecNegotiate checks does remote codec match local and returns negotiated codec.
+// For opus rtpmap always has 2 channels, so channels are taken from local codec and
+// fmtp params are taken from remote.
+// Telephone event and comfort noise can have dynamic payload type, so payload type is taken from remote
+func codecNegotiate(local Codec, remote Codec) (Codec, bool) {
+	if local.IsTelephoneEvent() && remote.IsTelephoneEvent() {
+		return remote, local.SampleRate == remote.SampleRate
+	}
+
+	if local.IsComfortNoise() && remote.IsComfortNoise() {
+		return remote, local.SampleRate == remote.SampleRate
+	}
+
+	if local.IsOpus() && remote.IsOpus() {
+		remote.NumChannels = local.NumChannels
+		remote.Name = local.Name
+		local.Opus = remote.Opus
+		return local, local == remote
+	}
+	return local, local == remote
+}
+
 func CodecAudioFromSession(s *MediaSession) Codec {
 	codec, exists := CodecAudioFromList(s.filterCodecs)
 	if !exists {
@@ -60,7 +114,7 @@ func CodecAudioFromSession(s *MediaSession) Codec {
 
 func CodecAudioFromList(codecs []Codec) (Codec, bool) {
 	for _, codec := range codecs {
-		if codec.Name == "telephone-event" {
+		if codec.IsTelephoneEvent() || codec.IsComfortNoise() {
 			continue
 		}
 
@@ -70,6 +124,40 @@ func CodecAudioFromList(codecs []Codec) (Codec, bool) {
 	return Codec{}, false
 }
 
+// CodecTelephoneEventFromSession returns negotiated telephone-event codec.
+// If none is negotiated CodecTelephoneEvent8000 is returned
+func CodecTelephoneEventFromSession(s *MediaSession) Codec {
+	codec, exists := CodecTelephoneEventFromList(s.filterCodecs)
+	if !exists {
+		return CodecTelephoneEvent8000
+	}
+	return codec
+}
+
+func CodecTelephoneEventFromList(codecs []Codec) (Codec, bool) {
+	for _, codec := range codecs {
+		if codec.IsTelephoneEvent() {
+			return codec, true
+		}
+	}
+	return Codec{}, false
+}
+
+// CodecComfortNoiseFromSession returns negotiated comfort noise codec.
+// False is returned if remote does not support it
+func CodecComfortNoiseFromSession(s *MediaSession) (Codec, bool) {
+	return CodecComfortNoiseFromList(s.filterCodecs)
+}
+
+func CodecComfortNoiseFromList(codecs []Codec) (Codec, bool) {
+	for _, codec := range codecs {
+		if codec.IsComfortNoise() {
+			return codec, true
+		}
+	}
+	return Codec{}, false
+}
+
 // Deprecated: Use CodecAudioFromSession
 func CodecFromSession(s *MediaSession) Codec {
 	return CodecAudioFromSession(s)
@@ -92,6 +180,8 @@ func CodecAudioFromPayloadType(payloadType uint8) (Codec, error) {
 		return CodecAudioOpus, nil
 	case sdp.FORMAT_TYPE_TELEPHONE_EVENT:
 		return CodecTelephoneEvent8000, nil
+	case sdp.FORMAT_TYPE_CN:
+		return CodecComfortNoise8000, nil
 	}
 	return Codec{}, fmt.Errorf("non supported codec: %d", payloadType)
 }
@@ -108,6 +198,8 @@ func mapSupportedCodec(f string) Codec {
 		return CodecAudioOpus
 	case sdp.FORMAT_TYPE_TELEPHONE_EVENT:
 		return CodecTelephoneEvent8000
+	case sdp.FORMAT_TYPE_CN:
+		return CodecComfortNoise8000
 	default:
 		slog.Warn("Unsupported format. Using default clock rate", "format", f)
 	}
@@ -157,6 +249,13 @@ func CodecsFromSDPRead(formats []string, attrs []string, codecsAudio []Codec) (i
 			continue
 		}
 
+		// Static comfort noise can be without rtpmap
+		if f == sdp.FORMAT_TYPE_CN && !slices.ContainsFunc(attrs, func(a string) bool { return strings.HasPrefix(a, "rtpmap:13 ") }) {
+			codecsAudio[n] = CodecComfortNoise8000
+			n++
+			continue
+		}
+
 		pt64, err := strconv.ParseUint(f, 10, 8)
 		if err != nil {
 			rerr = errors.Join(rerr, fmt.Errorf("format type failed to conv to integer, skipping f=%s: %w", f, err))
@@ -202,6 +301,14 @@ func CodecsFromSDPRead(formats []string, attrs []string, codecsAudio []Codec) (i
 						codec.NumChannels = int(numChannels)
 					}
 				}
+
+				if codec.IsOpus() {
+					if val, exists := sdp.FmtpFromAttributes(attrs, f); exists {
+						if err := sdp.ParseOpusFmtp(val, &codec.Opus); err != nil {
+							rerr = errors.Join(rerr, fmt.Errorf("bad opus fmtp a=fmtp:%s %s: %w", f, val, err))
+						}
+					}
+				}
 				codecsAudio[n] = codec
 				n++
 			}
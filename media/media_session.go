@@ -242,7 +242,7 @@ func (s *MediaSession) LocalSDP() []byte {
 	//    supports codecs 8 and 48, it is RECOMMENDED that, if the answerer has
 	codecs := s.Codecs
 	if len(s.filterCodecs) > 0 {
-		codecs = s.filterCodecs
+		codecs = s.localFilterCodecs()
 	}
 
 	var localSDES sdesInline
@@ -284,6 +284,27 @@ func (s *MediaSession) LocalSDP() []byte {
 	return generateSDPForAudio(ip, connIP, rtpPort, s.Mode, codecs, localSDES)
 }
 
+// SetLocalSRTP sets SRTP master key and salt used to encrypt written packets.
+// Use it when keys are exchanged outside of SDP. It is not thread safe
+func (s *MediaSession) SetLocalSRTP(alg uint16, keySalt []byte) error {
+	profile := srtp.ProtectionProfile(alg)
+	keyLen, err := profile.KeyLen()
+	if err != nil {
+		return fmt.Errorf("srtp getting key len: %w", err)
+	}
+	if len(keySalt) <= keyLen {
+		return fmt.Errorf("srtp master key and salt too short")
+	}
+
+	ctx, err := srtp.CreateContext(keySalt[:keyLen], keySalt[keyLen:], profile)
+	if err != nil {
+		return fmt.Errorf("CreateContext failed: %w", err)
+	}
+	s.SRTPAlg = alg
+	s.localCtxSRTP = ctx
+	return nil
+}
+
 func (s *MediaSession) RemoteSDP(sdpReceived []byte) error {
 	sd := sdp.SessionDescription{}
 	if err := sdp.Unmarshal(sdpReceived, &sd); err != nil {
@@ -381,8 +402,8 @@ func (s *MediaSession) updateRemoteCodecs(codecs []Codec) {
 	filter := codecs[:0] // reuse buffer
 	for _, rc := range codecs {
 		for _, c := range s.Codecs {
-			if c == rc {
-				filter = append(filter, c)
+			if nc, ok := codecNegotiate(c, rc); ok {
+				filter = append(filter, nc)
 				break
 			}
 		}
@@ -390,6 +411,21 @@ func (s *MediaSession) updateRemoteCodecs(codecs []Codec) {
 	s.filterCodecs = filter
 }
 
+// localFilterCodecs returns negotiated codecs but with our local format parameters.
+// Negotiated codecs are holding remote fmtp, which should not be presented as ours in SDP
+func (s *MediaSession) localFilterCodecs() []Codec {
+	codecs := slices.Clone(s.filterCodecs)
+	for i, fc := range codecs {
+		for _, c := range s.Codecs {
+			if c.PayloadType == fc.PayloadType {
+				codecs[i].Opus = c.Opus
+				break
+			}
+		}
+	}
+	return codecs
+}
+
 // CommonCodecs returns common codecs if negotiation is finished, that is Local and Remote SDP are exchanged
 // NOTE: Not thread safe, should be called after negotiation or session must be Forked
 func (s *MediaSession) CommonCodecs() []Codec {
@@ -740,14 +776,25 @@ func generateSDPForAudio(originIP net.IP, connectionIP net.IP, rtpPort int, mode
 		case CodecAudioAlaw.PayloadType:
 			formatsMap = append(formatsMap, "a=rtpmap:8 PCMA/8000")
 		case CodecAudioOpus.PayloadType:
+			// Opus rtpmap has always 2 channels. Mono or stereo is signaled with fmtp
+			// https://datatracker.ietf.org/doc/html/rfc7587#section-7
 			formatsMap = append(formatsMap, "a=rtpmap:96 opus/48000/2")
-			// Providing 0 when FEC cannot be used on the receiving side is RECOMMENDED.
-			// https://datatracker.ietf.org/doc/html/rfc7587
-			formatsMap = append(formatsMap, "a=fmtp:96 useinbandfec=0")
+			formatsMap = append(formatsMap, "a=fmtp:96 "+f.Opus.String())
 		case CodecTelephoneEvent8000.PayloadType:
 			formatsMap = append(formatsMap, "a=rtpmap:101 telephone-event/8000")
 			formatsMap = append(formatsMap, "a=fmtp:101 0-16")
+		case CodecComfortNoise8000.PayloadType:
+			formatsMap = append(formatsMap, "a=rtpmap:13 CN/8000")
 		default:
+			if f.IsTelephoneEvent() {
+				formatsMap = append(formatsMap, fmt.Sprintf("a=rtpmap:%d telephone-event/%d", f.PayloadType, f.SampleRate))
+				formatsMap = append(formatsMap, fmt.Sprintf("a=fmtp:%d 0-16", f.PayloadType))
+				break
+			}
+			if f.IsComfortNoise() {
+				formatsMap = append(formatsMap, fmt.Sprintf("a=rtpmap:%d CN/%d", f.PayloadType, f.SampleRate))
+				break
+			}
 			s := fmt.Sprintf("a=rtpmap:%d %s/%d/%d", f.PayloadType, f.Name, f.SampleRate, f.NumChannels)
 			formatsMap = append(formatsMap, s)
 		}
@@ -19,6 +19,9 @@ import (
 func TestMediaPortRange(t *testing.T) {
 	RTPPortStart = 5000
 	RTPPortEnd = 5010
+	t.Cleanup(func() {
+		RTPPortStart, RTPPortEnd = 0, 0
+	})
 
 	sessions := []*MediaSession{}
 	for i := RTPPortStart; i < RTPPortEnd; i += 2 {
@@ -138,6 +141,22 @@ func TestMediaSessionUpdateCodec(t *testing.T) {
 	m = newM()
 	m.updateRemoteCodecs([]Codec{{Name: "NonExisting"}})
 	assert.Equal(t, []Codec{}, m.filterCodecs)
+
+	// Telephone event payload type is dynamic
+	m = newM()
+	telEvent := CodecTelephoneEvent8000
+	telEvent.PayloadType = 100
+	m.updateRemoteCodecs([]Codec{CodecAudioUlaw, telEvent})
+	assert.Equal(t, []Codec{CodecAudioUlaw, telEvent}, m.filterCodecs)
+	assert.Equal(t, telEvent, CodecTelephoneEventFromSession(m))
+	assert.Contains(t, string(generateSDPForAudio(net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 1), 1234, "sendrecv", m.filterCodecs, sdesInline{})),
+		"a=rtpmap:100 telephone-event/8000\r\na=fmtp:100 0-16\r\n")
+
+	m = newM()
+	telEvent.SampleRate = 48000
+	m.updateRemoteCodecs([]Codec{CodecAudioUlaw, telEvent})
+	assert.Equal(t, []Codec{CodecAudioUlaw}, m.filterCodecs)
+	assert.Equal(t, CodecTelephoneEvent8000, CodecTelephoneEventFromSession(m))
 }
 
 func TestMediaSessionUpdateSDP(t *testing.T) {
@@ -167,10 +186,14 @@ a=sendrecv`
 	err := m.RemoteSDP([]byte(sd))
 	require.NoError(t, err)
 
+	// Remote has no opus fmtp so defaults are negotiated
+	negOpus := CodecAudioOpus
+	negOpus.Opus = sdp.OpusFmtp{}
+
 	require.Len(t, m.filterCodecs, 4)
 	assert.Equal(t, CodecAudioUlaw, m.filterCodecs[0])
 	assert.Equal(t, CodecAudioAlaw, m.filterCodecs[1])
-	assert.Equal(t, CodecAudioOpus, m.filterCodecs[2])
+	assert.Equal(t, negOpus, m.filterCodecs[2])
 	assert.Equal(t, CodecTelephoneEvent8000, m.filterCodecs[3])
 
 	lsdp := m.LocalSDP()
@@ -202,11 +225,47 @@ a=sendrecv`
 
 		require.Len(t, m.filterCodecs, 3)
 		assert.Equal(t, CodecAudioUlaw, m.filterCodecs[0])
-		assert.Equal(t, CodecAudioOpus, m.filterCodecs[1])
+		assert.Equal(t, negOpus, m.filterCodecs[1])
 		assert.Equal(t, CodecTelephoneEvent8000, m.filterCodecs[2])
 	}
 }
 
+func TestMediaSessionOpusFmtp(t *testing.T) {
+	sd := `v=0
+o=- 3948988145 3948988145 IN IP4 192.168.178.54
+s=Sip Go Media
+c=IN IP4 192.168.178.54
+t=0 0
+m=audio 34391 RTP/AVP 96 101
+a=rtpmap:96 opus/48000/2
+a=fmtp:96 maxplaybackrate=16000;stereo=0;useinbandfec=1;usedtx=1
+a=rtpmap:101 telephone-event/8000
+a=fmtp:101 0-16
+a=sendrecv`
+
+	m := MediaSession{
+		Codecs: []Codec{CodecAudioOpusMono, CodecTelephoneEvent8000},
+		Laddr:  net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		Mode:   "sendrecv",
+	}
+	require.NoError(t, m.Init())
+	defer m.Close()
+	require.NoError(t, m.RemoteSDP([]byte(sd)))
+
+	require.Len(t, m.filterCodecs, 2)
+	codec := m.filterCodecs[0]
+	assert.Equal(t, 1, codec.NumChannels)
+	assert.Equal(t, sdp.OpusFmtp{MaxPlaybackRate: 16000, UseInbandFEC: true, UseDTX: true}, codec.Opus)
+	assert.True(t, codec.Equal(CodecAudioOpusMono))
+
+	// Our SDP must present local parameters and not remote
+	lsd := sdp.SessionDescription{}
+	require.NoError(t, sdp.Unmarshal(m.LocalSDP(), &lsd))
+	val, exists := lsd.Fmtp("96")
+	require.True(t, exists)
+	assert.Equal(t, "stereo=0;sprop-stereo=0;useinbandfec=1", val)
+}
+
 func TestMediaSRTP(t *testing.T) {
 	m1 := MediaSession{
 		Laddr:     net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
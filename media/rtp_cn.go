@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package media
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/zaf/g711"
+)
+
+var (
+	// RTPCNUpdateInterval is how often comfort noise updates are sent during silence.
+	// Updates are also sent when noise level changes
+	RTPCNUpdateInterval = 200 * time.Millisecond
+)
+
+// CNPayload is comfort noise payload RFC 3389
+type CNPayload struct {
+	// Level is noise level in -dBov. 0 is loudest and 127 is quietest
+	Level uint8
+	// Coefficients are optional quantized reflection coefficients describing noise spectrum
+	Coefficients []uint8
+}
+
+// CNDecode decodes comfort noise payload. Coefficients reuse existing slice
+func CNDecode(payload []byte, cn *CNPayload) error {
+	if len(payload) < 1 {
+		return fmt.Errorf("comfort noise payload too short")
+	}
+	cn.Level = payload[0] & 0x7F
+	cn.Coefficients = append(cn.Coefficients[:0], payload[1:]...)
+	return nil
+}
+
+// CNEncode encodes comfort noise payload
+func CNEncode(cn CNPayload) []byte {
+	payload := make([]byte, 1+len(cn.Coefficients))
+	payload[0] = cn.Level & 0x7F
+	copy(payload[1:], cn.Coefficients)
+	return payload
+}
+
+// CNLevel returns comfort noise level in -dBov for 16 bit samples
+func CNLevel(samples []int16) uint8 {
+	if len(samples) == 0 {
+		return 127
+	}
+	sum := 0.0
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+	if rms < 1 {
+		return 127
+	}
+	dbov := -20 * math.Log10(rms/math.MaxInt16)
+	return uint8(min(max(math.Round(dbov), 0), 127))
+}
+
+// RTPCNReader is implemented by readers that can receive comfort noise.
+// Decoders can use this to generate noise instead of decoding payload.
+type RTPCNReader interface {
+	// ReadCN returns comfort noise parameters if payload returned with last Read was comfort noise.
+	// Safe to call only in same goroutine as Read
+	ReadCN() (CNPayload, bool)
+}
+
+// RTPSilenceDetector decides is encoded frame silence. Used by RTPPacketWriter for silence suppression
+type RTPSilenceDetector interface {
+	// DetectSilence returns true if payload is silence and comfort noise describing it
+	DetectSilence(payload []byte) (bool, CNPayload)
+}
+
+// G711SilenceDetector detects silence in G.711 payload based on frame energy.
+// Speech continues for Hangover frames after energy drops, so word endings are not cut
+type G711SilenceDetector struct {
+	// Alaw is true for PCMA payload, otherwise PCMU is expected
+	Alaw bool
+	// Threshold is level in -dBov. Frames quieter than this are silence
+	Threshold uint8
+	// Hangover is number of frames still treated as speech after speech ends
+	Hangover int
+
+	hangover int
+	samples  []int16
+}
+
+// NewG711SilenceDetector creates detector for codec with default threshold -50dBov and 200ms hangover
+func NewG711SilenceDetector(codec Codec) *G711SilenceDetector {
+	return &G711SilenceDetector{
+		Alaw:      codec.PayloadType == CodecAudioAlaw.PayloadType,
+		Threshold: 50,
+		Hangover:  int(200 * time.Millisecond / codec.SampleDur),
+	}
+}
+
+func (d *G711SilenceDetector) DetectSilence(payload []byte) (bool, CNPayload) {
+	if cap(d.samples) < len(payload) {
+		d.samples = make([]int16, len(payload))
+	}
+	samples := d.samples[:len(payload)]
+	for i, b := range payload {
+		if d.Alaw {
+			samples[i] = g711.DecodeAlawFrame(b)
+		} else {
+			samples[i] = g711.DecodeUlawFrame(b)
+		}
+	}
+
+	cn := CNPayload{Level: CNLevel(samples)}
+	if cn.Level < d.Threshold {
+		d.hangover = d.Hangover
+		return false, cn
+	}
+	if d.hangover > 0 {
+		d.hangover--
+		return false, cn
+	}
+	return true, cn
+}
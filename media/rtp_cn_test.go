@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package media
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media/sdp"
+	"github.com/zaf/g711"
+)
+
+func TestCNEncodeDecode(t *testing.T) {
+	cn := CNPayload{Level: 60, Coefficients: []uint8{120, 130}}
+	payload := CNEncode(cn)
+	assert.Equal(t, []byte{60, 120, 130}, payload)
+
+	decoded := CNPayload{}
+	require.NoError(t, CNDecode(payload, &decoded))
+	assert.Equal(t, cn, decoded)
+
+	require.Error(t, CNDecode(nil, &decoded))
+	assert.EqualValues(t, 127, CNLevel(make([]int16, 160)))
+}
+
+func TestCNNegotiation(t *testing.T) {
+	codecs := make([]Codec, 3)
+	n, err := CodecsFromSDPRead([]string{"8", "13", "101"}, []string{"rtpmap:101 telephone-event/8000"}, codecs)
+	require.NoError(t, err)
+	assert.Equal(t, []Codec{CodecAudioAlaw, CodecComfortNoise8000, CodecTelephoneEvent8000}, codecs[:n])
+
+	newSession := func(codecs ...Codec) *MediaSession {
+		m := &MediaSession{
+			Laddr:  net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			Codecs: codecs,
+			Mode:   sdp.ModeSendrecv,
+		}
+		require.NoError(t, m.Init())
+		t.Cleanup(func() { m.Close() })
+		return m
+	}
+
+	m1 := newSession(CodecAudioAlaw, CodecComfortNoise8000)
+	m2 := newSession(CodecAudioAlaw, CodecComfortNoise8000, CodecTelephoneEvent8000)
+	assert.Contains(t, string(m1.LocalSDP()), "a=rtpmap:13 CN/8000")
+	require.NoError(t, m2.RemoteSDP(m1.LocalSDP()))
+
+	cn, ok := CodecComfortNoiseFromSession(m2)
+	require.True(t, ok)
+	assert.Equal(t, CodecComfortNoise8000, cn)
+	// CN is never chosen as audio codec
+	audio, _ := CodecAudioFromList([]Codec{CodecComfortNoise8000, CodecAudioAlaw})
+	assert.Equal(t, CodecAudioAlaw, audio)
+
+	// Not negotiated if remote does not support it
+	m3 := newSession(CodecAudioAlaw)
+	require.NoError(t, m2.RemoteSDP(m3.LocalSDP()))
+	_, ok = CodecComfortNoiseFromSession(m2)
+	assert.False(t, ok)
+}
+
+func TestRTPWriterSilenceSuppression(t *testing.T) {
+	buf := &rtpBuffer{}
+	w := NewRTPPacketWriter(buf, CodecAudioUlaw)
+	w.clockTicker.Reset(1 * time.Nanosecond)
+	detector := NewG711SilenceDetector(CodecAudioUlaw)
+	detector.Hangover = 1
+	w.SetSilenceSuppression(detector, CodecComfortNoise8000)
+
+	speech := make([]byte, 160)
+	for i := range speech {
+		speech[i] = g711.EncodeUlawFrame(int16(8000 * (i%2*2 - 1)))
+	}
+	silence := bytes.Repeat([]byte{g711.EncodeUlawFrame(0)}, 160)
+
+	// speech, hangover, silence start, suppressed, suppressed, speech
+	for _, frame := range [][]byte{speech, silence, silence, silence, silence, speech} {
+		_, err := w.Write(frame)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, buf.buf, 4)
+	types := []uint8{}
+	for _, p := range buf.buf {
+		types = append(types, p.PayloadType)
+	}
+	assert.Equal(t, []uint8{0, 0, 13, 0}, types)
+	assert.EqualValues(t, 127, buf.buf[2].Payload[0])
+
+	// Timestamp keeps media clock and talkspurt has marker
+	assert.Equal(t, uint32(5*160), buf.buf[3].Timestamp)
+	assert.Equal(t, []bool{true, false, false, true}, []bool{buf.buf[0].Marker, buf.buf[1].Marker, buf.buf[2].Marker, buf.buf[3].Marker})
+	// Sequence is continuous
+	assert.Equal(t, buf.buf[0].SequenceNumber+3, buf.buf[3].SequenceNumber)
+}
+
+func TestRTPReaderCN(t *testing.T) {
+	data := []byte{}
+	for i, pt := range []uint8{0, 13, 0} {
+		payload := make([]byte, 160)
+		if pt == 13 {
+			payload = []byte{70}
+		}
+		pkt := rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: pt, SSRC: 1234, SequenceNumber: uint16(i), Timestamp: uint32(i * 160)},
+			Payload: payload,
+		}
+		b, _ := pkt.Marshal()
+		data = append(data, b...)
+	}
+
+	// Packets are read one by one from connection
+	reader := &packetsReader{data: data, size: []int{172, 13, 172}}
+	sess := fakeMediaSessionReader(0, reader)
+	r := NewRTPPacketReaderSession(NewRTPSession(sess))
+
+	buf := make([]byte, RTPBufSize)
+	var cns []bool
+	for {
+		_, err := r.Read(buf)
+		if err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			break
+		}
+		cn, ok := r.ReadCN()
+		cns = append(cns, ok)
+		if ok {
+			assert.EqualValues(t, 70, cn.Level)
+		}
+	}
+	assert.Equal(t, []bool{false, true, false}, cns)
+}
+
+type packetsReader struct {
+	data []byte
+	size []int
+}
+
+func (r *packetsReader) Read(b []byte) (int, error) {
+	if len(r.size) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, r.data[:r.size[0]])
+	r.data = r.data[n:]
+	r.size = r.size[1:]
+	return n, nil
+}
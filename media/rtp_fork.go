@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package media
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/vertan/diago/media/sdp"
+)
+
+var (
+	// RTPForkWriteTimeout limits blocking of RTP session by fork write
+	RTPForkWriteTimeout = 20 * time.Millisecond
+)
+
+// RTPFork sends copy of RTP packets read and written by RTP session to media session Sess.
+// Packets are copied after SRTP decryption and encrypted again if Sess has local SRTP set.
+// Fork write errors are only counted and never returned to RTP session, so
+// unreachable fork destination has no impact on main stream.
+// Attach it with RTPSession AddFork.
+//
+// Experimental
+type RTPFork struct {
+	// Sess is media session toward fork destination
+	Sess *MediaSession
+	// Mode is direction of forked packets: sdp.ModeRecvonly for read, sdp.ModeSendonly for written.
+	// Default are both
+	Mode string
+	// SSRCRead and SSRCWrite rewrite SSRC of forked packets when non zero.
+	// Useful when both directions are sent to same destination
+	SSRCRead  uint32
+	SSRCWrite uint32
+
+	// mu protects session write buffer as packets are read and written concurrently
+	mu      sync.Mutex
+	packets atomic.Uint64
+	errors  atomic.Uint64
+	closed  atomic.Bool
+}
+
+type RTPForkStats struct {
+	// Packets is number of forked packets
+	Packets uint64
+	// Errors is number of packets failed to write
+	Errors uint64
+}
+
+func NewRTPFork(sess *MediaSession) *RTPFork {
+	return &RTPFork{
+		Sess: sess,
+		Mode: sdp.ModeSendrecv,
+	}
+}
+
+// Stats returns packet counters of fork
+func (f *RTPFork) Stats() RTPForkStats {
+	return RTPForkStats{
+		Packets: f.packets.Load(),
+		Errors:  f.errors.Load(),
+	}
+}
+
+// Close stops forking and closes media session
+func (f *RTPFork) Close() error {
+	if !f.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return f.Sess.Close()
+}
+
+func (f *RTPFork) forkRead(pkt *rtp.Packet) {
+	if f.Mode == sdp.ModeSendonly {
+		return
+	}
+	f.write(pkt, f.SSRCRead)
+}
+
+func (f *RTPFork) forkWrite(pkt *rtp.Packet) {
+	if f.Mode == sdp.ModeRecvonly {
+		return
+	}
+	f.write(pkt, f.SSRCWrite)
+}
+
+func (f *RTPFork) write(pkt *rtp.Packet, ssrc uint32) {
+	if f.closed.Load() {
+		return
+	}
+
+	// Shallow copy is enough as only header value is changed
+	p := *pkt
+	if ssrc > 0 {
+		p.SSRC = ssrc
+	}
+
+	f.mu.Lock()
+	f.Sess.rtpConn.SetWriteDeadline(time.Now().Add(RTPForkWriteTimeout))
+	err := f.Sess.WriteRTP(&p)
+	f.mu.Unlock()
+
+	if err != nil {
+		// Log only first failure to avoid flooding on every packet
+		if f.errors.Add(1) == 1 {
+			DefaultLogger().Warn("RTP fork write failed", "raddr", f.Sess.Raddr.String(), "error", err)
+		}
+		return
+	}
+	f.packets.Add(1)
+}
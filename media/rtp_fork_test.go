@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package media
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/srtp/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media/sdp"
+)
+
+func TestRTPFork(t *testing.T) {
+	newSession := func() *MediaSession {
+		m := &MediaSession{
+			Laddr:  net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			Codecs: []Codec{CodecAudioAlaw},
+			Mode:   sdp.ModeSendrecv,
+		}
+		require.NoError(t, m.Init())
+		t.Cleanup(func() { m.Close() })
+		return m
+	}
+
+	phone, leg := newSession(), newSession()
+	phone.SetRemoteAddr(&leg.Laddr)
+	leg.SetRemoteAddr(&phone.Laddr)
+	rtpLeg := NewRTPSession(leg)
+
+	// Collector receives SRTP with key known out of band
+	keySalt := bytes.Repeat([]byte{1}, 30)
+	collector := newSession()
+	ctx, err := srtp.CreateContext(keySalt[:16], keySalt[16:], srtp.ProtectionProfileAes128CmHmacSha1_80)
+	require.NoError(t, err)
+	collector.remoteCtxSRTP = ctx
+
+	forkSess := newSession()
+	forkSess.SetRemoteAddr(&collector.Laddr)
+	require.NoError(t, forkSess.SetLocalSRTP(SRTPAes128CmHmacSha1_80, keySalt))
+	fork := NewRTPFork(forkSess)
+	fork.SSRCRead, fork.SSRCWrite = 1111, 2222
+	rtpLeg.AddFork(fork)
+
+	// Unreachable destination does not affect main stream
+	closed := newSession()
+	unreachable := newSession()
+	unreachable.SetRemoteAddr(&closed.Laddr)
+	closed.Close()
+	rtpLeg.AddFork(NewRTPFork(unreachable))
+
+	readCollector := func() rtp.Packet {
+		pkt := rtp.Packet{}
+		collector.rtpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err := collector.ReadRTP(make([]byte, RTPBufSize), &pkt)
+		require.NoError(t, err)
+		return pkt
+	}
+
+	for i := 0; i < 3; i++ {
+		pkt := rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 1234, SequenceNumber: uint16(100 + i), Timestamp: uint32(160 * i)},
+			Payload: bytes.Repeat([]byte{byte(i)}, 160),
+		}
+		require.NoError(t, phone.WriteRTP(&pkt))
+		readPkt := rtp.Packet{}
+		leg.rtpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err := rtpLeg.ReadRTP(make([]byte, RTPBufSize), &readPkt)
+		require.NoError(t, err)
+
+		forked := readCollector()
+		assert.Equal(t, uint32(1111), forked.SSRC)
+		assert.Equal(t, pkt.SequenceNumber, forked.SequenceNumber)
+		assert.Equal(t, pkt.Payload, forked.Payload)
+
+		pkt.SSRC = 5678
+		require.NoError(t, rtpLeg.WriteRTP(&pkt))
+		forked = readCollector()
+		assert.Equal(t, uint32(2222), forked.SSRC)
+		assert.Equal(t, pkt.Payload, forked.Payload)
+	}
+	assert.Equal(t, RTPForkStats{Packets: 6}, fork.Stats())
+
+	// Packet reader reuses payload buffer, so forked payload must be trimmed to received size
+	reader := NewRTPPacketReaderSession(rtpLeg)
+	buf := make([]byte, RTPBufSize)
+	for i, size := range []int{160, 20} {
+		pkt := rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 1234, SequenceNumber: uint16(103 + i), Timestamp: uint32(160 * (3 + i))},
+			Payload: bytes.Repeat([]byte{byte(10 + i)}, size),
+		}
+		if i == 1 {
+			require.NoError(t, pkt.SetExtension(1, []byte{1, 2, 3}))
+		}
+		require.NoError(t, phone.WriteRTP(&pkt))
+		leg.rtpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := reader.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, size, n)
+
+		forked := readCollector()
+		assert.Equal(t, pkt.Payload, forked.Payload)
+	}
+	assert.EqualValues(t, 8, fork.Stats().Packets)
+
+	// Removed fork receives no more packets
+	rtpLeg.RemoveFork(fork)
+	pkt := rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: 8, SSRC: 5678}, Payload: []byte{1}}
+	require.NoError(t, rtpLeg.WriteRTP(&pkt))
+	assert.EqualValues(t, 8, fork.Stats().Packets)
+}
@@ -0,0 +1,351 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package media
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+var (
+	// RTPJitterBufferMinDelay and RTPJitterBufferMaxDelay are default bounds of playout delay
+	RTPJitterBufferMinDelay = 20 * time.Millisecond
+	RTPJitterBufferMaxDelay = 200 * time.Millisecond
+	// RTPJitterBufferSize is default max number of buffered packets
+	RTPJitterBufferSize = 50
+	// RTPJitterBufferJitterFactor is how many times playout delay is bigger than jitter estimate
+	RTPJitterBufferJitterFactor = 4
+)
+
+// RTPJitterBufferStats are stats of jitter buffer
+type RTPJitterBufferStats struct {
+	// Delay is current playout delay
+	Delay time.Duration
+	// Jitter is last jitter estimate from RTP session
+	Jitter time.Duration
+	// Buffered is number of packets waiting in buffer
+	Buffered int
+
+	Played uint64
+	// Lost packets were skipped as they did not arrive within delay
+	Lost uint64
+	// Late packets arrived after they were skipped or played. They are dropped
+	Late uint64
+	// Duplicate packets are dropped
+	Duplicate uint64
+	// Overflow packets are dropped because buffer was full
+	Overflow uint64
+}
+
+type jitterPacket struct {
+	seq     uint64
+	arrival time.Time
+	header  rtp.Header
+	payload []byte
+}
+
+// RTPJitterBuffer sits between RTPSession and RTPPacketReader. It reorders packets by extended
+// sequence number and drops duplicates and late packets. When packet is missing, it waits for
+// playout delay, which adapts from RTPSession jitter estimate, before skipping it.
+// Skipped packets are visible as sequence gap to RTPPacketReader, which signals loss to decoders.
+//
+// Packets are read in background after first ReadRTP.
+//
+// Experimental
+type RTPJitterBuffer struct {
+	// MinDelay and MaxDelay bound playout delay. Should be set before first Read
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// Size is max number of buffered packets
+	Size int
+
+	mu      sync.Mutex
+	session *RTPSession
+	notify  chan struct{}
+	running bool
+	err     error
+
+	packets []jitterPacket
+	free    [][]byte
+
+	// receiving stream
+	ssrc       uint32
+	highest    uint64
+	highestSeq uint16
+	receiving  bool
+	// playing stream
+	nextSeq uint64
+	playing bool
+	lost    int
+
+	stats RTPJitterBufferStats
+}
+
+func NewRTPJitterBuffer(sess *RTPSession) *RTPJitterBuffer {
+	b := &RTPJitterBuffer{}
+	b.Init(sess)
+	return b
+}
+
+func (b *RTPJitterBuffer) Init(sess *RTPSession) {
+	b.session = sess
+	b.notify = make(chan struct{}, 1)
+	if b.MinDelay == 0 {
+		b.MinDelay = RTPJitterBufferMinDelay
+	}
+	if b.MaxDelay == 0 {
+		b.MaxDelay = RTPJitterBufferMaxDelay
+	}
+	if b.Size == 0 {
+		b.Size = RTPJitterBufferSize
+	}
+	b.stats.Delay = b.MinDelay
+}
+
+// UpdateRTPSession changes session packets are read from. Used on media session changes
+func (b *RTPJitterBuffer) UpdateRTPSession(sess *RTPSession) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.session = sess
+}
+
+// Stats returns current jitter buffer stats
+func (b *RTPJitterBuffer) Stats() RTPJitterBufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := b.stats
+	stats.Buffered = len(b.packets)
+	return stats
+}
+
+// ReadLost returns number of packets skipped before packet returned with last ReadRTP
+func (b *RTPJitterBuffer) ReadLost() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lost
+}
+
+// ReadRTP returns next packet in sequence. Payload is copied to pkt.Payload if it fits, same as RTPSession.
+// Returned n is size of RTP packet without padding
+func (b *RTPJitterBuffer) ReadRTP(buf []byte, pkt *rtp.Packet) (int, error) {
+	b.mu.Lock()
+	if !b.running {
+		// Stopped reading with error like deadline is restarted on next read
+		b.running = true
+		go b.readLoop()
+	}
+	b.mu.Unlock()
+
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		b.mu.Lock()
+		p, wait, err := b.next(time.Now())
+		if p != nil {
+			n := b.readPacket(p, pkt)
+			b.mu.Unlock()
+			return n, nil
+		}
+		b.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+
+		var timeout <-chan time.Time
+		if wait > 0 {
+			if timer == nil {
+				timer = time.NewTimer(wait)
+			} else {
+				timer.Reset(wait)
+			}
+			timeout = timer.C
+		}
+
+		select {
+		case <-b.notify:
+		case <-timeout:
+		}
+	}
+}
+
+// next returns next packet for playout or how long to wait for missing packet.
+// Error is returned once buffer is drained
+func (b *RTPJitterBuffer) next(now time.Time) (*jitterPacket, time.Duration, error) {
+	if len(b.packets) == 0 {
+		err := b.err
+		b.err = nil
+		return nil, 0, err
+	}
+
+	head := &b.packets[0]
+	if !b.playing || head.seq == b.nextSeq {
+		b.playing = true
+		b.lost = 0
+		return b.pop(), 0, nil
+	}
+
+	// Packet is missing. Wait for it until head is delayed enough
+	if wait := head.arrival.Add(b.stats.Delay).Sub(now); wait > 0 && b.err == nil {
+		return nil, wait, nil
+	}
+
+	b.lost = int(head.seq - b.nextSeq)
+	b.stats.Lost += uint64(b.lost)
+	return b.pop(), 0, nil
+}
+
+func (b *RTPJitterBuffer) pop() *jitterPacket {
+	p := b.packets[0]
+	b.packets = slices.Delete(b.packets, 0, 1)
+	b.nextSeq = p.seq + 1
+	b.stats.Played++
+	return &p
+}
+
+func (b *RTPJitterBuffer) readPacket(p *jitterPacket, pkt *rtp.Packet) int {
+	pkt.Header = p.header
+	pkt.PaddingSize = 0
+	if len(pkt.Payload) >= len(p.payload) {
+		pkt.Payload = pkt.Payload[:copy(pkt.Payload, p.payload)]
+	} else {
+		pkt.Payload = slices.Clone(p.payload)
+	}
+	b.free = append(b.free, p.payload[:cap(p.payload)])
+	return p.header.MarshalSize() + len(p.payload)
+}
+
+func (b *RTPJitterBuffer) readLoop() {
+	buf := make([]byte, RTPBufSize)
+	pkt := rtp.Packet{}
+	for {
+		b.mu.Lock()
+		sess := b.session
+		b.mu.Unlock()
+
+		// Payload is moved in place to start of buffer and resliced to payload size
+		pkt.Payload = buf
+		n, err := sess.ReadRTP(buf, &pkt)
+		if err != nil {
+			// Error is returned to reader after buffer is drained
+			b.mu.Lock()
+			b.err = err
+			b.running = false
+			b.mu.Unlock()
+			b.signal()
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		stats := sess.ReadStats()
+
+		b.mu.Lock()
+		b.updateDelay(stats.Jitter())
+		b.push(pkt.Header, pkt.Payload, time.Now())
+		b.mu.Unlock()
+		b.signal()
+	}
+}
+
+func (b *RTPJitterBuffer) signal() {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (b *RTPJitterBuffer) updateDelay(jitter time.Duration) {
+	b.stats.Jitter = jitter
+	b.stats.Delay = min(max(time.Duration(RTPJitterBufferJitterFactor)*jitter, b.MinDelay), b.MaxDelay)
+}
+
+// extendedSeq returns extended sequence number of packet. Older packets are also extended
+func (b *RTPJitterBuffer) extendedSeq(h *rtp.Header) uint64 {
+	if !b.receiving || h.SSRC != b.ssrc {
+		// New stream continues after current one. Starting after first cycle allows older packets
+		b.highest++
+		if !b.receiving {
+			b.highest = 1<<16 + uint64(h.SequenceNumber)
+		}
+		b.receiving = true
+		b.ssrc = h.SSRC
+		b.highestSeq = h.SequenceNumber
+		return b.highest
+	}
+
+	delta := int64(int16(h.SequenceNumber - b.highestSeq))
+	if delta > int64(maxDropout) || -delta > int64(maxMisorder) {
+		// Sequence restarted
+		b.highest++
+		b.highestSeq = h.SequenceNumber
+		return b.highest
+	}
+
+	if delta > 0 {
+		b.highest += uint64(delta)
+		b.highestSeq = h.SequenceNumber
+		return b.highest
+	}
+	return b.highest - uint64(-delta)
+}
+
+func (b *RTPJitterBuffer) push(h rtp.Header, payload []byte, now time.Time) {
+	seq := b.extendedSeq(&h)
+	if b.playing && seq < b.nextSeq {
+		b.stats.Late++
+		return
+	}
+
+	i, exists := slices.BinarySearchFunc(b.packets, seq, func(p jitterPacket, seq uint64) int {
+		return int(int64(p.seq - seq))
+	})
+	if exists {
+		b.stats.Duplicate++
+		return
+	}
+
+	if len(b.packets) >= b.Size {
+		// Reader is not keeping up. Drop oldest
+		b.stats.Overflow++
+		if i == 0 {
+			return
+		}
+		dropped := b.packets[0]
+		b.packets = slices.Delete(b.packets, 0, 1)
+		b.free = append(b.free, dropped.payload[:cap(dropped.payload)])
+		i--
+		// Continue from next buffered without waiting
+		b.nextSeq = seq
+		if len(b.packets) > 0 {
+			b.nextSeq = min(b.packets[0].seq, seq)
+		}
+		b.playing = true
+	}
+
+	var data []byte
+	if n := len(b.free); n > 0 {
+		data = b.free[n-1]
+		b.free = b.free[:n-1]
+	}
+	if cap(data) < len(payload) {
+		data = make([]byte, len(payload), max(len(payload), 160))
+	}
+	data = data[:len(payload)]
+	copy(data, payload)
+
+	h.Padding = false
+	h.Extension = false
+	h.Extensions = nil
+	h.CSRC = slices.Clone(h.CSRC)
+	b.packets = slices.Insert(b.packets, i, jitterPacket{seq: seq, arrival: now, header: h, payload: data})
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package media
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTPJitterBufferReorder(t *testing.T) {
+	jb := NewRTPJitterBuffer(nil)
+	now := time.Now()
+
+	push := func(seq uint16, arrival time.Duration) {
+		jb.push(rtp.Header{SSRC: 1234, SequenceNumber: seq}, []byte{byte(seq)}, now.Add(arrival))
+	}
+	next := func(at time.Duration) (uint16, time.Duration) {
+		p, wait, err := jb.next(now.Add(at))
+		require.NoError(t, err)
+		if p == nil {
+			return 0, wait
+		}
+		assert.Equal(t, []byte{byte(p.header.SequenceNumber)}, p.payload)
+		return p.header.SequenceNumber, 0
+	}
+
+	// Sequence wraps around
+	push(65535, 0)
+	push(1, 20*time.Millisecond)
+	push(1, 21*time.Millisecond)
+	seq, _ := next(21 * time.Millisecond)
+	assert.Equal(t, uint16(65535), seq)
+
+	// Missing 0 is waited for delay of head
+	_, wait := next(25 * time.Millisecond)
+	assert.Equal(t, 15*time.Millisecond, wait)
+
+	push(0, 30*time.Millisecond)
+	push(0, 31*time.Millisecond)
+	seq, _ = next(31 * time.Millisecond)
+	assert.Equal(t, uint16(0), seq)
+	seq, _ = next(31 * time.Millisecond)
+	assert.Equal(t, uint16(1), seq)
+	assert.Equal(t, 0, jb.ReadLost())
+
+	// Loss is signaled after delay
+	push(4, 80*time.Millisecond)
+	_, wait = next(80 * time.Millisecond)
+	assert.Equal(t, 20*time.Millisecond, wait)
+	seq, _ = next(100 * time.Millisecond)
+	assert.Equal(t, uint16(4), seq)
+	assert.Equal(t, 2, jb.ReadLost())
+
+	// Late packet is dropped
+	push(3, 110*time.Millisecond)
+	_, _, err := jb.next(now.Add(110 * time.Millisecond))
+	require.NoError(t, err)
+
+	stats := jb.Stats()
+	assert.EqualValues(t, 4, stats.Played)
+	assert.EqualValues(t, 2, stats.Lost)
+	assert.EqualValues(t, 1, stats.Late)
+	assert.EqualValues(t, 2, stats.Duplicate)
+	assert.Equal(t, 0, stats.Buffered)
+}
+
+func TestRTPJitterBufferAdaptiveDelay(t *testing.T) {
+	jb := NewRTPJitterBuffer(nil)
+
+	jb.updateDelay(2 * time.Millisecond)
+	assert.Equal(t, RTPJitterBufferMinDelay, jb.Stats().Delay)
+
+	jb.updateDelay(15 * time.Millisecond)
+	assert.Equal(t, 60*time.Millisecond, jb.Stats().Delay)
+
+	jb.updateDelay(time.Second)
+	assert.Equal(t, RTPJitterBufferMaxDelay, jb.Stats().Delay)
+}
+
+func TestRTPJitterBufferOverflow(t *testing.T) {
+	jb := &RTPJitterBuffer{Size: 3}
+	jb.Init(nil)
+	now := time.Now()
+
+	for _, seq := range []uint16{10, 12, 13, 14} {
+		jb.push(rtp.Header{SSRC: 1234, SequenceNumber: seq}, []byte{byte(seq)}, now)
+	}
+
+	p, _, _ := jb.next(now)
+	require.NotNil(t, p)
+	assert.Equal(t, uint16(12), p.header.SequenceNumber)
+	assert.EqualValues(t, 1, jb.Stats().Overflow)
+}
+
+func TestRTPJitterBufferPacketReader(t *testing.T) {
+	reader, writer := io.Pipe()
+	sess := fakeMediaSessionReader(0, reader)
+	rtpSess := NewRTPSession(sess)
+	jb := NewRTPJitterBuffer(rtpSess)
+	rtpReader := NewRTPPacketReaderSession(rtpSess)
+	rtpReader.UpdateReader(jb)
+
+	go func() {
+		for _, seq := range []uint16{100, 102, 101, 101, 104} {
+			pkt := rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 1234, SequenceNumber: seq, Timestamp: uint32(seq) * 160},
+				Payload: []byte{byte(seq)},
+			}
+			if seq == 102 {
+				// Header extension is not part of payload
+				pkt.SetExtension(1, []byte{1, 2, 3})
+			}
+			data, _ := pkt.Marshal()
+			writer.Write(data)
+		}
+		writer.Close()
+	}()
+
+	var payloads []byte
+	var lost []int
+	buf := make([]byte, RTPBufSize)
+	for {
+		n, err := rtpReader.Read(buf)
+		if err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			break
+		}
+		payloads = append(payloads, buf[:n]...)
+		lost = append(lost, rtpReader.ReadLost())
+	}
+
+	assert.Equal(t, []byte{100, 101, 102, 104}, payloads)
+	assert.Equal(t, []int{0, 0, 0, 1}, lost)
+	// Duplicate can arrive after packet is played
+	stats := jb.Stats()
+	assert.EqualValues(t, 1, stats.Duplicate+stats.Late)
+}
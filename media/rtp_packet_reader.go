@@ -34,6 +34,14 @@ type RTPCReaderRaw interface {
 	ReadRTCPRaw(buf []byte) (int, error)
 }
 
+// RTPLossReader is implemented by readers that detect packet loss on stream.
+// Decoders can use this to conceal missing audio.
+type RTPLossReader interface {
+	// ReadLost returns number of packets lost before payload returned with last Read.
+	// Safe to call only in same goroutine as Read
+	ReadLost() int
+}
+
 // RTPPacketReader reads RTP packet and extracts payload and header
 type RTPPacketReader struct {
 	mu  sync.RWMutex
@@ -54,12 +62,21 @@ type RTPPacketReader struct {
 	unread        int
 	// We want to track our last SSRC.
 	lastSSRC uint32
+	// lost is number of packets detected missing before last read packet
+	lost int
+	// cn is comfort noise received with last read packet
+	cn            CNPayload
+	cnRead        bool
+	cnPayloadType uint8
 }
 
 // NewRTPPacketReaderSession just helper constructor
 func NewRTPPacketReaderSession(sess *RTPSession) *RTPPacketReader {
 	r := newRTPPacketReaderMedia(sess.Sess)
 	r.reader = sess
+	if cn, ok := CodecComfortNoiseFromSession(sess.Sess); ok {
+		r.cnPayloadType = cn.PayloadType
+	}
 	return r
 }
 
@@ -74,7 +91,8 @@ func NewRTPPacketReader(reader RTPReader, codec Codec) *RTPPacketReader {
 	w := RTPPacketReader{
 		reader: reader,
 		// payloadType:   codec.PayloadType,
-		seqReader: RTPExtendedSequenceNumber{},
+		seqReader:     RTPExtendedSequenceNumber{},
+		cnPayloadType: CodecComfortNoise8000.PayloadType,
 		// unreadPayload: make([]byte, RTPBufSize),
 		// rtpBuffer:     make([]byte, RTPBufSize),
 		log: DefaultLogger().With("caller", "media"),
@@ -84,12 +102,14 @@ func NewRTPPacketReader(reader RTPReader, codec Codec) *RTPPacketReader {
 }
 
 // Read Implements io.Reader and extracts Payload from RTP packet
-// has no input queue or sorting control of packets
+// has no input queue or sorting control of packets. For this use RTPJitterBuffer as reader
 // Buffer is used for reading headers and Headers are stored in PacketHeader
 //
 // NOTE: Consider that if you are passsing smaller buffer than RTP header+payload, io.ErrShortBuffer is returned
 func (r *RTPPacketReader) Read(b []byte) (int, error) {
 	if r.unread > 0 {
+		r.lost = 0
+		r.cnRead = false
 		n := r.readPayload(b, r.unreadPayload[:r.unread])
 		return n, nil
 	}
@@ -115,6 +135,7 @@ func (r *RTPPacketReader) Read(b []byte) (int, error) {
 
 	r.mu.RLock()
 	reader := r.reader
+	cnPayloadType := r.cnPayloadType
 	r.mu.RUnlock()
 
 	rtpN, err := reader.ReadRTP(buf, pkt)
@@ -133,13 +154,15 @@ func (r *RTPPacketReader) Read(b []byte) (int, error) {
 		return 0, nil
 	}
 
-	payloadSize := rtpN - pkt.Header.MarshalSize() - int(pkt.PaddingSize)
+	// Payload is sliced to its size. Header size can not be used, as extensions may be removed
+	payloadSize := len(pkt.Payload)
 	// In case of DTMF we can receive different payload types
 	// if pt != pkt.PayloadType {
 	// 	return 0, fmt.Errorf("payload type does not match. expected=%d, actual=%d", pt, pkt.PayloadType)
 	// }
 
 	// If we are tracking this source, do check are we keep getting pkts in sequence
+	r.lost = 0
 	if r.lastSSRC == pkt.SSRC {
 		prevSeq := r.seqReader.ReadExtendedSeq()
 		if err := r.seqReader.UpdateSeq(pkt.SequenceNumber); err != nil {
@@ -149,6 +172,10 @@ func (r *RTPPacketReader) Read(b []byte) (int, error) {
 		newSeq := r.seqReader.ReadExtendedSeq()
 		if prevSeq+1 != newSeq {
 			r.log.Debug("Out of order pkt received", "expected", prevSeq+1, "actual", newSeq, "real", pkt.SequenceNumber)
+			// Gap in sequence. Huge jumps are stream restarts and are not reported as loss
+			if newSeq > prevSeq && newSeq-prevSeq <= uint64(maxMisorder) {
+				r.lost = int(newSeq - prevSeq - 1)
+			}
 		}
 	} else {
 		r.seqReader.InitSeq(pkt.SequenceNumber)
@@ -156,6 +183,14 @@ func (r *RTPPacketReader) Read(b []byte) (int, error) {
 
 	r.lastSSRC = pkt.SSRC
 	r.PacketHeader = pkt.Header
+	r.cnRead = false
+	if pkt.PayloadType == cnPayloadType {
+		if err := CNDecode(pkt.Payload[:payloadSize], &r.cn); err != nil {
+			r.log.Warn("Failed to decode comfort noise", "error", err)
+		} else {
+			r.cnRead = true
+		}
+	}
 	// Is there better way to compare this?
 	if len(b) != len(unreadPayload) {
 		// We are not using passed buffer. We need to copy payload
@@ -167,6 +202,18 @@ func (r *RTPPacketReader) Read(b []byte) (int, error) {
 	return payloadSize, nil
 }
 
+// ReadLost returns number of packets lost before last read packet.
+// It is based on sequence gaps and it should be called after Read in same goroutine
+func (r *RTPPacketReader) ReadLost() int {
+	return r.lost
+}
+
+// ReadCN returns comfort noise parameters if last read packet was comfort noise RFC 3389.
+// It should be called after Read in same goroutine
+func (r *RTPPacketReader) ReadCN() (CNPayload, bool) {
+	return r.cn, r.cnRead
+}
+
 func (r *RTPPacketReader) readPayload(b []byte, payload []byte) int {
 	n := copy(b, payload)
 	if n < len(payload) {
@@ -188,6 +235,16 @@ func (r *RTPPacketReader) Reader() RTPReader {
 }
 
 func (r *RTPPacketReader) UpdateRTPSession(rtpSess *RTPSession) {
+	if cn, ok := CodecComfortNoiseFromSession(rtpSess.Sess); ok {
+		r.mu.Lock()
+		r.cnPayloadType = cn.PayloadType
+		r.mu.Unlock()
+	}
+	// Jitter buffer stays and only reads from new session
+	if jb, ok := r.Reader().(*RTPJitterBuffer); ok {
+		jb.UpdateRTPSession(rtpSess)
+		return
+	}
 	r.UpdateReader(rtpSess)
 	// codec := CodecFromSession(rtpSess.Sess)
 	// r.mu.Lock()
@@ -65,6 +65,41 @@ func TestRTPReader(t *testing.T) {
 	}
 }
 
+func TestRTPReaderLost(t *testing.T) {
+	rtpConn := bytes.NewBuffer([]byte{})
+	sess := fakeMediaSessionReader(0, rtpConn)
+	rtpSess := NewRTPSession(sess)
+	rtpReader := NewRTPPacketReaderSession(rtpSess)
+
+	buf := make([]byte, 3200)
+	for i, seq := range []uint16{1, 2, 5, 6, 9} {
+		writePkt := rtp.Packet{
+			Header: rtp.Header{
+				SSRC:           1234,
+				Version:        2,
+				PayloadType:    8,
+				SequenceNumber: seq,
+				Timestamp:      160 * uint32(seq),
+				Marker:         i == 0,
+			},
+			Payload: []byte("12312313"),
+		}
+		data, _ := writePkt.Marshal()
+		rtpConn.Reset()
+		rtpConn.Write(data)
+
+		_, err := rtpReader.Read(buf)
+		require.NoError(t, err)
+
+		switch seq {
+		case 5, 9:
+			require.Equal(t, 2, rtpReader.ReadLost())
+		default:
+			require.Equal(t, 0, rtpReader.ReadLost())
+		}
+	}
+}
+
 func BenchmarkRTPReader(b *testing.B) {
 	rtpConn := bytes.NewBuffer([]byte{})
 	sess := fakeMediaSessionReader(0, rtpConn)
@@ -5,6 +5,7 @@ package media
 
 import (
 	"math/rand"
+	"slices"
 	"sync"
 	"time"
 
@@ -44,6 +45,8 @@ type RTPPacketWriter struct {
 
 	payloadType uint8
 	sampleRate  uint32
+	// csrc are contribution sources added to packets. Used by mixers
+	csrc []uint32
 
 	// Internals
 	// clock rate is decided based on media
@@ -52,14 +55,20 @@ type RTPPacketWriter struct {
 	seqWriter           RTPExtendedSequenceNumber
 	nextTimestamp       uint32
 	initTimestamp       uint32
+
+	// silence suppression
+	silenceDetector RTPSilenceDetector
+	cnPayloadType   uint8
+	silent          bool
+	lastCN          CNPayload
+	lastCNTime      time.Time
 }
 
 // RTPPacketWriter packetize payload in RTP packet before passing on media session
 // Not having:
 // - random Timestamp
 // - allow different clock rate
-// - CSRC contribution source
-// - Silence detection and marker set
+// - Silence detection is optional with SetSilenceSuppression
 // updateClockRate- Padding and encryyption
 func NewRTPPacketWriter(writer RTPWriter, codec Codec) *RTPPacketWriter {
 	w := RTPPacketWriter{
@@ -71,8 +80,6 @@ func NewRTPPacketWriter(writer RTPWriter, codec Codec) *RTPPacketWriter {
 		// initTimestamp: rand.Uint32(), // TODO random start timestamp
 		// MTU:         1500,
 
-		// TODO: CSRC CSRC is contribution source identifiers.
-		// This is set when media is passed trough mixer/translators and original SSRC wants to be preserverd
 	}
 
 	w.nextTimestamp = w.initTimestamp
@@ -126,6 +133,27 @@ func (p *RTPPacketWriter) InitTimestamp() uint32 {
 	return p.initTimestamp
 }
 
+// SetCSRC sets contribution sources for next written packets. Max 15 are used.
+// This is set when media is passed through mixer and original SSRC wants to be preserved
+func (p *RTPPacketWriter) SetCSRC(csrc []uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.csrc = slices.Clone(csrc[:min(len(csrc), 15)])
+}
+
+// SetSilenceSuppression enables silence suppression on Write. Silent frames are not sent,
+// instead comfort noise updates are sent with cn payload type. First packet of talkspurt has marker set.
+// Nil detector disables it
+//
+// Experimental
+func (p *RTPPacketWriter) SetSilenceSuppression(detector RTPSilenceDetector, cn Codec) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.silenceDetector = detector
+	p.cnPayloadType = cn.PayloadType
+	p.silent = false
+}
+
 func (p *RTPPacketWriter) DelayTimestamp(ofsset uint32) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -138,12 +166,50 @@ func (p *RTPPacketWriter) DelayTimestamp(ofsset uint32) {
 // It is not thread safe and order of payload frames is required
 func (p *RTPPacketWriter) Write(b []byte) (int, error) {
 	p.mu.RLock()
-	n, err := p.WriteSamples(b, p.sampleRateTimestamp, p.nextTimestamp == p.initTimestamp, p.payloadType)
+	var n int
+	var err error
+	if p.silenceDetector != nil {
+		n, err = p.writeSuppressed(b)
+	} else {
+		n, err = p.WriteSamples(b, p.sampleRateTimestamp, p.nextTimestamp == p.initTimestamp, p.payloadType)
+	}
 	p.mu.RUnlock()
 	p.lastSampleTime = <-p.clockTicker.C
 	return n, err
 }
 
+// writeSuppressed sends comfort noise instead of silent frames. Timestamp keeps advancing during silence
+func (p *RTPPacketWriter) writeSuppressed(b []byte) (int, error) {
+	silent, cn := p.silenceDetector.DetectSilence(b)
+	if !silent {
+		marker := p.silent || p.nextTimestamp == p.initTimestamp
+		p.silent = false
+		return p.WriteSamples(b, p.sampleRateTimestamp, marker, p.payloadType)
+	}
+
+	now := time.Now()
+	// Update is sent on silence start, periodically and on noise level change
+	if !p.silent || now.Sub(p.lastCNTime) >= RTPCNUpdateInterval || absDiff(cn.Level, p.lastCN.Level) > 3 {
+		p.silent = true
+		p.lastCN = cn
+		p.lastCNTime = now
+		if _, err := p.WriteSamples(CNEncode(cn), p.sampleRateTimestamp, false, p.cnPayloadType); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	p.nextTimestamp += p.sampleRateTimestamp
+	return len(b), nil
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
 // WriteSamples allows to skip default packet rate.
 // This is useful if you need to write different payload but keeping same SSRC
 func (p *RTPPacketWriter) WriteSamples(payload []byte, sampleRateTimestamp uint32, marker bool, payloadType uint8) (int, error) {
@@ -161,7 +227,7 @@ func (p *RTPPacketWriter) WriteSamples(payload []byte, sampleRateTimestamp uint3
 		Timestamp:      p.nextTimestamp,
 		SequenceNumber: p.seqWriter.NextSeqNumber(),
 		SSRC:           p.SSRC,
-		// CSRC:           []uint32{},
+		CSRC:           p.csrc,
 	}
 	pkt.Payload = payload
 	p.nextTimestamp += sampleRateTimestamp
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/emiago/sipgo/fakes"
+	"github.com/pion/rtp"
 	"github.com/stretchr/testify/require"
 )
 
@@ -52,6 +53,31 @@ func TestRTPWriter(t *testing.T) {
 	}
 }
 
+func TestRTPWriterCSRC(t *testing.T) {
+	buf := &rtpBuffer{}
+	rtpWriter := NewRTPPacketWriter(buf, CodecAudioAlaw)
+	rtpWriter.clockTicker.Reset(1 * time.Nanosecond)
+
+	rtpWriter.SetCSRC([]uint32{1111, 2222})
+	_, err := rtpWriter.Write([]byte("12312313"))
+	require.NoError(t, err)
+
+	rtpWriter.SetCSRC(nil)
+	_, err = rtpWriter.Write([]byte("12312313"))
+	require.NoError(t, err)
+
+	require.Len(t, buf.buf, 2)
+	require.Equal(t, []uint32{1111, 2222}, buf.buf[0].CSRC)
+	require.Empty(t, buf.buf[1].CSRC)
+
+	// Must be encoded in packet
+	data, err := buf.buf[0].Marshal()
+	require.NoError(t, err)
+	pkt := rtp.Packet{}
+	require.NoError(t, pkt.Unmarshal(data))
+	require.Equal(t, []uint32{1111, 2222}, pkt.CSRC)
+}
+
 func BenchmarkRTPPacketWriter(b *testing.B) {
 	reader, writer := io.Pipe()
 	session := fakeMediaSessionWriter(0, 1234, writer)
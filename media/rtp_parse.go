@@ -49,8 +49,9 @@ func rtpUnmarshalPayload(n int, buf []byte, p *rtp.Packet) error {
 	}
 
 	// If Payload buffer exists try to fill it and allow buffer reusage
+	// Payload is resliced to real size, as header size is not known after extensions are removed
 	if p.Payload != nil && len(p.Payload) >= len(buf[n:end]) {
-		copy(p.Payload, buf[n:end])
+		p.Payload = p.Payload[:copy(p.Payload, buf[n:end])]
 		return nil
 	}
 
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package media
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// RTPRelay forwards RTP packets from Reader session to Writer session without decoding payload.
+// Payload is not decoded and buffers are reused, packet is only parsed to rewrite header.
+// If sessions are SRTP, packets are decrypted and encrypted by sessions, so relay works between SRTP and RTP.
+//
+// Outgoing stream has single SSRC with continuous sequence numbers and timestamps.
+// When incoming SSRC changes (re-INVITE, switching legs) offsets are recalculated
+// and marker bit is set on first packet of new stream.
+//
+// Sessions replaced on media update (re-INVITE) should be passed with UpdateRTPSession.
+//
+// # Stats are tracked by RTP sessions, see RTPSession.ReadStats and RTPSession.WriteStats
+//
+// Experimental
+type RTPRelay struct {
+	// Reader and Writer must not be changed after Relay is started. Use UpdateRTPSession
+	Reader *RTPSession
+	Writer *RTPSession
+	// SSRC of outgoing stream
+	SSRC uint32
+	// PayloadTypes maps incoming payload type to outgoing. Unmapped are passed as is.
+	// Useful when telephone-event payload types differ
+	PayloadTypes map[uint8]uint8
+
+	mu         sync.Mutex
+	sampleRate uint32
+
+	started   bool
+	receiving bool
+	inSSRC    uint32
+	seqOffset uint16
+	tsOffset  uint32
+	// next are values expected to continue outgoing stream
+	nextSeq  uint16
+	nextTs   uint32
+	lastTime time.Time
+}
+
+func NewRTPRelay(reader *RTPSession, writer *RTPSession) *RTPRelay {
+	r := &RTPRelay{}
+	r.Init(reader, writer)
+	return r
+}
+
+func (r *RTPRelay) Init(reader *RTPSession, writer *RTPSession) {
+	r.Reader = reader
+	r.Writer = writer
+	r.sampleRate = CodecAudioFromSession(reader.Sess).SampleRate
+	r.started = false
+	r.receiving = false
+}
+
+// ContinueStream makes relay continue already sent stream with last header.
+// SSRC is taken from header and next packet follows its sequence number
+func (r *RTPRelay) ContinueStream(last rtp.Header) {
+	r.SSRC = last.SSRC
+	r.nextSeq = last.SequenceNumber + 1
+	r.nextTs = last.Timestamp
+	r.lastTime = time.Now()
+	r.started = true
+}
+
+// UpdateRTPSession replaces reader or writer session prev with rtpSess, like after re-INVITE.
+// Packet being read on previous session is still relayed
+func (r *RTPRelay) UpdateRTPSession(prev *RTPSession, rtpSess *RTPSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Reader == prev {
+		r.Reader = rtpSess
+		r.sampleRate = CodecAudioFromSession(rtpSess.Sess).SampleRate
+	}
+	if r.Writer == prev {
+		r.Writer = rtpSess
+	}
+}
+
+// Relay forwards packets until reading or writing fails. It returns relayed payload bytes
+func (r *RTPRelay) Relay() (written int64, err error) {
+	buf := make([]byte, RTPBufSize)
+	pkt := rtp.Packet{}
+	for {
+		n, err := r.relayPacket(buf, &pkt)
+		if err != nil {
+			return written, err
+		}
+		written += int64(n)
+	}
+}
+
+func (r *RTPRelay) relayPacket(buf []byte, pkt *rtp.Packet) (int, error) {
+	// Payload is moved in place to start of buffer, which avoids allocation.
+	// Reading reslices it to payload size
+	pkt.Payload = buf
+	r.mu.Lock()
+	reader := r.Reader
+	r.mu.Unlock()
+	n, err := reader.ReadRTP(buf, pkt)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		// Skipped by session
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	r.rewrite(&pkt.Header, time.Now())
+	writer := r.Writer
+	r.mu.Unlock()
+	if err := writer.WriteRTP(pkt); err != nil {
+		return 0, err
+	}
+	return len(pkt.Payload), nil
+}
+
+func (r *RTPRelay) rewrite(h *rtp.Header, now time.Time) {
+	if !r.receiving || h.SSRC != r.inSSRC {
+		// New incoming stream. Offsets are set so that it continues outgoing stream
+		if r.started {
+			// Timestamp advances for time passed since last packet
+			elapsed := now.Sub(r.lastTime)
+			r.nextTs += uint32(elapsed.Seconds() * float64(r.sampleRate))
+			h.Marker = true
+		} else {
+			r.nextSeq = h.SequenceNumber
+			r.nextTs = h.Timestamp
+			r.started = true
+		}
+		r.receiving = true
+		r.inSSRC = h.SSRC
+		r.seqOffset = r.nextSeq - h.SequenceNumber
+		r.tsOffset = r.nextTs - h.Timestamp
+	}
+
+	if pt, exists := r.PayloadTypes[h.PayloadType]; exists {
+		h.PayloadType = pt
+	}
+
+	h.SSRC = r.SSRC
+	h.SequenceNumber += r.seqOffset
+	h.Timestamp += r.tsOffset
+
+	// Reordered packets must not move stream back
+	if int16(h.SequenceNumber-r.nextSeq) >= 0 {
+		r.nextSeq = h.SequenceNumber + 1
+		r.nextTs = h.Timestamp
+		r.lastTime = now
+	}
+}
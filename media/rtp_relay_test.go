@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/fakes"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media/sdp"
+)
+
+func TestRTPRelayRewrite(t *testing.T) {
+	r := RTPRelay{SSRC: 9999, sampleRate: 8000, PayloadTypes: map[uint8]uint8{101: 100}}
+	now := time.Now()
+
+	h := rtp.Header{SSRC: 1111, SequenceNumber: 100, Timestamp: 1000, PayloadType: 8}
+	r.rewrite(&h, now)
+	assert.Equal(t, rtp.Header{SSRC: 9999, SequenceNumber: 100, Timestamp: 1000, PayloadType: 8}, h)
+
+	h = rtp.Header{SSRC: 1111, SequenceNumber: 101, Timestamp: 1160, PayloadType: 101}
+	r.rewrite(&h, now.Add(20*time.Millisecond))
+	assert.Equal(t, rtp.Header{SSRC: 9999, SequenceNumber: 101, Timestamp: 1160, PayloadType: 100}, h)
+
+	// Reordered packet keeps stream position
+	h = rtp.Header{SSRC: 1111, SequenceNumber: 99, Timestamp: 840, PayloadType: 8}
+	r.rewrite(&h, now.Add(25*time.Millisecond))
+	assert.Equal(t, uint16(99), h.SequenceNumber)
+
+	// New source continues stream
+	h = rtp.Header{SSRC: 2222, SequenceNumber: 5000, Timestamp: 50000, PayloadType: 8}
+	r.rewrite(&h, now.Add(40*time.Millisecond))
+	assert.Equal(t, rtp.Header{SSRC: 9999, SequenceNumber: 102, Timestamp: 1320, PayloadType: 8, Marker: true}, h)
+
+	h = rtp.Header{SSRC: 2222, SequenceNumber: 5001, Timestamp: 50160, PayloadType: 8}
+	r.rewrite(&h, now.Add(60*time.Millisecond))
+	assert.Equal(t, rtp.Header{SSRC: 9999, SequenceNumber: 103, Timestamp: 1480, PayloadType: 8}, h)
+
+	t.Run("ContinueStream", func(t *testing.T) {
+		r := RTPRelay{sampleRate: 8000}
+		r.ContinueStream(rtp.Header{SSRC: 4444, SequenceNumber: 65535, Timestamp: 320})
+
+		h := rtp.Header{SSRC: 1111, SequenceNumber: 100, Timestamp: 1000}
+		r.rewrite(&h, r.lastTime.Add(20*time.Millisecond))
+		assert.Equal(t, rtp.Header{SSRC: 4444, SequenceNumber: 0, Timestamp: 480, Marker: true}, h)
+	})
+}
+
+func TestRTPRelaySRTP(t *testing.T) {
+	newSession := func(secure int) *MediaSession {
+		m := &MediaSession{
+			Laddr:     net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			Codecs:    []Codec{CodecAudioAlaw},
+			SecureRTP: secure,
+			SRTPAlg:   SRTPAes128CmHmacSha1_80,
+			Mode:      sdp.ModeSendrecv,
+		}
+		require.NoError(t, m.Init())
+		t.Cleanup(func() { m.Close() })
+		return m
+	}
+	connect := func(m1, m2 *MediaSession) {
+		require.NoError(t, m1.RemoteSDP(m2.LocalSDP()))
+		require.NoError(t, m2.RemoteSDP(m1.LocalSDP()))
+	}
+
+	// phone1 <-SRTP-> leg1 | relay | leg2 <-RTP-> phone2
+	phone1, leg1 := newSession(1), newSession(1)
+	connect(phone1, leg1)
+	leg2, phone2 := newSession(0), newSession(0)
+	connect(leg2, phone2)
+
+	rtpLeg1, rtpLeg2 := NewRTPSession(leg1), NewRTPSession(leg2)
+	relay := NewRTPRelay(rtpLeg1, rtpLeg2)
+	relay.SSRC = 9999
+	go relay.Relay()
+
+	for i := 0; i < 5; i++ {
+		pkt := rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 1234, SequenceNumber: uint16(1000 + i), Timestamp: uint32(160 * i)},
+			Payload: bytes.Repeat([]byte{byte(i)}, 160),
+		}
+		require.NoError(t, phone1.WriteRTP(&pkt))
+
+		readPkt := rtp.Packet{}
+		phone2.rtpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err := phone2.ReadRTP(make([]byte, RTPBufSize), &readPkt)
+		require.NoError(t, err)
+
+		assert.Equal(t, pkt.Payload, readPkt.Payload)
+		assert.Equal(t, uint32(9999), readPkt.SSRC)
+		assert.Equal(t, pkt.SequenceNumber, readPkt.SequenceNumber)
+	}
+
+	// Smaller payload like telephone-event
+	pkt := rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 1234, SequenceNumber: 1005, Timestamp: 800},
+		Payload: []byte{1, 2, 3, 4},
+	}
+	require.NoError(t, phone1.WriteRTP(&pkt))
+	readPkt := rtp.Packet{}
+	phone2.rtpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err := phone2.ReadRTP(make([]byte, RTPBufSize), &readPkt)
+	require.NoError(t, err)
+	assert.Equal(t, pkt.Payload, readPkt.Payload)
+
+	// Header extension is not part of payload
+	pkt = rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 1234, SequenceNumber: 1006, Timestamp: 960},
+		Payload: bytes.Repeat([]byte{6}, 160),
+	}
+	require.NoError(t, pkt.SetExtension(1, []byte{1, 2, 3}))
+	require.NoError(t, phone1.WriteRTP(&pkt))
+	readPkt = rtp.Packet{}
+	phone2.rtpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = phone2.ReadRTP(make([]byte, RTPBufSize), &readPkt)
+	require.NoError(t, err)
+	assert.Equal(t, pkt.Payload, readPkt.Payload)
+
+	assert.EqualValues(t, 7, rtpLeg1.ReadStats().PacketsCount)
+	assert.EqualValues(t, 7, rtpLeg2.WriteStats().PacketsCount)
+	assert.EqualValues(t, 6*160+4, rtpLeg2.WriteStats().OctetCount)
+}
+
+func BenchmarkRTPRelay(b *testing.B) {
+	newSessions := func() (*RTPSession, *RTPSession, *bytes.Buffer) {
+		rtpConn := bytes.NewBuffer([]byte{})
+		reader := fakeMediaSessionReader(0, rtpConn)
+		writer := &MediaSession{
+			Codecs: []Codec{CodecAudioAlaw},
+			Raddr:  net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
+		}
+		writer.rtpConn = &fakes.UDPConn{
+			Writers: map[string]io.Writer{writer.Raddr.String(): io.Discard},
+		}
+		return NewRTPSession(reader), NewRTPSession(writer), rtpConn
+	}
+
+	pkt := rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 8, SSRC: 1234},
+		Payload: make([]byte, 160),
+	}
+	data, _ := pkt.Marshal()
+	nextPacket := func(i int) []byte {
+		binary.BigEndian.PutUint16(data[2:], uint16(i))
+		binary.BigEndian.PutUint32(data[4:], uint32(160*i))
+		return data
+	}
+
+	// Copy is payload reading and packetizing again as done by audio proxy
+	b.Run("Copy", func(b *testing.B) {
+		reader, writer, rtpConn := newSessions()
+		r := NewRTPPacketReaderSession(reader)
+		w := NewRTPPacketWriterSession(writer)
+		w.clockTicker.Reset(1 * time.Nanosecond)
+		buf := make([]byte, RTPBufSize)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			rtpConn.Write(nextPacket(i))
+			n, err := r.Read(buf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Relay", func(b *testing.B) {
+		reader, writer, rtpConn := newSessions()
+		relay := NewRTPRelay(reader, writer)
+		buf := make([]byte, RTPBufSize)
+		pkt := rtp.Packet{}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			rtpConn.Write(nextPacket(i))
+			if _, err := relay.relayPacket(buf, &pkt); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/rtcp"
@@ -54,6 +56,9 @@ type RTPSession struct {
 	onReadRTCP  func(pkt rtcp.Packet, rtpStats RTPReadStats)
 	onWriteRTCP func(pkt rtcp.Packet, rtpStats RTPWriteStats)
 
+	// forks receive copy of read and written packets. Slice is replaced on change
+	forks atomic.Pointer[[]*RTPFork]
+
 	closed bool
 }
 
@@ -88,6 +93,14 @@ type RTPReadStats struct {
 	RTT time.Duration
 }
 
+// Jitter returns interarrival jitter estimate
+func (stats *RTPReadStats) Jitter() time.Duration {
+	if stats.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(stats.jitter / float64(stats.SampleRate) * float64(time.Second))
+}
+
 /*
 	 func (stats *RTPReadStats) calcJitter(now time.Time, readPktTimestamp uint32) {
 		sampleRate := float64(stats.SampleRate)
@@ -175,6 +188,30 @@ func (s *RTPSession) OnWriteRTCP(f func(pkt rtcp.Packet, rtpStats RTPWriteStats)
 	s.onWriteRTCP = f
 }
 
+// AddFork starts sending copy of read and written RTP packets to fork
+func (s *RTPSession) AddFork(f *RTPFork) {
+	s.rtcpMU.Lock()
+	defer s.rtcpMU.Unlock()
+	var forks []*RTPFork
+	if current := s.forks.Load(); current != nil {
+		forks = slices.Clone(*current)
+	}
+	forks = append(forks, f)
+	s.forks.Store(&forks)
+}
+
+// RemoveFork stops sending packets to fork. It does not close fork
+func (s *RTPSession) RemoveFork(f *RTPFork) {
+	s.rtcpMU.Lock()
+	defer s.rtcpMU.Unlock()
+	current := s.forks.Load()
+	if current == nil {
+		return
+	}
+	forks := slices.DeleteFunc(slices.Clone(*current), func(fork *RTPFork) bool { return fork == f })
+	s.forks.Store(&forks)
+}
+
 // ReadRTP reads RTP
 // NOTE: For RTCP we may read some properties of media session. Do not run this until
 // full media session is negotiated. For updating media, media session forking must be done!
@@ -198,6 +235,12 @@ func (s *RTPSession) ReadRTP(b []byte, readPkt *rtp.Packet) (n int, err error) {
 		break
 	}
 
+	if forks := s.forks.Load(); forks != nil {
+		for _, f := range *forks {
+			f.forkRead(readPkt)
+		}
+	}
+
 	s.rtcpMU.Lock()
 	defer s.rtcpMU.Unlock()
 	// pktArrival := time.Now()
@@ -277,6 +320,12 @@ func (s *RTPSession) WriteRTP(pkt *rtp.Packet) error {
 		return err
 	}
 
+	if forks := s.forks.Load(); forks != nil {
+		for _, f := range *forks {
+			f.forkWrite(pkt)
+		}
+	}
+
 	s.rtcpMU.Lock()
 	writeStats := &s.writeStats
 	// For now we only track latest SSRC
@@ -301,7 +350,7 @@ func (s *RTPSession) WriteRTP(pkt *rtp.Packet) error {
 func (s *RTPSession) WriteRTPRaw(buf []byte) (int, error) {
 	// In this case just proxy RTP. RTP Session can not work without full RTP decoded
 	// It is expected that RTCP is also proxied
-	return s.Sess.WriteRTCPRaw(buf)
+	return s.Sess.WriteRTPRaw(buf)
 }
 
 func (s *RTPSession) ReadStats() RTPReadStats {
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package sdp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fmtp returns format parameters value for payload type format
+// a=fmtp:<format> <format specific parameters>
+func (sd SessionDescription) Fmtp(format string) (string, bool) {
+	return FmtpFromAttributes(sd.Values("a"), format)
+}
+
+// FmtpFromAttributes finds fmtp value for format in list of attributes (a= values)
+func FmtpFromAttributes(attrs []string, format string) (string, bool) {
+	pref := "fmtp:" + format + " "
+	for _, a := range attrs {
+		if strings.HasPrefix(a, pref) {
+			return strings.TrimSpace(a[len(pref):]), true
+		}
+	}
+	return "", false
+}
+
+// OpusFmtp are opus format parameters
+// https://datatracker.ietf.org/doc/html/rfc7587#section-6.1
+//
+// Zero values match defaults defined by RFC, except MaxPlaybackRate and SpropMaxCaptureRate where
+// zero means not present (48000).
+// Parameters describe receiver side. When parsed from remote SDP they are preferences
+// that our encoder should follow.
+type OpusFmtp struct {
+	MaxPlaybackRate     int
+	SpropMaxCaptureRate int
+	MaxPTime            int
+	PTime               int
+	MaxAverageBitrate   int
+	Stereo              bool
+	SpropStereo         bool
+	CBR                 bool
+	UseInbandFEC        bool
+	UseDTX              bool
+}
+
+// ParseOpusFmtp parses fmtp value like "minptime=10;useinbandfec=1"
+// Unknown parameters are ignored
+func ParseOpusFmtp(value string, f *OpusFmtp) error {
+	for _, param := range strings.Split(value, ";") {
+		param = strings.TrimSpace(param)
+		if param == "" {
+			continue
+		}
+
+		key, val, found := strings.Cut(param, "=")
+		if !found {
+			return fmt.Errorf("opus fmtp: bad parameter %q", param)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+
+		var err error
+		switch key {
+		case "maxplaybackrate":
+			f.MaxPlaybackRate, err = strconv.Atoi(val)
+		case "sprop-maxcapturerate":
+			f.SpropMaxCaptureRate, err = strconv.Atoi(val)
+		case "maxptime":
+			f.MaxPTime, err = strconv.Atoi(val)
+		case "ptime":
+			f.PTime, err = strconv.Atoi(val)
+		case "maxaveragebitrate":
+			f.MaxAverageBitrate, err = strconv.Atoi(val)
+		case "stereo":
+			f.Stereo, err = parseFmtpBool(val)
+		case "sprop-stereo":
+			f.SpropStereo, err = parseFmtpBool(val)
+		case "cbr":
+			f.CBR, err = parseFmtpBool(val)
+		case "useinbandfec":
+			f.UseInbandFEC, err = parseFmtpBool(val)
+		case "usedtx":
+			f.UseDTX, err = parseFmtpBool(val)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("opus fmtp: bad value for %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// String returns fmtp value. Boolean parameters are always present, as some
+// endpoints do not follow RFC defaults
+func (f OpusFmtp) String() string {
+	params := make([]string, 0, 10)
+	if f.MaxPlaybackRate > 0 {
+		params = append(params, "maxplaybackrate="+strconv.Itoa(f.MaxPlaybackRate))
+	}
+	if f.SpropMaxCaptureRate > 0 {
+		params = append(params, "sprop-maxcapturerate="+strconv.Itoa(f.SpropMaxCaptureRate))
+	}
+	if f.MaxPTime > 0 {
+		params = append(params, "maxptime="+strconv.Itoa(f.MaxPTime))
+	}
+	if f.PTime > 0 {
+		params = append(params, "ptime="+strconv.Itoa(f.PTime))
+	}
+	if f.MaxAverageBitrate > 0 {
+		params = append(params, "maxaveragebitrate="+strconv.Itoa(f.MaxAverageBitrate))
+	}
+
+	params = append(params,
+		"stereo="+fmtpBool(f.Stereo),
+		"sprop-stereo="+fmtpBool(f.SpropStereo),
+	)
+
+	if f.CBR {
+		params = append(params, "cbr=1")
+	}
+
+	params = append(params, "useinbandfec="+fmtpBool(f.UseInbandFEC))
+	if f.UseDTX {
+		params = append(params, "usedtx=1")
+	}
+	return strings.Join(params, ";")
+}
+
+func parseFmtpBool(val string) (bool, error) {
+	switch val {
+	case "1":
+		return true, nil
+	case "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected 0 or 1, got %q", val)
+}
+
+func fmtpBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
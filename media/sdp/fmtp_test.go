@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package sdp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpusFmtp(t *testing.T) {
+	body := "v=0\r\n" +
+		"o=- 3905350750 3905350750 IN IP4 192.168.100.11\r\n" +
+		"s=-\r\n" +
+		"c=IN IP4 192.168.100.11\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 57797 RTP/AVP 96 101\r\n" +
+		"a=rtpmap:96 opus/48000/2\r\n" +
+		"a=fmtp:96 minptime=10; useinbandfec=1;usedtx=1;maxplaybackrate=16000;maxaveragebitrate=20000;stereo=0\r\n" +
+		"a=rtpmap:101 telephone-event/8000\r\n" +
+		"a=fmtp:101 0-16\r\n"
+
+	sd := SessionDescription{}
+	require.NoError(t, Unmarshal([]byte(body), &sd))
+
+	val, exists := sd.Fmtp("96")
+	require.True(t, exists)
+
+	f := OpusFmtp{}
+	require.NoError(t, ParseOpusFmtp(val, &f))
+	assert.Equal(t, OpusFmtp{
+		MaxPlaybackRate:   16000,
+		MaxAverageBitrate: 20000,
+		UseInbandFEC:      true,
+		UseDTX:            true,
+	}, f)
+
+	val, exists = sd.Fmtp("101")
+	require.True(t, exists)
+	assert.Equal(t, "0-16", val)
+
+	_, exists = sd.Fmtp("0")
+	assert.False(t, exists)
+
+	t.Run("Generate", func(t *testing.T) {
+		assert.Equal(t, "maxplaybackrate=16000;maxaveragebitrate=20000;stereo=0;sprop-stereo=0;useinbandfec=1;usedtx=1", f.String())
+
+		parsed := OpusFmtp{}
+		require.NoError(t, ParseOpusFmtp(f.String(), &parsed))
+		assert.Equal(t, f, parsed)
+	})
+
+	t.Run("BadValue", func(t *testing.T) {
+		require.Error(t, ParseOpusFmtp("stereo=yes", &OpusFmtp{}))
+		require.Error(t, ParseOpusFmtp("maxplaybackrate=abc", &OpusFmtp{}))
+	})
+}
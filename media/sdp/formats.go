@@ -11,6 +11,7 @@ import (
 const (
 	FORMAT_TYPE_ULAW            = "0"
 	FORMAT_TYPE_ALAW            = "8"
+	FORMAT_TYPE_CN              = "13"
 	FORMAT_TYPE_OPUS            = "96"
 	FORMAT_TYPE_TELEPHONE_EVENT = "101"
 )
@@ -45,6 +46,8 @@ func (fmts Formats) String() string {
 			out[i] = "8(alaw)"
 		case FORMAT_TYPE_OPUS:
 			out[i] = "96(opus)"
+		case FORMAT_TYPE_CN:
+			out[i] = "13(cn)"
 		default:
 			// Unknown then just use as number
 			out[i] = v
@@ -36,6 +36,17 @@ func (sd SessionDescription) Value(key string) string {
 	return values[0]
 }
 
+// Mode returns direction attribute like ModeSendonly. Default is ModeSendrecv
+func (sd SessionDescription) Mode() string {
+	for _, v := range sd.Values("a") {
+		switch v {
+		case ModeSendrecv, ModeSendonly, ModeRecvonly, ModeInactive:
+			return v
+		}
+	}
+	return ModeSendrecv
+}
+
 // MediaDescription represents a media type.
 // m=<media> <port>/<number of ports> <proto> <fmt> ...
 // https://tools.ietf.org/html/rfc4566#section-5.14
@@ -58,3 +58,28 @@ a=rtcp-mux
 	require.Equal(t, net.ParseIP("192.168.100.11").String(), ci.IP.String())
 
 }
+
+func TestMediaSections(t *testing.T) {
+	body := "v=0\r\n" +
+		"o=- 1 1 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"c=IN IP4 127.0.0.1\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 1000 RTP/AVP 0\r\n" +
+		"a=sendonly\r\n" +
+		"a=label:1\r\n" +
+		"m=audio 1002 RTP/AVP 8\r\n" +
+		"a=inactive\r\n" +
+		"a=label:2\r\n"
+
+	sections := MediaSections([]byte(body))
+	require.Len(t, sections, 2)
+
+	sd := SessionDescription{}
+	require.NoError(t, Unmarshal(sections[1], &sd))
+	require.Equal(t, "IN IP4 127.0.0.1", sd.Value("c"))
+	require.Equal(t, []string{"audio 1002 RTP/AVP 8"}, sd.Values("m"))
+	require.Equal(t, ModeInactive, sd.Mode())
+
+	require.Equal(t, body, string(JoinMediaSections(sections...)))
+}
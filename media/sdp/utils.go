@@ -4,6 +4,7 @@
 package sdp
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"strings"
@@ -29,8 +30,46 @@ const (
 	ModeRecvonly string = "recvonly"
 	ModeSendrecv string = "sendrecv"
 	ModeSendonly string = "sendonly"
+	ModeInactive string = "inactive"
 )
 
+// MediaSections splits SDP with multiple media descriptions. Each section has session part
+// followed by single media description, so it can be handled as single media SDP
+func MediaSections(data []byte) [][]byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	session := ""
+	sections := [][]byte{}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "m=") {
+			sections = append(sections, []byte(session))
+		}
+		if len(sections) == 0 {
+			session += line
+			continue
+		}
+		sections[len(sections)-1] = append(sections[len(sections)-1], line...)
+	}
+	return sections
+}
+
+// JoinMediaSections joins single media SDPs into SDP with multiple media descriptions.
+// Session part is taken from first SDP
+func JoinMediaSections(sdps ...[]byte) []byte {
+	var res []byte
+	for _, data := range sdps {
+		ind := bytes.Index(data, []byte("\nm="))
+		if ind < 0 {
+			continue
+		}
+		if res == nil {
+			res = append(res, data...)
+			continue
+		}
+		res = append(res, data[ind+1:]...)
+	}
+	return res
+}
+
 // GenerateForAudio is minimal AUDIO SDP setup
 // mode -> consts like ModeRecvOnly, ModeSendrecv
 func GenerateForAudio(originIP net.IP, connectionIP net.IP, rtpPort int, mode string, fmts Formats) []byte {
@@ -51,6 +90,8 @@ func GenerateForAudio(originIP net.IP, connectionIP net.IP, rtpPort int, mode st
 		case FORMAT_TYPE_TELEPHONE_EVENT:
 			formatsMap = append(formatsMap, "a=rtpmap:101 telephone-event/8000")
 			formatsMap = append(formatsMap, "a=fmtp:101 0-16")
+		case FORMAT_TYPE_CN:
+			formatsMap = append(formatsMap, "a=rtpmap:13 CN/8000")
 		}
 	}
 
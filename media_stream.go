@@ -0,0 +1,712 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/google/uuid"
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+/*
+Media stream forks call audio over WebSocket. Framing:
+
+Control events are JSON text messages, see MediaStreamEvent:
+  - start: first message with call id, tracks and media format
+  - media: audio as base64 payload. Only sent with JSONMedia option
+  - dtmf: digit received from call on inbound track
+  - mark: sent back when audio before mark received from socket is played, or cleared
+  - stop: last message before socket is closed
+
+Audio is by default sent as binary messages with 8 byte header:
+  - byte 0: track, 0 inbound (received from call), 1 outbound (sent to call)
+  - bytes 1-3: reserved, zero
+  - bytes 4-7: timestamp in milliseconds since start, big endian uint32
+  - audio payload in media format
+
+With Bidirectional option socket can send audio to play into call in same media format:
+  - binary messages with audio payload without header. Raw codec audio must be single frame per message
+  - media event with base64 payload
+  - mark event, which is returned when all audio before it is played
+  - clear event, which drops not played audio. Marks of dropped audio are returned
+*/
+
+const (
+	MediaStreamTrackInbound  = "inbound"
+	MediaStreamTrackOutbound = "outbound"
+
+	// MediaStreamEncodingPCM is 16 bit signed little endian PCM
+	MediaStreamEncodingPCM = "pcm_s16le"
+
+	// MediaStreamHeaderSize is header size of binary audio message
+	MediaStreamHeaderSize = 8
+)
+
+var (
+	// MediaStreamQueueSize is number of messages queued for sending. Audio is dropped when queue is full,
+	// so that slow socket does not block call media
+	MediaStreamQueueSize = 100
+	// MediaStreamWriteTimeout is max duration of single socket write
+	MediaStreamWriteTimeout = 5 * time.Second
+)
+
+// MediaStreamEvent is JSON message of media stream
+type MediaStreamEvent struct {
+	Event    string            `json:"event"`
+	StreamID string            `json:"streamId,omitempty"`
+	Start    *MediaStreamStart `json:"start,omitempty"`
+	Media    *MediaStreamMedia `json:"media,omitempty"`
+	DTMF     *MediaStreamDTMF  `json:"dtmf,omitempty"`
+	Mark     *MediaStreamMark  `json:"mark,omitempty"`
+}
+
+type MediaStreamStart struct {
+	CallID      string            `json:"callId"`
+	Tracks      []string          `json:"tracks"`
+	MediaFormat MediaStreamFormat `json:"mediaFormat"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+type MediaStreamFormat struct {
+	// Encoding is MediaStreamEncodingPCM or lowercase codec name for raw audio, ex. pcmu
+	Encoding   string `json:"encoding"`
+	SampleRate int    `json:"sampleRate"`
+	Channels   int    `json:"channels"`
+}
+
+type MediaStreamMedia struct {
+	Track string `json:"track,omitempty"`
+	// Timestamp in milliseconds since start
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Payload is base64 encoded audio
+	Payload []byte `json:"payload"`
+}
+
+type MediaStreamDTMF struct {
+	Track string `json:"track"`
+	Digit string `json:"digit"`
+}
+
+type MediaStreamMark struct {
+	Name string `json:"name"`
+}
+
+// MediaStreamOptions are options of media stream. Zero values are defaults
+type MediaStreamOptions struct {
+	// Raw sends codec payload as is. By default audio is decoded to PCM
+	Raw bool
+	// SampleRate of PCM audio. Default is codec sample rate
+	SampleRate int
+	// Tracks to stream. Default are inbound and outbound
+	Tracks []string
+	// JSONMedia sends audio as media events instead of binary messages
+	JSONMedia bool
+	// Bidirectional plays audio received from socket into call
+	Bidirectional bool
+	// Header is sent with WebSocket handshake, ex. for authorization
+	Header http.Header
+	// Metadata is passed in start event
+	Metadata map[string]string
+}
+
+// MediaStream forks call audio to WebSocket and optionally plays audio received from socket.
+// Use NewMediaStream
+//
+// Experimental
+type MediaStream struct {
+	// ID is stream id passed in all events
+	ID string
+
+	opts   MediaStreamOptions
+	format MediaStreamFormat
+	conn   net.Conn
+	log    *slog.Logger
+	start  time.Time
+
+	out       chan ws.Frame
+	eventCh   chan struct{}
+	stopCh    chan struct{}
+	writeDone chan struct{}
+	done      chan struct{}
+
+	player  *mediaStreamPlayer
+	dropped atomic.Int64
+	stopped atomic.Bool
+
+	mu     sync.Mutex
+	detach []func()
+	events []ws.Frame
+}
+
+// NewMediaStream connects to WebSocket url and starts forking audio of dialog.
+// Only audio reader and writer obtained after this call are forked.
+// Stream is stopped when dialog or socket ends
+//
+// Experimental
+func NewMediaStream(ctx context.Context, d DialogSession, url string, opts MediaStreamOptions) (*MediaStream, error) {
+	m := d.Media()
+	pr, pw := MediaProps{}, MediaProps{}
+	if r := m.audioReaderProps(&pr); r == nil {
+		return nil, fmt.Errorf("no media setup")
+	}
+	_ = m.audioWriterProps(&pw)
+
+	if opts.Tracks == nil {
+		opts.Tracks = []string{MediaStreamTrackInbound, MediaStreamTrackOutbound}
+	}
+	codec := pr.Codec
+	if opts.Raw {
+		// Single format is sent for all tracks and played audio, so codecs must match
+		inbound := slices.Contains(opts.Tracks, MediaStreamTrackInbound)
+		outbound := opts.Bidirectional || slices.Contains(opts.Tracks, MediaStreamTrackOutbound)
+		if inbound && outbound && !pr.Codec.Equal(pw.Codec) {
+			return nil, fmt.Errorf("codecs of reader and writer need to match for raw stream")
+		}
+		if !inbound {
+			codec = pw.Codec
+		}
+	}
+	format := MediaStreamFormat{Encoding: strings.ToLower(codec.Name), SampleRate: int(codec.SampleRate), Channels: codec.NumChannels}
+	if !opts.Raw {
+		if opts.SampleRate == 0 {
+			opts.SampleRate = int(codec.SampleRate)
+		}
+		format = MediaStreamFormat{Encoding: MediaStreamEncodingPCM, SampleRate: opts.SampleRate, Channels: 1}
+	}
+
+	s := &MediaStream{
+		ID:        uuid.NewString(),
+		opts:      opts,
+		format:    format,
+		log:       media.DefaultLogger().With("stream", url),
+		out:       make(chan ws.Frame, MediaStreamQueueSize),
+		eventCh:   make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+		writeDone: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	// Forks are created before connecting, as codecs may not be supported
+	forks := make([]io.Writer, len(opts.Tracks))
+	for i, track := range opts.Tracks {
+		var trackCodec media.Codec
+		switch track {
+		case MediaStreamTrackInbound:
+			trackCodec = pr.Codec
+		case MediaStreamTrackOutbound:
+			trackCodec = pw.Codec
+		default:
+			return nil, fmt.Errorf("unknown track %q", track)
+		}
+		w, err := s.trackWriter(track, trackCodec)
+		if err != nil {
+			return nil, err
+		}
+		forks[i] = w
+	}
+
+	var player io.Writer
+	var playerEnc *audio.PCMEncoderWriter
+	if opts.Bidirectional {
+		var err error
+		player, playerEnc, err = s.playerWriter(pw.Codec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.connect(ctx, url, dialogCallID(d)); err != nil {
+		return nil, err
+	}
+
+	taps := m.audioTapsInstall()
+	s.mu.Lock()
+	for i, track := range opts.Tracks {
+		tap := &taps.read
+		if track == MediaStreamTrackOutbound {
+			tap = &taps.write
+		}
+		s.detach = append(s.detach, tap.attach(forks[i]))
+	}
+	s.detach = append(s.detach, taps.dtmf.attach(s.sendDTMF))
+	s.mu.Unlock()
+
+	// Played audio is written after forking, so it is streamed on outbound track
+	audioWriter, _ := m.AudioWriter()
+
+	if opts.Bidirectional {
+		if playerEnc != nil {
+			playerEnc.Writer = audioWriter
+		} else {
+			player = audioWriter
+		}
+		go s.play(player)
+	}
+	go s.stopWith(d.Context())
+	return s, nil
+}
+
+func (s *MediaStream) connect(ctx context.Context, url string, callID string) error {
+	dialer := ws.Dialer{Header: ws.HandshakeHeaderHTTP(s.opts.Header)}
+	conn, br, _, err := dialer.Dial(ctx, url)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.start = time.Now()
+
+	start, err := json.Marshal(MediaStreamEvent{
+		Event:    "start",
+		StreamID: s.ID,
+		Start: &MediaStreamStart{
+			CallID:      callID,
+			Tracks:      s.opts.Tracks,
+			MediaFormat: s.format,
+			Metadata:    s.opts.Metadata,
+		},
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if err := s.writeFrame(ws.NewTextFrame(start)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	var src io.Reader = conn
+	if br != nil {
+		// Server may have sent data with handshake response
+		src = io.MultiReader(br, conn)
+	}
+	go s.writeLoop()
+	go s.readLoop(src)
+	return nil
+}
+
+// trackWriter returns writer converting codec audio to stream format
+func (s *MediaStream) trackWriter(track string, codec media.Codec) (io.Writer, error) {
+	w := &mediaStreamTrack{s: s, track: track}
+	if s.opts.Raw {
+		return w, nil
+	}
+
+	var pcmWriter io.Writer = w
+	if s.format.SampleRate != int(codec.SampleRate) || codec.NumChannels > 1 {
+		resampler, err := audio.NewPCMResamplerWriter(w, int(codec.SampleRate), max(codec.NumChannels, 1), s.format.SampleRate, 1)
+		if err != nil {
+			return nil, err
+		}
+		pcmWriter = resampler
+	}
+	dec := &audio.PCMDecoderWriter{}
+	if err := dec.Init(codec, pcmWriter); err != nil {
+		return nil, err
+	}
+	return dec, nil
+}
+
+// playerWriter returns writer converting stream format to codec audio.
+// Encoder writer is set when forking is installed. Raw audio is played as is
+func (s *MediaStream) playerWriter(codec media.Codec) (io.Writer, *audio.PCMEncoderWriter, error) {
+	if s.opts.Raw {
+		s.player = newMediaStreamPlayer(0)
+		return nil, nil, nil
+	}
+	// PCM is played in 20ms frames
+	s.player = newMediaStreamPlayer(s.format.SampleRate * 20 / 1000 * 2)
+
+	enc := &audio.PCMEncoderWriter{}
+	if err := enc.Init(codec, nil); err != nil {
+		return nil, nil, err
+	}
+	if s.format.SampleRate == int(codec.SampleRate) && codec.NumChannels <= 1 {
+		return enc, enc, nil
+	}
+	resampler, err := audio.NewPCMResamplerWriter(enc, s.format.SampleRate, 1, int(codec.SampleRate), max(codec.NumChannels, 1))
+	return resampler, enc, err
+}
+
+// play writes audio received from socket to call until stream stops
+func (s *MediaStream) play(w io.Writer) {
+	for {
+		item, ok := s.player.next()
+		if !ok {
+			return
+		}
+		if item.audio == nil {
+			s.sendMark(item.mark)
+			continue
+		}
+		if _, err := w.Write(item.audio); err != nil {
+			s.log.Error("Media stream playback failed", "error", err)
+			return
+		}
+	}
+}
+
+// Clear drops audio received from socket that is not played yet
+func (s *MediaStream) Clear() {
+	if s.player == nil {
+		return
+	}
+	for _, mark := range s.player.clear() {
+		s.sendMark(mark)
+	}
+}
+
+// Dropped returns number of audio messages dropped due to slow socket
+func (s *MediaStream) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Done is closed when stream is stopped
+func (s *MediaStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Stop stops forking, sends stop event and closes socket
+func (s *MediaStream) Stop() error {
+	if !s.stopped.CompareAndSwap(false, true) {
+		<-s.done
+		return nil
+	}
+	defer close(s.done)
+
+	s.mu.Lock()
+	detach := s.detach
+	s.detach = nil
+	s.mu.Unlock()
+	for _, f := range detach {
+		f()
+	}
+	if s.player != nil {
+		s.player.close()
+	}
+
+	close(s.stopCh)
+	<-s.writeDone
+	return s.conn.Close()
+}
+
+func (s *MediaStream) stopWith(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-s.stopCh:
+		return
+	}
+	if err := s.Stop(); err != nil {
+		s.log.Error("Failed to stop media stream", "error", err)
+	}
+}
+
+func (s *MediaStream) sendMedia(track string, payload []byte) {
+	ts := time.Since(s.start).Milliseconds()
+	var frame ws.Frame
+	if s.opts.JSONMedia {
+		data, err := json.Marshal(MediaStreamEvent{
+			Event:    "media",
+			StreamID: s.ID,
+			Media:    &MediaStreamMedia{Track: track, Timestamp: ts, Payload: payload},
+		})
+		if err != nil {
+			s.log.Error("Failed to encode media event", "error", err)
+			return
+		}
+		frame = ws.NewTextFrame(data)
+	} else {
+		data := make([]byte, MediaStreamHeaderSize+len(payload))
+		if track == MediaStreamTrackOutbound {
+			data[0] = 1
+		}
+		binary.BigEndian.PutUint32(data[4:], uint32(ts))
+		copy(data[MediaStreamHeaderSize:], payload)
+		frame = ws.NewBinaryFrame(data)
+	}
+
+	select {
+	case s.out <- frame:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *MediaStream) sendDTMF(digit rune) {
+	s.sendEvent(MediaStreamEvent{
+		Event: "dtmf",
+		DTMF:  &MediaStreamDTMF{Track: MediaStreamTrackInbound, Digit: string(digit)},
+	})
+}
+
+func (s *MediaStream) sendMark(name string) {
+	s.sendEvent(MediaStreamEvent{Event: "mark", Mark: &MediaStreamMark{Name: name}})
+}
+
+// sendEvent queues event without blocking, as DTMF is sent from media reading. Unlike audio, events are not dropped
+func (s *MediaStream) sendEvent(ev MediaStreamEvent) {
+	ev.StreamID = s.ID
+	data, err := json.Marshal(ev)
+	if err != nil {
+		s.log.Error("Failed to encode media stream event", "error", err)
+		return
+	}
+	s.mu.Lock()
+	s.events = append(s.events, ws.NewTextFrame(data))
+	s.mu.Unlock()
+	select {
+	case s.eventCh <- struct{}{}:
+	default:
+	}
+}
+
+// writeQueued writes queued messages. Audio is written first, as it was queued before events
+func (s *MediaStream) writeQueued() error {
+	for len(s.out) > 0 {
+		if err := s.writeFrame(<-s.out); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	events := s.events
+	s.events = nil
+	s.mu.Unlock()
+	for _, frame := range events {
+		if err := s.writeFrame(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MediaStream) writeFrame(frame ws.Frame) error {
+	s.conn.SetWriteDeadline(time.Now().Add(MediaStreamWriteTimeout))
+	return ws.WriteFrame(s.conn, ws.MaskFrameInPlace(frame))
+}
+
+func (s *MediaStream) writeLoop() {
+	defer close(s.writeDone)
+	for {
+		select {
+		case frame := <-s.out:
+			if err := s.writeFrame(frame); err != nil {
+				s.log.Error("Media stream write failed", "error", err)
+				return
+			}
+		case <-s.eventCh:
+			if err := s.writeQueued(); err != nil {
+				s.log.Error("Media stream write failed", "error", err)
+				return
+			}
+		case <-s.stopCh:
+			s.writeStop()
+			return
+		}
+	}
+}
+
+// writeStop writes queued messages, stop event and closes WebSocket
+func (s *MediaStream) writeStop() {
+	if err := s.writeQueued(); err != nil {
+		return
+	}
+	stop, _ := json.Marshal(MediaStreamEvent{Event: "stop", StreamID: s.ID})
+	if err := s.writeFrame(ws.NewTextFrame(stop)); err != nil {
+		return
+	}
+	s.writeFrame(ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusNormalClosure, "")))
+}
+
+func (s *MediaStream) readLoop(src io.Reader) {
+	rd := wsutil.Reader{
+		Source:         bufio.NewReader(src),
+		State:          ws.StateClientSide,
+		CheckUTF8:      true,
+		OnIntermediate: s.handleControl,
+	}
+	for {
+		data, op, err := s.readMessage(&rd)
+		if err != nil {
+			if !s.stopped.Load() && !errors.Is(err, io.EOF) {
+				s.log.Error("Media stream read failed", "error", err)
+			}
+			break
+		}
+		if s.player == nil {
+			continue
+		}
+
+		if op == ws.OpBinary {
+			s.player.enqueueAudio(data)
+			continue
+		}
+		ev := MediaStreamEvent{}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			s.log.Error("Failed to parse media stream event", "error", err)
+			continue
+		}
+		switch ev.Event {
+		case "media":
+			if ev.Media != nil {
+				s.player.enqueueAudio(ev.Media.Payload)
+			}
+		case "mark":
+			if ev.Mark != nil {
+				s.player.enqueueMark(ev.Mark.Name)
+			}
+		case "clear":
+			s.Clear()
+		}
+	}
+
+	if err := s.Stop(); err != nil {
+		s.log.Error("Failed to stop media stream", "error", err)
+	}
+}
+
+func (s *MediaStream) readMessage(rd *wsutil.Reader) ([]byte, ws.OpCode, error) {
+	for {
+		hdr, err := rd.NextFrame()
+		if err != nil {
+			return nil, 0, err
+		}
+		if hdr.OpCode.IsControl() {
+			if err := s.handleControl(hdr, rd); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		data, err := io.ReadAll(rd)
+		return data, hdr.OpCode, err
+	}
+}
+
+// handleControl answers ping. Responses are written by write loop, as socket writes are not concurrent safe
+func (s *MediaStream) handleControl(hdr ws.Header, r io.Reader) error {
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch hdr.OpCode {
+	case ws.OpPing:
+		select {
+		case s.out <- ws.NewPongFrame(payload):
+		default:
+		}
+	case ws.OpClose:
+		return io.EOF
+	}
+	return nil
+}
+
+// mediaStreamTrack sends audio of track
+type mediaStreamTrack struct {
+	s     *MediaStream
+	track string
+}
+
+func (t *mediaStreamTrack) Write(b []byte) (int, error) {
+	t.s.sendMedia(t.track, b)
+	return len(b), nil
+}
+
+type mediaStreamItem struct {
+	audio []byte
+	mark  string
+}
+
+// mediaStreamPlayer queues audio received from socket in frames
+type mediaStreamPlayer struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	frameSize int
+	queue     []mediaStreamItem
+	pending   []byte
+	closed    bool
+}
+
+func newMediaStreamPlayer(frameSize int) *mediaStreamPlayer {
+	p := &mediaStreamPlayer{frameSize: frameSize}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *mediaStreamPlayer) enqueueAudio(b []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.frameSize == 0 {
+		p.queue = append(p.queue, mediaStreamItem{audio: append([]byte(nil), b...)})
+		p.cond.Signal()
+		return
+	}
+
+	p.pending = append(p.pending, b...)
+	for len(p.pending) >= p.frameSize {
+		p.queue = append(p.queue, mediaStreamItem{audio: append([]byte(nil), p.pending[:p.frameSize]...)})
+		p.pending = p.pending[p.frameSize:]
+	}
+	p.cond.Signal()
+}
+
+func (p *mediaStreamPlayer) enqueueMark(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queue = append(p.queue, mediaStreamItem{mark: name})
+	p.cond.Signal()
+}
+
+// clear drops queued audio and returns dropped marks
+func (p *mediaStreamPlayer) clear() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	marks := []string{}
+	for _, item := range p.queue {
+		if item.audio == nil {
+			marks = append(marks, item.mark)
+		}
+	}
+	p.queue = nil
+	p.pending = nil
+	return marks
+}
+
+// next blocks until item is queued. It returns false when player is closed
+func (p *mediaStreamPlayer) next() (mediaStreamItem, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.queue) == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return mediaStreamItem{}, false
+	}
+	item := p.queue[0]
+	p.queue = p.queue[1:]
+	return item, true
+}
+
+func (p *mediaStreamPlayer) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+}
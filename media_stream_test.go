@@ -0,0 +1,198 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+// dtmfPacketReader returns frames and sets packet header payload type like RTP reader
+type dtmfPacketReader struct {
+	frames [][]byte
+	pts    []uint8
+	reader *media.RTPPacketReader
+}
+
+func (r *dtmfPacketReader) Read(b []byte) (int, error) {
+	if len(r.frames) == 0 {
+		return 0, io.EOF
+	}
+	r.reader.PacketHeader.PayloadType = r.pts[0]
+	n := copy(b, r.frames[0])
+	r.frames, r.pts = r.frames[1:], r.pts[1:]
+	return n, nil
+}
+
+type mediaStreamMessage struct {
+	op   ws.OpCode
+	data []byte
+}
+
+func TestMediaStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgs := make(chan mediaStreamMessage, 100)
+	send := make(chan mediaStreamMessage, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		conn, _, _, err := ws.UpgradeHTTP(r, w)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go func() {
+			for m := range send {
+				wsutil.WriteServerMessage(conn, m.op, m.data)
+			}
+		}()
+		for {
+			data, op, err := wsutil.ReadClientData(conn)
+			if err != nil {
+				close(msgs)
+				return
+			}
+			msgs <- mediaStreamMessage{op, data}
+		}
+	}))
+	defer srv.Close()
+
+	pcm := make([]byte, 320)
+	for i := range pcm {
+		pcm[i] = byte(i)
+	}
+	alaw := make([]byte, len(pcm)/2)
+	_, err := audio.EncodeAlawTo(alaw, pcm)
+	require.NoError(t, err)
+	dtmf := media.DTMFEncode(media.DTMFEvent{Event: 1, EndOfEvent: true, Duration: 800})
+
+	rtpReader := media.NewRTPPacketReader(nil, media.CodecAudioAlaw)
+	played := &syncBuffer{}
+	d := &DialogServerSession{
+		DialogServerSession: &sipgo.DialogServerSession{Dialog: sipgo.Dialog{
+			ID:            "call-1",
+			InviteRequest: sip.NewRequest(sip.INVITE, sip.Uri{User: "alice", Host: "127.0.0.1"}),
+		}},
+		DialogMedia: DialogMedia{
+			mediaSession: &media.MediaSession{Codecs: []media.Codec{media.CodecAudioAlaw}},
+			audioReader: &dtmfPacketReader{
+				// End of event is repeated and sent only once
+				frames: [][]byte{alaw, dtmf, dtmf},
+				pts:    []uint8{8, 101, 101},
+				reader: rtpReader,
+			},
+			audioWriter:     played,
+			RTPPacketReader: rtpReader,
+			RTPPacketWriter: media.NewRTPPacketWriter(nil, media.CodecAudioAlaw),
+		},
+	}
+	d.Init()
+
+	s, err := NewMediaStream(ctx, d, "ws"+strings.TrimPrefix(srv.URL, "http"), MediaStreamOptions{
+		Bidirectional: true,
+		Header:        http.Header{"Authorization": {"Bearer token"}},
+		Metadata:      map[string]string{"agent": "bob"},
+	})
+	require.NoError(t, err)
+
+	readEvent := func() MediaStreamEvent {
+		m := <-msgs
+		require.Equal(t, ws.OpText, m.op)
+		ev := MediaStreamEvent{}
+		require.NoError(t, json.Unmarshal(m.data, &ev))
+		assert.Equal(t, s.ID, ev.StreamID)
+		return ev
+	}
+
+	ev := readEvent()
+	require.Equal(t, "start", ev.Event)
+	assert.Equal(t, "call-1", ev.Start.CallID)
+	assert.Equal(t, []string{MediaStreamTrackInbound, MediaStreamTrackOutbound}, ev.Start.Tracks)
+	assert.Equal(t, MediaStreamFormat{Encoding: MediaStreamEncodingPCM, SampleRate: 8000, Channels: 1}, ev.Start.MediaFormat)
+	assert.Equal(t, "bob", ev.Start.Metadata["agent"])
+
+	// Inbound audio is decoded to PCM and DTMF is sent as event
+	r, err := d.AudioReader()
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, r)
+	require.NoError(t, err)
+
+	expected := make([]byte, len(pcm))
+	_, err = audio.DecodeAlawTo(expected, alaw)
+	require.NoError(t, err)
+
+	m := <-msgs
+	require.Equal(t, ws.OpBinary, m.op)
+	assert.Equal(t, byte(0), m.data[0])
+	assert.Less(t, binary.BigEndian.Uint32(m.data[4:]), uint32(1000))
+	assert.Equal(t, expected, m.data[MediaStreamHeaderSize:])
+
+	ev = readEvent()
+	require.Equal(t, "dtmf", ev.Event)
+	assert.Equal(t, MediaStreamDTMF{Track: MediaStreamTrackInbound, Digit: "1"}, *ev.DTMF)
+
+	// Audio from socket is played and forked on outbound track. Mark is returned after playback
+	send <- mediaStreamMessage{ws.OpBinary, expected}
+	markEv, _ := json.Marshal(MediaStreamEvent{Event: "mark", Mark: &MediaStreamMark{Name: "greeting"}})
+	send <- mediaStreamMessage{ws.OpText, markEv}
+
+	m = <-msgs
+	require.Equal(t, ws.OpBinary, m.op)
+	assert.Equal(t, byte(1), m.data[0])
+	assert.Equal(t, expected, m.data[MediaStreamHeaderSize:])
+
+	ev = readEvent()
+	require.Equal(t, "mark", ev.Event)
+	assert.Equal(t, "greeting", ev.Mark.Name)
+	assert.Equal(t, alaw, played.Bytes())
+
+	// Clear returns marks of dropped audio
+	s.player.enqueueMark("dropped")
+	s.Clear()
+	ev = readEvent()
+	require.Equal(t, "mark", ev.Event)
+	assert.Equal(t, "dropped", ev.Mark.Name)
+
+	require.NoError(t, s.Stop())
+	<-s.Done()
+	ev = readEvent()
+	assert.Equal(t, "stop", ev.Event)
+	_, ok := <-msgs
+	assert.False(t, ok)
+	close(send)
+
+	// Taps stay installed on dialog and stopped stream is detached
+	assert.Same(t, d.audioTaps, d.audioTapsInstall())
+	_, ok = d.audioReader.(*dialogTapReader).r.(*dtmfPacketReader)
+	assert.True(t, ok)
+	assert.Empty(t, d.audioTaps.read.targets)
+	assert.Empty(t, d.audioTaps.write.targets)
+	assert.Empty(t, d.audioTaps.dtmf.targets)
+}
+
+func TestMediaStreamEventNotBlocking(t *testing.T) {
+	// Write loop is not running, so events must be queued without blocking media reading
+	s := &MediaStream{eventCh: make(chan struct{}, 1), log: media.DefaultLogger()}
+	for i := 0; i < MediaStreamQueueSize+1; i++ {
+		s.sendDTMF('1')
+	}
+	assert.Len(t, s.events, MediaStreamQueueSize+1)
+}
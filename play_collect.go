@@ -0,0 +1,336 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+const (
+	// Reasons of ending digit collection
+	CollectReasonMaxDigits  = "MAXDIGITS"
+	CollectReasonTerminator = "TERMINATOR"
+	CollectReasonTimeout    = "TIMEOUT"
+	CollectReasonNoInput    = "NOINPUT"
+	CollectReasonInvalid    = "INVALID"
+)
+
+// PlayCollectOptions are options of PlayAndCollect. Zero values are defaults
+type PlayCollectOptions struct {
+	// Prompts are wav files played in order before and while collecting
+	Prompts []string
+	// DisableBargeIn keeps prompts playing on DTMF. Digits received during prompts are ignored
+	DisableBargeIn bool
+	// BargeInSpeech stops prompts when caller starts speaking
+	BargeInSpeech bool
+
+	// MinDigits is minimum number of digits for valid input. Default 1
+	MinDigits int
+	// MaxDigits ends collection when reached. Zero is no limit and collection ends with terminator or timeout
+	MaxDigits int
+	// Terminators are keys that end collection, like "#". They are not part of digits
+	Terminators string
+
+	// FirstDigitTimeout is waiting for first digit after prompts. Default 5s
+	FirstDigitTimeout time.Duration
+	// InterDigitTimeout is waiting for next digit. Default 3s
+	InterDigitTimeout time.Duration
+
+	// Retries is number of additional attempts on no input or invalid input
+	Retries int
+	// NoInputPrompt is played before retry after no input
+	NoInputPrompt string
+	// InvalidPrompt is played before retry after invalid input
+	InvalidPrompt string
+
+	// Pattern must match digits for valid input
+	Pattern *regexp.Regexp
+	// Validate returns false on invalid digits
+	Validate func(digits string) bool
+}
+
+func (o *PlayCollectOptions) defaults() {
+	if o.MinDigits == 0 {
+		o.MinDigits = 1
+	}
+	if o.FirstDigitTimeout == 0 {
+		o.FirstDigitTimeout = 5 * time.Second
+	}
+	if o.InterDigitTimeout == 0 {
+		o.InterDigitTimeout = 3 * time.Second
+	}
+}
+
+// PlayCollectResult is result of PlayAndCollect
+type PlayCollectResult struct {
+	Digits string
+	// Reason is one of CollectReason constants. NOINPUT and INVALID are returned when retries are exhausted
+	Reason string
+	// Terminator is key that ended collection with TERMINATOR reason
+	Terminator rune
+	// BargeIn is true if prompts were interrupted
+	BargeIn bool
+	// Attempts made, including retries
+	Attempts int
+}
+
+// PlayAndCollect plays prompts and collects DTMF digits with barge-in, timeouts and retries.
+// It reads audio until collection ends, so no other audio reading should be running.
+//
+// Experimental
+func (d *DialogMedia) PlayAndCollect(ctx context.Context, opts PlayCollectOptions) (PlayCollectResult, error) {
+	props := MediaProps{}
+	reader := d.audioReaderProps(&props)
+	if reader == nil {
+		return PlayCollectResult{}, errNoRTPSession
+	}
+
+	dtmfReader := DTMFReader{
+		dtmfReader:   media.NewRTPDTMFReader(media.CodecTelephoneEventFromSession(d.mediaSession), d.RTPPacketReader, reader),
+		mediaSession: d.mediaSession,
+	}
+	reader = &dtmfReader
+
+	events := make(chan playCollectEvent, 32)
+	dtmfReader.OnDTMF(func(dtmf rune) error {
+		select {
+		case events <- playCollectEvent{dtmf: dtmf}:
+		default:
+		}
+		return nil
+	})
+
+	if opts.BargeInSpeech {
+		vad := &audio.VADReader{}
+		if err := vad.Init(props.Codec, reader); err != nil {
+			return PlayCollectResult{}, err
+		}
+		vad.PacketReader = d.RTPPacketReader
+		vad.OnSpeechStart = func() {
+			select {
+			case events <- playCollectEvent{speech: true}:
+			default:
+			}
+		}
+		reader = vad
+	}
+
+	readDone := make(chan struct{})
+	var readErr error
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, media.RTPBufSize)
+		for {
+			if _, err := reader.Read(buf); err != nil {
+				readErr = err
+				return
+			}
+		}
+	}()
+	defer func() {
+		// Stop reading and enable RTP again
+		d.mediaSession.StopRTP(1, 0)
+		<-readDone
+		d.mediaSession.StartRTP(1)
+	}()
+
+	pc := playCollect{
+		opts:     opts,
+		events:   events,
+		readDone: readDone,
+		readErr:  func() error { return readErr },
+		play:     d.playCollectPrompts,
+	}
+	return pc.run(ctx)
+}
+
+// playCollectPrompts plays prompts in background and returns stop function and done channel
+func (d *DialogMedia) playCollectPrompts(prompts []string) (func(), <-chan error) {
+	done := make(chan error, 1)
+	playback, err := d.PlaybackControlCreate()
+	if err != nil {
+		done <- err
+		return func() {}, done
+	}
+
+	go func() {
+		for _, p := range prompts {
+			if _, err := playback.PlayFile(p); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	return playback.Stop, done
+}
+
+type playCollectEvent struct {
+	dtmf   rune
+	speech bool
+}
+
+// playCollect runs attempts of prompt playing and digit collection
+type playCollect struct {
+	opts     PlayCollectOptions
+	events   <-chan playCollectEvent
+	readDone <-chan struct{}
+	readErr  func() error
+	play     func(prompts []string) (stop func(), done <-chan error)
+}
+
+func (pc *playCollect) run(ctx context.Context) (PlayCollectResult, error) {
+	pc.opts.defaults()
+	opts := pc.opts
+
+	res := PlayCollectResult{}
+	prompts := opts.Prompts
+	for {
+		res.Attempts++
+		if err := pc.collect(ctx, prompts, &res); err != nil {
+			return res, err
+		}
+
+		retryPrompt := ""
+		switch {
+		case res.Reason == CollectReasonNoInput:
+			retryPrompt = opts.NoInputPrompt
+		case !pc.valid(res.Digits):
+			res.Reason = CollectReasonInvalid
+			retryPrompt = opts.InvalidPrompt
+		default:
+			return res, nil
+		}
+
+		if res.Attempts > opts.Retries {
+			return res, nil
+		}
+
+		prompts = opts.Prompts
+		if retryPrompt != "" {
+			prompts = append([]string{retryPrompt}, opts.Prompts...)
+		}
+	}
+}
+
+func (pc *playCollect) valid(digits string) bool {
+	opts := pc.opts
+	if len(digits) < opts.MinDigits {
+		return false
+	}
+	if opts.Pattern != nil && !opts.Pattern.MatchString(digits) {
+		return false
+	}
+	if opts.Validate != nil && !opts.Validate(digits) {
+		return false
+	}
+	return true
+}
+
+// collect plays prompts and collects digits for single attempt
+func (pc *playCollect) collect(ctx context.Context, prompts []string, res *PlayCollectResult) error {
+	opts := pc.opts
+	res.Digits = ""
+	res.Reason = ""
+	res.Terminator = 0
+
+	stop, playDone := pc.play(prompts)
+	playing := true
+	defer func() {
+		if playing {
+			stop()
+			<-playDone
+		}
+	}()
+
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	startTimer := func(d time.Duration) {
+		if timer == nil {
+			timer = time.NewTimer(d)
+		} else {
+			timer.Reset(d)
+		}
+		timeout = timer.C
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	digits := strings.Builder{}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-pc.readDone:
+			if err := pc.readErr(); err != nil {
+				return err
+			}
+			return io.EOF
+
+		case err := <-playDone:
+			playing = false
+			if err != nil {
+				return err
+			}
+			if digits.Len() == 0 {
+				startTimer(opts.FirstDigitTimeout)
+			} else {
+				startTimer(opts.InterDigitTimeout)
+			}
+
+		case <-timeout:
+			res.Digits = digits.String()
+			res.Reason = CollectReasonTimeout
+			if digits.Len() == 0 {
+				res.Reason = CollectReasonNoInput
+			}
+			return nil
+
+		case ev := <-pc.events:
+			if ev.speech {
+				if playing && opts.BargeInSpeech {
+					res.BargeIn = true
+					stop()
+				}
+				continue
+			}
+
+			if playing {
+				if opts.DisableBargeIn {
+					continue
+				}
+				res.BargeIn = true
+				stop()
+			}
+
+			if strings.ContainsRune(opts.Terminators, ev.dtmf) {
+				res.Digits = digits.String()
+				res.Reason = CollectReasonTerminator
+				res.Terminator = ev.dtmf
+				return nil
+			}
+
+			digits.WriteRune(ev.dtmf)
+			if opts.MaxDigits > 0 && digits.Len() >= opts.MaxDigits {
+				res.Digits = digits.String()
+				res.Reason = CollectReasonMaxDigits
+				return nil
+			}
+			if !playing {
+				startTimer(opts.InterDigitTimeout)
+			}
+		}
+	}
+}
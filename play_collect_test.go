@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPlayCollect runs collection where each prompt plays for promptDur and events are sent at given offsets
+type testPlayCollect struct {
+	promptDur time.Duration
+	played    [][]string
+	stopped   int
+}
+
+func (tp *testPlayCollect) play(prompts []string) (func(), <-chan error) {
+	tp.played = append(tp.played, prompts)
+	done := make(chan error, 1)
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-time.After(time.Duration(len(prompts)) * tp.promptDur):
+		case <-stop:
+		}
+		done <- nil
+	}()
+	stopped := false
+	return func() {
+		if !stopped {
+			stopped = true
+			tp.stopped++
+			close(stop)
+		}
+	}, done
+}
+
+func testPlayCollectRun(t *testing.T, tp *testPlayCollect, opts PlayCollectOptions, input string, inputDelay time.Duration) PlayCollectResult {
+	events := make(chan playCollectEvent, 32)
+	go func() {
+		for _, r := range input {
+			time.Sleep(inputDelay)
+			if r == '~' {
+				events <- playCollectEvent{speech: true}
+				continue
+			}
+			events <- playCollectEvent{dtmf: r}
+		}
+	}()
+
+	pc := playCollect{
+		opts:     opts,
+		events:   events,
+		readDone: make(chan struct{}),
+		readErr:  func() error { return nil },
+		play:     tp.play,
+	}
+	res, err := pc.run(context.Background())
+	require.NoError(t, err)
+	return res
+}
+
+func TestPlayCollect(t *testing.T) {
+	ms := time.Millisecond
+	fast := PlayCollectOptions{
+		Prompts:           []string{"welcome.wav", "menu.wav"},
+		FirstDigitTimeout: 100 * ms,
+		InterDigitTimeout: 100 * ms,
+	}
+
+	t.Run("BargeInMaxDigits", func(t *testing.T) {
+		tp := &testPlayCollect{promptDur: time.Second}
+		opts := fast
+		opts.MaxDigits = 3
+		res := testPlayCollectRun(t, tp, opts, "1234", 10*ms)
+		assert.Equal(t, "123", res.Digits)
+		assert.Equal(t, CollectReasonMaxDigits, res.Reason)
+		assert.True(t, res.BargeIn)
+		assert.Equal(t, 1, res.Attempts)
+		assert.Equal(t, 1, tp.stopped)
+	})
+
+	t.Run("Terminator", func(t *testing.T) {
+		tp := &testPlayCollect{promptDur: 10 * ms}
+		opts := fast
+		opts.Terminators = "#*"
+		res := testPlayCollectRun(t, tp, opts, "42#", 30*ms)
+		assert.Equal(t, "42", res.Digits)
+		assert.Equal(t, CollectReasonTerminator, res.Reason)
+		assert.Equal(t, '#', res.Terminator)
+		assert.False(t, res.BargeIn)
+	})
+
+	t.Run("InterDigitTimeout", func(t *testing.T) {
+		tp := &testPlayCollect{promptDur: 10 * ms}
+		res := testPlayCollectRun(t, tp, fast, "12", 30*ms)
+		assert.Equal(t, "12", res.Digits)
+		assert.Equal(t, CollectReasonTimeout, res.Reason)
+	})
+
+	t.Run("NoInputRetries", func(t *testing.T) {
+		tp := &testPlayCollect{promptDur: 10 * ms}
+		opts := fast
+		opts.Retries = 1
+		opts.NoInputPrompt = "noinput.wav"
+		res := testPlayCollectRun(t, tp, opts, "", 0)
+		assert.Equal(t, CollectReasonNoInput, res.Reason)
+		assert.Equal(t, 2, res.Attempts)
+		require.Len(t, tp.played, 2)
+		assert.Equal(t, []string{"noinput.wav", "welcome.wav", "menu.wav"}, tp.played[1])
+	})
+
+	t.Run("InvalidThenValid", func(t *testing.T) {
+		tp := &testPlayCollect{promptDur: 10 * ms}
+		opts := fast
+		opts.MinDigits = 2
+		opts.MaxDigits = 4
+		opts.Terminators = "#"
+		opts.Retries = 3
+		opts.InvalidPrompt = "invalid.wav"
+		opts.Pattern = regexp.MustCompile("^[0-9]+$")
+		opts.Validate = func(digits string) bool { return digits != "0000" }
+		res := testPlayCollectRun(t, tp, opts, "1#0000*1#123#", 40*ms)
+		assert.Equal(t, "123", res.Digits)
+		assert.Equal(t, CollectReasonTerminator, res.Reason)
+		assert.Equal(t, 4, res.Attempts)
+	})
+
+	t.Run("InvalidExhausted", func(t *testing.T) {
+		tp := &testPlayCollect{promptDur: 10 * ms}
+		opts := fast
+		opts.MinDigits = 2
+		res := testPlayCollectRun(t, tp, opts, "1", 30*ms)
+		assert.Equal(t, "1", res.Digits)
+		assert.Equal(t, CollectReasonInvalid, res.Reason)
+		assert.Equal(t, 1, res.Attempts)
+	})
+
+	t.Run("DisableBargeIn", func(t *testing.T) {
+		tp := &testPlayCollect{promptDur: 50 * ms}
+		opts := fast
+		opts.DisableBargeIn = true
+		opts.MaxDigits = 1
+		// First digit is during prompts and it is ignored
+		res := testPlayCollectRun(t, tp, opts, "12", 60*ms)
+		assert.Equal(t, "2", res.Digits)
+		assert.False(t, res.BargeIn)
+		assert.Equal(t, 0, tp.stopped)
+	})
+
+	t.Run("BargeInSpeech", func(t *testing.T) {
+		tp := &testPlayCollect{promptDur: time.Second}
+		opts := fast
+		opts.BargeInSpeech = true
+		opts.MaxDigits = 1
+		res := testPlayCollectRun(t, tp, opts, "~5", 20*ms)
+		assert.Equal(t, "5", res.Digits)
+		assert.True(t, res.BargeIn)
+		assert.Equal(t, 1, tp.stopped)
+	})
+}
@@ -7,9 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/vertan/diago/audio"
 	"github.com/vertan/diago/media"
@@ -17,6 +21,9 @@ import (
 
 var (
 	PlaybackBufferSize = 3840 // For now largest we support. 48000 sample rate with 2 channels
+
+	// PlaybackResampleQuality is used when audio sample rate or channels do not match codec
+	PlaybackResampleQuality = audio.ResampleQualityHigh
 )
 
 var playBufPool = sync.Pool{
@@ -51,25 +58,15 @@ func NewAudioPlayback(writer io.Writer, codec media.Codec) AudioPlayback {
 }
 
 // Play is generic approach to play supported audio contents
-// Empty mimeType will stream reader as buffer. Make sure that bitdepth and numchannels is set correctly
+// Empty mimeType will stream reader as buffer. Make sure that bitdepth and numchannels is set correctly.
+// Mime type can have parameters, like raw PCM "audio/L16;rate=16000;channels=2"
 func (p *AudioPlayback) Play(reader io.Reader, mimeType string) (int64, error) {
-	var written int64
-	var err error
-
 	if p.onPlay != nil {
 		// Execute hook on play
 		p.onPlay()
 	}
 
-	switch mimeType {
-	case "":
-		written, err = p.stream(reader, p.writer)
-	case "audio/wav", "audio/x-wav", "audio/wav-x", "audio/vnd.wave":
-		written, err = p.streamWav(reader, p.writer)
-	default:
-		return 0, fmt.Errorf("unsuported content type %q", mimeType)
-	}
-
+	written, err := p.streamContent(reader, mimeType)
 	p.totalWritten += written
 	if errors.Is(err, io.EOF) {
 		return written, nil
@@ -77,20 +74,102 @@ func (p *AudioPlayback) Play(reader io.Reader, mimeType string) (int64, error) {
 	return written, err
 }
 
+// streamContent streams audio by content type
+func (p *AudioPlayback) streamContent(body io.Reader, contentType string) (int64, error) {
+	return p.streamContentWriter(body, contentType, p.writer)
+}
+
+func (p *AudioPlayback) streamContentWriter(body io.Reader, contentType string, playWriter io.Writer) (int64, error) {
+	if contentType == "" {
+		return p.stream(body, playWriter)
+	}
+
+	mimeType, params, err := parsePlaybackContentType(contentType)
+	if err != nil {
+		return 0, err
+	}
+
+	switch mimeType {
+	case "audio/wav", "audio/x-wav", "audio/wav-x", "audio/vnd.wave":
+		return p.streamWav(body, playWriter)
+	case "audio/basic", "audio/au", "audio/x-au":
+		return p.streamAu(body, playWriter)
+	case "audio/pcmu":
+		return p.streamG711(body, audio.WavAudioFormatULaw, playWriter)
+	case "audio/pcma":
+		return p.streamG711(body, audio.WavAudioFormatALaw, playWriter)
+	case "audio/ogg", "audio/opus":
+		return p.streamOggOpus(body, playWriter)
+	case "audio/l16":
+		return p.streamL16(body, params, playWriter)
+	}
+	return 0, fmt.Errorf("unsuported content type %q", contentType)
+}
+
+// contentSupported checks can content type be played
+func (p *AudioPlayback) contentSupported(contentType string) error {
+	mimeType, _, err := parsePlaybackContentType(contentType)
+	if err != nil {
+		return err
+	}
+	switch mimeType {
+	case "audio/wav", "audio/x-wav", "audio/wav-x", "audio/vnd.wave",
+		"audio/basic", "audio/au", "audio/x-au",
+		"audio/pcmu", "audio/pcma",
+		"audio/ogg", "audio/opus",
+		"audio/l16":
+		return nil
+	}
+	return fmt.Errorf("unsuported content type %q", contentType)
+}
+
+func parsePlaybackContentType(contentType string) (string, map[string]string, error) {
+	mimeType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	if mimeType == "audio/l16" {
+		if _, err := strconv.Atoi(params["rate"]); err != nil {
+			return "", nil, fmt.Errorf("audio/L16 content type %q needs rate", contentType)
+		}
+	}
+	return mimeType, params, nil
+}
+
 // PlayFile will play file and close file when finished playing
-// If you need to play same file multiple times, that use generic Play function
+// If you need to play same file multiple times, that use generic Play function.
+// Supported are .wav, .au, .opus and raw G.711 .ulaw and .alaw files
 func (p *AudioPlayback) PlayFile(filename string) (int64, error) {
+	mimeType, err := playbackFileMimeType(filename)
+	if err != nil {
+		return 0, err
+	}
+
 	file, err := os.Open(filename)
 	if err != nil {
 		return 0, err
 	}
 	defer file.Close()
 
-	if ext := path.Ext(file.Name()); ext != ".wav" {
-		return 0, fmt.Errorf("only playing wav file is now supported, but detected=%s", ext)
-	}
+	return p.Play(file, mimeType)
+}
 
-	return p.Play(file, "audio/wav")
+// playbackFileMimeType returns mime type by file extension
+func playbackFileMimeType(filename string) (string, error) {
+	switch ext := strings.ToLower(path.Ext(filename)); ext {
+	case ".wav":
+		return "audio/wav", nil
+	case ".au", ".snd":
+		return "audio/basic", nil
+	case ".ulaw", ".ul", ".mulaw", ".pcmu":
+		return "audio/PCMU", nil
+	case ".alaw", ".al", ".pcma":
+		return "audio/PCMA", nil
+	case ".opus", ".ogg":
+		return "audio/ogg", nil
+	default:
+		return "", fmt.Errorf("playing file with extension %q is not supported", ext)
+	}
 }
 
 func (p *AudioPlayback) stream(body io.Reader, playWriter io.Writer) (int64, error) {
@@ -104,40 +183,225 @@ func (p *AudioPlayback) stream(body io.Reader, playWriter io.Writer) (int64, err
 }
 
 func (p *AudioPlayback) streamWav(body io.Reader, playWriter io.Writer) (int64, error) {
-	codec := p.codec
-	wavReader := audio.NewWavReader(body)
-	if err := wavReader.ReadHeaders(); err != nil {
+	wavReader, err := p.wavReadHeaders(body)
+	if err != nil {
+		return 0, err
+	}
+	return p.streamAudio(wavReader, wavReader.AudioFormat, int(wavReader.SampleRate), int(wavReader.NumChannels), wavReader.PCMReader, playWriter)
+}
+
+func (p *AudioPlayback) streamAu(body io.Reader, playWriter io.Writer) (int64, error) {
+	auReader := audio.NewAuReader(body)
+	if err := auReader.ReadHeaders(); err != nil {
+		return 0, err
+	}
+	format, _, err := auReader.AudioFormat()
+	if err != nil {
+		return 0, err
+	}
+	return p.streamAudio(auReader, format, int(auReader.SampleRate), int(auReader.NumChannels), auReader.PCMReader, playWriter)
+}
+
+// streamG711 streams raw G.711 8000 mono audio
+func (p *AudioPlayback) streamG711(body io.Reader, format uint16, playWriter io.Writer) (int64, error) {
+	pcmReader := func() (io.Reader, error) {
+		return audio.NewPCM16Reader(format, 8, body)
+	}
+	return p.streamAudio(body, format, 8000, 1, pcmReader, playWriter)
+}
+
+// streamL16 streams raw big endian PCM with rate and channels params (RFC 2586)
+func (p *AudioPlayback) streamL16(body io.Reader, params map[string]string, playWriter io.Writer) (int64, error) {
+	sampleRate, err := strconv.Atoi(params["rate"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid audio/L16 rate: %w", err)
+	}
+	numChannels := 1
+	if ch, ok := params["channels"]; ok {
+		numChannels, err = strconv.Atoi(ch)
+		if err != nil || numChannels < 1 || numChannels > 2 {
+			return 0, fmt.Errorf("invalid audio/L16 channels %q", ch)
+		}
+	}
+
+	pcm, err := p.pcmToCodec(audio.NewL16Reader(body), sampleRate, numChannels)
+	if err != nil {
 		return 0, err
 	}
-	if wavReader.BitsPerSample != uint16(p.BitDepth) {
-		return 0, fmt.Errorf("wav file bitdepth=%d does not match expected=%d", wavReader.BitsPerSample, p.BitDepth)
+	return p.streamPCM(pcm, playWriter)
+}
+
+// streamOggOpus passes opus packets directly when call uses opus, otherwise they are decoded
+func (p *AudioPlayback) streamOggOpus(body io.Reader, playWriter io.Writer) (int64, error) {
+	oggReader := audio.NewOggOpusReader(body)
+	if err := oggReader.ReadHeaders(); err != nil {
+		return 0, err
 	}
-	if wavReader.SampleRate != codec.SampleRate {
-		return 0, fmt.Errorf("wav file samplerate=%d does not match expected=%d", wavReader.SampleRate, codec.SampleRate)
+
+	if !p.codec.IsOpus() {
+		pcm, err := oggReader.PCMReader()
+		if err != nil {
+			return 0, err
+		}
+		pcm, err = p.pcmToCodec(pcm, audio.OggOpusSampleRate, int(oggReader.Head.Channels))
+		if err != nil {
+			return 0, err
+		}
+		return p.streamPCM(pcm, playWriter)
+	}
+
+	buf := playBufPool.Get()
+	defer playBufPool.Put(buf)
+	packetBuf := buf.([]byte)
+
+	// Packets are written with codec sample duration, so they must match
+	frameSamples := int(float64(audio.OggOpusSampleRate) * p.codec.SampleDur.Seconds())
+	var written int64
+	for {
+		n, err := oggReader.Read(packetBuf)
+		if err != nil {
+			return written, err
+		}
+		samples, err := audio.OpusPacketSamples(packetBuf[:n])
+		if err != nil {
+			return written, err
+		}
+		if samples != frameSamples {
+			return written, fmt.Errorf("opus packet duration %s does not match codec %s", time.Duration(samples)*time.Second/audio.OggOpusSampleRate, p.codec.SampleDur)
+		}
+
+		wn, err := playWriter.Write(packetBuf[:n])
+		written += int64(wn)
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// streamAudio passes G.711 data directly when it matches codec, otherwise it is transcoded over PCM
+func (p *AudioPlayback) streamAudio(data io.Reader, format uint16, sampleRate int, numChannels int, pcmReader func() (io.Reader, error), playWriter io.Writer) (int64, error) {
+	if p.codecMatches(format, sampleRate, numChannels) {
+		return p.streamEncoded(data, playWriter)
+	}
+
+	pcm, err := pcmReader()
+	if err != nil {
+		return 0, err
+	}
+	pcm, err = p.pcmToCodec(pcm, sampleRate, numChannels)
+	if err != nil {
+		return 0, err
+	}
+	return p.streamPCM(pcm, playWriter)
+}
+
+// codecMatches checks is audio encoded same as codec
+func (p *AudioPlayback) codecMatches(format uint16, sampleRate int, numChannels int) bool {
+	codec := p.codec
+	if sampleRate != int(codec.SampleRate) || numChannels != codec.NumChannels {
+		return false
 	}
-	if wavReader.NumChannels != uint16(codec.NumChannels) {
-		return 0, fmt.Errorf("wav file numchannels=%d does not match expected=%d", wavReader.NumChannels, codec.NumChannels)
+	switch format {
+	case audio.WavAudioFormatULaw:
+		return codec.PayloadType == audio.FORMAT_TYPE_ULAW
+	case audio.WavAudioFormatALaw:
+		return codec.PayloadType == audio.FORMAT_TYPE_ALAW
 	}
+	return false
+}
+
+// streamEncoded writes encoded data in codec frames
+func (p *AudioPlayback) streamEncoded(data io.Reader, playWriter io.Writer) (int64, error) {
+	// G.711 has 8 bit samples
+	payloadSize := p.codec.SamplesPCM(8)
+
+	buf := playBufPool.Get()
+	defer playBufPool.Put(buf)
+	payloadBuf := buf.([]byte)[:payloadSize]
+
+	return copyFrames(data, playWriter, payloadBuf)
+}
 
+// streamPCM encodes PCM in codec sample rate and channels to writer
+func (p *AudioPlayback) streamPCM(pcmReader io.Reader, playWriter io.Writer) (int64, error) {
 	// We need to read and packetize to 20 ms
 	// sampleDurMS := int(codec.SampleDur.Milliseconds())
 	// payloadSize := int(dec.BitsPerSample) / 8 * int(dec.NumChannels) * int(dec.SampleRate) / 1000 * sampleDurMS
-	payloadSize := p.codec.SamplesPCM(int(wavReader.BitsPerSample))
+	payloadSize := p.codec.SamplesPCM(p.BitDepth)
 
 	buf := playBufPool.Get()
 	defer playBufPool.Put(buf)
 	payloadBuf := buf.([]byte)[:payloadSize] // 20 ms
 
 	enc := &audio.PCMEncoderWriter{}
-	if err := enc.Init(codec, playWriter); err != nil {
+	if err := enc.Init(p.codec, playWriter); err != nil {
 		return 0, fmt.Errorf("failed to create PCM encoder: %w", err)
 	}
 
-	written, err := media.CopyWithBuf(wavReader, enc, payloadBuf)
+	written, err := copyFrames(pcmReader, enc, payloadBuf)
 	// written, err := wavCopy(dec, enc, payloadBuf)
 	return written, err
 }
 
+// copyFrames writes reader data in frames of buffer size, so that short reads (ex. chunked HTTP body)
+// do not produce short packets. Only last frame can be shorter. It returns io.EOF when reader is done
+func copyFrames(reader io.Reader, writer io.Writer, frameBuf []byte) (int64, error) {
+	var written int64
+	for {
+		n, err := io.ReadFull(reader, frameBuf)
+		if n > 0 {
+			wn, werr := writer.Write(frameBuf[:n])
+			written += int64(wn)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return written, io.EOF
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// wavPCMReader reads wav headers and returns PCM reader in codec sample rate and channels
+func (p *AudioPlayback) wavPCMReader(body io.Reader) (io.Reader, error) {
+	wavReader, err := p.wavReadHeaders(body)
+	if err != nil {
+		return nil, err
+	}
+	pcm, err := wavReader.PCMReader()
+	if err != nil {
+		return nil, err
+	}
+	return p.pcmToCodec(pcm, int(wavReader.SampleRate), int(wavReader.NumChannels))
+}
+
+func (p *AudioPlayback) wavReadHeaders(body io.Reader) (*audio.WavReader, error) {
+	wavReader := audio.NewWavReader(body)
+	if err := wavReader.ReadHeaders(); err != nil {
+		return nil, err
+	}
+	return wavReader, nil
+}
+
+// pcmToCodec resamples PCM to codec sample rate and channels if needed
+func (p *AudioPlayback) pcmToCodec(pcm io.Reader, sampleRate int, numChannels int) (io.Reader, error) {
+	codec := p.codec
+	if sampleRate == int(codec.SampleRate) && numChannels == codec.NumChannels {
+		return pcm, nil
+	}
+
+	// Convert audio to codec format
+	resampler := &audio.PCMResamplerReader{}
+	resampler.Quality = PlaybackResampleQuality
+	if err := resampler.Init(pcm, sampleRate, numChannels, int(codec.SampleRate), codec.NumChannels); err != nil {
+		return nil, fmt.Errorf("failed to create resampler: %w", err)
+	}
+	return resampler, nil
+}
+
 func (p *AudioPlayback) calcPlayoutSize() int {
 	codec := &p.codec
 	sampleDurMS := int(codec.SampleDur.Milliseconds())
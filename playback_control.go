@@ -4,8 +4,21 @@
 package diago
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"mime"
+	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/vertan/diago/audio"
+)
+
+var (
+	ErrPlaybackNotSeekable = errors.New("playback source is not seekable")
 )
 
 type AudioPlaybackControl struct {
@@ -18,10 +31,239 @@ func (p *AudioPlaybackControl) Mute(mute bool) {
 	p.control.Mute(mute)
 }
 
+// Stop stops playback and playlist. Playback can not be used after
 func (p *AudioPlaybackControl) Stop() {
 	p.control.Stop()
 }
 
+// Pause stops audio output until Resume. No RTP is sent while paused
+func (p *AudioPlaybackControl) Pause() {
+	p.control.Pause()
+}
+
+// Resume continues paused playback. RTP timestamp is moved for pause duration and marker is set
+func (p *AudioPlaybackControl) Resume() {
+	p.control.Resume()
+}
+
+func (p *AudioPlaybackControl) Paused() bool {
+	return p.control.Paused()
+}
+
+// Position returns played duration of current audio
+func (p *AudioPlaybackControl) Position() time.Duration {
+	return p.control.Position()
+}
+
+// Seek moves playback position of current audio. Whence is io.SeekStart for absolute
+// or io.SeekCurrent for relative position. Position is limited to audio duration.
+// Only wav from files and readers implementing io.ReadSeeker can be seeked, otherwise ErrPlaybackNotSeekable is returned
+func (p *AudioPlaybackControl) Seek(offset time.Duration, whence int) error {
+	return p.control.Seek(offset, whence)
+}
+
+// Play is like AudioPlayback Play, but wav from io.ReadSeeker can be seeked
+func (p *AudioPlaybackControl) Play(reader io.Reader, mimeType string) (int64, error) {
+	rs, ok := reader.(io.ReadSeeker)
+	if !ok || !isWavMimeType(mimeType) {
+		p.control.startSource(nil)
+		return p.AudioPlayback.Play(reader, mimeType)
+	}
+
+	if p.onPlay != nil {
+		p.onPlay()
+	}
+	written, err := p.playWavSeekable(rs)
+	p.totalWritten += written
+	if errors.Is(err, io.EOF) {
+		return written, nil
+	}
+	return written, err
+}
+
+// PlayFile is like AudioPlayback PlayFile, but wav file can be seeked
+func (p *AudioPlaybackControl) PlayFile(filename string) (int64, error) {
+	mimeType, err := playbackFileMimeType(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return p.Play(file, mimeType)
+}
+
+func (p *AudioPlaybackControl) playWavSeekable(rs io.ReadSeeker) (int64, error) {
+	wavReader, err := p.wavReadHeaders(rs)
+	if err != nil {
+		return 0, err
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size := int64(wavReader.DataSize)
+	if size < 0 {
+		// Unknown size of streamed wav. Data is until end of file
+		end, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return 0, err
+		}
+		size = end - start
+	}
+
+	src := &playbackSource{
+		rs:         rs,
+		start:      start,
+		size:       size,
+		blockAlign: int64(wavReader.NumChannels) * int64(wavReader.BitsPerSample) / 8,
+		byteRate:   int64(wavReader.SampleRate) * int64(wavReader.NumChannels) * int64(wavReader.BitsPerSample) / 8,
+	}
+	if src.blockAlign == 0 || src.byteRate == 0 {
+		return 0, fmt.Errorf("invalid wav format")
+	}
+	pcmReader := func() (io.Reader, error) {
+		return audio.NewPCM16Reader(wavReader.AudioFormat, int(wavReader.BitsPerSample), src)
+	}
+
+	p.control.startSource(src)
+	defer p.control.startSource(nil)
+	return p.streamAudio(src, wavReader.AudioFormat, int(wavReader.SampleRate), int(wavReader.NumChannels), pcmReader, p.writer)
+}
+
+// PlaylistEvent is passed when playlist item is finished
+type PlaylistEvent struct {
+	Index int
+	Item  string
+	// Skipped is true when item was interrupted with Next or Previous
+	Skipped bool
+	Err     error
+}
+
+// Enqueue adds files or http(s) URLs to playlist
+func (p *AudioPlaybackControl) Enqueue(items ...string) {
+	p.control.mu.Lock()
+	defer p.control.mu.Unlock()
+	p.control.queue = append(p.control.queue, items...)
+}
+
+// Next skips to next playlist item. It has no effect when playlist is not playing
+func (p *AudioPlaybackControl) Next() {
+	p.control.jump(1)
+}
+
+// Previous skips to previous playlist item. It has no effect when playlist is not playing
+func (p *AudioPlaybackControl) Previous() {
+	p.control.jump(-1)
+}
+
+// PlayPlaylist plays queued items until end of playlist or Stop.
+// onItem is called after each item with completion or skip event.
+// Item error stops playlist, unless it was skipped
+func (p *AudioPlaybackControl) PlayPlaylist(onItem func(ev PlaylistEvent)) error {
+	c := p.control
+	c.mu.Lock()
+	c.playlist = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.playlist = false
+		c.jumpBy = 0
+		c.mu.Unlock()
+		c.skip.Store(false)
+	}()
+
+	for {
+		c.mu.Lock()
+		if c.index < 0 || c.index >= len(c.queue) || c.stop.Load() {
+			c.mu.Unlock()
+			return nil
+		}
+		index, item := c.index, c.queue[c.index]
+		c.skip.Store(false)
+		c.mu.Unlock()
+
+		var err error
+		if strings.HasPrefix(item, "http://") || strings.HasPrefix(item, "https://") {
+			c.startSource(nil)
+			_, err = p.PlayURL(item)
+		} else {
+			_, err = p.PlayFile(item)
+		}
+
+		c.mu.Lock()
+		jump := c.jumpBy
+		c.jumpBy = 0
+		c.index = max(c.index+1, 0)
+		if jump != 0 {
+			c.index = max(index+jump, 0)
+		}
+		c.mu.Unlock()
+
+		ev := PlaylistEvent{Index: index, Item: item, Skipped: jump != 0, Err: err}
+		if onItem != nil {
+			onItem(ev)
+		}
+		if err != nil && !ev.Skipped {
+			return err
+		}
+	}
+}
+
+func isWavMimeType(contentType string) bool {
+	mimeType, _, _ := mime.ParseMediaType(contentType)
+	switch mimeType {
+	case "audio/wav", "audio/x-wav", "audio/wav-x", "audio/vnd.wave":
+		return true
+	}
+	return false
+}
+
+// playbackSource is seekable wav data
+type playbackSource struct {
+	mu         sync.Mutex
+	rs         io.ReadSeeker
+	start      int64
+	size       int64
+	pos        int64
+	blockAlign int64
+	byteRate   int64
+}
+
+func (s *playbackSource) Read(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	n, err := s.rs.Read(b[:min(int64(len(b)), s.size-s.pos)])
+	s.pos += int64(n)
+	return n, err
+}
+
+// seek moves to position and returns actual position
+func (s *playbackSource) seek(pos time.Duration) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.blockAlign <= 0 || s.byteRate <= 0 {
+		return 0, ErrPlaybackNotSeekable
+	}
+	off := int64(pos.Seconds()*float64(s.byteRate)) / s.blockAlign * s.blockAlign
+	off = min(max(off, 0), s.size)
+	if _, err := s.rs.Seek(s.start+off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	s.pos = off
+	return time.Duration(off) * time.Second / time.Duration(s.byteRate), nil
+}
+
 /*
 	Playback control should provide functionality like Mute Unmute over audio.
 */
@@ -30,8 +272,25 @@ type audioControl struct {
 	Reader io.Reader // MUST be set if usede as reader
 	Writer io.Writer // Must be set if used as writer
 
-	muted atomic.Bool
-	stop  atomic.Bool
+	// frameDur is duration of written frame for position
+	frameDur time.Duration
+	// onResume is called when writing continues after pause
+	onResume func()
+
+	muted  atomic.Bool
+	stop   atomic.Bool
+	skip   atomic.Bool
+	frames atomic.Int64
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+	src    *playbackSource
+	queue  []string
+	index  int
+	jumpBy int
+	// playlist is true while PlayPlaylist is running. Jumps are ignored otherwise
+	playlist bool
 }
 
 func (c *audioControl) Read(b []byte) (n int, err error) {
@@ -54,8 +313,8 @@ func (c *audioControl) Read(b []byte) (n int, err error) {
 }
 
 func (c *audioControl) Write(b []byte) (n int, err error) {
-	if c.stop.Load() {
-		return 0, io.EOF
+	if err := c.waitPaused(); err != nil {
+		return 0, err
 	}
 
 	if c.muted.Load() {
@@ -64,7 +323,38 @@ func (c *audioControl) Write(b []byte) (n int, err error) {
 		}
 	}
 
-	return c.Writer.Write(b)
+	n, err = c.Writer.Write(b)
+	c.frames.Add(1)
+	return n, err
+}
+
+// waitPaused blocks while paused and returns io.EOF when stopped or skipped
+func (c *audioControl) waitPaused() error {
+	if c.stopped() {
+		return io.EOF
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.paused {
+		if c.stopped() {
+			return io.EOF
+		}
+		c.getCond().Wait()
+	}
+	return nil
+}
+
+func (c *audioControl) stopped() bool {
+	return c.stop.Load() || c.skip.Load()
+}
+
+// getCond must be called under lock
+func (c *audioControl) getCond() *sync.Cond {
+	if c.cond == nil {
+		c.cond = sync.NewCond(&c.mu)
+	}
+	return c.cond
 }
 
 func (c *audioControl) Mute(mute bool) {
@@ -74,4 +364,85 @@ func (c *audioControl) Mute(mute bool) {
 // Stop will stop reader/writer and return io.Eof
 func (c *audioControl) Stop() {
 	c.stop.Store(true)
+	c.wake()
+}
+
+func (c *audioControl) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = true
+}
+
+func (c *audioControl) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return
+	}
+	c.paused = false
+	if c.onResume != nil {
+		c.onResume()
+	}
+	c.getCond().Broadcast()
+}
+
+func (c *audioControl) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+func (c *audioControl) wake() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.getCond().Broadcast()
+}
+
+func (c *audioControl) jump(by int) {
+	c.mu.Lock()
+	if !c.playlist {
+		c.mu.Unlock()
+		return
+	}
+	c.jumpBy = by
+	c.mu.Unlock()
+	c.skip.Store(true)
+	c.wake()
+}
+
+// startSource resets position for new audio
+func (c *audioControl) startSource(src *playbackSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.src = src
+	c.frames.Store(0)
+}
+
+func (c *audioControl) Position() time.Duration {
+	return time.Duration(c.frames.Load()) * c.frameDur
+}
+
+func (c *audioControl) Seek(offset time.Duration, whence int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.src == nil {
+		return ErrPlaybackNotSeekable
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.Position()
+	default:
+		return fmt.Errorf("unsupported seek whence %d", whence)
+	}
+
+	pos, err := c.src.seek(offset)
+	if err != nil {
+		return err
+	}
+	if c.frameDur > 0 {
+		c.frames.Store(int64(pos / c.frameDur))
+	}
+	return nil
 }
@@ -5,9 +5,16 @@ package diago
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media"
 )
 
 func TestAudioControl(t *testing.T) {
@@ -36,3 +43,223 @@ func TestAudioControl(t *testing.T) {
 	res = append(res, payload...)
 	require.Equal(t, res, receiver.Bytes())
 }
+
+func TestAudioControlPause(t *testing.T) {
+	receiver := bytes.NewBuffer([]byte{})
+	resumed := 0
+	p := audioControl{
+		Writer:   receiver,
+		frameDur: 20 * time.Millisecond,
+		onResume: func() { resumed++ },
+	}
+
+	p.Pause()
+	require.True(t, p.Paused())
+
+	written := make(chan error)
+	go func() {
+		_, err := p.Write([]byte{1, 2, 3})
+		written <- err
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("write while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.Resume()
+	require.NoError(t, <-written)
+	require.Equal(t, 1, resumed)
+	require.Equal(t, []byte{1, 2, 3}, receiver.Bytes())
+	require.Equal(t, 20*time.Millisecond, p.Position())
+
+	// Stop unblocks paused writer
+	p.Pause()
+	go func() {
+		_, err := p.Write([]byte{1, 2, 3})
+		written <- err
+	}()
+	p.Stop()
+	require.ErrorIs(t, <-written, io.EOF)
+}
+
+// hookWriter calls onWrite before each write with number of previous writes
+type hookWriter struct {
+	writes  int
+	onWrite func(n int)
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	if w.onWrite != nil {
+		w.onWrite(w.writes)
+	}
+	w.writes++
+	return len(b), nil
+}
+
+func testPlaybackControl(w io.Writer) AudioPlaybackControl {
+	codec := media.CodecAudioUlaw
+	control := &audioControl{Writer: w, frameDur: codec.SampleDur}
+	return AudioPlaybackControl{
+		AudioPlayback: NewAudioPlayback(control, codec),
+		control:       control,
+	}
+}
+
+func TestAudioPlaybackControlSeek(t *testing.T) {
+	// 1s of audio is 50 frames
+	wav := testWav(8000, 8000)
+
+	t.Run("Absolute", func(t *testing.T) {
+		w := &hookWriter{}
+		p := testPlaybackControl(w)
+		w.onWrite = func(n int) {
+			if n == 5 {
+				require.NoError(t, p.Seek(500*time.Millisecond, io.SeekStart))
+			}
+		}
+		_, err := p.Play(bytes.NewReader(wav), "audio/wav")
+		require.NoError(t, err)
+		require.Equal(t, 6+25, w.writes)
+	})
+
+	t.Run("Relative", func(t *testing.T) {
+		w := &hookWriter{}
+		p := testPlaybackControl(w)
+		w.onWrite = func(n int) {
+			if n == 10 {
+				require.Equal(t, 200*time.Millisecond, p.Position())
+				require.NoError(t, p.Seek(-100*time.Millisecond, io.SeekCurrent))
+				require.Equal(t, 100*time.Millisecond, p.Position())
+			}
+		}
+		_, err := p.Play(bytes.NewReader(wav), "audio/wav")
+		require.NoError(t, err)
+		require.Equal(t, 11+45, w.writes)
+	})
+
+	t.Run("Clamped", func(t *testing.T) {
+		w := &hookWriter{}
+		p := testPlaybackControl(w)
+		w.onWrite = func(n int) {
+			if n == 0 {
+				require.NoError(t, p.Seek(time.Hour, io.SeekStart))
+			}
+		}
+		_, err := p.Play(bytes.NewReader(wav), "audio/wav")
+		require.NoError(t, err)
+		require.Equal(t, 1, w.writes)
+	})
+
+	t.Run("NotSeekable", func(t *testing.T) {
+		w := &hookWriter{}
+		p := testPlaybackControl(w)
+		w.onWrite = func(n int) {
+			if n == 0 {
+				require.ErrorIs(t, p.Seek(0, io.SeekStart), ErrPlaybackNotSeekable)
+			}
+		}
+		_, err := p.Play(bytes.NewReader(make([]byte, 160)), "")
+		require.NoError(t, err)
+		require.Equal(t, 1, w.writes)
+	})
+
+	t.Run("UnknownSize", func(t *testing.T) {
+		wav := bytes.Clone(wav)
+		binary.LittleEndian.PutUint32(wav[40:], 0xFFFFFFFF)
+		w := &hookWriter{}
+		p := testPlaybackControl(w)
+		w.onWrite = func(n int) {
+			if n == 5 {
+				require.NoError(t, p.Seek(900*time.Millisecond, io.SeekStart))
+			}
+		}
+		_, err := p.Play(bytes.NewReader(wav), "audio/wav")
+		require.NoError(t, err)
+		require.Equal(t, 6+5, w.writes)
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		src := &playbackSource{rs: bytes.NewReader(wav), size: int64(len(wav))}
+		_, err := src.seek(time.Second)
+		require.ErrorIs(t, err, ErrPlaybackNotSeekable)
+	})
+}
+
+func TestAudioPlaybackControlPlaylist(t *testing.T) {
+	dir := t.TempDir()
+	files := make([]string, 3)
+	for i := range files {
+		files[i] = filepath.Join(dir, fmt.Sprintf("%d.wav", i))
+		// 10 frames each
+		require.NoError(t, os.WriteFile(files[i], testWav(8000, 1600), 0644))
+	}
+
+	w := &hookWriter{}
+	p := testPlaybackControl(w)
+	p.Enqueue(files...)
+
+	previous := false
+	w.onWrite = func(n int) {
+		switch n {
+		case 12:
+			// Second item skipped
+			p.Next()
+		case 15:
+			// Third item back to second
+			if !previous {
+				previous = true
+				p.Previous()
+			}
+		}
+	}
+
+	events := []PlaylistEvent{}
+	err := p.PlayPlaylist(func(ev PlaylistEvent) {
+		events = append(events, ev)
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []PlaylistEvent{
+		{Index: 0, Item: files[0]},
+		{Index: 1, Item: files[1], Skipped: true},
+		{Index: 2, Item: files[2], Skipped: true},
+		{Index: 1, Item: files[1]},
+		{Index: 2, Item: files[2]},
+	}, events)
+
+	t.Run("Stop", func(t *testing.T) {
+		w := &hookWriter{}
+		p := testPlaybackControl(w)
+		p.Enqueue(files...)
+		w.onWrite = func(n int) {
+			if n == 3 {
+				p.Stop()
+			}
+		}
+		events := 0
+		require.NoError(t, p.PlayPlaylist(func(ev PlaylistEvent) { events++ }))
+		require.Equal(t, 1, events)
+		require.Equal(t, 4, w.writes)
+	})
+
+	t.Run("NoPlaylist", func(t *testing.T) {
+		w := &hookWriter{}
+		p := testPlaybackControl(w)
+		w.onWrite = func(n int) {
+			if n == 3 {
+				p.Next()
+			}
+		}
+		// Jump without playlist does not stop this or next playback
+		_, err := p.PlayFile(files[0])
+		require.NoError(t, err)
+		require.Equal(t, 10, w.writes)
+
+		p.Previous()
+		_, err = p.PlayFile(files[0])
+		require.NoError(t, err)
+		require.Equal(t, 20, w.writes)
+	})
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/audio"
 	"github.com/vertan/diago/media"
 )
 
@@ -67,6 +68,27 @@ func TestIntegrationPlaybackStreamWAV(t *testing.T) {
 	require.Greater(t, written, int64(10000))
 }
 
+func TestPlaybackWavResample(t *testing.T) {
+	// 1 sec of 16kHz stereo audio
+	wavFile, err := os.Create(t.TempDir() + "/stereo16k.wav")
+	require.NoError(t, err)
+	wavWriter := audio.NewWavWriter(wavFile)
+	wavWriter.SampleRate = 16000
+	wavWriter.NumChans = 2
+	_, err = wavWriter.Write(make([]byte, 16000*2*2))
+	require.NoError(t, err)
+	require.NoError(t, wavWriter.Close())
+
+	buf := bytes.NewBuffer(nil)
+	p := NewAudioPlayback(buf, media.CodecAudioUlaw)
+	written, err := p.PlayFile(wavFile.Name())
+	require.NoError(t, err)
+
+	// Written is PCM, which is encoded as 8kHz mono
+	assert.EqualValues(t, 8000*2, written)
+	assert.Equal(t, 8000, buf.Len())
+}
+
 func TestIntegrationPlaybackFile(t *testing.T) {
 	r, w := io.Pipe()
 	go func() {
@@ -104,3 +126,94 @@ func TestIntegrationPlaybackFile(t *testing.T) {
 	})
 
 }
+
+func TestPlaybackG711(t *testing.T) {
+	ulaw := bytes.Repeat([]byte{0xff, 0x7f, 0x10, 0x90}, 100)
+	ulawWav := func() []byte {
+		buf := bytes.NewBuffer(nil)
+		_, err := audio.WavWrite(buf, ulaw, audio.WavWriteOpts{
+			AudioFormat: audio.WavAudioFormatULaw,
+			BitDepth:    8,
+			NumChans:    1,
+			SampleRate:  8000,
+		})
+		require.NoError(t, err)
+		return buf.Bytes()
+	}
+
+	t.Run("Passthrough", func(t *testing.T) {
+		w := &frameSizeWriter{}
+		buf := bytes.NewBuffer(nil)
+		p := NewAudioPlayback(io.MultiWriter(w, buf), media.CodecAudioUlaw)
+		_, err := p.Play(bytes.NewReader(ulawWav()), "audio/wav")
+		require.NoError(t, err)
+		assert.Equal(t, ulaw, buf.Bytes())
+		assert.Equal(t, []int{160, 160, 80}, w.frames)
+	})
+
+	t.Run("Transcode", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		p := NewAudioPlayback(buf, media.CodecAudioAlaw)
+		_, err := p.Play(bytes.NewReader(ulawWav()), "audio/wav")
+		require.NoError(t, err)
+
+		lpcm := make([]byte, 2*len(ulaw))
+		audio.DecodeUlawTo(lpcm, ulaw)
+		alaw := make([]byte, len(ulaw))
+		audio.EncodeAlawTo(alaw, lpcm)
+		assert.Equal(t, alaw, buf.Bytes())
+	})
+
+	t.Run("RawFile", func(t *testing.T) {
+		filename := t.TempDir() + "/prompt.ulaw"
+		require.NoError(t, os.WriteFile(filename, ulaw, 0644))
+
+		buf := bytes.NewBuffer(nil)
+		p := NewAudioPlayback(buf, media.CodecAudioUlaw)
+		_, err := p.PlayFile(filename)
+		require.NoError(t, err)
+		assert.Equal(t, ulaw, buf.Bytes())
+
+		_, err = p.PlayFile(t.TempDir() + "/prompt.mp3")
+		require.Error(t, err)
+	})
+}
+
+func TestPlaybackOggOpus(t *testing.T) {
+	oggOpus := func(packets ...[]byte) []byte {
+		buf := bytes.NewBuffer(nil)
+		w := audio.NewOggOpusWriter(buf, 2, 48000)
+		for _, p := range packets {
+			_, err := w.Write(p)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	t.Run("Passthrough", func(t *testing.T) {
+		// CELT 20 ms packets
+		packets := [][]byte{{0xf8, 1, 2}, {0xf8, 3}, {0xf8, 4, 5, 6}}
+		w := &packetRecorder{}
+		p := NewAudioPlayback(w, media.CodecAudioOpus)
+		_, err := p.Play(bytes.NewReader(oggOpus(packets...)), "audio/ogg")
+		require.NoError(t, err)
+		assert.Equal(t, packets, w.packets)
+	})
+
+	t.Run("DurationMismatch", func(t *testing.T) {
+		// CELT 10 ms packet
+		p := NewAudioPlayback(&packetRecorder{}, media.CodecAudioOpus)
+		_, err := p.Play(bytes.NewReader(oggOpus([]byte{0xf0, 1})), "audio/ogg")
+		require.Error(t, err)
+	})
+}
+
+type packetRecorder struct {
+	packets [][]byte
+}
+
+func (w *packetRecorder) Write(b []byte) (int, error) {
+	w.packets = append(w.packets, bytes.Clone(b))
+	return len(b), nil
+}
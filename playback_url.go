@@ -7,12 +7,10 @@ package diago
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
-	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -21,24 +19,84 @@ import (
 
 var (
 	DefaultPlaybackURLRangeSize int = 65536
+
+	// PlaybackURLClient is default client of PlayURL. It has no timeout as streams can be long,
+	// so requests should be limited with context or PlayURLOptions Timeout
+	PlaybackURLClient = &http.Client{}
+
+	// PlaybackURLTimeout is timeout of PlayURL for each response and reading of response body
+	PlaybackURLTimeout = 10 * time.Second
+
+	// PlaybackURLCacheDefault is default cache of PlayURL. Nil disables caching
+	PlaybackURLCacheDefault *PlaybackURLCache
 )
 
+// PlayURLOptions are options of PlayURLContext. Zero values are defaults
+type PlayURLOptions struct {
+	// Client is http client for requests. Default PlaybackURLClient
+	Client *http.Client
+	// Cache stores downloaded audio. Default PlaybackURLCacheDefault
+	Cache *PlaybackURLCache
+	// Timeout limits waiting for each response and each read of response body.
+	// Zero is no limit and request is only limited with context
+	Timeout time.Duration
+}
+
+func (o *PlayURLOptions) defaults() {
+	if o.Client == nil {
+		o.Client = PlaybackURLClient
+	}
+	if o.Cache == nil {
+		o.Cache = PlaybackURLCacheDefault
+	}
+}
+
+// PlayURL plays audio from url with default options and PlaybackURLTimeout
 func (p *AudioPlayback) PlayURL(urlStr string) (int64, error) {
+	return p.PlayURLContext(context.Background(), urlStr, PlayURLOptions{Timeout: PlaybackURLTimeout})
+}
+
+// PlayURLContext plays audio from url. Audio is fetched with range requests if server supports them,
+// otherwise response is streamed as it is received, which allows playing live chunked streams.
+// Supported content types are same as for Play, including raw PCM as audio/L16;rate=8000
+func (p *AudioPlayback) PlayURLContext(ctx context.Context, urlStr string, opts PlayURLOptions) (int64, error) {
+	opts.defaults()
+	if p.onPlay != nil {
+		p.onPlay()
+	}
+
 	var written int64
-	err := p.playURL(urlStr, &written)
+	err := p.playURL(ctx, urlStr, opts, &written)
+	p.totalWritten += written
 	if errors.Is(err, io.EOF) {
 		return written, nil
 	}
 	return written, err
 }
 
-func (p *AudioPlayback) playURL(urlStr string, written *int64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (p *AudioPlayback) playURL(ctx context.Context, urlStr string, opts PlayURLOptions, written *int64) error {
+	client := opts.Client
+	cache := opts.Cache
+
 	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
 		return err
 	}
+
+	var cached playbackURLCacheEntry
+	var isCached bool
+	if cache != nil {
+		cached, isCached = cache.get(urlStr)
+		if isCached {
+			if cached.etag != "" {
+				req.Header.Set("If-None-Match", cached.etag)
+			}
+			if cached.lastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.lastModified)
+			}
+		}
+	}
+
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Range_requests
 	// WAV header size is 44 bytes so we have more than enough
 	// This must be correctly round up in case partial reads
@@ -46,49 +104,138 @@ func (p *AudioPlayback) playURL(urlStr string, written *int64) error {
 	readSize := (DefaultPlaybackURLRangeSize / pcmSamples) * pcmSamples
 	req.Header.Add("Range", "bytes=0-"+strconv.Itoa(readSize-1)) // Try with range request
 
-	res, err := client.Do(req)
+	res, err := httpDoTimeout(client, req, opts.Timeout)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("non 200 received. code=%d", res.StatusCode)
-	}
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		if !isCached {
+			return fmt.Errorf("not modified received without cached audio")
+		}
+		body, err := cache.open(cached)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
 
-	contType := res.Header.Get("Content-Type")
-	mimeType, _, err := mime.ParseMediaType(contType)
-	if err != nil {
+		n, err := p.streamContent(body, cached.contentType)
+		*written = n
 		return err
+	case http.StatusOK, http.StatusPartialContent:
+	default:
+		return fmt.Errorf("non 200 received. code=%d", res.StatusCode)
 	}
 
-	switch mimeType {
-	case "audio/wav", "audio/x-wav", "audio/wav-x", "audio/vnd.wave":
-	default:
-		return fmt.Errorf("unsuported content type %q", contType)
+	contentType := res.Header.Get("Content-Type")
+	if err := p.contentSupported(contentType); err != nil {
+		return err
 	}
 
-	// Check can be streamed
+	var body io.Reader
+	var stopRange func() error
 	if res.StatusCode == http.StatusPartialContent {
-		// acceptRanges := res.Header.Get("Accept-Ranges")
-		// if acceptRanges != "bytes" {
-		// 	return fmt.Errorf("header Accept-Ranges != bytes. Value=%q", acceptRanges)
-		// }
-
-		contentRange := res.Header.Get("Content-Range")
-		ind := strings.LastIndex(contentRange, "/")
-		if ind < 0 {
-			return fmt.Errorf("full audio size in Content-Range not present")
-		}
-		maxSize, err := strconv.ParseInt(contentRange[ind+1:], 10, 64)
+		body, stopRange, err = httpRangeReader(client, req, res, readSize, opts.Timeout)
 		if err != nil {
 			return err
 		}
+	} else {
+		// Server does not support ranges or it is live stream. Response is played while received
+		body = bufio.NewReaderSize(res.Body, readSize)
+	}
 
-		if maxSize <= 0 {
-			return fmt.Errorf("parsing audio size failed")
+	var rec *playbackURLRecorder
+	if cache != nil {
+		rec = &playbackURLRecorder{reader: body, max: cache.MaxSize}
+		body = rec
+	}
+
+	// Failed write means playback is stopped
+	playWriter := &playbackURLWriter{writer: p.writer}
+	n, err := p.streamContentWriter(body, contentType, playWriter)
+	*written = n
+
+	if rec != nil && !playWriter.failed && (err == nil || errors.Is(err, io.EOF)) && (res.ContentLength >= 0 || stopRange != nil) {
+		// Audio can end before body, like wav with trailing chunks. Rest is needed for caching
+		rec.drain()
+	}
+
+	if stopRange != nil {
+		// There is no reason having http goroutine still running
+		// First make sure http goroutine exited and join errors
+		err = errors.Join(stopRange(), err)
+	}
+
+	if rec != nil && rec.complete {
+		cache.put(urlStr, playbackURLCacheEntry{
+			contentType:  contentType,
+			etag:         res.Header.Get("ETag"),
+			lastModified: res.Header.Get("Last-Modified"),
+		}, rec.data)
+	}
+	return err
+}
+
+// httpRangeReader returns reader of audio which is fetched with range requests in background.
+// Stop closes reader and returns fetching error
+func httpRangeReader(client *http.Client, req *http.Request, res *http.Response, readSize int, timeout time.Duration) (io.Reader, func() error, error) {
+	// acceptRanges := res.Header.Get("Accept-Ranges")
+	// if acceptRanges != "bytes" {
+	// 	return fmt.Errorf("header Accept-Ranges != bytes. Value=%q", acceptRanges)
+	// }
+
+	contentRange := res.Header.Get("Content-Range")
+	ind := strings.LastIndex(contentRange, "/")
+	if ind < 0 {
+		return nil, nil, fmt.Errorf("full audio size in Content-Range not present")
+	}
+	maxSize, err := strconv.ParseInt(contentRange[ind+1:], 10, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if maxSize <= 0 {
+		return nil, nil, fmt.Errorf("parsing audio size failed")
+	}
+
+	httpPartial := func(res *http.Response, writer io.Writer, size int64) error {
+		chunk, err := io.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("reading chunk stopped: %w", err)
 		}
+		res.Body.Close()
+
+		if _, err := writer.Write(chunk); err != nil {
+			return err
+		}
+
+		var start int64 = size
+		var offset int64 = size * 2
+		for ; start < maxSize; start += offset {
+			end := min(start+offset-1, maxSize)
+			// Range is inclusive
+			rangeHDR := fmt.Sprintf("bytes=%d-%d", start, end)
+
+			req.Header.Set("Range", rangeHDR) // Try with range request
+			req.Header.Del("If-None-Match")
+			req.Header.Del("If-Modified-Since")
+			res, err = httpDoTimeout(client, req, timeout)
+			if err != nil {
+				return fmt.Errorf("failed to request range: %w", err)
+			}
+
+			if res.StatusCode == http.StatusRequestedRangeNotSatisfiable && res.ContentLength == 0 {
+				res.Body.Close()
+				break
+			}
+
+			if res.StatusCode != http.StatusPartialContent {
+				res.Body.Close()
+				return fmt.Errorf("expected partial content response: code=%d", res.StatusCode)
+			}
 
-		httpPartial := func(res *http.Response, writer io.Writer, size int64) error {
 			chunk, err := io.ReadAll(res.Body)
 			if err != nil {
 				return fmt.Errorf("reading chunk stopped: %w", err)
@@ -98,75 +245,121 @@ func (p *AudioPlayback) playURL(urlStr string, written *int64) error {
 			if _, err := writer.Write(chunk); err != nil {
 				return err
 			}
-
-			var start int64 = size
-			var offset int64 = size * 2
-			for ; start < maxSize; start += offset {
-				end := min(start+offset-1, maxSize)
-				// Range is inclusive
-				rangeHDR := fmt.Sprintf("bytes=%d-%d", start, end)
-
-				req.Header.Set("Range", rangeHDR) // Try with range request
-				res, err = client.Do(req)
-				if err != nil {
-					return fmt.Errorf("failed to request range: %w", err)
-				}
-
-				if res.StatusCode == http.StatusRequestedRangeNotSatisfiable && res.ContentLength == 0 {
-					break
-				}
-
-				if res.StatusCode != http.StatusPartialContent {
-					return fmt.Errorf("expected partial content response: code=%d", res.StatusCode)
-				}
-
-				chunk, err := io.ReadAll(res.Body)
-				if err != nil {
-					return fmt.Errorf("reading chunk stopped: %w", err)
-				}
-				res.Body.Close()
-
-				if _, err := writer.Write(chunk); err != nil {
-					return err
-				}
-			}
-			return nil
 		}
+		return nil
+	}
 
-		httpErr := make(chan error)
-		reader, writer := io.Pipe()
+	httpErr := make(chan error)
+	reader, writer := io.Pipe()
 
-		// Buffering allows that there is always one Write ahead
-		bufferReader := bufio.NewReaderSize(reader, readSize)
-		go func() {
-			err := httpPartial(res, writer, int64(readSize))
-			writer.Close()
-			httpErr <- err
-		}()
-
-		n, err := p.streamWav(bufferReader, p.writer)
-		*written = n
-		p.totalWritten += n
+	// Buffering allows that there is always one Write ahead
+	bufferReader := bufio.NewReaderSize(reader, readSize)
+	go func() {
+		err := httpPartial(res, writer, int64(readSize))
+		writer.Close()
+		httpErr <- err
+	}()
 
+	stop := func() error {
 		// Closing reader to stop writing routine
 		reader.Close()
-		// There is no reason having http goroutine still running
-		// First make sure http goroutine exited and join errors
-		err = errors.Join(<-httpErr, err)
-		return err
+		return <-httpErr
+	}
+	return bufferReader, stop, nil
+}
+
+// httpDoTimeout sends request which fails when response or any read of its body takes longer than timeout.
+// Zero timeout does not limit request
+func httpDoTimeout(client *http.Client, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 {
+		return client.Do(req)
 	}
 
-	samples, err := io.ReadAll(res.Body)
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(timeout, cancel)
+	res, err := client.Do(req.WithContext(ctx))
+	if !timer.Stop() && err != nil {
+		err = fmt.Errorf("no response within %s: %w", timeout, context.DeadlineExceeded)
+	}
 	if err != nil {
-		return err
+		cancel()
+		return nil, err
 	}
+	res.Body = &httpTimeoutBody{body: res.Body, timer: timer, timeout: timeout, cancel: cancel}
+	return res, nil
+}
 
-	defer res.Body.Close()
+// httpTimeoutBody cancels request when read takes longer than timeout.
+// Time between reads is not limited as playback reads at audio pace
+type httpTimeoutBody struct {
+	body    io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
 
-	wavBuf := bytes.NewReader(samples)
-	n, err := p.streamWav(wavBuf, p.writer)
-	*written = n
-	p.totalWritten += n
+func (b *httpTimeoutBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	n, err := b.body.Read(p)
+	if !b.timer.Stop() && err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("reading response stalled for %s: %w", b.timeout, context.DeadlineExceeded)
+	}
+	return n, err
+}
 
-	return err
+func (b *httpTimeoutBody) Close() error {
+	b.timer.Stop()
+	b.cancel()
+	return b.body.Close()
+}
+
+// playbackURLWriter remembers failed write, which happens when playback is stopped
+type playbackURLWriter struct {
+	writer io.Writer
+	failed bool
+}
+
+func (w *playbackURLWriter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	if err != nil {
+		w.failed = true
+	}
+	return n, err
+}
+
+// playbackURLRecorder keeps read data for caching until max size
+type playbackURLRecorder struct {
+	reader   io.Reader
+	max      int64
+	data     []byte
+	complete bool
+	tooLarge bool
+}
+
+func (r *playbackURLRecorder) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	if !r.tooLarge {
+		if int64(len(r.data)+n) > r.max {
+			// Not cacheable. Stop keeping data
+			r.tooLarge = true
+			r.data = nil
+		} else {
+			r.data = append(r.data, b[:n]...)
+		}
+	}
+	if errors.Is(err, io.EOF) && !r.tooLarge {
+		r.complete = true
+	}
+	return n, err
+}
+
+// drain reads rest of data until it is complete or too large for caching.
+// It must not be called when playback is stopped, as rest of stream is not needed
+func (r *playbackURLRecorder) drain() {
+	buf := make([]byte, 4096)
+	for !r.tooLarge {
+		if _, err := r.Read(buf); err != nil {
+			return
+		}
+	}
 }
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// PlaybackURLCache caches audio downloaded by PlayURL in memory or in directory.
+// Cached audio is revalidated with ETag or Last-Modified on each play, so that only changed audio is downloaded again.
+// Least recently used audio is removed when MaxSize is exceeded.
+//
+// Experimental
+type PlaybackURLCache struct {
+	// Dir stores audio as files. Empty keeps audio in memory
+	Dir string
+	// MaxSize is total size of cached audio in bytes
+	MaxSize int64
+
+	mu      sync.Mutex
+	entries map[string]*playbackURLCacheEntry
+	size    int64
+	tick    uint64
+}
+
+type playbackURLCacheEntry struct {
+	contentType  string
+	etag         string
+	lastModified string
+
+	size int64
+	data []byte
+	file string
+	used uint64
+}
+
+// NewPlaybackURLCache creates cache with max size in bytes. Empty dir keeps audio in memory
+func NewPlaybackURLCache(dir string, maxSize int64) *PlaybackURLCache {
+	return &PlaybackURLCache{
+		Dir:     dir,
+		MaxSize: maxSize,
+	}
+}
+
+// get returns copy of entry. Only entries that can be revalidated are returned
+func (c *PlaybackURLCache) get(url string) (playbackURLCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[url]
+	if !ok || (e.etag == "" && e.lastModified == "") {
+		return playbackURLCacheEntry{}, false
+	}
+	c.tick++
+	e.used = c.tick
+	return *e, true
+}
+
+func (c *PlaybackURLCache) open(e playbackURLCacheEntry) (io.ReadCloser, error) {
+	if e.file == "" {
+		return io.NopCloser(bytes.NewReader(e.data)), nil
+	}
+	return os.Open(e.file)
+}
+
+// put stores audio of url. Audio that can not be revalidated or is larger than cache is not stored
+func (c *PlaybackURLCache) put(url string, e playbackURLCacheEntry, data []byte) {
+	if (e.etag == "" && e.lastModified == "") || int64(len(data)) > c.MaxSize {
+		return
+	}
+
+	e.size = int64(len(data))
+	if c.Dir == "" {
+		e.data = data
+	} else {
+		sum := sha256.Sum256([]byte(url))
+		e.file = filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+		if err := writeCacheFile(c.Dir, e.file, data); err != nil {
+			slog.Error("Failed to write playback cache file", "error", err)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*playbackURLCacheEntry)
+	}
+	if old, ok := c.entries[url]; ok {
+		c.size -= old.size
+	}
+	c.tick++
+	e.used = c.tick
+	c.entries[url] = &e
+	c.size += e.size
+
+	for c.size > c.MaxSize {
+		c.evict()
+	}
+}
+
+// writeCacheFile writes to unique temporary file first, as file can be played
+// and same url can be stored at same time
+func writeCacheFile(dir string, file string, data []byte) error {
+	f, err := os.CreateTemp(dir, filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// evict removes least recently used entry. Must be called under lock
+func (c *PlaybackURLCache) evict() {
+	var oldestURL string
+	var oldest *playbackURLCacheEntry
+	for url, e := range c.entries {
+		if oldest == nil || e.used < oldest.used {
+			oldestURL, oldest = url, e
+		}
+	}
+	if oldest == nil {
+		return
+	}
+
+	delete(c.entries, oldestURL)
+	c.size -= oldest.size
+	if oldest.file != "" {
+		if err := os.Remove(oldest.file); err != nil {
+			slog.Error("Failed to remove playback cache file", "error", err)
+		}
+	}
+}
+
+// Size returns total size of cached audio
+func (c *PlaybackURLCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
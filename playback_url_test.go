@@ -11,13 +11,16 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/emiago/sipgo"
 	"github.com/emiago/sipgo/sip"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/vertan/diago/media"
 )
@@ -179,3 +182,224 @@ func TestPiper(t *testing.T) {
 	reader.Close()
 	<-done
 }
+
+func TestPlaybackURL(t *testing.T) {
+	wav := testWav(8000, 8000)
+	etag := `"v1"`
+	var fullRequests, notModified int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/range.wav", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "audio/wav")
+		w.Header().Set("ETag", etag)
+		if req.Header.Get("If-None-Match") == etag {
+			notModified++
+		} else {
+			fullRequests++
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(wav))
+	})
+	mux.HandleFunc("/norange.wav", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "audio/wav")
+		w.Write(wav)
+	})
+	mux.HandleFunc("/live", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "audio/L16;rate=16000")
+		// 100 ms chunks of big endian PCM
+		chunk := make([]byte, 3200)
+		for i := 0; i < 10; i++ {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+	})
+	// Chunks are flushed with odd sizes, so body is read in short reads
+	writeChunked := func(w http.ResponseWriter, data []byte) {
+		for len(data) > 0 {
+			n := min(77, len(data))
+			w.Write(data[:n])
+			w.(http.Flusher).Flush()
+			data = data[n:]
+		}
+	}
+	mux.HandleFunc("/chunked.wav", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "audio/wav")
+		writeChunked(w, wav)
+	})
+	mux.HandleFunc("/chunked.ulaw", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "audio/PCMU")
+		writeChunked(w, make([]byte, 8000))
+	})
+	mux.HandleFunc("/blocked", func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	})
+	mux.HandleFunc("/stalled.wav", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "audio/wav")
+		// Rest of audio never comes
+		w.Header().Set("Content-Length", strconv.Itoa(len(wav)))
+		w.Write(wav[:len(wav)/2])
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// 1s of 8000 PCM encoded to ulaw
+	expectedWritten := int64(16000)
+
+	t.Run("NoRange", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		p := NewAudioPlayback(buf, media.CodecAudioUlaw)
+		written, err := p.PlayURL(srv.URL + "/norange.wav")
+		require.NoError(t, err)
+		assert.Equal(t, expectedWritten, written)
+		assert.Equal(t, 8000, buf.Len())
+	})
+
+	t.Run("LiveL16", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		p := NewAudioPlayback(buf, media.CodecAudioUlaw)
+		_, err := p.PlayURLContext(context.Background(), srv.URL+"/live", PlayURLOptions{})
+		require.NoError(t, err)
+		// 1s resampled to 8000
+		assert.InDelta(t, 8000, buf.Len(), 160)
+	})
+
+	t.Run("ChunkedFullFrames", func(t *testing.T) {
+		for _, path := range []string{"/chunked.wav", "/chunked.ulaw"} {
+			w := &playbackFramesWriter{}
+			p := NewAudioPlayback(w, media.CodecAudioUlaw)
+			_, err := p.PlayURL(srv.URL + path)
+			require.NoError(t, err)
+			require.Len(t, w.frames, 50, path)
+			for _, n := range w.frames {
+				assert.Equal(t, 160, n, path)
+			}
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		p := NewAudioPlayback(bytes.NewBuffer(nil), media.CodecAudioUlaw)
+		_, err := p.PlayURLContext(ctx, srv.URL+"/blocked", PlayURLOptions{Client: srv.Client()})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		p := NewAudioPlayback(bytes.NewBuffer(nil), media.CodecAudioUlaw)
+		_, err := p.PlayURLContext(context.Background(), srv.URL+"/blocked", PlayURLOptions{Timeout: 50 * time.Millisecond})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// PlayURL has default timeout
+		defer func(timeout time.Duration) { PlaybackURLTimeout = timeout }(PlaybackURLTimeout)
+		PlaybackURLTimeout = 50 * time.Millisecond
+		_, err = p.PlayURL(srv.URL + "/blocked")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// Stalled body
+		_, err = p.PlayURLContext(context.Background(), srv.URL+"/stalled.wav", PlayURLOptions{
+			Cache:   NewPlaybackURLCache("", 1<<20),
+			Timeout: 50 * time.Millisecond,
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("StoppedNoDrain", func(t *testing.T) {
+		// Stopped playback fails writes with EOF
+		p := NewAudioPlayback(&playbackStoppedWriter{}, media.CodecAudioUlaw)
+		done := make(chan error)
+		go func() {
+			_, err := p.PlayURLContext(context.Background(), srv.URL+"/stalled.wav", PlayURLOptions{Cache: NewPlaybackURLCache("", 1<<20)})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("stopped playback waits for rest of body")
+		}
+	})
+
+	for _, dir := range []string{"", t.TempDir()} {
+		t.Run("Cache"+dir, func(t *testing.T) {
+			fullRequests, notModified = 0, 0
+			cache := NewPlaybackURLCache(dir, 1<<20)
+			opts := PlayURLOptions{Cache: cache}
+
+			for i := 0; i < 3; i++ {
+				buf := bytes.NewBuffer(nil)
+				p := NewAudioPlayback(buf, media.CodecAudioUlaw)
+				written, err := p.PlayURLContext(context.Background(), srv.URL+"/range.wav", opts)
+				require.NoError(t, err)
+				assert.Equal(t, expectedWritten, written)
+				assert.Equal(t, 8000, buf.Len())
+			}
+			assert.Equal(t, 1, fullRequests)
+			assert.Equal(t, 2, notModified)
+			assert.Equal(t, int64(len(wav)), cache.Size())
+
+			// Changed audio is downloaded again
+			etag = `"v2"`
+			defer func() { etag = `"v1"` }()
+			p := NewAudioPlayback(bytes.NewBuffer(nil), media.CodecAudioUlaw)
+			_, err := p.PlayURLContext(context.Background(), srv.URL+"/range.wav", opts)
+			require.NoError(t, err)
+			assert.Equal(t, 2, fullRequests)
+		})
+	}
+
+	t.Run("CacheConcurrentPut", func(t *testing.T) {
+		dir := t.TempDir()
+		cache := NewPlaybackURLCache(dir, 1<<20)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cache.put("a", playbackURLCacheEntry{etag: "a"}, wav)
+			}()
+		}
+		wg.Wait()
+
+		// Only stored file is left
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		e, ok := cache.get("a")
+		require.True(t, ok)
+		f, err := cache.open(e)
+		require.NoError(t, err)
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, wav, data)
+	})
+
+	t.Run("CacheEviction", func(t *testing.T) {
+		cache := NewPlaybackURLCache("", int64(len(wav)))
+		cache.put("a", playbackURLCacheEntry{etag: "a"}, wav)
+		cache.put("b", playbackURLCacheEntry{etag: "b"}, wav)
+		_, ok := cache.get("a")
+		assert.False(t, ok)
+		_, ok = cache.get("b")
+		assert.True(t, ok)
+
+		cache.put("c", playbackURLCacheEntry{etag: "c"}, append(wav, 0))
+		_, ok = cache.get("c")
+		assert.False(t, ok, "larger than cache")
+	})
+}
+
+type playbackStoppedWriter struct{}
+
+func (w *playbackStoppedWriter) Write(b []byte) (int, error) {
+	return 0, io.EOF
+}
+
+type playbackFramesWriter struct {
+	frames []int
+}
+
+func (w *playbackFramesWriter) Write(b []byte) (int, error) {
+	w.frames = append(w.frames, len(b))
+	return len(b), nil
+}
@@ -1,9 +1,15 @@
 package diago
 
 import (
+	"encoding/json"
 	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
 )
 
 type AudioStereoRecordingWav struct {
@@ -19,9 +25,320 @@ func (r *AudioStereoRecordingWav) AudioWriter() *audio.MonitorPCMStereo {
 	return &r.mon
 }
 
+// Pause records silence until Resume
+func (r *AudioStereoRecordingWav) Pause() {
+	r.mon.Pause(false)
+}
+
+func (r *AudioStereoRecordingWav) Resume() {
+	r.mon.Resume()
+}
+
 func (r *AudioStereoRecordingWav) Close() error {
 	return errors.Join(
 		r.mon.Close(),
 		r.wawWriter.Close(),
 	)
 }
+
+// AudioStereoRecordingOggOpus records caller and callee as stereo Ogg Opus.
+// Opus calls are recorded without re-encoding
+type AudioStereoRecordingOggOpus struct {
+	oggWriter *audio.OggOpusPCMWriter
+	mon       audio.MonitorPCMStereo
+
+	// rtpWriter records opus payloads when call codec is opus
+	rtpWriter *audio.OggOpusRTPWriter
+	reader    io.Reader
+	writer    io.Writer
+}
+
+func (r *AudioStereoRecordingOggOpus) AudioReader() io.Reader {
+	if r.rtpWriter != nil {
+		return r.reader
+	}
+	return &r.mon
+}
+
+func (r *AudioStereoRecordingOggOpus) AudioWriter() io.Writer {
+	if r.rtpWriter != nil {
+		return r.writer
+	}
+	return &r.mon
+}
+
+// Pause records silence until Resume
+func (r *AudioStereoRecordingOggOpus) Pause() {
+	if r.rtpWriter != nil {
+		r.rtpWriter.Pause()
+		return
+	}
+	r.mon.Pause(false)
+}
+
+func (r *AudioStereoRecordingOggOpus) Resume() {
+	if r.rtpWriter != nil {
+		r.rtpWriter.Resume()
+		return
+	}
+	r.mon.Resume()
+}
+
+// Close writes recording. Underlying writer is not closed
+func (r *AudioStereoRecordingOggOpus) Close() error {
+	if r.rtpWriter != nil {
+		return r.rtpWriter.Close()
+	}
+	return errors.Join(
+		r.mon.Close(),
+		r.oggWriter.Close(),
+	)
+}
+
+type RecordingState string
+
+const (
+	RecordingStarted RecordingState = "STARTED"
+	RecordingPaused  RecordingState = "PAUSED"
+	RecordingResumed RecordingState = "RESUMED"
+	RecordingStopped RecordingState = "STOPPED"
+)
+
+// RecordingEvent is passed on recording state change
+type RecordingEvent struct {
+	State RecordingState
+	Time  time.Time
+}
+
+// RecordingMetadata describes recording for archiving. It is written as JSON sidecar
+type RecordingMetadata struct {
+	// CallIDs of recorded legs in channel order
+	CallIDs    []string         `json:"call_ids"`
+	StartTime  time.Time        `json:"start_time"`
+	EndTime    time.Time        `json:"end_time"`
+	SampleRate int              `json:"sample_rate"`
+	Channels   int              `json:"channels"`
+	Pauses     []RecordingPause `json:"pauses"`
+}
+
+// RecordingPause is paused interval of recording
+type RecordingPause struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Removed is true when paused audio is left out of recording instead of recorded as silence
+	Removed bool `json:"removed"`
+}
+
+// BridgeRecordingOptions are options of bridge recording. Zero values are defaults
+type BridgeRecordingOptions struct {
+	// Mono mixes both legs into single channel.
+	// By default originator is recorded on left and other leg on right channel
+	Mono bool
+	// SampleRate of recording. Default is sample rate of originator codec
+	SampleRate int
+	// RemovePaused leaves paused sections out of recording. By default they are recorded as silence
+	RemovePaused bool
+	// OnEvent is called on recording state change
+	OnEvent func(ev RecordingEvent)
+	// Metadata receives RecordingMetadata as JSON on Close
+	Metadata io.Writer
+}
+
+// BridgeRecording records both legs of Bridge as wav. Use Bridge RecordingCreate
+//
+// Experimental
+type BridgeRecording struct {
+	opts      BridgeRecordingOptions
+	wavWriter *audio.WavWriter
+	rec       audio.PCMStereoRecorder
+
+	mu     sync.Mutex
+	meta   RecordingMetadata
+	paused bool
+	closed bool
+}
+
+func newBridgeRecording(wavFile io.WriteSeeker, opts BridgeRecordingOptions) *BridgeRecording {
+	channels := 2
+	if opts.Mono {
+		channels = 1
+	}
+	wavWriter := audio.NewWavWriter(wavFile)
+	wavWriter.SampleRate = opts.SampleRate
+	wavWriter.NumChans = channels
+
+	r := &BridgeRecording{
+		opts:      opts,
+		wavWriter: wavWriter,
+		meta: RecordingMetadata{
+			StartTime:  time.Now(),
+			SampleRate: opts.SampleRate,
+			Channels:   channels,
+			Pauses:     []RecordingPause{},
+		},
+	}
+	r.rec.Mono = opts.Mono
+	r.rec.Init(wavWriter, opts.SampleRate)
+	r.emit(RecordingStarted, r.meta.StartTime)
+	return r
+}
+
+// tapReader records audio read from leg on channel
+func (r *BridgeRecording) tapReader(ch int, codec media.Codec, reader io.Reader, log *slog.Logger) (io.Reader, error) {
+	w, err := r.rec.ChannelWriter(ch, codec)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingTapReader{r: reader, w: w, log: log}, nil
+}
+
+func (r *BridgeRecording) setCallIDs(callIDs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.meta.CallIDs = callIDs
+}
+
+// Pause stops recording audio until Resume. Paused audio is recorded as silence or removed with RemovePaused
+func (r *BridgeRecording) Pause() {
+	r.mu.Lock()
+	if r.paused || r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.paused = true
+	now := time.Now()
+	r.meta.Pauses = append(r.meta.Pauses, RecordingPause{Start: now, Removed: r.opts.RemovePaused})
+	r.rec.Pause(r.opts.RemovePaused)
+	r.mu.Unlock()
+
+	r.emit(RecordingPaused, now)
+}
+
+func (r *BridgeRecording) Resume() {
+	r.mu.Lock()
+	if !r.paused || r.closed {
+		r.mu.Unlock()
+		return
+	}
+	now := r.endPause()
+	r.rec.Resume()
+	r.mu.Unlock()
+
+	r.emit(RecordingResumed, now)
+}
+
+// endPause must be called under lock
+func (r *BridgeRecording) endPause() time.Time {
+	now := time.Now()
+	r.paused = false
+	r.meta.Pauses[len(r.meta.Pauses)-1].End = now
+	return now
+}
+
+func (r *BridgeRecording) Paused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.paused
+}
+
+// Metadata returns current recording metadata
+func (r *BridgeRecording) Metadata() RecordingMetadata {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	meta := r.meta
+	meta.CallIDs = append([]string(nil), r.meta.CallIDs...)
+	meta.Pauses = append([]RecordingPause{}, r.meta.Pauses...)
+	return meta
+}
+
+// Close writes remaining audio, finalizes wav and writes metadata.
+// Underlying file is not closed
+func (r *BridgeRecording) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	if r.paused {
+		r.endPause()
+	}
+	r.meta.EndTime = time.Now()
+	r.mu.Unlock()
+
+	err := errors.Join(
+		r.rec.Close(),
+		r.wavWriter.Close(),
+	)
+	if r.opts.Metadata != nil {
+		err = errors.Join(err, json.NewEncoder(r.opts.Metadata).Encode(r.Metadata()))
+	}
+	r.emit(RecordingStopped, r.meta.EndTime)
+	return err
+}
+
+func (r *BridgeRecording) emit(state RecordingState, t time.Time) {
+	if r.opts.OnEvent != nil {
+		r.opts.OnEvent(RecordingEvent{State: state, Time: t})
+	}
+}
+
+// recordingTapReader writes read audio to recording. Failed recording does not stop reading
+type recordingTapReader struct {
+	r      io.Reader
+	w      io.Writer
+	log    *slog.Logger
+	failed bool
+}
+
+func (t *recordingTapReader) Read(b []byte) (int, error) {
+	n, err := t.r.Read(b)
+	if n > 0 && !t.failed {
+		if _, werr := t.w.Write(b[:n]); werr != nil {
+			t.failed = true
+			t.log.Error("Recording failed. Audio is not recorded further", "error", werr)
+		}
+	}
+	return n, err
+}
+
+// oggOpusRTPTapReader records opus payloads read from call with RTP timestamps
+type oggOpusRTPTapReader struct {
+	r      io.Reader
+	pkt    *media.RTPPacketReader
+	rec    *audio.OggOpusRTPWriter
+	pt     uint8
+	failed bool
+}
+
+func (t *oggOpusRTPTapReader) Read(b []byte) (int, error) {
+	n, err := t.r.Read(b)
+	// Header is checked as DTMF or comfort noise are not recorded
+	if n > 0 && !t.failed && t.pkt.PacketHeader.PayloadType == t.pt {
+		if werr := t.rec.WriteRTP(0, b[:n], t.pkt.PacketHeader.Timestamp); werr != nil {
+			t.failed = true
+			media.DefaultLogger().Error("Recording failed. Audio is not recorded further", "error", werr)
+		}
+	}
+	return n, err
+}
+
+// oggOpusRTPTapWriter records opus payloads written to call with RTP timestamps
+type oggOpusRTPTapWriter struct {
+	w      io.Writer
+	pkt    *media.RTPPacketWriter
+	rec    *audio.OggOpusRTPWriter
+	pt     uint8
+	failed bool
+}
+
+func (t *oggOpusRTPTapWriter) Write(b []byte) (int, error) {
+	n, err := t.w.Write(b)
+	if err == nil && !t.failed && t.pkt.PacketHeader.PayloadType == t.pt {
+		if werr := t.rec.WriteRTP(1, b, t.pkt.PacketHeader.Timestamp); werr != nil {
+			t.failed = true
+			media.DefaultLogger().Error("Recording failed. Audio is not recorded further", "error", werr)
+		}
+	}
+	return n, err
+}
@@ -2,9 +2,11 @@ package diago
 
 import (
 	"bytes"
+	"io"
 	"os"
 	"testing"
 
+	"github.com/pion/rtp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/vertan/diago/audio"
@@ -45,3 +47,78 @@ func TestIntegrationRecordingStereoWav(t *testing.T) {
 	// 2 channels, 4 frames Read, 4 frames Write
 	assert.Equal(t, 2*4*320, wav.DataSize)
 }
+
+// opusRTPReader returns packets with opus payload and timestamps
+type opusRTPReader struct {
+	packets []rtp.Packet
+}
+
+func (r *opusRTPReader) ReadRTP(buf []byte, p *rtp.Packet) (int, error) {
+	if len(r.packets) == 0 {
+		return 0, io.EOF
+	}
+	pkt := r.packets[0]
+	r.packets = r.packets[1:]
+	p.Header = pkt.Header
+	p.Payload = p.Payload[:copy(p.Payload, pkt.Payload)]
+	return pkt.MarshalSize(), nil
+}
+
+type opusRTPWriter struct{}
+
+func (w *opusRTPWriter) WriteRTP(p *rtp.Packet) error { return nil }
+
+func TestRecordingStereoOggOpusRTP(t *testing.T) {
+	payload := []byte{0xf8, 1, 2, 3}
+	reader := &opusRTPReader{}
+	for i := range 3 {
+		reader.packets = append(reader.packets, rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: uint16(i), Timestamp: uint32(1000 + i*960)},
+			Payload: payload,
+		})
+	}
+	// DTMF is not recorded
+	reader.packets = append(reader.packets, rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 101, SequenceNumber: 3, Timestamp: 1000 + 3*960},
+		Payload: []byte{1, 0, 0, 160},
+	})
+
+	dialog := &DialogServerSession{
+		DialogMedia: DialogMedia{
+			mediaSession:    &media.MediaSession{Codecs: []media.Codec{media.CodecAudioOpus}},
+			RTPPacketReader: media.NewRTPPacketReader(reader, media.CodecAudioOpus),
+			RTPPacketWriter: media.NewRTPPacketWriter(&opusRTPWriter{}, media.CodecAudioOpus),
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	rec, err := dialog.AudioStereoRecordingOggOpusCreate(buf)
+	require.NoError(t, err)
+
+	// Audio is read and written at same pace like in call
+	readBuf := make([]byte, media.RTPBufSize)
+	for range 3 {
+		_, err := rec.AudioReader().Read(readBuf)
+		require.NoError(t, err)
+		_, err = rec.AudioWriter().Write(payload)
+		require.NoError(t, err)
+	}
+	media.ReadAll(rec.AudioReader(), media.RTPBufSize)
+	require.NoError(t, rec.Close())
+
+	r := audio.NewOggReader(bytes.NewReader(buf.Bytes()))
+	packets := [][]byte{}
+	for {
+		p, _, err := r.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		packets = append(packets, bytes.Clone(p))
+	}
+	// Headers and 3 packets with payloads of both channels
+	require.Len(t, packets, 5)
+	for _, p := range packets[2:] {
+		assert.Equal(t, []byte{0xf8, 3, 1, 2, 3, 0xf8, 1, 2, 3}, p)
+	}
+}
@@ -4,70 +4,39 @@
 package diago
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
-	"fmt"
-	"math"
+	"errors"
+	"io"
 	"net"
 	"sync"
-	"time"
 
 	"github.com/vertan/diago/audio"
 	"github.com/vertan/diago/media"
 )
 
 var (
-	ringtones sync.Map
+	ringtone = audio.MustParseTone("350+440/2000,0/4000")
 )
 
-func loadRingTonePCM(codec media.Codec) ([]byte, error) {
-	uuid := fmt.Sprintf("%s-%d", codec.Name, codec.SampleRate)
-	ringval, exists := ringtones.Load(uuid)
-	if exists {
-		return ringval.([]byte), nil
-	}
-	pcmBytes := generateRingTonePCM(int(codec.SampleRate))
-	ringtones.Store(uuid, pcmBytes)
-	return pcmBytes, nil
-}
-
-func generateRingTonePCM(sampleRate int) []byte {
-	var (
-		durationSec = 2
-		volume      = 0.3
-		freq1       = 350.0
-		freq2       = 440.0
-	)
-
-	numSamples := sampleRate * durationSec
-	buf := &bytes.Buffer{}
-
-	for i := 0; i < numSamples; i++ {
-		t := float64(i) / float64(sampleRate)
-		// Combine the two sine waves and normalize
-		sample := volume * (math.Sin(2*math.Pi*freq1*t) + math.Sin(2*math.Pi*freq2*t)) / 2.0
-		// Convert to 16-bit signed PCM
-		intSample := int16(sample * math.MaxInt16)
-		binary.Write(buf, binary.LittleEndian, intSample)
-	}
-
-	pcmBytes := buf.Bytes()
-
-	return pcmBytes
-}
-
-// AudioRingtone is playback for ringtone
+// AudioTone is playback for call progress tone from tone plan
 //
 // Experimental
-type AudioRingtone struct {
+type AudioTone struct {
 	writer       *audio.PCMEncoderWriter
-	ringtone     []byte
+	tone         audio.Tone
+	level        float64
+	sampleRate   int
 	sampleSize   int
 	mediaSession *media.MediaSession
 }
 
-func (a *AudioRingtone) PlayBackground() (func() error, error) {
+// AudioRingtone is playback for ringtone
+//
+// Experimental
+type AudioRingtone = AudioTone
+
+// PlayBackground plays tone until returned stop function is called
+func (a *AudioTone) PlayBackground() (func() error, error) {
 	if err := a.mediaSession.StartRTP(1); err != nil {
 		return nil, err
 	}
@@ -98,28 +67,42 @@ func (a *AudioRingtone) PlayBackground() (func() error, error) {
 		if e, ok := playErr.(net.Error); ok && e.Timeout() {
 			return nil
 		}
+		if errors.Is(playErr, context.Canceled) {
+			return nil
+		}
 
 		return playErr
 	}, nil
 }
 
-func (a *AudioRingtone) Play(ctx context.Context) error {
+// Play plays tone until ctx is done. Tones without repeated cadence return when played
+func (a *AudioTone) Play(ctx context.Context) error {
 	return a.play(ctx)
 }
 
-func (a *AudioRingtone) play(timerCtx context.Context) error {
-	t := time.NewTimer(0)
+func (a *AudioTone) play(ctx context.Context) error {
+	gen := audio.ToneGenerator{SampleRate: a.sampleRate, Tone: a.tone, Level: a.level}
+	gen.Init()
+
+	buf := make([]byte, a.sampleSize)
 	for {
-		_, err := media.WriteAll(a.writer, a.ringtone, a.sampleSize)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := gen.Read(buf)
 		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
 			return err
 		}
+		// Last frame of tone is padded with silence as codecs like opus encode only full frames
+		clear(buf[n:])
 
-		t.Reset(4 * time.Second)
-		select {
-		case <-t.C:
-		case <-timerCtx.Done():
-			return timerCtx.Err()
+		// Writer is paced by RTP clock
+		if _, err := a.writer.Write(buf); err != nil {
+			return err
 		}
 	}
 }
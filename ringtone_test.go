@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/audio"
+	"github.com/vertan/diago/media"
+)
+
+func TestAudioTonePlay(t *testing.T) {
+	codec := media.CodecAudioAlaw
+	buf := &bytes.Buffer{}
+	encoder := audio.PCMEncoderWriter{}
+	require.NoError(t, encoder.Init(codec, buf))
+
+	// 30ms tone is written as 2 full frames
+	at := AudioTone{
+		writer:     &encoder,
+		tone:       audio.MustParseTone("!425/30"),
+		sampleRate: int(codec.SampleRate),
+		sampleSize: codec.Samples16(),
+	}
+	require.NoError(t, at.Play(context.Background()))
+	assert.Equal(t, 2*160, buf.Len())
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/vertan/diago/media"
+	"github.com/vertan/diago/media/sdp"
+)
+
+// RTPForkOptions are options of RTP fork. Zero values are defaults
+type RTPForkOptions struct {
+	// Mode is direction to fork: sdp.ModeRecvonly for received, sdp.ModeSendonly for sent RTP.
+	// Default are both directions
+	Mode string
+	// SSRCRead and SSRCWrite rewrite SSRC of forked packets when non zero
+	SSRCRead  uint32
+	SSRCWrite uint32
+	// SRTPKey is master key and salt for encrypting forked packets with SRTPAlg.
+	// Default is plain RTP
+	SRTPKey []byte
+	SRTPAlg uint16
+}
+
+// ForkRTP sends copy of dialog RTP packets to dest host:port from new media session.
+// Fork stays on media session changes (re-INVITE) until StopForkRTP or dialog close.
+// Packets relayed without RTP session (Bridge RTPpass) are not forked.
+//
+// Experimental
+func (d *DialogMedia) ForkRTP(dest string, opts RTPForkOptions) (*media.RTPFork, error) {
+	raddr, err := net.ResolveUDPAddr("udp", dest)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.rtpSession == nil {
+		return nil, errNoRTPSession
+	}
+
+	sess := &media.MediaSession{
+		Codecs: slices.Clone(d.mediaSession.Codecs),
+		Mode:   sdp.ModeSendonly,
+		Laddr:  net.UDPAddr{IP: d.mediaSession.Laddr.IP},
+	}
+	if err := sess.Init(); err != nil {
+		return nil, fmt.Errorf("failed to create fork media session: %w", err)
+	}
+	sess.SetRemoteAddr(raddr)
+	if opts.SRTPKey != nil {
+		alg := opts.SRTPAlg
+		if alg == 0 {
+			alg = media.SRTPAes128CmHmacSha1_80
+		}
+		if err := sess.SetLocalSRTP(alg, opts.SRTPKey); err != nil {
+			sess.Close()
+			return nil, err
+		}
+	}
+
+	fork := media.NewRTPFork(sess)
+	if opts.Mode != "" {
+		fork.Mode = opts.Mode
+	}
+	fork.SSRCRead = opts.SSRCRead
+	fork.SSRCWrite = opts.SSRCWrite
+
+	d.rtpSession.AddFork(fork)
+	d.rtpForks = append(d.rtpForks, fork)
+	d.onCloseUnsafe(fork.Close)
+	return fork, nil
+}
+
+// StopForkRTP stops fork created with ForkRTP and closes its media session
+func (d *DialogMedia) StopForkRTP(fork *media.RTPFork) error {
+	d.mu.Lock()
+	d.rtpForks = slices.DeleteFunc(d.rtpForks, func(f *media.RTPFork) bool { return f == fork })
+	if d.rtpSession != nil {
+		d.rtpSession.RemoveFork(fork)
+	}
+	d.mu.Unlock()
+	return fork.Close()
+}
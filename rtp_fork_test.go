@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media"
+)
+
+func TestDialogMediaForkRTP(t *testing.T) {
+	newSession := func() *media.MediaSession {
+		sess, err := media.NewMediaSession(net.IPv4(127, 0, 0, 1), 0)
+		require.NoError(t, err)
+		t.Cleanup(func() { sess.Close() })
+		return sess
+	}
+	phone, leg := newSession(), newSession()
+	require.NoError(t, leg.RemoteSDP(phone.LocalSDP()))
+
+	d := &DialogMedia{}
+	d.initRTPSessionUnsafe(leg, media.NewRTPSession(leg))
+	defer d.Close()
+
+	collector, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer collector.Close()
+
+	fork, err := d.ForkRTP(collector.LocalAddr().String(), RTPForkOptions{SSRCWrite: 4321})
+	require.NoError(t, err)
+
+	readForked := func() rtp.Packet {
+		buf := make([]byte, media.RTPBufSize)
+		collector.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := collector.ReadFrom(buf)
+		require.NoError(t, err)
+		pkt := rtp.Packet{}
+		require.NoError(t, pkt.Unmarshal(buf[:n]))
+		return pkt
+	}
+
+	_, err = d.RTPPacketWriter.Write(make([]byte, 160))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4321), readForked().SSRC)
+
+	// Fork stays after media session update
+	require.NoError(t, d.sdpUpdateUnsafe(phone.LocalSDP()))
+	_, err = d.RTPPacketWriter.Write(make([]byte, 160))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4321), readForked().SSRC)
+
+	require.NoError(t, d.StopForkRTP(fork))
+	assert.Empty(t, d.rtpForks)
+	_, err = d.RTPPacketWriter.Write(make([]byte, 160))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, fork.Stats().Packets)
+}
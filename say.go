@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// SayGrammars are grammar rules by base language code
+	SayGrammars = map[string]SayGrammar{
+		"en": SayGrammarEnglish{},
+	}
+)
+
+// SayGrammar builds phrase tokens by language rules.
+// Tokens are sound names like "digits/5" which are looked up in SoundLibrary
+type SayGrammar interface {
+	Digits(digits string) ([]string, error)
+	Number(n int64) ([]string, error)
+	Ordinal(n int64) ([]string, error)
+	// Money says amount in minor units, like cents, of ISO 4217 currency
+	Money(amount int64, currency string) ([]string, error)
+	Date(t time.Time) ([]string, error)
+	Time(t time.Time) ([]string, error)
+}
+
+// SoundLibrary maps phrase tokens to wav files in per language directories as <language>/<token>.wav.
+// Fallback languages are searched in order when token does not exist for language.
+//
+// Experimental
+type SoundLibrary struct {
+	FS       fs.FS
+	Language string
+	Fallback []string
+}
+
+// NewSoundLibrary creates sound library from directory
+func NewSoundLibrary(dir string, language string, fallback ...string) *SoundLibrary {
+	return &SoundLibrary{
+		FS:       os.DirFS(dir),
+		Language: language,
+		Fallback: fallback,
+	}
+}
+
+// Open opens token sound file from first language having it
+func (l *SoundLibrary) Open(token string) (fs.File, error) {
+	for _, lang := range l.languages() {
+		f, err := l.FS.Open(path.Join(lang, token+".wav"))
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("sound %q not found for language %q: %w", token, l.Language, fs.ErrNotExist)
+}
+
+// Grammar returns say grammar for library language or its fallbacks.
+// Regional language like "en-US" uses "en" grammar
+func (l *SoundLibrary) Grammar() (SayGrammar, error) {
+	for _, lang := range l.languages() {
+		if g, ok := SayGrammars[lang]; ok {
+			return g, nil
+		}
+		base, _, _ := strings.Cut(lang, "-")
+		base, _, _ = strings.Cut(base, "_")
+		if g, ok := SayGrammars[strings.ToLower(base)]; ok {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("no say grammar for language %q", l.Language)
+}
+
+func (l *SoundLibrary) languages() []string {
+	return append([]string{l.Language}, l.Fallback...)
+}
+
+// PlayPhrase plays sounds of tokens from library gaplessly as one playback.
+// All sounds are opened before playing, so missing sound returns error without playing
+//
+// Experimental
+func (p *AudioPlayback) PlayPhrase(lib *SoundLibrary, tokens ...string) (int64, error) {
+	readers := make([]io.Reader, 0, len(tokens))
+	for _, token := range tokens {
+		f, err := lib.Open(token)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+
+		pcm, err := p.wavPCMReader(f)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read sound %q: %w", token, err)
+		}
+		readers = append(readers, pcm)
+	}
+
+	if p.onPlay != nil {
+		p.onPlay()
+	}
+	// Sounds are read as one PCM stream, so that sound boundaries do not produce short frames
+	written, err := p.streamPCM(io.MultiReader(readers...), p.writer)
+	p.totalWritten += written
+	if errors.Is(err, io.EOF) {
+		return written, nil
+	}
+	return written, err
+}
+
+func (p *AudioPlayback) say(lib *SoundLibrary, build func(g SayGrammar) ([]string, error)) (int64, error) {
+	g, err := lib.Grammar()
+	if err != nil {
+		return 0, err
+	}
+	tokens, err := build(g)
+	if err != nil {
+		return 0, err
+	}
+	return p.PlayPhrase(lib, tokens...)
+}
+
+// SayDigits says each digit, like confirmation code "1234"
+func (p *AudioPlayback) SayDigits(lib *SoundLibrary, digits string) (int64, error) {
+	return p.say(lib, func(g SayGrammar) ([]string, error) { return g.Digits(digits) })
+}
+
+// SayNumber says cardinal number
+func (p *AudioPlayback) SayNumber(lib *SoundLibrary, n int64) (int64, error) {
+	return p.say(lib, func(g SayGrammar) ([]string, error) { return g.Number(n) })
+}
+
+// SayOrdinal says ordinal number, like "first"
+func (p *AudioPlayback) SayOrdinal(lib *SoundLibrary, n int64) (int64, error) {
+	return p.say(lib, func(g SayGrammar) ([]string, error) { return g.Ordinal(n) })
+}
+
+// SayMoney says amount in minor units, like cents, of ISO 4217 currency
+func (p *AudioPlayback) SayMoney(lib *SoundLibrary, amount int64, currency string) (int64, error) {
+	return p.say(lib, func(g SayGrammar) ([]string, error) { return g.Money(amount, currency) })
+}
+
+// SayDate says date with weekday
+func (p *AudioPlayback) SayDate(lib *SoundLibrary, t time.Time) (int64, error) {
+	return p.say(lib, func(g SayGrammar) ([]string, error) { return g.Date(t) })
+}
+
+// SayTime says time of day
+func (p *AudioPlayback) SayTime(lib *SoundLibrary, t time.Time) (int64, error) {
+	return p.say(lib, func(g SayGrammar) ([]string, error) { return g.Time(t) })
+}
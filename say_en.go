@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SayGrammarEnglish says in English with sounds:
+//   - digits/0 - digits/19, digits/20 - digits/90 by tens, digits/hundred, digits/thousand, digits/million, digits/billion
+//   - digits/h-1 - digits/h-19, digits/h-20 - digits/h-90 by tens, digits/h-hundred, digits/h-thousand, digits/h-million, digits/h-billion for ordinals
+//   - digits/minus, digits/oh, digits/star, digits/pound, letters/a - letters/z
+//   - digits/day-0 - digits/day-6 weekdays from Sunday, digits/mon-0 - digits/mon-11 months from January
+//   - digits/oclock, digits/a-m, digits/p-m
+//   - currency/and and currency/<unit> with singular and plural units, like currency/dollar and currency/dollars
+type SayGrammarEnglish struct{}
+
+var sayEnglishCurrencies = map[string][4]string{
+	// major singular, major plural, minor singular, minor plural
+	"USD": {"dollar", "dollars", "cent", "cents"},
+	"CAD": {"dollar", "dollars", "cent", "cents"},
+	"AUD": {"dollar", "dollars", "cent", "cents"},
+	"EUR": {"euro", "euros", "cent", "cents"},
+	"GBP": {"pound", "pounds", "penny", "pence"},
+}
+
+var sayEnglishScales = []struct {
+	value int64
+	name  string
+}{
+	{1_000_000_000, "billion"},
+	{1_000_000, "million"},
+	{1_000, "thousand"},
+	{100, "hundred"},
+}
+
+func (SayGrammarEnglish) Digits(digits string) ([]string, error) {
+	tokens := make([]string, 0, len(digits))
+	for _, r := range strings.ToLower(digits) {
+		switch {
+		case r >= '0' && r <= '9':
+			tokens = append(tokens, "digits/"+string(r))
+		case r >= 'a' && r <= 'z':
+			tokens = append(tokens, "letters/"+string(r))
+		case r == '*':
+			tokens = append(tokens, "digits/star")
+		case r == '#':
+			tokens = append(tokens, "digits/pound")
+		default:
+			return nil, fmt.Errorf("can not say digit %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+func (g SayGrammarEnglish) Number(n int64) ([]string, error) {
+	return g.number(nil, n, false), nil
+}
+
+func (g SayGrammarEnglish) Ordinal(n int64) ([]string, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("can not say ordinal %d", n)
+	}
+	return g.number(nil, n, true), nil
+}
+
+// number appends words of n. With ordinal last word is ordinal
+func (g SayGrammarEnglish) number(tokens []string, n int64, ordinal bool) []string {
+	prefix := "digits/"
+	if ordinal {
+		prefix = "digits/h-"
+	}
+
+	if n < 0 {
+		tokens = append(tokens, "digits/minus")
+		n = -n
+	}
+	if n == 0 {
+		return append(tokens, "digits/0")
+	}
+
+	for _, s := range sayEnglishScales {
+		if n < s.value {
+			continue
+		}
+		tokens = g.number(tokens, n/s.value, false)
+		n %= s.value
+		if n == 0 {
+			return append(tokens, prefix+s.name)
+		}
+		tokens = append(tokens, "digits/"+s.name)
+	}
+
+	if n >= 20 {
+		tens, units := n/10*10, n%10
+		if units == 0 {
+			return append(tokens, prefix+strconv.FormatInt(tens, 10))
+		}
+		tokens = append(tokens, "digits/"+strconv.FormatInt(tens, 10))
+		n = units
+	}
+	return append(tokens, prefix+strconv.FormatInt(n, 10))
+}
+
+func (g SayGrammarEnglish) Money(amount int64, currency string) ([]string, error) {
+	units, ok := sayEnglishCurrencies[strings.ToUpper(currency)]
+	if !ok {
+		return nil, fmt.Errorf("can not say currency %q", currency)
+	}
+
+	var tokens []string
+	if amount < 0 {
+		tokens = append(tokens, "digits/minus")
+		amount = -amount
+	}
+	major, minor := amount/100, amount%100
+
+	unit := func(n int64, singular, plural string) string {
+		if n == 1 {
+			return "currency/" + singular
+		}
+		return "currency/" + plural
+	}
+
+	if major > 0 || minor == 0 {
+		tokens = g.number(tokens, major, false)
+		tokens = append(tokens, unit(major, units[0], units[1]))
+	}
+	if minor > 0 {
+		if major > 0 {
+			tokens = append(tokens, "currency/and")
+		}
+		tokens = g.number(tokens, minor, false)
+		tokens = append(tokens, unit(minor, units[2], units[3]))
+	}
+	return tokens, nil
+}
+
+// Date says like "Tuesday, March fifth two thousand nine"
+func (g SayGrammarEnglish) Date(t time.Time) ([]string, error) {
+	tokens := []string{
+		"digits/day-" + strconv.Itoa(int(t.Weekday())),
+		"digits/mon-" + strconv.Itoa(int(t.Month())-1),
+	}
+	tokens = g.number(tokens, int64(t.Day()), true)
+	return g.year(tokens, int64(t.Year())), nil
+}
+
+// year appends year like "nineteen ninety nine", "two thousand five" or "twenty twenty four"
+func (g SayGrammarEnglish) year(tokens []string, y int64) []string {
+	if y < 1000 || y%1000 < 10 {
+		return g.number(tokens, y, false)
+	}
+
+	tokens = g.number(tokens, y/100, false)
+	switch rest := y % 100; {
+	case rest == 0:
+		return append(tokens, "digits/hundred")
+	case rest < 10:
+		return g.number(append(tokens, "digits/oh"), rest, false)
+	default:
+		return g.number(tokens, rest, false)
+	}
+}
+
+// Time says 12 hour clock like "ten oh five a m" or "three o'clock p m"
+func (g SayGrammarEnglish) Time(t time.Time) ([]string, error) {
+	hour := t.Hour() % 12
+	if hour == 0 {
+		hour = 12
+	}
+
+	tokens := g.number(nil, int64(hour), false)
+	switch min := t.Minute(); {
+	case min == 0:
+		tokens = append(tokens, "digits/oclock")
+	case min < 10:
+		tokens = g.number(append(tokens, "digits/oh"), int64(min), false)
+	default:
+		tokens = g.number(tokens, int64(min), false)
+	}
+
+	if t.Hour() < 12 {
+		return append(tokens, "digits/a-m"), nil
+	}
+	return append(tokens, "digits/p-m"), nil
+}
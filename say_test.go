@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media"
+)
+
+func TestSayGrammarEnglish(t *testing.T) {
+	g := SayGrammarEnglish{}
+	d := func(words ...string) []string {
+		for i, w := range words {
+			words[i] = "digits/" + w
+		}
+		return words
+	}
+
+	numbers := map[int64][]string{
+		0:             d("0"),
+		7:             d("7"),
+		13:            d("13"),
+		40:            d("40"),
+		42:            d("40", "2"),
+		100:           d("1", "hundred"),
+		115:           d("1", "hundred", "15"),
+		1999:          d("1", "thousand", "9", "hundred", "90", "9"),
+		20_000:        d("20", "thousand"),
+		1_000_001:     d("1", "million", "1"),
+		-3:            d("minus", "3"),
+		2_500_000_000: d("2", "billion", "5", "hundred", "million"),
+	}
+	for n, expected := range numbers {
+		tokens, err := g.Number(n)
+		require.NoError(t, err)
+		assert.Equal(t, expected, tokens, n)
+	}
+
+	ordinals := map[int64][]string{
+		1:    d("h-1"),
+		21:   d("20", "h-1"),
+		30:   d("h-30"),
+		100:  d("1", "h-hundred"),
+		1000: d("1", "h-thousand"),
+		1102: d("1", "thousand", "1", "hundred", "h-2"),
+	}
+	for n, expected := range ordinals {
+		tokens, err := g.Ordinal(n)
+		require.NoError(t, err)
+		assert.Equal(t, expected, tokens, n)
+	}
+	_, err := g.Ordinal(0)
+	assert.Error(t, err)
+
+	tokens, err := g.Digits("09*#A")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"digits/0", "digits/9", "digits/star", "digits/pound", "letters/a"}, tokens)
+	_, err = g.Digits("1-2")
+	assert.Error(t, err)
+
+	tokens, err = g.Money(12_301, "usd")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"digits/1", "digits/hundred", "digits/20", "digits/3", "currency/dollars", "currency/and", "digits/1", "currency/cent"}, tokens)
+	tokens, err = g.Money(5, "GBP")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"digits/5", "currency/pence"}, tokens)
+	tokens, err = g.Money(100, "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"digits/1", "currency/euro"}, tokens)
+	tokens, err = g.Money(0, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"digits/0", "currency/dollars"}, tokens)
+	_, err = g.Money(100, "XXX")
+	assert.Error(t, err)
+
+	tokens, err = g.Date(time.Date(2009, time.March, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, d("day-2", "mon-2", "h-3", "2", "thousand", "9"), tokens)
+	tokens, err = g.Date(time.Date(2024, time.December, 25, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, d("day-3", "mon-11", "20", "h-5", "20", "20", "4"), tokens)
+	tokens, err = g.Date(time.Date(1905, time.January, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, d("day-0", "mon-0", "h-1", "19", "oh", "5"), tokens)
+
+	tokens, err = g.Time(time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, d("12", "oh", "5", "a-m"), tokens)
+	tokens, err = g.Time(time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, d("3", "oclock", "p-m"), tokens)
+	tokens, err = g.Time(time.Date(2024, 1, 1, 23, 45, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, d("11", "40", "5", "p-m"), tokens)
+}
+
+// testWav creates mono 16 bit wav with samples
+func testWav(sampleRate int, samples int) []byte {
+	data := make([]byte, 44+samples*2)
+	copy(data[0:], "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(36+samples*2))
+	copy(data[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(data[16:], 16)
+	binary.LittleEndian.PutUint16(data[20:], 1)
+	binary.LittleEndian.PutUint16(data[22:], 1)
+	binary.LittleEndian.PutUint32(data[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(data[28:], uint32(sampleRate*2))
+	binary.LittleEndian.PutUint16(data[32:], 2)
+	binary.LittleEndian.PutUint16(data[34:], 16)
+	copy(data[36:], "data")
+	binary.LittleEndian.PutUint32(data[40:], uint32(samples*2))
+	for i := 0; i < samples; i++ {
+		binary.LittleEndian.PutUint16(data[44+i*2:], uint16(1000))
+	}
+	return data
+}
+
+type frameSizeWriter struct {
+	frames []int
+}
+
+func (w *frameSizeWriter) Write(b []byte) (int, error) {
+	w.frames = append(w.frames, len(b))
+	return len(b), nil
+}
+
+func TestSoundLibraryPlayPhrase(t *testing.T) {
+	lib := &SoundLibrary{
+		FS: fstest.MapFS{
+			"en-US/digits/1.wav": {Data: testWav(8000, 100)},
+			"en/digits/1.wav":    {Data: testWav(8000, 1)},
+			"en/digits/2.wav":    {Data: testWav(8000, 100)},
+			"en/digits/3.wav":    {Data: testWav(16000, 200)},
+		},
+		Language: "en-US",
+		Fallback: []string{"en"},
+	}
+
+	g, err := lib.Grammar()
+	require.NoError(t, err)
+	assert.Equal(t, SayGrammarEnglish{}, g)
+
+	w := &frameSizeWriter{}
+	p := NewAudioPlayback(w, media.CodecAudioUlaw)
+	n, err := p.SayDigits(lib, "123")
+	require.NoError(t, err)
+	// Sounds are joined in full frames. Language sound is used before fallback
+	assert.Equal(t, []int{160, 140}, w.frames)
+	assert.EqualValues(t, 600, n)
+
+	w.frames = nil
+	_, err = p.SayDigits(lib, "14")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Empty(t, w.frames)
+
+	lib.Language = "xx"
+	lib.Fallback = nil
+	_, err = lib.Grammar()
+	assert.Error(t, err)
+}
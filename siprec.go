@@ -0,0 +1,662 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+	"github.com/vertan/diago/media"
+	"github.com/vertan/diago/media/sdp"
+)
+
+var (
+	// SIPRECStopTimeout is max duration of ending SIPREC session when recorded dialog ends
+	SIPRECStopTimeout = 5 * time.Second
+)
+
+// SIPRECOptions are options of SIPREC session. Zero values are defaults
+type SIPRECOptions struct {
+	// Transport used for SRS. Default is transport from SRS uri.
+	// Multipart INVITE with metadata is normally larger than UDP MTU, so TCP or TLS should be used
+	Transport string
+	// For digest authentication
+	Username string
+	Password string
+	// Headers are extra headers added to INVITE
+	Headers []sip.Header
+}
+
+// SIPRECSession is recording session with SRS (RFC 7866), where this Diago is SRC.
+// Audio of each direction is sent as separate stream labeled in SDP and described by metadata.
+// Use Diago SIPRECInvite or SIPRECInviteBridge
+//
+// Experimental
+type SIPRECSession struct {
+	dialog    *DialogClientSession
+	log       *slog.Logger
+	sessionID string
+	start     time.Time
+	streams   []*siprecStream
+
+	mu           sync.Mutex
+	participants []siprecParticipant
+	detach       []func()
+	paused       bool
+	stopped      bool
+}
+
+type siprecParticipant struct {
+	id   string
+	aor  string
+	name string
+	// send is index of stream that participant sends
+	send          int
+	associated    time.Time
+	disassociated time.Time
+}
+
+// siprecStream sends forked audio to SRS
+type siprecStream struct {
+	id     string
+	label  string
+	codec  media.Codec
+	sess   *media.MediaSession
+	writer *media.RTPPacketWriter
+
+	paused   atomic.Bool
+	marker   atomic.Bool
+	pausedAt time.Time
+}
+
+func (st *siprecStream) Write(b []byte) (int, error) {
+	if st.paused.Load() {
+		return len(b), nil
+	}
+	// Audio is paced by recorded media, so samples are written without packet writer clock
+	return st.writer.WriteSamples(b, st.codec.SampleTimestamp(), st.marker.Swap(false), st.codec.PayloadType)
+}
+
+func (st *siprecStream) pause() {
+	st.pausedAt = time.Now()
+	st.paused.Store(true)
+}
+
+func (st *siprecStream) resume() {
+	// Timestamp is moved for pause duration so that streams stay aligned
+	st.writer.DelayTimestamp(uint32(time.Since(st.pausedAt).Seconds() * float64(st.codec.SampleRate)))
+	st.marker.Store(true)
+	st.paused.Store(false)
+}
+
+// SIPRECInvite starts SIPREC session recording dialog on SRS. Audio read from dialog is sent as first stream
+// and audio written to dialog as second stream. Only audio reader and writer obtained after this call are forked.
+// Session is stopped when dialog ends
+//
+// Experimental
+func (dg *Diago) SIPRECInvite(ctx context.Context, srs sip.Uri, d DialogSession, opts SIPRECOptions) (*SIPRECSession, error) {
+	m := d.Media()
+	pr, pw := MediaProps{}, MediaProps{}
+	if r := m.audioReaderProps(&pr); r == nil {
+		return nil, fmt.Errorf("no media setup")
+	}
+	_ = m.audioWriterProps(&pw)
+
+	s, err := dg.siprecInvite(ctx, srs, []media.Codec{pr.Codec, pw.Codec}, []DialogSession{d}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Taps are shared on dialog, so stopped session leaves dialog reader and writer as is
+	taps := m.audioTapsInstall()
+	s.attach(&taps.read, &taps.write)
+
+	go s.stopWith(d.Context())
+	return s, nil
+}
+
+// SIPRECInviteBridge starts SIPREC session recording bridge on SRS. Audio of each bridge leg is sent as
+// separate stream in order of legs. Bridge must have both legs and can not use RTPpass.
+// Session is stopped when any leg ends
+//
+// Experimental
+func (dg *Diago) SIPRECInviteBridge(ctx context.Context, srs sip.Uri, b *Bridge, opts SIPRECOptions) (*SIPRECSession, error) {
+	if b.RTPpass {
+		return nil, fmt.Errorf("siprec is not possible with RTPpass")
+	}
+	dialogs := b.GetDialogs()
+	if len(dialogs) != 2 {
+		return nil, fmt.Errorf("bridge must have 2 dialogs")
+	}
+
+	codecs := make([]media.Codec, len(dialogs))
+	for i, d := range dialogs {
+		props := MediaProps{}
+		if r := d.Media().audioReaderProps(&props); r == nil {
+			return nil, fmt.Errorf("no media setup on dialog %q", d.Id())
+		}
+		codecs[i] = props.Codec
+	}
+
+	s, err := dg.siprecInvite(ctx, srs, codecs, dialogs, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.attach(b.taps[0], b.taps[1])
+	for _, d := range dialogs {
+		go s.stopWith(d.Context())
+	}
+	return s, nil
+}
+
+func (dg *Diago) siprecInvite(ctx context.Context, srs sip.Uri, codecs []media.Codec, dialogs []DialogSession, opts SIPRECOptions) (*SIPRECSession, error) {
+	d, err := dg.NewDialog(srs, NewDialogOptions{Transport: opts.Transport})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SIPRECSession{
+		dialog:    d,
+		log:       dg.log,
+		sessionID: siprecID(),
+		start:     time.Now(),
+	}
+	for i, codec := range codecs {
+		s.streams = append(s.streams, &siprecStream{
+			id:    siprecID(),
+			label: strconv.Itoa(i + 1),
+			codec: codec,
+		})
+	}
+	s.participants = siprecParties(dialogs, s.start)
+
+	if err := s.invite(ctx, opts); err != nil {
+		d.Close()
+		for _, st := range s.streams[1:] {
+			// Sessions without answer are not closed by dialog
+			if st.sess != nil && st.writer == nil {
+				st.sess.Close()
+			}
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SIPRECSession) invite(ctx context.Context, opts SIPRECOptions) error {
+	d := s.dialog
+	base := d.mediaSession
+	for i, st := range s.streams {
+		if i == 0 {
+			base.Codecs = []media.Codec{st.codec}
+			st.sess = base
+			continue
+		}
+
+		sess := &media.MediaSession{
+			Codecs:     []media.Codec{st.codec},
+			Laddr:      net.UDPAddr{IP: base.Laddr.IP, Port: 0},
+			Mode:       sdp.ModeSendonly,
+			ExternalIP: base.ExternalIP,
+			SecureRTP:  base.SecureRTP,
+			SRTPAlg:    base.SRTPAlg,
+		}
+		if err := sess.Init(); err != nil {
+			return err
+		}
+		st.sess = sess
+	}
+
+	s.mu.Lock()
+	body, contentType, err := s.offerUnsafe(sdp.ModeSendonly, true)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	inviteReq := d.InviteRequest
+	for _, h := range opts.Headers {
+		inviteReq.AppendHeader(h)
+	}
+	inviteReq.AppendHeader(s.contactHDR())
+	inviteReq.AppendHeader(sip.NewHeader("Require", "siprec"))
+	inviteReq.AppendHeader(sip.NewHeader("Content-Type", contentType))
+	inviteReq.SetBody(body)
+	if fromHDR := inviteReq.From(); fromHDR != nil {
+		fromHDR.Params["tag"] = sip.GenerateTagN(16)
+	}
+
+	if err := sipgo.ClientRequestBuild(d.UA.Client, inviteReq); err != nil {
+		return err
+	}
+	err = d.DialogClientSession.Invite(ctx, func(c *sipgo.Client, req *sip.Request) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ansOpts := sipgo.AnswerOptions{
+		Username: opts.Username,
+		Password: opts.Password,
+	}
+	if err := d.DialogClientSession.WaitAnswer(ctx, ansOpts); err != nil {
+		return err
+	}
+
+	if err := s.setupStreams(d.InviteResponse); err != nil {
+		return errors.Join(err, d.Bye(ctx))
+	}
+	return d.Ack(ctx)
+}
+
+// setupStreams applies SRS answer on streams
+func (s *SIPRECSession) setupStreams(res *sip.Response) error {
+	sdpBody, _, err := siprecParseBody(res.ContentType(), res.Body())
+	if err != nil {
+		return err
+	}
+	sections := sdp.MediaSections(sdpBody)
+	if len(sections) != len(s.streams) {
+		return fmt.Errorf("siprec answer has %d media descriptions, expected %d", len(sections), len(s.streams))
+	}
+
+	d := s.dialog
+	for i, st := range s.streams {
+		if err := st.sess.RemoteSDP(sections[i]); err != nil {
+			return fmt.Errorf("siprec stream %s: %w", st.label, err)
+		}
+
+		rtpSess := media.NewRTPSession(st.sess)
+		st.marker.Store(true)
+		d.mu.Lock()
+		if i == 0 {
+			d.initRTPSessionUnsafe(st.sess, rtpSess)
+			d.onCloseUnsafe(rtpSess.Close)
+		} else {
+			// Dialog closes only first media session
+			sess := st.sess
+			d.onCloseUnsafe(func() error {
+				return errors.Join(rtpSess.Close(), sess.Close())
+			})
+		}
+		st.writer = media.NewRTPPacketWriterSession(rtpSess)
+		d.mu.Unlock()
+
+		if err := rtpSess.MonitorBackground(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// offerUnsafe returns SDP with stream per media description and optionally metadata as multipart body.
+// Must be called under lock
+func (s *SIPRECSession) offerUnsafe(mode string, withMetadata bool) ([]byte, string, error) {
+	sdps := make([][]byte, len(s.streams))
+	for i, st := range s.streams {
+		st.sess.Mode = mode
+		sdps[i] = append(st.sess.LocalSDP(), "a=label:"+st.label+"\r\n"...)
+	}
+	body := sdp.JoinMediaSections(sdps...)
+	if !withMetadata {
+		return body, "application/sdp", nil
+	}
+
+	meta, err := xml.Marshal(s.metadataUnsafe())
+	if err != nil {
+		return nil, "", err
+	}
+	return siprecMultipartBody(body, append([]byte(xml.Header), meta...))
+}
+
+func (s *SIPRECSession) contactHDR() *sip.ContactHeader {
+	contact := s.dialog.UA.ContactHDR.Clone()
+	if contact.Params == nil {
+		contact.Params = sip.NewParams()
+	}
+	// Marks us as SRC https://datatracker.ietf.org/doc/html/rfc7866#section-6.1.1
+	contact.Params.Add("+sip.src", "")
+	return contact
+}
+
+// attach forks audio of taps to streams in same order
+func (s *SIPRECSession) attach(taps ...*audioTap) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, tap := range taps {
+		s.detach = append(s.detach, tap.attach(s.streams[i]))
+	}
+}
+
+// stopWith stops session when recorded dialog ends
+func (s *SIPRECSession) stopWith(recorded context.Context) {
+	select {
+	case <-recorded.Done():
+	case <-s.dialog.Context().Done():
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), SIPRECStopTimeout)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		s.log.Error("Failed to stop SIPREC session", "error", err)
+	}
+}
+
+// Dialog returns dialog with SRS
+func (s *SIPRECSession) Dialog() *DialogClientSession {
+	return s.dialog
+}
+
+// Pause stops sending audio and signals streams as inactive with reINVITE. Audio stays paused if reINVITE fails
+func (s *SIPRECSession) Pause(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused || s.stopped {
+		return nil
+	}
+	for _, st := range s.streams {
+		st.pause()
+	}
+	s.paused = true
+	return s.reInviteUnsafe(ctx, sdp.ModeInactive, false)
+}
+
+// Resume continues sending audio and signals streams as sendonly with reINVITE
+func (s *SIPRECSession) Resume(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.paused || s.stopped {
+		return nil
+	}
+	if err := s.reInviteUnsafe(ctx, sdp.ModeSendonly, false); err != nil {
+		return err
+	}
+	for _, st := range s.streams {
+		st.resume()
+	}
+	s.paused = false
+	return nil
+}
+
+func (s *SIPRECSession) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// UpdateParticipants sends updated metadata with reINVITE. Dialogs are passed in stream order as
+// on session start. Participants no longer present are disassociated
+func (s *SIPRECSession) UpdateParticipants(ctx context.Context, dialogs ...DialogSession) error {
+	now := time.Now()
+	parties := siprecParties(dialogs, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return fmt.Errorf("siprec session is stopped")
+	}
+
+	participants := []siprecParticipant{}
+	for _, p := range s.participants {
+		if !p.disassociated.IsZero() {
+			participants = append(participants, p)
+			continue
+		}
+
+		found := false
+		for i, np := range parties {
+			if np.aor == p.aor && np.name == p.name {
+				// Keep participant id, but stream can change
+				parties[i].id = p.id
+				parties[i].associated = p.associated
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.disassociated = now
+			participants = append(participants, p)
+		}
+	}
+	s.participants = append(participants, parties...)
+
+	mode := sdp.ModeSendonly
+	if s.paused {
+		mode = sdp.ModeInactive
+	}
+	return s.reInviteUnsafe(ctx, mode, true)
+}
+
+// Metadata returns current recording metadata
+func (s *SIPRECSession) Metadata() SIPRECMetadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.metadataUnsafe()
+}
+
+func (s *SIPRECSession) metadataUnsafe() SIPRECMetadata {
+	start := s.start
+	meta := SIPRECMetadata{
+		DataMode:               "complete",
+		Sessions:               []SIPRECMetadataSession{{ID: s.sessionID, StartTime: &start}},
+		SessionRecordingAssocs: []SIPRECMetadataSessionRecordingAssoc{{SessionID: s.sessionID, AssociateTime: &start}},
+	}
+	for _, st := range s.streams {
+		meta.Streams = append(meta.Streams, SIPRECMetadataStream{ID: st.id, SessionID: s.sessionID, Label: st.label})
+	}
+
+	for _, p := range s.participants {
+		meta.Participants = append(meta.Participants, SIPRECMetadataParticipant{
+			ID:     p.id,
+			NameID: SIPRECMetadataNameID{AOR: p.aor, Name: p.name},
+		})
+
+		assoc := SIPRECMetadataParticipantSessionAssoc{
+			ParticipantID: p.id,
+			SessionID:     s.sessionID,
+			AssociateTime: &p.associated,
+		}
+		if !p.disassociated.IsZero() {
+			assoc.DisassociateTime = &p.disassociated
+			meta.ParticipantSessionAssoc = append(meta.ParticipantSessionAssoc, assoc)
+			continue
+		}
+		meta.ParticipantSessionAssoc = append(meta.ParticipantSessionAssoc, assoc)
+
+		streamAssoc := SIPRECMetadataParticipantStreamAssoc{ParticipantID: p.id}
+		for i, st := range s.streams {
+			if i == p.send {
+				streamAssoc.Send = append(streamAssoc.Send, st.id)
+				continue
+			}
+			streamAssoc.Recv = append(streamAssoc.Recv, st.id)
+		}
+		meta.ParticipantStreamAssoc = append(meta.ParticipantStreamAssoc, streamAssoc)
+	}
+	return meta
+}
+
+// reInviteUnsafe must be called under lock
+func (s *SIPRECSession) reInviteUnsafe(ctx context.Context, mode string, withMetadata bool) error {
+	d := s.dialog
+	body, contentType, err := s.offerUnsafe(mode, withMetadata)
+	if err != nil {
+		return err
+	}
+
+	req := sip.NewRequest(sip.INVITE, d.RemoteContact().Address)
+	req.AppendHeader(s.contactHDR())
+	req.AppendHeader(sip.NewHeader("Content-Type", contentType))
+	req.SetBody(body)
+
+	res, err := d.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if !res.IsSuccess() {
+		return sipgo.ErrDialogResponse{
+			Res: res,
+		}
+	}
+
+	cont := res.Contact()
+	if cont == nil {
+		return fmt.Errorf("reinvite: no contact header present")
+	}
+
+	ack := sip.NewRequest(sip.ACK, cont.Address)
+	return d.WriteRequest(ack)
+}
+
+// Stop stops forking audio, ends session with BYE and closes it
+func (s *SIPRECSession) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	detach := s.detach
+	s.detach = nil
+	s.mu.Unlock()
+
+	for _, f := range detach {
+		f()
+	}
+
+	var err error
+	if s.dialog.LoadState() == sip.DialogStateConfirmed {
+		err = s.dialog.Hangup(ctx)
+	}
+	return errors.Join(err, s.dialog.Close())
+}
+
+// siprecParties returns participants of recorded dialogs in stream order.
+// Single dialog has remote and local party, otherwise remote party of each dialog is used
+func siprecParties(dialogs []DialogSession, now time.Time) []siprecParticipant {
+	parties := []siprecParticipant{}
+	for _, d := range dialogs {
+		remote, local := dialogParties(d)
+		parties = append(parties, remote)
+		if len(dialogs) == 1 {
+			parties = append(parties, local)
+		}
+	}
+	for i := range parties {
+		parties[i].id = siprecID()
+		parties[i].send = i
+		parties[i].associated = now
+	}
+	return parties
+}
+
+// dialogParties returns remote and local party of dialog
+func dialogParties(d DialogSession) (remote siprecParticipant, local siprecParticipant) {
+	req := d.DialogSIP().InviteRequest
+	from, to := siprecParticipant{}, siprecParticipant{}
+	if h := req.From(); h != nil {
+		from.aor, from.name = h.Address.Addr(), h.DisplayName
+	}
+	if h := req.To(); h != nil {
+		to.aor, to.name = h.Address.Addr(), h.DisplayName
+	}
+
+	if _, ok := d.(*DialogClientSession); ok {
+		return to, from
+	}
+	return from, to
+}
+
+func siprecMultipartBody(sdpBody []byte, metadata []byte) ([]byte, string, error) {
+	buf := bytes.Buffer{}
+	mw := multipart.NewWriter(&buf)
+
+	parts := []struct {
+		header textproto.MIMEHeader
+		body   []byte
+	}{
+		{textproto.MIMEHeader{"Content-Type": {"application/sdp"}}, sdpBody},
+		{textproto.MIMEHeader{
+			"Content-Type":        {siprecMetadataContentType},
+			"Content-Disposition": {siprecMetadataDisposition},
+		}, metadata},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(p.header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := w.Write(p.body); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "multipart/mixed;boundary=" + mw.Boundary(), nil
+}
+
+// siprecParseBody returns SDP and metadata of SIPREC body. Body can be multipart or SDP only
+func siprecParseBody(contentType *sip.ContentTypeHeader, body []byte) (sdpBody []byte, metadata []byte, err error) {
+	if contentType == nil || body == nil {
+		return nil, nil, fmt.Errorf("no body present")
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType.Value())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if mediaType == "application/sdp" {
+		return body, nil, nil
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, nil, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "application/sdp":
+			sdpBody = data
+		case siprecMetadataContentType:
+			metadata = data
+		}
+	}
+
+	if sdpBody == nil {
+		return nil, nil, fmt.Errorf("no sdp present in body")
+	}
+	return sdpBody, metadata, nil
+}
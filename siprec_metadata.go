@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	siprecMetadataContentType = "application/rs-metadata+xml"
+	siprecMetadataDisposition = "recording-session"
+)
+
+// SIPRECMetadata is recording metadata of SIPREC session (RFC 7865).
+// It is sent by SRC with complete datamode on each change
+type SIPRECMetadata struct {
+	XMLName                 xml.Name                                `xml:"urn:ietf:params:xml:ns:recording:1 recording"`
+	DataMode                string                                  `xml:"datamode"`
+	Sessions                []SIPRECMetadataSession                 `xml:"session"`
+	Participants            []SIPRECMetadataParticipant             `xml:"participant"`
+	Streams                 []SIPRECMetadataStream                  `xml:"stream"`
+	SessionRecordingAssocs  []SIPRECMetadataSessionRecordingAssoc   `xml:"sessionrecordingassoc"`
+	ParticipantSessionAssoc []SIPRECMetadataParticipantSessionAssoc `xml:"participantsessionassoc"`
+	ParticipantStreamAssoc  []SIPRECMetadataParticipantStreamAssoc  `xml:"participantstreamassoc"`
+}
+
+// Participant returns participant by id
+func (m *SIPRECMetadata) Participant(id string) (SIPRECMetadataParticipant, bool) {
+	for _, p := range m.Participants {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return SIPRECMetadataParticipant{}, false
+}
+
+// Stream returns stream by SDP label
+func (m *SIPRECMetadata) Stream(label string) (SIPRECMetadataStream, bool) {
+	for _, s := range m.Streams {
+		if s.Label == label {
+			return s, true
+		}
+	}
+	return SIPRECMetadataStream{}, false
+}
+
+type SIPRECMetadataSession struct {
+	ID        string     `xml:"session_id,attr"`
+	StartTime *time.Time `xml:"start-time,omitempty"`
+	StopTime  *time.Time `xml:"stop-time,omitempty"`
+}
+
+type SIPRECMetadataParticipant struct {
+	ID     string               `xml:"participant_id,attr"`
+	NameID SIPRECMetadataNameID `xml:"nameID"`
+}
+
+type SIPRECMetadataNameID struct {
+	AOR  string `xml:"aor,attr"`
+	Name string `xml:"name,omitempty"`
+}
+
+type SIPRECMetadataStream struct {
+	ID        string `xml:"stream_id,attr"`
+	SessionID string `xml:"session_id,attr"`
+	// Label matches a=label of media description in SDP
+	Label string `xml:"label"`
+}
+
+type SIPRECMetadataSessionRecordingAssoc struct {
+	SessionID     string     `xml:"session_id,attr"`
+	AssociateTime *time.Time `xml:"associate-time,omitempty"`
+}
+
+type SIPRECMetadataParticipantSessionAssoc struct {
+	ParticipantID    string     `xml:"participant_id,attr"`
+	SessionID        string     `xml:"session_id,attr"`
+	AssociateTime    *time.Time `xml:"associate-time,omitempty"`
+	DisassociateTime *time.Time `xml:"disassociate-time,omitempty"`
+}
+
+// SIPRECMetadataParticipantStreamAssoc lists stream ids participant sends and receives
+type SIPRECMetadataParticipantStreamAssoc struct {
+	ParticipantID string   `xml:"participant_id,attr"`
+	Send          []string `xml:"send"`
+	Recv          []string `xml:"recv"`
+}
+
+// siprecID generates metadata id as base64 encoded UUID (RFC 7865 section 6.9)
+func siprecID() string {
+	id := uuid.New()
+	return base64.RawURLEncoding.EncodeToString(id[:])
+}
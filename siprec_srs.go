@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/vertan/diago/media"
+	"github.com/vertan/diago/media/sdp"
+)
+
+// SIPRECAnswerOptions are options for answering SIPREC session as SRS
+type SIPRECAnswerOptions struct {
+	// Codecs accepted for streams. Default are codecs of media config
+	Codecs []media.Codec
+	// OnUpdate is called when SRC updates metadata or pauses and resumes streams with reINVITE.
+	// It must not block
+	OnUpdate func(rec *SIPRECRecording)
+}
+
+// SIPRECRecording is recording session received from SRC. Use DialogServerSession AnswerSIPREC
+//
+// Experimental
+type SIPRECRecording struct {
+	// Streams are in order of media descriptions in SDP
+	Streams []*SIPRECStream
+
+	mu       sync.Mutex
+	metadata SIPRECMetadata
+	onUpdate func(rec *SIPRECRecording)
+}
+
+// SIPRECStream is single audio stream of SIPREC session
+type SIPRECStream struct {
+	// Label is SDP label used to match stream in metadata
+	Label string
+	Codec media.Codec
+	// Reader reads audio payload of stream
+	Reader io.Reader
+
+	sess *media.MediaSession
+	mode string
+}
+
+// Metadata returns last metadata received from SRC
+func (r *SIPRECRecording) Metadata() SIPRECMetadata {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.metadata
+}
+
+// StreamMode returns SDP mode of stream as answered. It is sdp.ModeInactive while SRC paused recording
+func (r *SIPRECRecording) StreamMode(i int) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Streams[i].mode
+}
+
+// AnswerSIPREC answers SIPREC INVITE as SRS. Stream is created for each media description.
+// First stream is also dialog media, so it can be read with AudioReader.
+//
+// Experimental
+func (d *DialogServerSession) AnswerSIPREC(opts SIPRECAnswerOptions) (*SIPRECRecording, error) {
+	req := d.InviteRequest
+	sdpBody, metadata, err := siprecParseBody(req.ContentType(), req.Body())
+	if err != nil {
+		return nil, err
+	}
+	sections := sdp.MediaSections(sdpBody)
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no media descriptions in SDP")
+	}
+
+	rec := &SIPRECRecording{onUpdate: opts.OnUpdate}
+	if err := rec.updateMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	conf := d.mediaConf
+	if opts.Codecs != nil {
+		conf.Codecs = opts.Codecs
+	}
+
+	rtpSessions := make([]*media.RTPSession, len(sections))
+	answers := make([][]byte, len(sections))
+	for i, section := range sections {
+		sess, err := newMediaSessionFromConf(conf, sdp.ModeRecvonly)
+		if err != nil {
+			return nil, err
+		}
+		if err := sess.RemoteSDP(section); err != nil {
+			sess.Close()
+			return nil, err
+		}
+		sess.Mode = siprecAnswerMode(section)
+
+		rtpSess := media.NewRTPSession(sess)
+		d.mu.Lock()
+		if i == 0 {
+			d.initRTPSessionUnsafe(sess, rtpSess)
+			d.onCloseUnsafe(rtpSess.Close)
+		} else {
+			// Dialog closes only first media session
+			d.onCloseUnsafe(func() error {
+				return errors.Join(rtpSess.Close(), sess.Close())
+			})
+		}
+		d.mu.Unlock()
+
+		stream := &SIPRECStream{
+			Label:  siprecLabel(section),
+			Codec:  media.CodecAudioFromSession(sess),
+			Reader: media.NewRTPPacketReaderSession(rtpSess),
+			sess:   sess,
+			mode:   sess.Mode,
+		}
+		rec.Streams = append(rec.Streams, stream)
+		rtpSessions[i] = rtpSess
+		answers[i] = stream.localSDP()
+	}
+
+	d.mu.Lock()
+	d.siprec = rec
+	d.mu.Unlock()
+
+	if err := d.RespondSDP(sdp.JoinMediaSections(answers...)); err != nil {
+		return nil, err
+	}
+	for _, rtpSess := range rtpSessions {
+		if err := rtpSess.MonitorBackground(); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+func (s *SIPRECStream) localSDP() []byte {
+	sd := s.sess.LocalSDP()
+	if s.Label == "" {
+		return sd
+	}
+	return append(sd, "a=label:"+s.Label+"\r\n"...)
+}
+
+func (r *SIPRECRecording) updateMetadata(data []byte) error {
+	if data == nil {
+		return nil
+	}
+	meta := SIPRECMetadata{}
+	if err := xml.Unmarshal(data, &meta); err != nil {
+		return fmt.Errorf("failed to parse siprec metadata: %w", err)
+	}
+	r.mu.Lock()
+	r.metadata = meta
+	r.mu.Unlock()
+	return nil
+}
+
+// handleReInvite updates stream modes and metadata. Streams can not be added or removed
+func (r *SIPRECRecording) handleReInvite(req *sip.Request, tx sip.ServerTransaction, contactHDR sip.Header) error {
+	sdpBody, metadata, err := siprecParseBody(req.ContentType(), req.Body())
+	if err != nil {
+		return tx.Respond(sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - "+err.Error(), nil))
+	}
+	sections := sdp.MediaSections(sdpBody)
+	if len(sections) != len(r.Streams) {
+		return tx.Respond(sip.NewResponseFromRequest(req, sip.StatusNotAcceptableHere, "Not Acceptable Here", nil))
+	}
+	if err := r.updateMetadata(metadata); err != nil {
+		return tx.Respond(sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - "+err.Error(), nil))
+	}
+
+	r.mu.Lock()
+	answers := make([][]byte, len(sections))
+	for i, s := range r.Streams {
+		s.mode = siprecAnswerMode(sections[i])
+		s.sess.Mode = s.mode
+		answers[i] = s.localSDP()
+	}
+	r.mu.Unlock()
+
+	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", sdp.JoinMediaSections(answers...))
+	res.AppendHeader(contactHDR)
+	res.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
+	if err := tx.Respond(res); err != nil {
+		return err
+	}
+
+	if r.onUpdate != nil {
+		r.onUpdate(r)
+	}
+	return nil
+}
+
+// siprecAnswerMode returns SRS mode for offered media description. SRS only receives
+func siprecAnswerMode(section []byte) string {
+	sd := sdp.SessionDescription{}
+	if err := sdp.Unmarshal(section, &sd); err != nil {
+		return sdp.ModeRecvonly
+	}
+	switch sd.Mode() {
+	case sdp.ModeInactive, sdp.ModeRecvonly:
+		return sdp.ModeInactive
+	}
+	return sdp.ModeRecvonly
+}
+
+func siprecLabel(section []byte) string {
+	sd := sdp.SessionDescription{}
+	if err := sdp.Unmarshal(section, &sd); err != nil {
+		return ""
+	}
+	for _, v := range sd.Values("a") {
+		if label, ok := strings.CutPrefix(v, "label:"); ok {
+			return label
+		}
+	}
+	return ""
+}
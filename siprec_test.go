@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: MPL-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024, Emir Aganovic
+
+package diago
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vertan/diago/media"
+	"github.com/vertan/diago/media/sdp"
+)
+
+func TestIntegrationSIPREC(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	type srsCall struct {
+		d   *DialogServerSession
+		rec *SIPRECRecording
+	}
+	srsCh := make(chan srsCall)
+	updates := make(chan string, 10)
+	{
+		ua, _ := sipgo.NewUA(sipgo.WithUserAgent("srs"))
+		defer ua.Close()
+
+		// Same instance answers recorded call and acts as SRS
+		dg := NewDiago(ua, WithTransport(Transport{Transport: "tcp", BindHost: "127.0.0.1", BindPort: 15080}))
+		err := dg.ServeBackground(ctx, func(d *DialogServerSession) {
+			if h := d.InviteRequest.GetHeader("Require"); h == nil || h.Value() != "siprec" {
+				d.Answer()
+				dialogEcho(d)
+				return
+			}
+
+			assert.Contains(t, d.InviteRequest.Contact().Value(), "+sip.src")
+			rec, err := d.AnswerSIPREC(SIPRECAnswerOptions{
+				OnUpdate: func(rec *SIPRECRecording) {
+					updates <- rec.StreamMode(0)
+				},
+			})
+			require.NoError(t, err)
+			srsCh <- srsCall{d, rec}
+			<-d.Context().Done()
+		})
+		require.NoError(t, err)
+	}
+
+	ua, _ := sipgo.NewUA()
+	defer ua.Close()
+	// Metadata makes INVITE larger than UDP MTU
+	phone := NewDiago(ua, WithTransport(Transport{Transport: "tcp", BindHost: "127.0.0.1", BindPort: 0}))
+	err := phone.ServeBackground(ctx, func(d *DialogServerSession) {})
+	require.NoError(t, err)
+
+	dialog, err := phone.Invite(ctx, sip.Uri{User: "alice", Host: "127.0.0.1", Port: 15080, UriParams: sip.HeaderParams{"transport": "tcp"}}, InviteOptions{})
+	require.NoError(t, err)
+	defer dialog.Close()
+
+	s, err := phone.SIPRECInvite(ctx, sip.Uri{User: "srs", Host: "127.0.0.1", Port: 15080}, dialog, SIPRECOptions{Transport: "tcp"})
+	require.NoError(t, err)
+	srs := <-srsCh
+
+	// Metadata describes participants and streams matching SDP labels
+	meta := srs.rec.Metadata()
+	require.Len(t, meta.Participants, 2)
+	assert.Equal(t, "sip:alice@127.0.0.1", meta.Participants[0].NameID.AOR)
+	require.Len(t, srs.rec.Streams, 2)
+	for i, label := range []string{"1", "2"} {
+		assert.Equal(t, label, srs.rec.Streams[i].Label)
+		stream, ok := meta.Stream(label)
+		require.True(t, ok)
+		assert.Equal(t, []string{stream.ID}, meta.ParticipantStreamAssoc[i].Send)
+		assert.Equal(t, sdp.ModeRecvonly, srs.rec.StreamMode(i))
+	}
+
+	// Both directions are forked as separate streams
+	audioR, err := dialog.AudioReader()
+	require.NoError(t, err)
+	audioW, err := dialog.AudioWriter()
+	require.NoError(t, err)
+
+	_, err = audioW.Write([]byte("my audio"))
+	require.NoError(t, err)
+	buf := make([]byte, 100)
+	n, err := audioR.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "my audio", string(buf[:n]))
+
+	for _, stream := range srs.rec.Streams {
+		n, err := stream.Reader.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "my audio", string(buf[:n]))
+	}
+
+	require.NoError(t, s.Pause(ctx))
+	assert.Equal(t, sdp.ModeInactive, <-updates)
+	assert.True(t, s.Paused())
+	require.NoError(t, s.Resume(ctx))
+	assert.Equal(t, sdp.ModeRecvonly, <-updates)
+
+	require.NoError(t, s.UpdateParticipants(ctx, dialog))
+	<-updates
+	meta = srs.rec.Metadata()
+	assert.Len(t, meta.Participants, 2)
+	assert.Equal(t, s.Metadata().Participants, meta.Participants)
+
+	require.NoError(t, s.Stop(ctx))
+	select {
+	case <-srs.d.Context().Done():
+	case <-ctx.Done():
+		t.Fatal("SRS dialog not terminated")
+	}
+	assert.Empty(t, dialog.audioTaps.read.targets)
+	assert.Empty(t, dialog.audioTaps.write.targets)
+}
+
+func TestSIPRECTapAudioOnly(t *testing.T) {
+	alaw := []byte("alaw audio")
+	dtmf := media.DTMFEncode(media.DTMFEvent{Event: 1, EndOfEvent: true, Duration: 800})
+	rtpReader := media.NewRTPPacketReader(nil, media.CodecAudioAlaw)
+	d := &DialogMedia{
+		mediaSession: &media.MediaSession{Codecs: []media.Codec{media.CodecAudioAlaw}},
+		audioReader: &dtmfPacketReader{
+			frames: [][]byte{alaw, dtmf, {0x7f}},
+			pts:    []uint8{8, 101, 13},
+			reader: rtpReader,
+		},
+		RTPPacketReader: rtpReader,
+		RTPPacketWriter: media.NewRTPPacketWriter(nil, media.CodecAudioAlaw),
+	}
+
+	// Taps are installed once and shared by forks
+	taps := d.audioTapsInstall()
+	require.Same(t, taps, d.audioTapsInstall())
+
+	recorded := &bytes.Buffer{}
+	taps.read.attach(recorded)
+	r, err := d.AudioReader()
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, r)
+	require.NoError(t, err)
+
+	// Telephone events and comfort noise are not audio of stream
+	assert.Equal(t, alaw, recorded.Bytes())
+}
@@ -4,14 +4,17 @@
 package diago
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"sync"
 
 	"github.com/pion/rtp"
+	"github.com/vertan/diago/audio"
 	"github.com/vertan/diago/media"
 )
 
@@ -61,3 +64,39 @@ func (s *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 
 	return resp, err
 }
+
+// readPCMFrames decodes audio and passes mono frames to process until it returns true.
+// Reading timeout or EOF stops reading without error and false is returned
+func readPCMFrames(reader io.Reader, codec media.Codec, process func(lpcm []byte) bool) (bool, error) {
+	dec := audio.PCMDecoderReader{}
+	if err := dec.Init(codec, reader); err != nil {
+		return false, err
+	}
+	defer dec.Close()
+
+	buf := make([]byte, codec.Samples16())
+	for {
+		n, err := dec.Read(buf)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() || errors.Is(err, io.EOF) {
+				return false, nil
+			}
+			return false, err
+		}
+		if process(pcmFirstChannel(buf[:n], codec.NumChannels)) {
+			return true, nil
+		}
+	}
+}
+
+// pcmFirstChannel keeps first channel of 16 bit PCM in place
+func pcmFirstChannel(lpcm []byte, channels int) []byte {
+	if channels < 2 {
+		return lpcm
+	}
+	n := len(lpcm) / 4
+	for i := 0; i < n; i++ {
+		copy(lpcm[i*2:i*2+2], lpcm[i*4:i*4+2])
+	}
+	return lpcm[:n*2]
+}